@@ -90,10 +90,13 @@ func (s *GatewayService) setupRoutes() {
 	// Add global CORS middleware
 	s.router.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, HEAD, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		c.Header("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Upload-Metadata, X-Video-ID, X-Upload-Warning")
 
-		if c.Request.Method == "OPTIONS" {
+		// Only preflight requests are answered here, other OPTIONS requests like tus discovery are
+		// proxied to the services
+		if c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.Status(http.StatusNoContent)
 			c.Abort()
 			return
@@ -202,6 +205,7 @@ func (s *GatewayService) setupRoutes() {
 		s.router,
 		api,
 		jwtMiddleware.VerifyJWT(),
+		jwtMiddleware.OptionalJWT(),
 		rateLimitMiddleware.RateLimit(),
 		s.proxyHandler.ProxyRequest,
 	)
@@ -12,31 +12,81 @@ func NewTranscoderHandler() *TranscoderHandler {
 	return &TranscoderHandler{}
 }
 
-// TranscodeJobRequest represents a request to create a new transcoding job
+// TranscodeJobRequest represents a request to transcode an uploaded video again
 type TranscodeJobRequest struct {
-	VideoID  string   `json:"videoId" example:"abc123" binding:"required"`
-	Formats  []string `json:"formats" example:"480p,720p,1080p" binding:"required"`
-	Priority int      `json:"priority" example:"1"`
+	VideoID       string `json:"video_id" example:"abc123" binding:"required"`
+	UserID        string `json:"user_id" example:"user123"`
+	Title         string `json:"title" example:"My Video"`
+	FileExtension string `json:"file_extension" example:".mp4"`
+	Width         int    `json:"width" example:"1920"`
+	Height        int    `json:"height" example:"1080"`
+}
+
+// TranscodeJobTransition represents a status a transcoding job went through
+type TranscodeJobTransition struct {
+	Status    string `json:"status" example:"downloading"`
+	Error     string `json:"error,omitempty" example:""`
+	CreatedAt string `json:"created_at" example:"2023-01-01T12:00:01Z"`
 }
 
 // TranscodeJobResponse represents a transcoding job response
 type TranscodeJobResponse struct {
-	JobID     string   `json:"jobId" example:"job123"`
-	VideoID   string   `json:"videoId" example:"abc123"`
-	Status    string   `json:"status" example:"processing"`
-	Progress  int      `json:"progress" example:"45"`
-	Formats   []string `json:"formats" example:"480p,720p,1080p"`
-	CreatedAt string   `json:"createdAt" example:"2023-01-01T12:00:00Z"`
-	UpdatedAt string   `json:"updatedAt" example:"2023-01-01T12:05:00Z"`
+	JobID         string                   `json:"job_id" example:"0b8f3c2e-6c1a-4d0e-9a57-3f3c1b2a9d10"`
+	VideoID       string                   `json:"video_id" example:"abc123"`
+	UserID        string                   `json:"user_id" example:"user123"`
+	Status        string                   `json:"status" example:"transcoding"`
+	Attempts      int                      `json:"attempts" example:"1"`
+	Progress      int                      `json:"progress" example:"42"`
+	Error         string                   `json:"error,omitempty" example:""`
+	CreatedAt     string                   `json:"created_at" example:"2023-01-01T12:00:00Z"`
+	UpdatedAt     string                   `json:"updated_at" example:"2023-01-01T12:05:00Z"`
+	StartedAt     string                   `json:"started_at,omitempty" example:"2023-01-01T12:00:01Z"`
+	CompletedAt   string                   `json:"completed_at,omitempty" example:""`
+	NextAttemptAt string                   `json:"next_attempt_at,omitempty" example:""`
+	Ladder        *TranscodeJobLadder      `json:"ladder,omitempty"`
+	History       []TranscodeJobTransition `json:"history,omitempty"`
+}
+
+// TranscodeJobLadder represents the renditions picked for a transcoding job
+type TranscodeJobLadder struct {
+	Rungs    []TranscodeJobRung           `json:"rungs"`
+	Analysis *TranscodeJobContentAnalysis `json:"analysis,omitempty"`
+}
+
+// TranscodeJobRung represents a rendition of a transcoding job
+type TranscodeJobRung struct {
+	Name             string `json:"name" example:"720p"`
+	Width            int    `json:"width" example:"1280"`
+	Height           int    `json:"height" example:"720"`
+	BitrateKbps      int    `json:"bitrate_kbps" example:"840"`
+	AudioBitrateKbps int    `json:"audio_bitrate_kbps" example:"128"`
+}
+
+// TranscodeJobContentAnalysis represents the probe encode a per-title ladder is based on
+type TranscodeJobContentAnalysis struct {
+	ProbeResolution  string   `json:"probe_resolution" example:"1280x720"`
+	ProbeCRF         int      `json:"probe_crf" example:"23"`
+	ProbeBitrateKbps int      `json:"probe_bitrate_kbps" example:"560"`
+	Samples          int      `json:"samples" example:"5"`
+	SampledSeconds   float64  `json:"sampled_seconds" example:"20"`
+	Complexity       float64  `json:"complexity" example:"0.3"`
+	DroppedRungs     []string `json:"dropped_rungs,omitempty" example:"240p"`
+}
+
+// TranscodeJobListResponse represents a list of transcoding jobs
+type TranscodeJobListResponse struct {
+	Count int                    `json:"count" example:"1"`
+	Jobs  []TranscodeJobResponse `json:"jobs"`
 }
 
 // @Summary      Create a new transcoding job
-// @Description  Submit a new video for transcoding
+// @Description  Queue an uploaded video for transcoding. Returns the existing job if the video is already queued or running.
 // @Tags         transcoder
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
 // @Param        request  body      TranscodeJobRequest   true  "Transcoding job details"
+// @Success      200      {object}  TranscodeJobResponse  "Job already queued or running"
 // @Success      201      {object}  TranscodeJobResponse  "Job created successfully"
 // @Failure      400      {object}  map[string]interface{}  "Bad request"
 // @Failure      401      {object}  map[string]interface{}  "Unauthorized"
@@ -49,7 +99,7 @@ func (h *TranscoderHandler) CreateJob() gin.HandlerFunc {
 }
 
 // @Summary      Get job status
-// @Description  Get the status of a transcoding job
+// @Description  Get the status and status history of a transcoding job
 // @Tags         transcoder
 // @Produce      json
 // @Security     BearerAuth
@@ -64,3 +114,57 @@ func (h *TranscoderHandler) GetJob() gin.HandlerFunc {
 	// The actual implementation is in the transcoder-service
 	return nil
 }
+
+// @Summary      List transcoding jobs
+// @Description  List transcoding jobs, newest first
+// @Tags         transcoder
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status    query     string  false  "Job status"  Enums(queued, downloading, transcoding, uploading, completed, failed, cancelled)
+// @Param        video_id  query     string  false  "Video ID"
+// @Param        limit     query     int     false  "Maximum number of jobs"  default(20)  maximum(100)
+// @Success      200       {object}  TranscodeJobListResponse  "Jobs"
+// @Failure      400       {object}  map[string]interface{}  "Invalid status"
+// @Failure      401       {object}  map[string]interface{}  "Unauthorized"
+// @Failure      500       {object}  map[string]interface{}  "Internal server error"
+// @Router       /api/v1/transcoder/jobs [get]
+func (h *TranscoderHandler) ListJobs() gin.HandlerFunc {
+	// This is just a placeholder for documentation
+	// The actual implementation is in the transcoder-service
+	return nil
+}
+
+// @Summary      Stream job progress
+// @Description  Stream the progress of a transcoding job as Server-Sent Events until the job stops running
+// @Tags         transcoder
+// @Produce      text/event-stream
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Job ID"
+// @Success      200  {string}  string  "progress events"
+// @Failure      401  {object}  map[string]interface{}  "Unauthorized"
+// @Failure      404  {object}  map[string]interface{}  "Job not found"
+// @Router       /api/v1/transcoder/jobs/{id}/progress [get]
+func (h *TranscoderHandler) JobProgress() gin.HandlerFunc {
+	// This is just a placeholder for documentation
+	// The actual implementation is in the transcoder-service
+	return nil
+}
+
+// @Summary      Cancel a transcoding job
+// @Description  Cancel a queued or running transcoding job. Running jobs are stopped asynchronously.
+// @Tags         transcoder
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "Job ID"
+// @Success      200  {object}  TranscodeJobResponse  "Job cancelled"
+// @Success      202  {object}  TranscodeJobResponse  "Job is being cancelled"
+// @Failure      401  {object}  map[string]interface{}  "Unauthorized"
+// @Failure      404  {object}  map[string]interface{}  "Job not found"
+// @Failure      409  {object}  map[string]interface{}  "Job already finished"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Router       /api/v1/transcoder/jobs/{id}/cancel [post]
+func (h *TranscoderHandler) CancelJob() gin.HandlerFunc {
+	// This is just a placeholder for documentation
+	// The actual implementation is in the transcoder-service
+	return nil
+}
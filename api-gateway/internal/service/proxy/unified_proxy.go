@@ -112,6 +112,16 @@ func addProxyHeaders(req *http.Request, c *gin.Context, clientIP string) {
 	} else {
 		req.Header.Set("X-Forwarded-For", clientIP)
 	}
+
+	// Identity headers are only trusted when set by the gateway from a verified token
+	req.Header.Del("X-User-ID")
+	req.Header.Del("X-User-Role")
+	if userID, ok := c.Get("user_id"); ok && userID != nil {
+		req.Header.Set("X-User-ID", fmt.Sprint(userID))
+	}
+	if role, ok := c.Get("role"); ok && role != nil {
+		req.Header.Set("X-User-Role", fmt.Sprint(role))
+	}
 }
 
 // getClientIP gets the client IP address from the request
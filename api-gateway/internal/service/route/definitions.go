@@ -43,12 +43,20 @@ func configureStreamingRoutes(router *RouterConfig, baseURL string) {
 	// Video access endpoints - all use videoID consistently
 	streaming.AddEndpoint("GET", "/videos/:videoID", "Get video by ID", boolPtr(false))
 	streaming.AddEndpoint("GET", "/videos/:videoID/thumbnail", "Get video thumbnail", boolPtr(false))
+	streaming.AddEndpoint("GET", "/videos/:videoID/storyboard.vtt", "Get seek preview storyboard", boolPtr(false))
+	streaming.AddEndpoint("GET", "/videos/:videoID/preview", "Get hover preview clip", boolPtr(false))
 
 	// HLS streaming endpoints
 	streaming.AddEndpoint("GET", "/videos/:videoID/hls/manifest", "Get HLS manifest", boolPtr(false))
 	streaming.AddEndpoint("GET", "/videos/:videoID/hls/:resolution/playlist", "Get HLS playlist for specific resolution", boolPtr(false))
 	streaming.AddEndpoint("GET", "/videos/:videoID/hls/:resolution/:segment", "Get HLS segment", boolPtr(false))
 	streaming.AddEndpoint("GET", "/videos/:videoID/hls/segments/:segment", "Get HLS segment directly", boolPtr(false))
+	streaming.AddEndpoint("GET", "/videos/:videoID/hls/subtitles/:lang/playlist", "Get HLS subtitle playlist", boolPtr(false))
+	streaming.AddEndpoint("GET", "/videos/:videoID/captions/:lang", "Get WebVTT caption track", boolPtr(false))
+
+	// DASH streaming endpoints
+	streaming.AddEndpoint("GET", "/videos/:videoID/dash/manifest.mpd", "Get DASH manifest", boolPtr(false))
+	streaming.AddEndpoint("GET", "/videos/:videoID/dash/:resolution/:segment", "Get DASH segment", boolPtr(false))
 
 	// MP4 endpoints
 	streaming.AddEndpoint("GET", "/videos/:videoID/mp4", "Get MP4 video", boolPtr(false))
@@ -71,7 +79,21 @@ func configureMetadataRoutes(router *RouterConfig, baseURL string) {
 	metadata.AddEndpoint("GET", "/videos/:videoID", "Get video details", boolPtr(false))
 	metadata.AddEndpoint("POST", "/videos", "Create new video metadata", boolPtr(false))
 	metadata.AddEndpoint("PUT", "/videos/:videoID", "Update video metadata", boolPtr(false))
-	metadata.AddEndpoint("DELETE", "/videos/:videoID", "Delete video", boolPtr(false))
+
+	// Owner endpoints, the metadata service checks the forwarded user ID against the video owner
+	metadata.AddEndpoint("PATCH", "/videos/:videoID", "Edit video title, description and tags", boolPtr(true))
+	metadata.AddEndpoint("POST", "/videos/:videoID/publish", "Publish or schedule a draft video", boolPtr(true))
+	metadata.AddEndpoint("DELETE", "/videos/:videoID", "Delete video", boolPtr(true))
+
+	// Caption tracks
+	metadata.AddEndpoint("GET", "/videos/:videoID/captions", "List caption languages of a video", boolPtr(false))
+	metadata.AddEndpoint("PUT", "/videos/:videoID/captions/:lang", "Upload SRT or WebVTT captions", boolPtr(true))
+	metadata.AddEndpoint("DELETE", "/videos/:videoID/captions/:lang", "Delete a caption track", boolPtr(true))
+
+	// Thumbnails
+	metadata.AddEndpoint("PUT", "/videos/:videoID/thumbnail", "Upload a custom thumbnail", boolPtr(true))
+	metadata.AddEndpoint("POST", "/videos/:videoID/thumbnail/regenerate", "Regenerate the thumbnail from a video frame", boolPtr(true))
+	metadata.AddEndpoint("GET", "/videos/:videoID/thumbnail/candidates", "List the thumbnail candidates of a video", boolPtr(true))
 }
 
 // configureUploadRoutes configures routes for the upload service
@@ -84,6 +106,24 @@ func configureUploadRoutes(router *RouterConfig, baseURL string) {
 	// Protected endpoints
 	upload.AddEndpoint("POST", "/videos", "Upload a new video", nil)
 	upload.AddEndpoint("POST", "/videos/process", "Process uploaded video", nil)
+	upload.AddEndpoint("GET", "/quota", "Get quota usage of the current user", nil)
+
+	// Resumable upload endpoints (tus 1.0)
+	upload.AddEndpoint("OPTIONS", "/files", "Discover resumable upload capabilities", boolPtr(false))
+	upload.AddEndpoint("POST", "/files", "Create a resumable upload", nil)
+	upload.AddEndpoint("HEAD", "/files/:id", "Get resumable upload offset", nil)
+	upload.AddEndpoint("PATCH", "/files/:id", "Upload a chunk", nil)
+	upload.AddEndpoint("DELETE", "/files/:id", "Cancel a resumable upload", nil)
+	upload.AddEndpoint("POST", "/files/:id/finalize", "Finalize a resumable upload", nil)
+
+	// Direct-to-storage upload endpoints
+	upload.AddEndpoint("POST", "/uploads", "Create a direct upload with presigned part URLs", nil)
+	upload.AddEndpoint("POST", "/uploads/:id/complete", "Complete a direct upload", nil)
+	upload.AddEndpoint("DELETE", "/uploads/:id", "Cancel a direct upload", nil)
+
+	// Admin endpoints (require the admin role)
+	upload.AddEndpoint("GET", "/admin/outbox/stuck", "List undelivered upload events", nil)
+	upload.AddEndpoint("POST", "/admin/outbox/redrive", "Re-drive failed upload events", nil)
 }
 
 // configureTranscoderRoutes configures routes for the transcoder service
@@ -96,5 +136,11 @@ func configureTranscoderRoutes(router *RouterConfig, baseURL string) {
 
 	// Protected endpoints
 	transcoder.AddEndpoint("POST", "/jobs", "Create new transcoding job", nil)
+	transcoder.AddEndpoint("GET", "/jobs", "List transcoding jobs", nil)
 	transcoder.AddEndpoint("GET", "/jobs/:jobID", "Get transcoding job status", nil)
+	transcoder.AddEndpoint("GET", "/jobs/:jobID/progress", "Stream transcoding job progress", nil)
+	transcoder.AddEndpoint("POST", "/jobs/:jobID/cancel", "Cancel a transcoding job", nil)
+
+	// Admin endpoints (require the admin role)
+	transcoder.AddEndpoint("POST", "/admin/dlq/redrive", "Re-drive dead-lettered upload events", nil)
 }
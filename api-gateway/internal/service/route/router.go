@@ -73,6 +73,7 @@ func (r *RouterConfig) RegisterHandlers(
 	router *gin.Engine,
 	apiGroup *gin.RouterGroup,
 	jwtMiddleware gin.HandlerFunc,
+	optionalJWTMiddleware gin.HandlerFunc,
 	rateLimitMiddleware gin.HandlerFunc,
 	handlerFunc func(string) gin.HandlerFunc,
 ) {
@@ -103,8 +104,8 @@ func (r *RouterConfig) RegisterHandlers(
 				protectedGroup.Use(jwtMiddleware)
 				protectedGroup.Handle(endpoint.Method, endpoint.Path, handlerFunc(svc.BaseURL))
 			} else {
-				// Register without auth middleware
-				group.Handle(endpoint.Method, endpoint.Path, handlerFunc(svc.BaseURL))
+				// Public endpoints still forward the identity of signed in users
+				group.Handle(endpoint.Method, endpoint.Path, optionalJWTMiddleware, handlerFunc(svc.BaseURL))
 			}
 		}
 	}
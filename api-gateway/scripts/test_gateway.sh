@@ -139,7 +139,7 @@ else
 fi
 
 echo -e "\nTesting OPTIONS preflight..."
-    response=$(curl -s -X OPTIONS http://localhost:8085/metadata/videos)
+    response=$(curl -s -X OPTIONS -H "Origin: http://localhost:3000" -H "Access-Control-Request-Method: GET" http://localhost:8085/metadata/videos)
 if [[ $response == "" || $response == *"Allow"* ]]; then
     print_result 0 "OPTIONS preflight handled"
 else
@@ -14,6 +14,7 @@ import (
 	kafkautil "youtube-clone-platform/metadata-service/internal/events"
 	"youtube-clone-platform/metadata-service/internal/handler"
 	"youtube-clone-platform/metadata-service/internal/service"
+	"youtube-clone-platform/metadata-service/internal/thumbnails"
 
 	"github.com/gin-gonic/gin"
 	"github.com/minio/minio-go/v7"
@@ -49,6 +50,13 @@ func main() {
 	}
 	defer transcodingConsumer.Close()
 
+	// Initialize transcoding failed consumer
+	transcodingFailedConsumer, err := initKafkaConsumer(cfg.KafkaBrokers, cfg.TranscodingFailedTopic, cfg.TranscodingFailedGroupID)
+	if err != nil {
+		log.Fatalf("Failed to initialize transcoding failed Kafka consumer: %v", err)
+	}
+	defer transcodingFailedConsumer.Close()
+
 	// Initialize view event consumer if configured
 	var viewConsumer *kafka.Reader
 	if cfg.ViewTopic != "" && len(cfg.KafkaBrokers) > 0 {
@@ -68,8 +76,16 @@ func main() {
 		log.Fatalf("Failed to initialize MinIO client: %v", err)
 	}
 
+	// Deleted videos are published so that the upload service releases their quota
+	deletionProducer := kafkautil.NewDeletionProducer(cfg.KafkaBrokers, cfg.DeleteTopic)
+	defer deletionProducer.Close()
+
 	// Create service instances
-	metadataService := service.NewMetadataService(db, minioClient)
+	metadataService := service.NewMetadataService(db, minioClient, service.AssetLocation{
+		Bucket:          cfg.MinIO.Bucket,
+		HLSPrefix:       cfg.MinIO.HLSPrefix,
+		ThumbnailPrefix: cfg.MinIO.ThumbnailPrefix,
+	}, thumbnails.NewTranscoderClient(cfg.TranscoderServiceURL), deletionProducer)
 	metadataHandler := handler.NewMetadataHandler(metadataService)
 
 	// Setup HTTP server
@@ -78,7 +94,7 @@ func main() {
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -105,6 +121,15 @@ func main() {
 		}
 	}()
 
+	go func() {
+		if err := kafkautil.StartTranscodingFailedConsumer(consumerCtx, transcodingFailedConsumer, metadataService); err != nil && err != context.Canceled {
+			log.Printf("Transcoding failed Kafka consumer error: %v", err)
+		}
+	}()
+
+	// Publish scheduled videos once their publish time has come
+	go metadataService.RunPublishScheduler(consumerCtx, cfg.PublishInterval)
+
 	// Start view event consumer if initialized
 	if viewConsumer != nil {
 		go func() {
@@ -0,0 +1,230 @@
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Supported caption formats
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+)
+
+// MaxSize is the largest caption file accepted
+const MaxSize = 2 * 1024 * 1024 // 2MB
+
+var (
+	ErrInvalidCaptions   = errors.New("invalid caption file")
+	ErrUnsupportedFormat = errors.New("unsupported caption format, expected SRT or WebVTT")
+	ErrInvalidLanguage   = errors.New("invalid language tag")
+)
+
+var (
+	languageRegex  = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	srtTimingRegex = regexp.MustCompile(`^(\d{1,2}:\d{2}:\d{2})[,.](\d{3})\s*-->\s*(\d{1,2}:\d{2}:\d{2})[,.](\d{3})`)
+	blankLineRegex = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+// Names of common languages, used as track label when none is given
+var languageNames = map[string]string{
+	"ar": "العربية",
+	"de": "Deutsch",
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"hi": "हिन्दी",
+	"it": "Italiano",
+	"ja": "日本語",
+	"ko": "한국어",
+	"nl": "Nederlands",
+	"pl": "Polski",
+	"pt": "Português",
+	"ru": "Русский",
+	"sv": "Svenska",
+	"tr": "Türkçe",
+	"zh": "中文",
+}
+
+// NormalizeLanguage validates a BCP 47 language tag such as "en" or "pt-BR" and returns it
+// with a lower case language and upper case region
+func NormalizeLanguage(tag string) (string, error) {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if !languageRegex.MatchString(tag) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLanguage, tag)
+	}
+
+	parts := strings.Split(tag, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// DefaultLabel returns the name players show for a language
+func DefaultLabel(language string) string {
+	primary := strings.SplitN(language, "-", 2)[0]
+	if name, ok := languageNames[primary]; ok {
+		return name
+	}
+	return language
+}
+
+// DetectFormat guesses the format of a caption file from its name, falling back to its content
+func DetectFormat(filename string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return FormatSRT, nil
+	case ".vtt":
+		return FormatVTT, nil
+	}
+
+	text := normalize(data)
+	if strings.HasPrefix(text, "WEBVTT") {
+		return FormatVTT, nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, "-->") {
+			if srtTimingRegex.MatchString(strings.TrimSpace(line)) {
+				return FormatSRT, nil
+			}
+			break
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ToVTT converts a caption file to WebVTT. WebVTT files are validated and returned with normalized line endings.
+func ToVTT(data []byte, format string) ([]byte, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidCaptions, MaxSize)
+	}
+
+	switch format {
+	case FormatSRT:
+		return srtToVTT(normalize(data))
+	case FormatVTT:
+		return validateVTT(normalize(data))
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// srtToVTT rewrites the SRT cues as WebVTT cues. Cue numbers and SRT display coordinates are
+// dropped and the comma before the milliseconds becomes a dot. Text after a blank line inside a cue
+// is kept with the cue, WebVTT cues cannot contain blank lines.
+func srtToVTT(text string) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n")
+
+	cues := 0
+	for _, block := range splitBlocks(text) {
+		lines := strings.Split(block, "\n")
+
+		if !strings.Contains(block, "-->") {
+			// A block that starts with a cue number is a cue without timing
+			if _, err := strconv.Atoi(strings.TrimSpace(lines[0])); err == nil || cues == 0 {
+				return nil, fmt.Errorf("%w: cue %d has no valid timing line", ErrInvalidCaptions, cues+1)
+			}
+			writeCueText(&out, lines)
+			continue
+		}
+
+		// The cue number is optional in practice
+		if !strings.Contains(lines[0], "-->") {
+			lines = lines[1:]
+		}
+
+		match := srtTimingRegex.FindStringSubmatch(strings.TrimSpace(lines[0]))
+		if match == nil {
+			return nil, fmt.Errorf("%w: cue %d has no valid timing line", ErrInvalidCaptions, cues+1)
+		}
+		start, startOK := parseTimestamp(match[1], match[2])
+		end, endOK := parseTimestamp(match[3], match[4])
+		if !startOK || !endOK || end < start {
+			return nil, fmt.Errorf("%w: cue %d has an invalid timing", ErrInvalidCaptions, cues+1)
+		}
+
+		fmt.Fprintf(&out, "\n%s.%s --> %s.%s\n", padHours(match[1]), match[2], padHours(match[3]), match[4])
+		writeCueText(&out, lines[1:])
+		cues++
+	}
+
+	if cues == 0 {
+		return nil, fmt.Errorf("%w: no cues found", ErrInvalidCaptions)
+	}
+	return out.Bytes(), nil
+}
+
+// writeCueText writes the text lines of a cue, a blank line would end the cue early
+func writeCueText(out *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+}
+
+// parseTimestamp returns the milliseconds of an hh:mm:ss timestamp, it reports false for minutes or
+// seconds out of range
+func parseTimestamp(hms string, millis string) (int64, bool) {
+	parts := strings.Split(hms, ":")
+	hours, _ := strconv.ParseInt(parts[0], 10, 64)
+	minutes, _ := strconv.ParseInt(parts[1], 10, 64)
+	seconds, _ := strconv.ParseInt(parts[2], 10, 64)
+	ms, _ := strconv.ParseInt(millis, 10, 64)
+	if minutes > 59 || seconds > 59 {
+		return 0, false
+	}
+	return ((hours*60+minutes)*60+seconds)*1000 + ms, true
+}
+
+// validateVTT checks the WebVTT signature and that there is at least one cue
+func validateVTT(text string) ([]byte, error) {
+	if !strings.HasPrefix(text, "WEBVTT") {
+		return nil, fmt.Errorf("%w: missing WEBVTT header", ErrInvalidCaptions)
+	}
+	if !strings.Contains(text, "-->") {
+		return nil, fmt.Errorf("%w: no cues found", ErrInvalidCaptions)
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return []byte(text), nil
+}
+
+// normalize strips a byte order mark and converts line endings to \n
+func normalize(data []byte) string {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// splitBlocks splits a caption file into its non-empty, blank line separated blocks
+func splitBlocks(text string) []string {
+	var blocks []string
+	for _, block := range blankLineRegex.Split(strings.TrimSpace(text), -1) {
+		if block = strings.Trim(block, "\n"); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// padHours makes sure the hours of a timestamp have two digits
+func padHours(timestamp string) string {
+	if len(timestamp) == len("0:00:00") {
+		return "0" + timestamp
+	}
+	return timestamp
+}
@@ -0,0 +1,181 @@
+package captions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSRTToVTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		srt     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "numbered cues",
+			srt:  "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name: "CRLF line endings and a byte order mark",
+			srt:  "\uFEFF1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\nthere\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nWorld\r\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\nthere\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name: "missing cue numbers",
+			srt:  "00:00:01,000 --> 00:00:02,000\nHello\n\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name: "1-digit hours",
+			srt:  "1\n0:00:01,000 --> 1:02:03,456\nHello\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 01:02:03.456\nHello\n",
+		},
+		{
+			name: "dots before the milliseconds and display coordinates",
+			srt:  "1\n00:00:01.000 --> 00:00:02.000 X1:10 X2:100 Y1:10 Y2:50\nHello\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name: "blank lines inside a cue",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\nHello\n\nthere\n \nagain\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\nthere\nagain\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name: "extra blank lines between cues",
+			srt:  "\n\n1\n00:00:01,000 --> 00:00:02,000\nHello\n\n\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n\n\n",
+			want: "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n",
+		},
+		{
+			name:    "timing with minutes out of range",
+			srt:     "1\n00:60:01,000 --> 00:61:02,000\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "timing with seconds out of range",
+			srt:     "1\n00:00:61,000 --> 00:00:62,000\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "cue ending before it starts",
+			srt:     "1\n00:00:02,000 --> 00:00:01,000\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "malformed timing line",
+			srt:     "1\n00:00:01 --> 00:00:02\nHello\n",
+			wantErr: true,
+		},
+		{
+			name:    "numbered cue without timing",
+			srt:     "1\n00:00:01,000 --> 00:00:02,000\nHello\n\n2\nWorld\n",
+			wantErr: true,
+		},
+		{
+			name:    "text before the first cue",
+			srt:     "Hello\n\n1\n00:00:01,000 --> 00:00:02,000\nWorld\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			srt:     "\r\n\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToVTT([]byte(tt.srt), FormatSRT)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCaptions) {
+					t.Fatalf("ToVTT() = %q, %v, want ErrInvalidCaptions", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ToVTT() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ToVTT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     string
+		wantErr  bool
+	}{
+		{name: "srt extension", filename: "captions.SRT", data: "anything", want: FormatSRT},
+		{name: "vtt extension", filename: "captions.vtt", data: "anything", want: FormatVTT},
+		{name: "WebVTT content", filename: "captions.txt", data: "WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n", want: FormatVTT},
+		{name: "WebVTT content with a byte order mark", filename: "captions", data: "\uFEFFWEBVTT\r\n", want: FormatVTT},
+		{name: "SRT content", filename: "captions.txt", data: "1\r\n00:00:01,000 --> 00:00:02,000\r\nHi\r\n", want: FormatSRT},
+		{name: "SRT content with 1-digit hours", filename: "captions", data: "0:00:01,000 --> 0:00:02,000\nHi\n", want: FormatSRT},
+		{name: "first timing line is not SRT", filename: "captions", data: "00:01.000 --> 00:02.000\nHi\n", wantErr: true},
+		{name: "no timing line", filename: "captions.txt", data: "Hello\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.filename, []byte(tt.data))
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedFormat) {
+					t.Fatalf("DetectFormat() = %q, %v, want ErrUnsupportedFormat", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectFormat() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "en", want: "en"},
+		{tag: "EN", want: "en"},
+		{tag: "pt-br", want: "pt-BR"},
+		{tag: "pt_BR", want: "pt-BR"},
+		{tag: " fr ", want: "fr"},
+		{tag: "zh-Hant-TW", want: "zh-Hant-TW"},
+		{tag: "es-419", want: "es-419"},
+		{tag: "fil", want: "fil"},
+		{tag: "", wantErr: true},
+		{tag: "e", wantErr: true},
+		{tag: "english", wantErr: true},
+		{tag: "en-", wantErr: true},
+		{tag: "en/../x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, err := NormalizeLanguage(tt.tag)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLanguage) {
+					t.Fatalf("NormalizeLanguage() = %q, %v, want ErrInvalidLanguage", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeLanguage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
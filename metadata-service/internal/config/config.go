@@ -2,6 +2,7 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -13,10 +14,19 @@ type Config struct {
 	KafkaGroupID       string
 	TranscodingTopic   string
 	TranscodingGroupID string
-	ViewTopic          string
-	ViewGroupID        string
-	MinIO              MinIOConfig
-	ServerPort         string
+	// Videos that could not be transcoded are marked failed from this topic
+	TranscodingFailedTopic   string
+	TranscodingFailedGroupID string
+	ViewTopic                string
+	ViewGroupID              string
+	MinIO                    MinIOConfig
+	ServerPort               string
+	// How often scheduled videos are checked for publishing
+	PublishInterval time.Duration
+	// Transcoder service that extracts thumbnail frames
+	TranscoderServiceURL string
+	// Deleted videos are published to this topic, the upload service releases their quota
+	DeleteTopic string
 }
 
 type MinIOConfig struct {
@@ -24,6 +34,10 @@ type MinIOConfig struct {
 	AccessKey string
 	SecretKey string
 	UseSSL    bool
+	// Bucket and prefix of the transcoded HLS output, caption tracks are stored next to it
+	Bucket          string
+	HLSPrefix       string
+	ThumbnailPrefix string
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,26 +46,47 @@ func LoadConfig() (*Config, error) {
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.SetDefault("SERVER_PORT", "8082")
+	viper.SetDefault("PUBLISH_SCHEDULER_INTERVAL", "1m")
+	viper.SetDefault("MINIO_PROCESSED_BUCKET", "processedvideos")
+	viper.SetDefault("MINIO_HLS_PREFIX", "hls")
+	viper.SetDefault("MINIO_THUMBNAIL_PREFIX", "thumbnails")
+	viper.SetDefault("TRANSCODER_SERVICE_URL", "http://localhost:8083")
+	viper.SetDefault("KAFKA_TOPICS_TRANSCODING_FAILED", "transcoding-failed")
+	viper.SetDefault("KAFKA_TRANSCODING_FAILED_GROUP_ID", "metadata-service-transcoding-failed")
+	viper.SetDefault("KAFKA_TOPICS_VIDEO_DELETE", "video-deletions")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	publishInterval, err := time.ParseDuration(viper.GetString("PUBLISH_SCHEDULER_INTERVAL"))
+	if err != nil || publishInterval <= 0 {
+		publishInterval = time.Minute
+	}
+
 	return &Config{
-		DatabasePath:       viper.GetString("DATABASE_PATH"),
-		KafkaBrokers:       viper.GetStringSlice("KAFKA_BROKERS"),
-		KafkaTopic:         viper.GetString("KAFKA_TOPICS_VIDEO_UPLOAD"),
-		KafkaGroupID:       viper.GetString("KAFKA_GROUP_ID"),
-		TranscodingTopic:   viper.GetString("KAFKA_TOPICS_TRANSCODING_COMPLETE"),
-		TranscodingGroupID: viper.GetString("KAFKA_TRANSCODING_GROUP_ID"),
-		ViewTopic:          viper.GetString("KAFKA_TOPICS_VIDEO_VIEW"),
-		ViewGroupID:        viper.GetString("KAFKA_VIEW_GROUP_ID"),
+		DatabasePath:             viper.GetString("DATABASE_PATH"),
+		KafkaBrokers:             viper.GetStringSlice("KAFKA_BROKERS"),
+		KafkaTopic:               viper.GetString("KAFKA_TOPICS_VIDEO_UPLOAD"),
+		KafkaGroupID:             viper.GetString("KAFKA_GROUP_ID"),
+		TranscodingTopic:         viper.GetString("KAFKA_TOPICS_TRANSCODING_COMPLETE"),
+		TranscodingGroupID:       viper.GetString("KAFKA_TRANSCODING_GROUP_ID"),
+		TranscodingFailedTopic:   viper.GetString("KAFKA_TOPICS_TRANSCODING_FAILED"),
+		TranscodingFailedGroupID: viper.GetString("KAFKA_TRANSCODING_FAILED_GROUP_ID"),
+		ViewTopic:                viper.GetString("KAFKA_TOPICS_VIDEO_VIEW"),
+		ViewGroupID:              viper.GetString("KAFKA_VIEW_GROUP_ID"),
 		MinIO: MinIOConfig{
-			Endpoint:  viper.GetString("MINIO_ENDPOINT"),
-			AccessKey: viper.GetString("MINIO_ACCESS_KEY"),
-			SecretKey: viper.GetString("MINIO_SECRET_KEY"),
-			UseSSL:    viper.GetBool("MINIO_USE_SSL"),
+			Endpoint:        viper.GetString("MINIO_ENDPOINT"),
+			AccessKey:       viper.GetString("MINIO_ACCESS_KEY"),
+			SecretKey:       viper.GetString("MINIO_SECRET_KEY"),
+			UseSSL:          viper.GetBool("MINIO_USE_SSL"),
+			Bucket:          viper.GetString("MINIO_PROCESSED_BUCKET"),
+			HLSPrefix:       viper.GetString("MINIO_HLS_PREFIX"),
+			ThumbnailPrefix: viper.GetString("MINIO_THUMBNAIL_PREFIX"),
 		},
-		ServerPort: viper.GetString("SERVER_PORT"),
+		ServerPort:           viper.GetString("SERVER_PORT"),
+		PublishInterval:      publishInterval,
+		TranscoderServiceURL: viper.GetString("TRANSCODER_SERVICE_URL"),
+		DeleteTopic:          viper.GetString("KAFKA_TOPICS_VIDEO_DELETE"),
 	}, nil
 }
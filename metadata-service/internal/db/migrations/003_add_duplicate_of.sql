@@ -0,0 +1,4 @@
+-- Track videos that reuse the transcoded assets of an identical upload
+ALTER TABLE videos ADD COLUMN duplicate_of TEXT;
+CREATE INDEX IF NOT EXISTS idx_videos_checksum ON videos(checksum);
+CREATE INDEX IF NOT EXISTS idx_videos_duplicate_of ON videos(duplicate_of);
@@ -0,0 +1,9 @@
+-- Uploads start as drafts and are published by their owner, right away or at publish_at
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'draft';
+ALTER TABLE videos ADD COLUMN publish_at TIMESTAMP;
+ALTER TABLE videos ADD COLUMN published_at TIMESTAMP;
+
+-- Videos uploaded before drafts existed were already public
+UPDATE videos SET visibility = 'public', published_at = created_at;
+
+CREATE INDEX IF NOT EXISTS idx_videos_visibility_publish_at ON videos(visibility, publish_at);
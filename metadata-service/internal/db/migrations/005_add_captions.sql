@@ -0,0 +1,11 @@
+-- Caption tracks, stored as WebVTT next to the HLS output of a video
+CREATE TABLE IF NOT EXISTS captions (
+    video_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    label TEXT NOT NULL,
+    source_format TEXT NOT NULL,
+    path TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (video_id, language),
+    FOREIGN KEY (video_id) REFERENCES videos(id)
+);
@@ -0,0 +1,6 @@
+-- EBU R128 loudness of the audio measured by the transcoder service before normalizing it to loudness_target
+ALTER TABLE videos ADD COLUMN loudness_integrated REAL;
+ALTER TABLE videos ADD COLUMN loudness_true_peak REAL;
+ALTER TABLE videos ADD COLUMN loudness_range REAL;
+ALTER TABLE videos ADD COLUMN loudness_threshold REAL;
+ALTER TABLE videos ADD COLUMN loudness_target REAL;
@@ -0,0 +1,2 @@
+-- Languages of the audio tracks of a video as a JSON array, in the order of the tracks
+ALTER TABLE videos ADD COLUMN audio_languages TEXT;
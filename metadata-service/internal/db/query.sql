@@ -4,8 +4,10 @@ INSERT INTO videos (
     bitrate, file_size, checksum, created_at, codec, frame_rate,
     aspect_ratio, audio_codec, audio_bitrate, audio_channels,
     content_type, original_filename, file_extension, sanitized_filename,
-    status, minio_path, hls_path, thumbnail_path, mp4_path, tags
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+    status, minio_path, hls_path, thumbnail_path, mp4_path, tags, duplicate_of,
+    loudness_integrated, loudness_true_peak, loudness_range, loudness_threshold, loudness_target,
+    audio_languages
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: GetVideo :one
 SELECT * FROM videos WHERE id = ? LIMIT 1;
@@ -13,8 +15,9 @@ SELECT * FROM videos WHERE id = ? LIMIT 1;
 -- name: GetRecentVideos :many
 SELECT * FROM videos 
 WHERE status IN ('ready', 'completed')
+AND (visibility = 'public' OR user_id = sqlc.arg(viewer_id))
 ORDER BY created_at DESC
-LIMIT ?;
+LIMIT sqlc.arg(limit);
 
 -- name: UpdateVideoStatus :exec
 UPDATE videos SET status = ? WHERE id = ?;
@@ -31,19 +34,24 @@ SELECT COUNT(*) as count FROM video_views WHERE video_id = ? AND user_id = ?;
 -- name: SearchVideos :many
 SELECT * FROM videos 
 WHERE status IN ('ready', 'completed')
+AND (visibility = 'public' OR user_id = sqlc.arg(viewer_id))
 AND (
-    title LIKE ? OR 
-    description LIKE ? OR 
-    tags LIKE ?
+    title LIKE sqlc.arg(title) OR 
+    description LIKE sqlc.arg(description) OR 
+    tags LIKE sqlc.arg(tags)
 )
 ORDER BY created_at DESC
-LIMIT ?;
+LIMIT sqlc.arg(limit);
 
 -- name: GetVideosByUser :many
 SELECT * FROM videos 
-WHERE user_id = ? AND status IN ('ready', 'completed')
+WHERE user_id = sqlc.arg(user_id)
+AND (
+    (status IN ('ready', 'completed') AND visibility = 'public') OR
+    user_id = sqlc.arg(viewer_id)
+)
 ORDER BY created_at DESC
-LIMIT ?;
+LIMIT sqlc.arg(limit);
 
 -- name: UpdateVideoTranscodingComplete :exec
 UPDATE videos 
@@ -51,5 +59,112 @@ SET
     status = ?,
     hls_path = ?,
     thumbnail_path = ?,
-    mp4_path = ?
-WHERE id = ?;
\ No newline at end of file
+    mp4_path = ?,
+    loudness_integrated = ?,
+    loudness_true_peak = ?,
+    loudness_range = ?,
+    loudness_threshold = ?,
+    loudness_target = ?
+WHERE id = ?;
+
+-- name: UpdateDuplicatesTranscodingComplete :exec
+UPDATE videos 
+SET 
+    status = ?,
+    hls_path = ?,
+    mp4_path = ?,
+    loudness_integrated = ?,
+    loudness_true_peak = ?,
+    loudness_range = ?,
+    loudness_threshold = ?,
+    loudness_target = ?
+WHERE duplicate_of = ? AND status IN ('processing', 'failed');
+
+-- name: UpdateDuplicatesThumbnail :exec
+UPDATE videos
+SET thumbnail_path = ?
+WHERE duplicate_of = ? AND status IN ('processing', 'failed')
+AND (thumbnail_path IS NULL OR thumbnail_path = '');
+
+-- name: GetVideosByChecksum :many
+SELECT * FROM videos 
+WHERE checksum = ? AND status != 'failed'
+ORDER BY created_at ASC
+LIMIT ?;
+
+-- name: GetUserVideosByChecksum :many
+SELECT * FROM videos 
+WHERE checksum = ? AND user_id = ? AND status != 'failed'
+ORDER BY created_at ASC
+LIMIT ?;
+
+-- name: UpdateVideoDetails :exec
+UPDATE videos 
+SET 
+    title = ?,
+    description = ?,
+    tags = ?
+WHERE id = ?;
+
+-- name: PublishVideo :exec
+UPDATE videos 
+SET 
+    visibility = 'public',
+    publish_at = NULL,
+    published_at = ?
+WHERE id = ?;
+
+-- name: ScheduleVideo :exec
+UPDATE videos 
+SET 
+    visibility = 'scheduled',
+    publish_at = ?
+WHERE id = ?;
+
+-- name: PublishScheduledVideos :execrows
+UPDATE videos 
+SET 
+    visibility = 'public',
+    published_at = publish_at
+WHERE visibility = 'scheduled' AND publish_at <= ?;
+
+-- name: UpsertCaption :exec
+INSERT INTO captions (video_id, language, label, source_format, path, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (video_id, language) DO UPDATE SET
+    label = excluded.label,
+    source_format = excluded.source_format,
+    path = excluded.path,
+    created_at = excluded.created_at;
+
+-- name: ListCaptions :many
+SELECT * FROM captions
+WHERE video_id = ?
+ORDER BY language;
+
+-- name: DeleteCaption :execrows
+DELETE FROM captions WHERE video_id = ? AND language = ?;
+
+-- name: DeleteVideoCaptions :exec
+DELETE FROM captions WHERE video_id = ?;
+
+-- name: DeleteVideoViews :exec
+DELETE FROM video_views WHERE video_id = ?;
+
+-- name: DeleteVideo :exec
+DELETE FROM videos WHERE id = ?;
+
+-- name: UpdateThumbnailPath :exec
+UPDATE videos 
+SET thumbnail_path = ?
+WHERE id = ?;
+
+-- name: UpdateVideoTranscodingFailed :exec
+UPDATE videos 
+SET status = 'failed'
+WHERE id = ? AND status = 'processing';
+
+-- name: UpdateDuplicatesTranscodingFailed :exec
+UPDATE videos 
+SET status = 'failed'
+WHERE duplicate_of = ? AND status = 'processing';
@@ -27,7 +27,17 @@ CREATE TABLE IF NOT EXISTS videos (
     hls_path TEXT,
     thumbnail_path TEXT,
     mp4_path TEXT,
-    tags TEXT
+    tags TEXT,
+    duplicate_of TEXT,
+    visibility TEXT NOT NULL DEFAULT 'draft',
+    publish_at TIMESTAMP,
+    published_at TIMESTAMP,
+    loudness_integrated REAL,
+    loudness_true_peak REAL,
+    loudness_range REAL,
+    loudness_threshold REAL,
+    loudness_target REAL,
+    audio_languages TEXT
 );
 
  CREATE TABLE IF NOT EXISTS video_views (
@@ -38,8 +48,22 @@ CREATE TABLE IF NOT EXISTS videos (
       FOREIGN KEY (video_id) REFERENCES videos(id)
   );
 
+CREATE TABLE IF NOT EXISTS captions (
+    video_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    label TEXT NOT NULL,
+    source_format TEXT NOT NULL,
+    path TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (video_id, language),
+    FOREIGN KEY (video_id) REFERENCES videos(id)
+);
+
 CREATE INDEX IF NOT EXISTS idx_videos_user_id ON videos(user_id);
 CREATE INDEX IF NOT EXISTS idx_videos_created_at ON videos(created_at);
 CREATE INDEX IF NOT EXISTS idx_videos_status ON videos(status);
+CREATE INDEX IF NOT EXISTS idx_videos_checksum ON videos(checksum);
+CREATE INDEX IF NOT EXISTS idx_videos_duplicate_of ON videos(duplicate_of);
+CREATE INDEX IF NOT EXISTS idx_videos_visibility_publish_at ON videos(visibility, publish_at);
 CREATE INDEX IF NOT EXISTS idx_video_views_video_id ON video_views(video_id);
 CREATE INDEX IF NOT EXISTS idx_video_views_user_id ON video_views(user_id);
\ No newline at end of file
@@ -88,6 +88,21 @@ func StartConsumer(ctx context.Context, reader *kafka.Reader, metadataService *s
 
 			log.Printf("Converted metadata for video ID: %s", metadata.ID)
 
+			// Duplicate uploads reuse the assets of the original instead of being transcoded
+			if event.DuplicateOf != "" {
+				if err := metadataService.ApplyDuplicateAssets(ctx, metadata, event.DuplicateOf); err != nil {
+					// The raw upload of a duplicate is not kept, the video is still stored so that it is
+					// not lost. It gets the assets of its source once the source completes transcoding.
+					log.Printf("Error applying duplicate assets of %s to video %s, storing it as failed: %v", event.DuplicateOf, metadata.ID, err)
+					metadataService.LinkUnavailableDuplicate(metadata, event.DuplicateOf)
+				} else {
+					log.Printf("Video %s is a duplicate of %s", metadata.ID, metadata.DuplicateOf.String)
+				}
+				if err := metadataService.WriteDuplicateMarker(ctx, metadata.ID, metadata.DuplicateOf.String); err != nil {
+					log.Printf("Error linking the assets of video %s to %s: %v", metadata.ID, metadata.DuplicateOf.String, err)
+				}
+			}
+
 			// Store metadata
 			if err := metadataService.CreateVideoMetadata(ctx, metadata); err != nil {
 				log.Printf("Error storing metadata: %v", err)
@@ -134,3 +149,36 @@ func StartTranscodingCompleteConsumer(ctx context.Context, reader *kafka.Reader,
 		}
 	}
 }
+
+// StartTranscodingFailedConsumer starts consuming transcoding failed messages from Kafka
+func StartTranscodingFailedConsumer(ctx context.Context, reader *kafka.Reader, metadataService *service.MetadataService) error {
+	log.Printf("Starting transcoding failed consumer...")
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			msg, err := reader.ReadMessage(ctx)
+			if err != nil {
+				log.Printf("Error reading transcoding failed message: %v", err)
+				continue
+			}
+
+			log.Printf("Received transcoding failed message: %s", string(msg.Value))
+
+			var event types.TranscodingFailedEvent
+			if err := json.Unmarshal(msg.Value, &event); err != nil {
+				log.Printf("Error unmarshaling transcoding failed message: %v", err)
+				log.Printf("Message content: %s", string(msg.Value))
+				continue
+			}
+
+			if err := metadataService.UpdateVideoFromTranscodingFailed(ctx, &event); err != nil {
+				log.Printf("Error marking video %s as failed: %v", event.VideoID, err)
+				continue
+			}
+
+			log.Printf("Video %s failed transcoding after %d attempts (%s): %s", event.VideoID, event.Attempts, event.ErrorClass, event.Error)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"youtube-clone-platform/metadata-service/internal/types"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeletionProducer publishes video deletion events to Kafka
+type DeletionProducer struct {
+	writer *kafka.Writer
+}
+
+// NewDeletionProducer creates a producer for the deletion topic
+func NewDeletionProducer(brokers []string, topic string) *DeletionProducer {
+	return &DeletionProducer{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.LeastBytes{},
+			RequiredAcks: kafka.RequireOne,
+			BatchTimeout: 10 * time.Millisecond,
+			MaxAttempts:  3,
+		},
+	}
+}
+
+// PublishVideoDeleted publishes the deletion of a video, keyed by the video ID
+func (p *DeletionProducer) PublishVideoDeleted(ctx context.Context, event types.VideoDeletedEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deletion event: %w", err)
+	}
+
+	if err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.VideoID),
+		Value: value,
+	}); err != nil {
+		return fmt.Errorf("failed to publish deletion event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the producer
+func (p *DeletionProducer) Close() error {
+	return p.writer.Close()
+}
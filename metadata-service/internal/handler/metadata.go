@@ -1,10 +1,17 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"youtube-clone-platform/metadata-service/internal/captions"
 	"youtube-clone-platform/metadata-service/internal/service"
+	"youtube-clone-platform/metadata-service/internal/thumbnails"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,15 +40,26 @@ func (h *MetadataHandler) RegisterRoutes(router *gin.Engine) {
 		api.GET("/videos/:id", h.GetVideoMetadata)
 		api.GET("/videos", h.GetRecentVideos)
 		api.POST("/videos/:id/views", h.IncrementViews)
+		api.PATCH("/videos/:id", h.UpdateVideo)
+		api.DELETE("/videos/:id", h.DeleteVideo)
+		api.POST("/videos/:id/publish", h.PublishVideo)
+		api.GET("/videos/:id/captions", h.ListCaptions)
+		api.PUT("/videos/:id/captions/:lang", h.UploadCaptions)
+		api.DELETE("/videos/:id/captions/:lang", h.DeleteCaptions)
+		api.PUT("/videos/:id/thumbnail", h.UploadThumbnail)
+		api.POST("/videos/:id/thumbnail/regenerate", h.RegenerateThumbnail)
+		api.GET("/videos/:id/thumbnail/candidates", h.ListThumbnailCandidates)
 		api.GET("/videos/search", h.SearchVideos)
 		api.GET("/users/:id/videos", h.GetUserVideos)
+		api.GET("/checksums/:checksum/videos", h.GetVideosByChecksum)
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"status": "ok"})
 		})
 	}
 }
 
-// GetVideoMetadata handles GET /api/v1/videos/:id
+// GetVideoMetadata handles GET /api/v1/videos/:id. Unpublished videos are only returned to their
+// owner.
 func (h *MetadataHandler) GetVideoMetadata(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -49,9 +67,9 @@ func (h *MetadataHandler) GetVideoMetadata(c *gin.Context) {
 		return
 	}
 
-	metadata, err := h.metadataService.GetVideoMetadata(c.Request.Context(), id)
+	metadata, err := h.metadataService.GetVisibleVideo(c.Request.Context(), id, c.GetHeader("X-User-ID"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		writeOwnerError(c, err)
 		return
 	}
 
@@ -66,7 +84,7 @@ func (h *MetadataHandler) GetRecentVideos(c *gin.Context) {
 		limit = 10
 	}
 
-	videos, err := h.metadataService.GetRecentVideos(c.Request.Context(), limit)
+	videos, err := h.metadataService.GetRecentVideos(c.Request.Context(), c.GetHeader("X-User-ID"), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,6 +115,251 @@ func (h *MetadataHandler) IncrementViews(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// UpdateVideo handles PATCH /api/v1/videos/:id
+func (h *MetadataHandler) UpdateVideo(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	var update service.VideoUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	video, err := h.metadataService.UpdateVideoDetails(c.Request.Context(), c.Param("id"), userID, update)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, video)
+}
+
+// PublishVideo handles POST /api/v1/videos/:id/publish
+func (h *MetadataHandler) PublishVideo(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	// An empty body publishes right away
+	var req struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "publish_at must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	video, err := h.metadataService.PublishVideo(c.Request.Context(), c.Param("id"), userID, req.PublishAt)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, video)
+}
+
+// DeleteVideo handles DELETE /api/v1/videos/:id
+func (h *MetadataHandler) DeleteVideo(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	if err := h.metadataService.DeleteVideo(c.Request.Context(), c.Param("id"), userID); err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListCaptions handles GET /api/v1/videos/:id/captions
+func (h *MetadataHandler) ListCaptions(c *gin.Context) {
+	tracks, err := h.metadataService.ListCaptions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"video_id": c.Param("id"),
+		"captions": tracks,
+	})
+}
+
+// UploadCaptions handles PUT /api/v1/videos/:id/captions/:lang. The SRT or WebVTT file is sent as
+// the "file" field of a multipart form or as the raw request body.
+func (h *MetadataHandler) UploadCaptions(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	var (
+		data     []byte
+		filename string
+		err      error
+	)
+	label := c.Query("label")
+	if file, header, formErr := c.Request.FormFile("file"); formErr == nil {
+		defer file.Close()
+		filename = header.Filename
+		data, err = io.ReadAll(io.LimitReader(file, captions.MaxSize+1))
+		if formLabel := c.PostForm("label"); formLabel != "" {
+			label = formLabel
+		}
+	} else {
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, captions.MaxSize+1))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read caption file"})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "caption file is required"})
+		return
+	}
+
+	track, err := h.metadataService.UploadCaptions(c.Request.Context(), c.Param("id"), userID, c.Param("lang"), label, filename, data)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// DeleteCaptions handles DELETE /api/v1/videos/:id/captions/:lang
+func (h *MetadataHandler) DeleteCaptions(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	if err := h.metadataService.DeleteCaptions(c.Request.Context(), c.Param("id"), userID, c.Param("lang")); err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UploadThumbnail handles PUT /api/v1/videos/:id/thumbnail. The JPEG or PNG image is sent as the
+// "file" field of a multipart form or as the raw request body.
+func (h *MetadataHandler) UploadThumbnail(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if file, _, formErr := c.Request.FormFile("file"); formErr == nil {
+		defer file.Close()
+		data, err = io.ReadAll(io.LimitReader(file, thumbnails.MaxSize+1))
+	} else {
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, thumbnails.MaxSize+1))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read thumbnail image"})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thumbnail image is required"})
+		return
+	}
+
+	thumbnail, err := h.metadataService.UploadThumbnail(c.Request.Context(), c.Param("id"), userID, data)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, thumbnail)
+}
+
+// RegenerateThumbnail handles POST /api/v1/videos/:id/thumbnail/regenerate
+func (h *MetadataHandler) RegenerateThumbnail(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	var req struct {
+		// Position of the frame in seconds
+		Timestamp *float64 `json:"timestamp"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Timestamp == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timestamp is required"})
+		return
+	}
+
+	thumbnail, err := h.metadataService.RegenerateThumbnail(c.Request.Context(), c.Param("id"), userID, *req.Timestamp)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, thumbnail)
+}
+
+// ListThumbnailCandidates handles GET /api/v1/videos/:id/thumbnail/candidates
+func (h *MetadataHandler) ListThumbnailCandidates(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	candidates, err := h.metadataService.ThumbnailCandidates(c.Request.Context(), c.Param("id"), userID)
+	if err != nil {
+		writeOwnerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"video_id":   c.Param("id"),
+		"candidates": candidates,
+	})
+}
+
+// writeOwnerError maps errors of owner-only, caption and thumbnail operations to HTTP responses
+func writeOwnerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "video not found"})
+	case errors.Is(err, service.ErrNotOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTitle),
+		errors.Is(err, captions.ErrInvalidCaptions),
+		errors.Is(err, captions.ErrUnsupportedFormat),
+		errors.Is(err, captions.ErrInvalidLanguage),
+		errors.Is(err, thumbnails.ErrInvalidImage),
+		errors.Is(err, thumbnails.ErrUnsupportedImage),
+		errors.Is(err, service.ErrInvalidTimestamp):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, thumbnails.ErrGeneratorFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // SearchVideos handles GET /api/v1/videos/search
 func (h *MetadataHandler) SearchVideos(c *gin.Context) {
 	query := c.Query("q")
@@ -111,7 +374,7 @@ func (h *MetadataHandler) SearchVideos(c *gin.Context) {
 		limit = 10
 	}
 
-	videos, err := h.metadataService.SearchVideos(c.Request.Context(), query, limit)
+	videos, err := h.metadataService.SearchVideos(c.Request.Context(), c.GetHeader("X-User-ID"), query, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -134,7 +397,30 @@ func (h *MetadataHandler) GetUserVideos(c *gin.Context) {
 		limit = 10
 	}
 
-	videos, err := h.metadataService.GetVideosByUser(c.Request.Context(), userID, limit)
+	videos, err := h.metadataService.GetVideosByUser(c.Request.Context(), c.GetHeader("X-User-ID"), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, videos)
+}
+
+// GetVideosByChecksum handles GET /api/v1/checksums/:checksum/videos
+func (h *MetadataHandler) GetVideosByChecksum(c *gin.Context) {
+	checksum := strings.ToLower(c.Param("checksum"))
+	if checksum == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "checksum is required"})
+		return
+	}
+
+	limitStr := c.DefaultQuery("limit", "10")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		limit = 10
+	}
+
+	videos, err := h.metadataService.GetVideosByChecksum(c.Request.Context(), checksum, c.Query("user_id"), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
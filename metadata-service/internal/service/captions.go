@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"time"
+
+	"youtube-clone-platform/metadata-service/internal/captions"
+	sqlc "youtube-clone-platform/metadata-service/internal/db/sqlc"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Caption is a subtitle track of a video
+type Caption struct {
+	Language     string    `json:"language"`
+	Label        string    `json:"label"`
+	SourceFormat string    `json:"source_format"`
+	Path         string    `json:"path"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UploadCaptions stores a caption file for a video owned by userID. SRT files are converted to
+// WebVTT and the track is stored as subtitles/<language>.vtt next to the HLS output of the video.
+// An existing track for the same language is replaced.
+func (s *MetadataService) UploadCaptions(ctx context.Context, videoID string, userID string, language string, label string, filename string, data []byte) (*Caption, error) {
+	if _, err := s.ownedVideo(ctx, videoID, userID); err != nil {
+		return nil, err
+	}
+
+	language, err := captions.NormalizeLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		label = captions.DefaultLabel(language)
+	}
+
+	format, err := captions.DetectFormat(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	vtt, err := captions.ToVTT(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	objectName := s.captionObjectName(videoID, language)
+	_, err = s.minioClient.PutObject(ctx, s.assets.Bucket, objectName, bytes.NewReader(vtt), int64(len(vtt)), minio.PutObjectOptions{
+		ContentType: "text/vtt; charset=utf-8",
+		UserMetadata: map[string]string{
+			"language": language,
+			"label":    label,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store captions: %w", err)
+	}
+
+	caption := &Caption{
+		Language:     language,
+		Label:        label,
+		SourceFormat: format,
+		Path:         objectName,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.store.UpsertCaption(ctx, sqlc.UpsertCaptionParams{
+		VideoID:      videoID,
+		Language:     caption.Language,
+		Label:        caption.Label,
+		SourceFormat: caption.SourceFormat,
+		Path:         caption.Path,
+		CreatedAt:    caption.CreatedAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save captions: %w", err)
+	}
+
+	return caption, nil
+}
+
+// ListCaptions returns the caption tracks of a video ordered by language
+func (s *MetadataService) ListCaptions(ctx context.Context, videoID string) ([]*Caption, error) {
+	if _, err := s.store.GetVideo(ctx, videoID); err != nil {
+		return nil, fmt.Errorf("failed to get video metadata: %w", err)
+	}
+
+	rows, err := s.store.ListCaptions(ctx, videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list captions: %w", err)
+	}
+
+	result := make([]*Caption, len(rows))
+	for i, row := range rows {
+		result[i] = &Caption{
+			Language:     row.Language,
+			Label:        row.Label,
+			SourceFormat: row.SourceFormat,
+			Path:         row.Path,
+			CreatedAt:    row.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+// DeleteCaptions removes the caption track of a video owned by userID
+func (s *MetadataService) DeleteCaptions(ctx context.Context, videoID string, userID string, language string) error {
+	if _, err := s.ownedVideo(ctx, videoID, userID); err != nil {
+		return err
+	}
+
+	language, err := captions.NormalizeLanguage(language)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.store.DeleteCaption(ctx, sqlc.DeleteCaptionParams{
+		VideoID:  videoID,
+		Language: language,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete captions: %w", err)
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := s.minioClient.RemoveObject(ctx, s.assets.Bucket, s.captionObjectName(videoID, language), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove captions: %w", err)
+	}
+	return nil
+}
+
+// captionObjectName returns where the WebVTT track of a language is stored
+func (s *MetadataService) captionObjectName(videoID string, language string) string {
+	return path.Join(s.assets.HLSPrefix, videoID, "subtitles", language+".vtt")
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"youtube-clone-platform/metadata-service/internal/types"
+)
+
+// DeletionPublisher publishes the deletion of videos to the other services
+type DeletionPublisher interface {
+	PublishVideoDeleted(ctx context.Context, event types.VideoDeletedEvent) error
+}
+
+// DeleteVideo deletes the metadata, captions and views of a video owned by userID. The deletion
+// is published first, so that a video is never gone without the upload service releasing its
+// quota. Publishing again when a failed deletion is retried is harmless.
+func (s *MetadataService) DeleteVideo(ctx context.Context, id string, userID string) error {
+	video, err := s.ownedVideo(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deletions.PublishVideoDeleted(ctx, types.VideoDeletedEvent{
+		VideoID:   video.ID,
+		UserID:    video.UserID,
+		DeletedAt: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteVideoCaptions(ctx, video.ID); err != nil {
+		return fmt.Errorf("failed to delete captions: %w", err)
+	}
+	if err := s.store.DeleteVideoViews(ctx, video.ID); err != nil {
+		return fmt.Errorf("failed to delete views: %w", err)
+	}
+	if err := s.store.DeleteVideo(ctx, video.ID); err != nil {
+		return fmt.Errorf("failed to delete video: %w", err)
+	}
+
+	return nil
+}
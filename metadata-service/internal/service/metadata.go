@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"youtube-clone-platform/metadata-service/internal/db"
 	sqlc "youtube-clone-platform/metadata-service/internal/db/sqlc"
+	"youtube-clone-platform/metadata-service/internal/thumbnails"
 	"youtube-clone-platform/metadata-service/internal/types"
 
 	"github.com/minio/minio-go/v7"
@@ -45,19 +49,45 @@ type VideoMetadata struct {
 	ThumbnailPath     sql.NullString `json:"thumbnail_path"`
 	MP4Path           sql.NullString `json:"mp4_path"`
 	Tags              []string       `json:"tags"`
+	DuplicateOf       sql.NullString `json:"duplicate_of"`
+	Visibility        string         `json:"visibility"`
+	PublishAt         sql.NullTime   `json:"publish_at"`
+	PublishedAt       sql.NullTime   `json:"published_at"`
+	// AudioLanguages are the languages of the audio tracks, every language once
+	AudioLanguages []string `json:"audio_languages"`
+	// Loudness of the audio before it was normalized to LoudnessTarget, all null if it was not
+	LoudnessIntegrated sql.NullFloat64 `json:"loudness_integrated"`
+	LoudnessTruePeak   sql.NullFloat64 `json:"loudness_true_peak"`
+	LoudnessRange      sql.NullFloat64 `json:"loudness_range"`
+	LoudnessThreshold  sql.NullFloat64 `json:"loudness_threshold"`
+	LoudnessTarget     sql.NullFloat64 `json:"loudness_target"`
+}
+
+// AssetLocation is where the transcoded assets of videos are stored
+type AssetLocation struct {
+	Bucket          string
+	HLSPrefix       string
+	ThumbnailPrefix string
 }
 
 // MetadataService handles video metadata operations
 type MetadataService struct {
 	store       *db.Store
 	minioClient *minio.Client
+	assets      AssetLocation
+	thumbnails  thumbnails.Generator
+	deletions   DeletionPublisher
 }
 
-// NewMetadataService creates a new metadata service
-func NewMetadataService(store *db.Store, minioClient *minio.Client) *MetadataService {
+// NewMetadataService creates a new metadata service. Thumbnails taken from a video frame are
+// generated by thumbnailGenerator, deleted videos are published to deletions.
+func NewMetadataService(store *db.Store, minioClient *minio.Client, assets AssetLocation, thumbnailGenerator thumbnails.Generator, deletions DeletionPublisher) *MetadataService {
 	return &MetadataService{
 		store:       store,
 		minioClient: minioClient,
+		assets:      assets,
+		thumbnails:  thumbnailGenerator,
+		deletions:   deletions,
 	}
 }
 
@@ -97,6 +127,8 @@ func (s *MetadataService) ConvertUploadMetadata(event *types.VideoUploadEvent) *
 		ThumbnailPath:     sql.NullString{String: "", Valid: false},
 		MP4Path:           sql.NullString{String: "", Valid: false},
 		Tags:              []string{},
+		Visibility:        VisibilityDraft,
+		AudioLanguages:    newAudioLanguages(event.Metadata.AudioTracks),
 	}
 
 	return metadata
@@ -108,36 +140,47 @@ func (s *MetadataService) CreateVideoMetadata(ctx context.Context, metadata *Vid
 	if err != nil {
 		return fmt.Errorf("failed to marshal tags: %w", err)
 	}
+	audioLanguagesJSON, err := json.Marshal(metadata.AudioLanguages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audio languages: %w", err)
+	}
 
 	params := sqlc.CreateVideoParams{
-		ID:                metadata.ID,
-		UserID:            metadata.UserID,
-		Title:             metadata.Title,
-		Description:       metadata.Description,
-		Duration:          metadata.Duration,
-		Width:             metadata.Width,
-		Height:            metadata.Height,
-		Format:            metadata.Format,
-		Bitrate:           metadata.Bitrate,
-		FileSize:          metadata.FileSize,
-		Checksum:          metadata.Checksum,
-		CreatedAt:         metadata.CreatedAt,
-		Codec:             metadata.Codec,
-		FrameRate:         metadata.FrameRate,
-		AspectRatio:       metadata.AspectRatio,
-		AudioCodec:        metadata.AudioCodec,
-		AudioBitrate:      metadata.AudioBitrate,
-		AudioChannels:     metadata.AudioChannels,
-		ContentType:       metadata.ContentType,
-		OriginalFilename:  metadata.OriginalFilename,
-		FileExtension:     metadata.FileExtension,
-		SanitizedFilename: metadata.SanitizedFilename,
-		Status:            metadata.Status,
-		MinioPath:         metadata.MinioPath,
-		HlsPath:           metadata.HLSPath,
-		ThumbnailPath:     metadata.ThumbnailPath,
-		Mp4Path:           metadata.MP4Path,
-		Tags:              sql.NullString{String: string(tagsJSON), Valid: true},
+		ID:                 metadata.ID,
+		UserID:             metadata.UserID,
+		Title:              metadata.Title,
+		Description:        metadata.Description,
+		Duration:           metadata.Duration,
+		Width:              metadata.Width,
+		Height:             metadata.Height,
+		Format:             metadata.Format,
+		Bitrate:            metadata.Bitrate,
+		FileSize:           metadata.FileSize,
+		Checksum:           metadata.Checksum,
+		CreatedAt:          metadata.CreatedAt,
+		Codec:              metadata.Codec,
+		FrameRate:          metadata.FrameRate,
+		AspectRatio:        metadata.AspectRatio,
+		AudioCodec:         metadata.AudioCodec,
+		AudioBitrate:       metadata.AudioBitrate,
+		AudioChannels:      metadata.AudioChannels,
+		ContentType:        metadata.ContentType,
+		OriginalFilename:   metadata.OriginalFilename,
+		FileExtension:      metadata.FileExtension,
+		SanitizedFilename:  metadata.SanitizedFilename,
+		Status:             metadata.Status,
+		MinioPath:          metadata.MinioPath,
+		HlsPath:            metadata.HLSPath,
+		ThumbnailPath:      metadata.ThumbnailPath,
+		Mp4Path:            metadata.MP4Path,
+		Tags:               sql.NullString{String: string(tagsJSON), Valid: true},
+		DuplicateOf:        metadata.DuplicateOf,
+		LoudnessIntegrated: metadata.LoudnessIntegrated,
+		LoudnessTruePeak:   metadata.LoudnessTruePeak,
+		LoudnessRange:      metadata.LoudnessRange,
+		LoudnessThreshold:  metadata.LoudnessThreshold,
+		LoudnessTarget:     metadata.LoudnessTarget,
+		AudioLanguages:     sql.NullString{String: string(audioLanguagesJSON), Valid: true},
 	}
 
 	return s.store.CreateVideo(ctx, params)
@@ -158,35 +201,45 @@ func (s *MetadataService) GetVideoMetadata(ctx context.Context, id string) (*Vid
 	}
 
 	return &VideoMetadata{
-		ID:                video.ID,
-		UserID:            video.UserID,
-		Title:             video.Title,
-		Description:       video.Description,
-		Duration:          video.Duration,
-		Width:             video.Width,
-		Height:            video.Height,
-		Format:            video.Format,
-		Bitrate:           video.Bitrate,
-		FileSize:          video.FileSize,
-		Checksum:          video.Checksum,
-		CreatedAt:         video.CreatedAt,
-		Codec:             video.Codec,
-		FrameRate:         video.FrameRate,
-		AspectRatio:       video.AspectRatio,
-		AudioCodec:        video.AudioCodec,
-		AudioBitrate:      video.AudioBitrate,
-		AudioChannels:     video.AudioChannels,
-		ContentType:       video.ContentType,
-		OriginalFilename:  video.OriginalFilename,
-		FileExtension:     video.FileExtension,
-		SanitizedFilename: video.SanitizedFilename,
-		Views:             video.Views,
-		Status:            video.Status,
-		MinioPath:         video.MinioPath,
-		HLSPath:           video.HlsPath,
-		ThumbnailPath:     video.ThumbnailPath,
-		MP4Path:           video.Mp4Path,
-		Tags:              tags,
+		ID:                 video.ID,
+		UserID:             video.UserID,
+		Title:              video.Title,
+		Description:        video.Description,
+		Duration:           video.Duration,
+		Width:              video.Width,
+		Height:             video.Height,
+		Format:             video.Format,
+		Bitrate:            video.Bitrate,
+		FileSize:           video.FileSize,
+		Checksum:           video.Checksum,
+		CreatedAt:          video.CreatedAt,
+		Codec:              video.Codec,
+		FrameRate:          video.FrameRate,
+		AspectRatio:        video.AspectRatio,
+		AudioCodec:         video.AudioCodec,
+		AudioBitrate:       video.AudioBitrate,
+		AudioChannels:      video.AudioChannels,
+		AudioLanguages:     parseAudioLanguages(video.AudioLanguages),
+		ContentType:        video.ContentType,
+		OriginalFilename:   video.OriginalFilename,
+		FileExtension:      video.FileExtension,
+		SanitizedFilename:  video.SanitizedFilename,
+		Views:              video.Views,
+		Status:             video.Status,
+		MinioPath:          video.MinioPath,
+		HLSPath:            video.HlsPath,
+		ThumbnailPath:      video.ThumbnailPath,
+		MP4Path:            video.Mp4Path,
+		Tags:               tags,
+		DuplicateOf:        video.DuplicateOf,
+		Visibility:         video.Visibility,
+		PublishAt:          video.PublishAt,
+		PublishedAt:        video.PublishedAt,
+		LoudnessIntegrated: video.LoudnessIntegrated,
+		LoudnessTruePeak:   video.LoudnessTruePeak,
+		LoudnessRange:      video.LoudnessRange,
+		LoudnessThreshold:  video.LoudnessThreshold,
+		LoudnessTarget:     video.LoudnessTarget,
 	}, nil
 }
 
@@ -217,9 +270,12 @@ func (s *MetadataService) IncrementViews(ctx context.Context, videoID, userID st
 	return nil
 }
 
-// GetRecentVideos retrieves the most recent videos
-func (s *MetadataService) GetRecentVideos(ctx context.Context, limit int) ([]*VideoMetadata, error) {
-	videos, err := s.store.GetRecentVideos(ctx, int64(limit))
+// GetRecentVideos retrieves the most recent published videos, and the viewer's own unpublished ones
+func (s *MetadataService) GetRecentVideos(ctx context.Context, viewerID string, limit int) ([]*VideoMetadata, error) {
+	videos, err := s.store.GetRecentVideos(ctx, sqlc.GetRecentVideosParams{
+		ViewerID: viewerID,
+		Limit:    int64(limit),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent videos: %w", err)
 	}
@@ -227,10 +283,12 @@ func (s *MetadataService) GetRecentVideos(ctx context.Context, limit int) ([]*Vi
 	return s.convertVideos(videos)
 }
 
-// SearchVideos searches for videos by title, description, or tags
-func (s *MetadataService) SearchVideos(ctx context.Context, query string, limit int) ([]*VideoMetadata, error) {
+// SearchVideos searches for videos by title, description, or tags.
+// Unpublished videos are only found by their owner.
+func (s *MetadataService) SearchVideos(ctx context.Context, viewerID string, query string, limit int) ([]*VideoMetadata, error) {
 	searchPattern := "%" + query + "%"
 	params := sqlc.SearchVideosParams{
+		ViewerID:    viewerID,
 		Title:       searchPattern,
 		Description: sql.NullString{String: searchPattern, Valid: true},
 		Tags:        sql.NullString{String: searchPattern, Valid: true},
@@ -245,11 +303,13 @@ func (s *MetadataService) SearchVideos(ctx context.Context, query string, limit
 	return s.convertVideos(videos)
 }
 
-// GetVideosByUser retrieves videos for a specific user
-func (s *MetadataService) GetVideosByUser(ctx context.Context, userID string, limit int) ([]*VideoMetadata, error) {
+// GetVideosByUser retrieves videos for a specific user. The user sees all of their videos,
+// including drafts and videos still processing, everyone else only the published ones.
+func (s *MetadataService) GetVideosByUser(ctx context.Context, viewerID string, userID string, limit int) ([]*VideoMetadata, error) {
 	params := sqlc.GetVideosByUserParams{
-		UserID: userID,
-		Limit:  int64(limit),
+		UserID:   userID,
+		ViewerID: viewerID,
+		Limit:    int64(limit),
 	}
 
 	videos, err := s.store.GetVideosByUser(ctx, params)
@@ -260,6 +320,110 @@ func (s *MetadataService) GetVideosByUser(ctx context.Context, userID string, li
 	return s.convertVideos(videos)
 }
 
+// GetVideosByChecksum retrieves the videos whose original file has the given checksum, oldest first.
+// If userID is set only that user's videos are returned.
+func (s *MetadataService) GetVideosByChecksum(ctx context.Context, checksum string, userID string, limit int) ([]*VideoMetadata, error) {
+	var (
+		videos []sqlc.Video
+		err    error
+	)
+	if userID != "" {
+		videos, err = s.store.GetUserVideosByChecksum(ctx, sqlc.GetUserVideosByChecksumParams{
+			Checksum: checksum,
+			UserID:   userID,
+			Limit:    int64(limit),
+		})
+	} else {
+		videos, err = s.store.GetVideosByChecksum(ctx, sqlc.GetVideosByChecksumParams{
+			Checksum: checksum,
+			Limit:    int64(limit),
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get videos by checksum: %w", err)
+	}
+
+	return s.convertVideos(videos)
+}
+
+// ApplyDuplicateAssets points a new video record at the assets of an identical, already
+// uploaded video, so the upload does not have to be transcoded again
+func (s *MetadataService) ApplyDuplicateAssets(ctx context.Context, metadata *VideoMetadata, sourceID string) error {
+	source, err := s.GetVideoMetadata(ctx, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to get duplicate source: %w", err)
+	}
+
+	// Always reference the video that owns the assets, never another duplicate
+	canonicalID := source.ID
+	if source.DuplicateOf.Valid && source.DuplicateOf.String != "" {
+		canonicalID = source.DuplicateOf.String
+	}
+
+	metadata.DuplicateOf = sql.NullString{String: canonicalID, Valid: true}
+	metadata.Status = source.Status
+	metadata.MinioPath = source.MinioPath
+	metadata.HLSPath = source.HLSPath
+	metadata.ThumbnailPath = source.ThumbnailPath
+	metadata.MP4Path = source.MP4Path
+	metadata.AudioLanguages = source.AudioLanguages
+	metadata.LoudnessIntegrated = source.LoudnessIntegrated
+	metadata.LoudnessTruePeak = source.LoudnessTruePeak
+	metadata.LoudnessRange = source.LoudnessRange
+	metadata.LoudnessThreshold = source.LoudnessThreshold
+	metadata.LoudnessTarget = source.LoudnessTarget
+
+	return nil
+}
+
+// DuplicateMarker is the object next to the HLS output of a duplicate that names the video whose
+// transcoded assets it shares. Object names of the streaming service are built from the video ID,
+// the marker lets it find the assets of the source.
+const DuplicateMarker = "duplicate_of"
+
+// WriteDuplicateMarker records that the transcoded assets of videoID are those of sourceID
+func (s *MetadataService) WriteDuplicateMarker(ctx context.Context, videoID string, sourceID string) error {
+	objectName := path.Join(s.assets.HLSPrefix, videoID, DuplicateMarker)
+	if _, err := s.minioClient.PutObject(ctx, s.assets.Bucket, objectName, strings.NewReader(sourceID), int64(len(sourceID)), minio.PutObjectOptions{
+		ContentType: "text/plain",
+	}); err != nil {
+		return fmt.Errorf("failed to write duplicate marker: %w", err)
+	}
+	return nil
+}
+
+// LinkUnavailableDuplicate links a duplicate upload to its source when the assets of the source
+// cannot be applied. The video is marked failed until the source completes transcoding, which
+// updates all of its duplicates.
+func (s *MetadataService) LinkUnavailableDuplicate(metadata *VideoMetadata, sourceID string) {
+	metadata.DuplicateOf = sql.NullString{String: sourceID, Valid: true}
+	metadata.Status = "failed"
+}
+
+// newAudioLanguages returns the languages of the audio tracks of a video in the order of the tracks,
+// every language once. Tracks without a language tag are left out.
+func newAudioLanguages(tracks []types.AudioTrack) []string {
+	languages := []string{}
+	for _, track := range tracks {
+		if track.Language != "" && !slices.Contains(languages, track.Language) {
+			languages = append(languages, track.Language)
+		}
+	}
+	return languages
+}
+
+// parseAudioLanguages decodes the audio languages of a video. Videos stored before audio languages
+// were recorded have none.
+func parseAudioLanguages(column sql.NullString) []string {
+	languages := []string{}
+	if column.Valid && column.String != "" {
+		if err := json.Unmarshal([]byte(column.String), &languages); err != nil {
+			return []string{}
+		}
+	}
+	return languages
+}
+
 // convertVideos converts a slice of SQLC Video models to VideoMetadata
 func (s *MetadataService) convertVideos(videos []sqlc.Video) ([]*VideoMetadata, error) {
 	result := make([]*VideoMetadata, len(videos))
@@ -272,35 +436,45 @@ func (s *MetadataService) convertVideos(videos []sqlc.Video) ([]*VideoMetadata,
 		}
 
 		result[i] = &VideoMetadata{
-			ID:                video.ID,
-			UserID:            video.UserID,
-			Title:             video.Title,
-			Description:       video.Description,
-			Duration:          video.Duration,
-			Width:             video.Width,
-			Height:            video.Height,
-			Format:            video.Format,
-			Bitrate:           video.Bitrate,
-			FileSize:          video.FileSize,
-			Checksum:          video.Checksum,
-			CreatedAt:         video.CreatedAt,
-			Codec:             video.Codec,
-			FrameRate:         video.FrameRate,
-			AspectRatio:       video.AspectRatio,
-			AudioCodec:        video.AudioCodec,
-			AudioBitrate:      video.AudioBitrate,
-			AudioChannels:     video.AudioChannels,
-			ContentType:       video.ContentType,
-			OriginalFilename:  video.OriginalFilename,
-			FileExtension:     video.FileExtension,
-			SanitizedFilename: video.SanitizedFilename,
-			Views:             video.Views,
-			Status:            video.Status,
-			MinioPath:         video.MinioPath,
-			HLSPath:           video.HlsPath,
-			ThumbnailPath:     video.ThumbnailPath,
-			MP4Path:           video.Mp4Path,
-			Tags:              tags,
+			ID:                 video.ID,
+			UserID:             video.UserID,
+			Title:              video.Title,
+			Description:        video.Description,
+			Duration:           video.Duration,
+			Width:              video.Width,
+			Height:             video.Height,
+			Format:             video.Format,
+			Bitrate:            video.Bitrate,
+			FileSize:           video.FileSize,
+			Checksum:           video.Checksum,
+			CreatedAt:          video.CreatedAt,
+			Codec:              video.Codec,
+			FrameRate:          video.FrameRate,
+			AspectRatio:        video.AspectRatio,
+			AudioCodec:         video.AudioCodec,
+			AudioBitrate:       video.AudioBitrate,
+			AudioChannels:      video.AudioChannels,
+			AudioLanguages:     parseAudioLanguages(video.AudioLanguages),
+			ContentType:        video.ContentType,
+			OriginalFilename:   video.OriginalFilename,
+			FileExtension:      video.FileExtension,
+			SanitizedFilename:  video.SanitizedFilename,
+			Views:              video.Views,
+			Status:             video.Status,
+			MinioPath:          video.MinioPath,
+			HLSPath:            video.HlsPath,
+			ThumbnailPath:      video.ThumbnailPath,
+			MP4Path:            video.Mp4Path,
+			Tags:               tags,
+			DuplicateOf:        video.DuplicateOf,
+			Visibility:         video.Visibility,
+			PublishAt:          video.PublishAt,
+			PublishedAt:        video.PublishedAt,
+			LoudnessIntegrated: video.LoudnessIntegrated,
+			LoudnessTruePeak:   video.LoudnessTruePeak,
+			LoudnessRange:      video.LoudnessRange,
+			LoudnessThreshold:  video.LoudnessThreshold,
+			LoudnessTarget:     video.LoudnessTarget,
 		}
 	}
 	return result, nil
@@ -316,6 +490,57 @@ func (s *MetadataService) UpdateVideoFromTranscodingComplete(ctx context.Context
 		ThumbnailPath: sql.NullString{String: event.ThumbnailPath, Valid: event.ThumbnailPath != ""},
 		Mp4Path:       sql.NullString{String: event.MP4Path, Valid: event.MP4Path != ""},
 	}
+	if loudness := event.Loudness; loudness != nil {
+		params.LoudnessIntegrated = sql.NullFloat64{Float64: loudness.IntegratedLUFS, Valid: true}
+		params.LoudnessTruePeak = sql.NullFloat64{Float64: loudness.TruePeakDBTP, Valid: true}
+		params.LoudnessRange = sql.NullFloat64{Float64: loudness.RangeLU, Valid: true}
+		params.LoudnessThreshold = sql.NullFloat64{Float64: loudness.ThresholdLUFS, Valid: true}
+		params.LoudnessTarget = sql.NullFloat64{Float64: loudness.TargetLUFS, Valid: true}
+	}
+
+	// Duplicates get the thumbnail from transcoding, never one the owner of the original picked
+	thumbnailPath := params.ThumbnailPath
+
+	// Keep a thumbnail the owner picked while the video was still processing
+	if video, err := s.store.GetVideo(ctx, event.VideoID); err == nil && s.hasThumbnailSet(video.ThumbnailPath) {
+		params.ThumbnailPath = video.ThumbnailPath
+	}
+
+	if err := s.store.UpdateVideoTranscodingComplete(ctx, params); err != nil {
+		return err
+	}
+
+	// Duplicates uploaded while the original was still processing share its assets. Duplicates
+	// that are ready already and thumbnails their owners picked are left alone.
+	duplicateOf := sql.NullString{String: event.VideoID, Valid: true}
+	if thumbnailPath.Valid {
+		if err := s.store.UpdateDuplicatesThumbnail(ctx, sqlc.UpdateDuplicatesThumbnailParams{
+			ThumbnailPath: thumbnailPath,
+			DuplicateOf:   duplicateOf,
+		}); err != nil {
+			return err
+		}
+	}
+	return s.store.UpdateDuplicatesTranscodingComplete(ctx, sqlc.UpdateDuplicatesTranscodingCompleteParams{
+		Status:             params.Status,
+		HlsPath:            params.HlsPath,
+		Mp4Path:            params.Mp4Path,
+		LoudnessIntegrated: params.LoudnessIntegrated,
+		LoudnessTruePeak:   params.LoudnessTruePeak,
+		LoudnessRange:      params.LoudnessRange,
+		LoudnessThreshold:  params.LoudnessThreshold,
+		LoudnessTarget:     params.LoudnessTarget,
+		DuplicateOf:        duplicateOf,
+	})
+}
+
+// UpdateVideoFromTranscodingFailed marks a video that could not be transcoded as failed. Videos
+// that already finished processing keep their status.
+func (s *MetadataService) UpdateVideoFromTranscodingFailed(ctx context.Context, event *types.TranscodingFailedEvent) error {
+	if err := s.store.UpdateVideoTranscodingFailed(ctx, event.VideoID); err != nil {
+		return err
+	}
 
-	return s.store.UpdateVideoTranscodingComplete(ctx, params)
+	// Duplicates uploaded while the original was still processing were waiting for its assets
+	return s.store.UpdateDuplicatesTranscodingFailed(ctx, sql.NullString{String: event.VideoID, Valid: true})
 }
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	sqlc "youtube-clone-platform/metadata-service/internal/db/sqlc"
+)
+
+// Video visibility. Uploads start as drafts, only public videos are listed to other users.
+const (
+	VisibilityDraft     = "draft"
+	VisibilityScheduled = "scheduled"
+	VisibilityPublic    = "public"
+)
+
+const maxTitleLength = 100
+
+var (
+	ErrNotOwner     = errors.New("video belongs to another user")
+	ErrInvalidTitle = errors.New("title must be 1 to 100 characters")
+)
+
+// VideoUpdate holds the details an owner can edit. Nil fields are left unchanged.
+type VideoUpdate struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+// UpdateVideoDetails updates the title, description and tags of a video owned by userID
+func (s *MetadataService) UpdateVideoDetails(ctx context.Context, id string, userID string, update VideoUpdate) (*VideoMetadata, error) {
+	video, err := s.ownedVideo(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" || len(title) > maxTitleLength {
+			return nil, ErrInvalidTitle
+		}
+		video.Title = title
+	}
+	if update.Description != nil {
+		video.Description = sql.NullString{String: *update.Description, Valid: *update.Description != ""}
+	}
+	if update.Tags != nil {
+		video.Tags = normalizeTags(*update.Tags)
+	}
+
+	tagsJSON, err := json.Marshal(video.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	if err := s.store.UpdateVideoDetails(ctx, sqlc.UpdateVideoDetailsParams{
+		Title:       video.Title,
+		Description: video.Description,
+		Tags:        sql.NullString{String: string(tagsJSON), Valid: true},
+		ID:          video.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update video details: %w", err)
+	}
+
+	return video, nil
+}
+
+// PublishVideo publishes a video owned by userID. Without publishAt, or with a time that has
+// already passed, the video is published right away, otherwise it is scheduled.
+func (s *MetadataService) PublishVideo(ctx context.Context, id string, userID string, publishAt *time.Time) (*VideoMetadata, error) {
+	video, err := s.ownedVideo(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if publishAt == nil || !publishAt.After(now) {
+		// Keep the original publication time of videos that are already public
+		if video.Visibility == VisibilityPublic {
+			return video, nil
+		}
+
+		publishedAt := sql.NullTime{Time: now, Valid: true}
+		if err := s.store.PublishVideo(ctx, sqlc.PublishVideoParams{
+			PublishedAt: publishedAt,
+			ID:          video.ID,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to publish video: %w", err)
+		}
+
+		video.Visibility = VisibilityPublic
+		video.PublishAt = sql.NullTime{}
+		video.PublishedAt = publishedAt
+		return video, nil
+	}
+
+	scheduledAt := sql.NullTime{Time: publishAt.UTC(), Valid: true}
+	if err := s.store.ScheduleVideo(ctx, sqlc.ScheduleVideoParams{
+		PublishAt: scheduledAt,
+		ID:        video.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to schedule video: %w", err)
+	}
+
+	video.Visibility = VisibilityScheduled
+	video.PublishAt = scheduledAt
+	return video, nil
+}
+
+// PublishScheduledVideos makes all videos whose publish time has come public
+func (s *MetadataService) PublishScheduledVideos(ctx context.Context, now time.Time) (int64, error) {
+	published, err := s.store.PublishScheduledVideos(ctx, sql.NullTime{Time: now.UTC(), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish scheduled videos: %w", err)
+	}
+	return published, nil
+}
+
+// RunPublishScheduler publishes scheduled videos every interval until the context is canceled
+func (s *MetadataService) RunPublishScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := s.PublishScheduledVideos(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error publishing scheduled videos: %v", err)
+		} else if published > 0 {
+			log.Printf("Published %d scheduled videos", published)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ownedVideo returns a video if it belongs to userID
+func (s *MetadataService) ownedVideo(ctx context.Context, id string, userID string) (*VideoMetadata, error) {
+	video, err := s.GetVideoMetadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if video.UserID != userID {
+		return nil, ErrNotOwner
+	}
+	return video, nil
+}
+
+// GetVisibleVideo returns a video viewerID may see. Videos that are not public are only visible to
+// their owner, other viewers get sql.ErrNoRows as if the video did not exist.
+func (s *MetadataService) GetVisibleVideo(ctx context.Context, id string, viewerID string) (*VideoMetadata, error) {
+	video, err := s.GetVideoMetadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if video.Visibility != VisibilityPublic && (viewerID == "" || video.UserID != viewerID) {
+		return nil, fmt.Errorf("video %s is not visible: %w", id, sql.ErrNoRows)
+	}
+	return video, nil
+}
+
+// normalizeTags trims tags and drops empty and repeated ones
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+	}
+	return result
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	sqlc "youtube-clone-platform/metadata-service/internal/db/sqlc"
+	"youtube-clone-platform/metadata-service/internal/thumbnails"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var ErrInvalidTimestamp = errors.New("timestamp must be within the video")
+
+// ThumbnailCandidate is a frame the thumbnail of a video was picked from during transcoding. Scores
+// are between 0 and 1, higher is better.
+type ThumbnailCandidate struct {
+	Path       string  `json:"path"`
+	Timestamp  float64 `json:"timestamp"`
+	Score      float64 `json:"score"`
+	Brightness float64 `json:"brightness"`
+	Contrast   float64 `json:"contrast"`
+	Sharpness  float64 `json:"sharpness"`
+}
+
+// Thumbnail is the current thumbnail set of a video
+type Thumbnail struct {
+	ThumbnailPath string            `json:"thumbnail_path"`
+	Sizes         map[string]string `json:"sizes"`
+}
+
+// UploadThumbnail replaces the thumbnail of a video owned by userID with a custom JPEG or PNG
+// image. The image is stored in every standard size.
+func (s *MetadataService) UploadThumbnail(ctx context.Context, videoID string, userID string, data []byte) (*Thumbnail, error) {
+	if _, err := s.ownedVideo(ctx, videoID, userID); err != nil {
+		return nil, err
+	}
+
+	img, err := thumbnails.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	version := thumbnails.NewVersion(time.Now())
+	for _, size := range thumbnails.Sizes {
+		jpegData, err := thumbnails.Render(img, size)
+		if err != nil {
+			return nil, err
+		}
+
+		objectName := thumbnails.ObjectName(s.assets.ThumbnailPrefix, videoID, version, size.Name)
+		_, err = s.minioClient.PutObject(ctx, s.assets.Bucket, objectName, bytes.NewReader(jpegData), int64(len(jpegData)), minio.PutObjectOptions{
+			ContentType: "image/jpeg",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+	}
+
+	return s.setThumbnail(ctx, videoID, thumbnails.ObjectName(s.assets.ThumbnailPrefix, videoID, version, thumbnails.DefaultSize))
+}
+
+// RegenerateThumbnail replaces the thumbnail of a video owned by userID with the frame at
+// timestamp seconds. The frame is extracted by the transcoder service.
+func (s *MetadataService) RegenerateThumbnail(ctx context.Context, videoID string, userID string, timestamp float64) (*Thumbnail, error) {
+	video, err := s.ownedVideo(ctx, videoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if timestamp < 0 || (video.Duration > 0 && timestamp >= video.Duration) {
+		return nil, fmt.Errorf("%w: %.3f is not between 0 and %.3f", ErrInvalidTimestamp, timestamp, video.Duration)
+	}
+
+	// Duplicates do not keep their own original file
+	sourceID := video.ID
+	if video.DuplicateOf.Valid && video.DuplicateOf.String != "" {
+		sourceID = video.DuplicateOf.String
+	}
+
+	thumbnailPath, err := s.thumbnails.GenerateFromFrame(ctx, thumbnails.FrameRequest{
+		VideoID:       video.ID,
+		SourceVideoID: sourceID,
+		FileExtension: video.FileExtension,
+		Timestamp:     timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.setThumbnail(ctx, videoID, thumbnailPath)
+}
+
+// ThumbnailCandidates returns the frames the transcoder service picked the thumbnail of a video owned
+// by userID from, best first. Videos transcoded before candidates were kept have none. The owner
+// chooses a candidate by regenerating the thumbnail at its timestamp.
+func (s *MetadataService) ThumbnailCandidates(ctx context.Context, videoID string, userID string) ([]ThumbnailCandidate, error) {
+	video, err := s.ownedVideo(ctx, videoID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Duplicates share the candidates of the original
+	sourceID := video.ID
+	if video.DuplicateOf.Valid && video.DuplicateOf.String != "" {
+		sourceID = video.DuplicateOf.String
+	}
+
+	objectName := thumbnails.CandidatesDir(s.assets.ThumbnailPrefix, sourceID) + thumbnails.CandidateManifest
+	object, err := s.minioClient.GetObject(ctx, s.assets.Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thumbnail candidates: %w", err)
+	}
+	defer object.Close()
+
+	candidates := []ThumbnailCandidate{}
+	if err := json.NewDecoder(object).Decode(&candidates); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return []ThumbnailCandidate{}, nil
+		}
+		return nil, fmt.Errorf("failed to read thumbnail candidates: %w", err)
+	}
+	return candidates, nil
+}
+
+// setThumbnail points a video at a new thumbnail set and removes the sets it replaces
+func (s *MetadataService) setThumbnail(ctx context.Context, videoID string, thumbnailPath string) (*Thumbnail, error) {
+	if err := s.store.UpdateThumbnailPath(ctx, sqlc.UpdateThumbnailPathParams{
+		ThumbnailPath: sql.NullString{String: thumbnailPath, Valid: true},
+		ID:            videoID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update thumbnail path: %w", err)
+	}
+
+	s.removeOldThumbnails(ctx, videoID, thumbnailPath)
+
+	return &Thumbnail{
+		ThumbnailPath: thumbnailPath,
+		Sizes:         thumbnails.SizePaths(thumbnailPath),
+	}, nil
+}
+
+// removeOldThumbnails deletes every thumbnail of a video that is not part of the current set. The
+// storyboard and the thumbnail candidates are kept. Failures are only logged, the streaming service
+// always serves the newest set.
+func (s *MetadataService) removeOldThumbnails(ctx context.Context, videoID string, thumbnailPath string) {
+	current := thumbnails.SizePaths(thumbnailPath)
+	keep := make(map[string]bool, len(current))
+	for _, objectName := range current {
+		keep[objectName] = true
+	}
+	storyboardDir := thumbnails.StoryboardDir(s.assets.ThumbnailPrefix, videoID)
+	candidatesDir := thumbnails.CandidatesDir(s.assets.ThumbnailPrefix, videoID)
+
+	objects := s.minioClient.ListObjects(ctx, s.assets.Bucket, minio.ListObjectsOptions{
+		Prefix:    thumbnails.Dir(s.assets.ThumbnailPrefix, videoID),
+		Recursive: true,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			log.Printf("Error listing thumbnails of video %s: %v", videoID, object.Err)
+			return
+		}
+		if keep[object.Key] || strings.HasPrefix(object.Key, storyboardDir) || strings.HasPrefix(object.Key, candidatesDir) {
+			continue
+		}
+		if err := s.minioClient.RemoveObject(ctx, s.assets.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Error removing old thumbnail %s: %v", object.Key, err)
+		}
+	}
+}
+
+// hasThumbnailSet reports whether a thumbnail path belongs to a custom or regenerated thumbnail set
+func (s *MetadataService) hasThumbnailSet(thumbnailPath sql.NullString) bool {
+	return thumbnailPath.Valid &&
+		strings.HasPrefix(thumbnailPath.String, s.assets.ThumbnailPrefix+"/") &&
+		strings.HasSuffix(thumbnailPath.String, "/"+thumbnails.DefaultSize+".jpg")
+}
@@ -0,0 +1,78 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrGeneratorFailed = errors.New("thumbnail generation failed")
+
+// FrameRequest asks for a thumbnail set taken from a frame of the original upload
+type FrameRequest struct {
+	VideoID string `json:"-"`
+	// SourceVideoID is the video whose original file is used, duplicates share the file of the original
+	SourceVideoID string  `json:"source_video_id"`
+	FileExtension string  `json:"file_extension"`
+	Timestamp     float64 `json:"timestamp"`
+}
+
+// Generator creates thumbnail sets from video frames
+type Generator interface {
+	// GenerateFromFrame stores a new thumbnail set and returns the object name of its default size
+	GenerateFromFrame(ctx context.Context, request FrameRequest) (string, error)
+}
+
+// TranscoderClient generates thumbnails through the transcoder service
+type TranscoderClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewTranscoderClient creates a client for the transcoder service at baseURL
+func NewTranscoderClient(baseURL string) *TranscoderClient {
+	return &TranscoderClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		// The original has to be downloaded before the frame can be extracted
+		client: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// GenerateFromFrame implements Generator
+func (c *TranscoderClient) GenerateFromFrame(ctx context.Context, request FrameRequest) (string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal thumbnail request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/transcoder/videos/%s/thumbnail", c.baseURL, url.PathEscape(request.VideoID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create thumbnail request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrGeneratorFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ThumbnailPath string `json:"thumbnail_path"`
+		Error         string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("%w: transcoder service returned %s", ErrGeneratorFailed, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s", ErrGeneratorFailed, result.Error)
+	}
+	return result.ThumbnailPath, nil
+}
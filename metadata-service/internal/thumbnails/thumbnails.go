@@ -0,0 +1,181 @@
+package thumbnails
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Size is a standard thumbnail size. Thumbnails are 16:9, images with another aspect ratio are
+// letterboxed.
+type Size struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// Sizes are the thumbnail sizes stored for every video
+var Sizes = []Size{
+	{Name: "small", Width: 320, Height: 180},
+	{Name: "medium", Width: 640, Height: 360},
+	{Name: "large", Width: 1280, Height: 720},
+}
+
+// DefaultSize is the size thumbnail_path points to
+const DefaultSize = "medium"
+
+const (
+	// MaxSize is the largest custom thumbnail accepted
+	MaxSize = 5 * 1024 * 1024 // 5MB
+	// Smallest and largest accepted image dimensions
+	minWidth     = 320
+	minHeight    = 180
+	maxDimension = 8192
+	jpegQuality  = 85
+)
+
+var (
+	ErrInvalidImage     = errors.New("invalid thumbnail image")
+	ErrUnsupportedImage = errors.New("unsupported thumbnail format, expected JPEG or PNG")
+)
+
+// Decode validates a custom thumbnail and decodes it. Only JPEG and PNG images between 320x180
+// and 8192x8192 pixels are accepted.
+func Decode(data []byte) (image.Image, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidImage, MaxSize)
+	}
+
+	// Check the header first so oversized images are rejected before they are decoded
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if format != "jpeg" && format != "png" {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width < minWidth || config.Height < minHeight {
+		return nil, fmt.Errorf("%w: image must be at least %dx%d pixels", ErrInvalidImage, minWidth, minHeight)
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return nil, fmt.Errorf("%w: image must be at most %dx%d pixels", ErrInvalidImage, maxDimension, maxDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return img, nil
+}
+
+// Render scales an image to fit a thumbnail size and encodes it as JPEG
+func Render(img image.Image, size Size) ([]byte, error) {
+	src := image.NewRGBA(img.Bounds())
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	// Fit the image into the thumbnail, keeping its aspect ratio
+	bounds := src.Bounds()
+	width, height := size.Width, bounds.Dy()*size.Width/bounds.Dx()
+	if height > size.Height {
+		width, height = bounds.Dx()*size.Height/bounds.Dy(), size.Height
+	}
+	width, height = max(width, 1), max(height, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size.Width, size.Height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	offset := image.Pt((size.Width-width)/2, (size.Height-height)/2)
+	scale(dst, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))}, src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scale draws src into the rectangle r of dst. Every destination pixel is the average of the
+// source pixels it covers, which keeps downscaled thumbnails free of aliasing.
+func scale(dst *image.RGBA, r image.Rectangle, src *image.RGBA) {
+	sb := src.Bounds()
+	for y := 0; y < r.Dy(); y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/r.Dy()
+		y1 := max(sb.Min.Y+(y+1)*sb.Dy()/r.Dy(), y0+1)
+		for x := 0; x < r.Dx(); x++ {
+			x0 := sb.Min.X + x*sb.Dx()/r.Dx()
+			x1 := max(sb.Min.X+(x+1)*sb.Dx()/r.Dx(), x0+1)
+
+			var red, green, blue, alpha, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+					red += uint32(src.Pix[i])
+					green += uint32(src.Pix[i+1])
+					blue += uint32(src.Pix[i+2])
+					alpha += uint32(src.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(r.Min.X+x, r.Min.Y+y)
+			dst.Pix[i] = uint8(red / n)
+			dst.Pix[i+1] = uint8(green / n)
+			dst.Pix[i+2] = uint8(blue / n)
+			dst.Pix[i+3] = uint8(alpha / n)
+		}
+	}
+}
+
+// NewVersion returns the version of a thumbnail set created at t. Versions sort by creation time,
+// so a replaced thumbnail never shares an object name, and therefore a cached URL, with the old one.
+func NewVersion(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// Dir returns the prefix all thumbnail versions of a video are stored under
+func Dir(prefix string, videoID string) string {
+	return path.Join(prefix, videoID) + "/"
+}
+
+// StoryboardDir returns the prefix the transcoder service stores the seek preview storyboard of a
+// video under, next to its thumbnail versions
+func StoryboardDir(prefix string, videoID string) string {
+	return path.Join(prefix, videoID, "storyboard") + "/"
+}
+
+// CandidatesDir returns the prefix the transcoder service stores the thumbnail candidates of a
+// video under, with a CandidateManifest listing them
+func CandidatesDir(prefix string, videoID string) string {
+	return path.Join(prefix, videoID, "candidates") + "/"
+}
+
+// CandidateManifest is the name of the JSON list of thumbnail candidates
+const CandidateManifest = "candidates.json"
+
+// ObjectName returns where a thumbnail size of a version is stored
+func ObjectName(prefix string, videoID string, version string, size string) string {
+	return path.Join(prefix, videoID, version, size+".jpg")
+}
+
+// SizePaths returns the object names of all sizes of the thumbnail set thumbnailPath belongs to.
+// Thumbnails created before sizes existed are returned as the default size.
+func SizePaths(thumbnailPath string) map[string]string {
+	paths := make(map[string]string, len(Sizes))
+	if !strings.HasSuffix(thumbnailPath, "/"+DefaultSize+".jpg") {
+		paths[DefaultSize] = thumbnailPath
+		return paths
+	}
+	dir := path.Dir(thumbnailPath)
+	for _, size := range Sizes {
+		paths[size.Name] = path.Join(dir, size.Name+".jpg")
+	}
+	return paths
+}
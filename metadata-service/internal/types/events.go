@@ -9,6 +9,7 @@ type VideoUploadEvent struct {
 	Size        int64         `json:"size"`
 	Metadata    VideoMetadata `json:"metadata"`
 	UploadedAt  string        `json:"uploaded_at"`
+	DuplicateOf string        `json:"duplicate_of,omitempty"`
 }
 
 // VideoMetadata represents the metadata extracted from a video file
@@ -31,6 +32,18 @@ type VideoMetadata struct {
 	OriginalFilename  string  `json:"original_filename"`
 	FileExtension     string  `json:"file_extension"`
 	SanitizedFilename string  `json:"sanitized_filename"`
+	// AudioTracks are all audio streams of the video, in the order of the streams
+	AudioTracks []AudioTrack `json:"audio_tracks,omitempty"`
+}
+
+// AudioTrack is an audio stream of a video, like a dubbed language or a commentary track
+type AudioTrack struct {
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	// Language is the language tag of the stream, usually ISO 639-2 like eng, empty if it is not tagged
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
 }
 
 // TranscodingCompleteEvent represents a transcoding completion event from the transcoder service
@@ -43,4 +56,35 @@ type TranscodingCompleteEvent struct {
 	ThumbnailPath string `json:"thumbnail_path"`
 	Status        string `json:"status"`
 	CompletedAt   string `json:"completed_at"`
+	// Loudness is the loudness of the audio before it was normalized, nil if it was not
+	Loudness *Loudness `json:"loudness,omitempty"`
+}
+
+// Loudness is the EBU R128 loudness of the audio of a video and the integrated loudness it was
+// normalized to
+type Loudness struct {
+	IntegratedLUFS float64 `json:"integrated_lufs"`
+	TruePeakDBTP   float64 `json:"true_peak_dbtp"`
+	RangeLU        float64 `json:"range_lu"`
+	ThresholdLUFS  float64 `json:"threshold_lufs"`
+	TargetLUFS     float64 `json:"target_lufs"`
+}
+
+// TranscodingFailedEvent represents a transcoding failure event from the transcoder service. It is
+// only sent once a video ran out of retries or cannot be transcoded at all.
+type TranscodingFailedEvent struct {
+	JobID      string `json:"job_id"`
+	VideoID    string `json:"video_id"`
+	UserID     string `json:"user_id"`
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+	Attempts   int    `json:"attempts"`
+	FailedAt   string `json:"failed_at"`
+}
+
+// VideoDeletedEvent is published when a video is deleted, the upload service releases its quota
+type VideoDeletedEvent struct {
+	VideoID   string `json:"video_id"`
+	UserID    string `json:"user_id"`
+	DeletedAt string `json:"deleted_at"`
 }
@@ -35,6 +35,7 @@ func main() {
 		HLSPrefix:       cfg.MinIO.HLSPrefix,
 		MP4Prefix:       cfg.MinIO.MP4Prefix,
 		ThumbnailPrefix: cfg.MinIO.ThumbnailPrefix,
+		PreviewPrefix:   cfg.MinIO.PreviewPrefix,
 		URLExpiry:       cfg.MinIO.URLExpiry,
 	})
 	if err != nil {
@@ -85,11 +86,18 @@ func main() {
 		api.GET("/health", healthHandler.HandleHealthCheck)
 		api.GET("/videos/:videoID/hls/manifest", streamHandler.HandleHLSManifest)
 		api.GET("/videos/:videoID/hls/segments/:segment", streamHandler.HandleHLSSegment)
+		api.GET("/videos/:videoID/hls/subtitles/:lang/playlist", streamHandler.HandleSubtitlePlaylist)
 		api.GET("/videos/:videoID/hls/:resolution/playlist", streamHandler.HandleHLSPlaylist)
 		api.GET("/videos/:videoID/hls/:resolution/:segment", streamHandler.HandleHLSSegment)
+		// DASH shares the CMAF segments of the HLS renditions
+		api.GET("/videos/:videoID/dash/manifest.mpd", streamHandler.HandleDASHManifest)
+		api.GET("/videos/:videoID/dash/:resolution/:segment", streamHandler.HandleHLSSegment)
 		api.GET("/videos/:videoID/mp4", streamHandler.HandleMP4)
 		api.GET("/videos/:videoID/mp4/qualities", streamHandler.ListMP4Qualities)
 		api.GET("/videos/:videoID/thumbnail", streamHandler.HandleThumbnail)
+		api.GET("/videos/:videoID/storyboard.vtt", streamHandler.HandleStoryboard)
+		api.GET("/videos/:videoID/preview", streamHandler.HandlePreview)
+		api.GET("/videos/:videoID/captions/:lang", streamHandler.HandleCaptions)
 		api.POST("/videos/:videoID/views", streamHandler.HandleRecordView) // Add view counting endpoint
 
 		// Also serve static files under /api/v1/streaming
@@ -22,6 +22,7 @@ type MinIOConfig struct {
 	HLSPrefix       string
 	MP4Prefix       string
 	ThumbnailPrefix string
+	PreviewPrefix   string
 	URLExpiry       int // URL expiry time in seconds
 }
 
@@ -44,6 +45,9 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	// Deployments from before hover previews do not set the preview prefix
+	viper.SetDefault("MINIO_PREVIEW_PREFIX", "previews")
+
 	return &Config{
 		ServerPort: viper.GetString("SERVER_PORT"),
 		MinIO: MinIOConfig{
@@ -55,6 +59,7 @@ func LoadConfig() (*Config, error) {
 			HLSPrefix:       viper.GetString("MINIO_HLS_PREFIX"),
 			MP4Prefix:       viper.GetString("MINIO_MP4_PREFIX"),
 			ThumbnailPrefix: viper.GetString("MINIO_THUMBNAIL_PREFIX"),
+			PreviewPrefix:   viper.GetString("MINIO_PREVIEW_PREFIX"),
 			URLExpiry:       viper.GetInt("MINIO_URL_EXPIRY"),
 		},
 		Logging: LoggingConfig{
@@ -25,7 +25,8 @@ func NewStreamHandler(storage storage.Storage, viewProducer events.Producer) *St
 	}
 }
 
-// HandleHLSManifest handles requests for HLS manifest files
+// HandleHLSManifest handles requests for HLS manifest files. The codecs query parameter lists the
+// codec families the client can play, like "avc1,hvc1", variants of other codecs are left out.
 func (h *StreamHandler) HandleHLSManifest(c *gin.Context) {
 	videoID := c.Param("videoID")
 	if videoID == "" {
@@ -45,12 +46,40 @@ func (h *StreamHandler) HandleHLSManifest(c *gin.Context) {
 		return
 	}
 
+	if codecs := c.Query("codecs"); codecs != "" {
+		manifest, err = storage.FilterVariants(manifest, storage.ParseCodecFamilies(codecs))
+		if err != nil {
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": "no variant has the supported codecs"})
+			return
+		}
+	}
+
 	c.Header("Content-Type", "application/vnd.apple.mpegurl")
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Cache-Control", "max-age=300") // Cache for 5 minutes
 	c.String(http.StatusOK, manifest)
 }
 
+// HandleDASHManifest handles requests for the DASH manifest of videos packaged as CMAF
+func (h *StreamHandler) HandleDASHManifest(c *gin.Context) {
+	videoID := c.Param("videoID")
+	if videoID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video ID is required"})
+		return
+	}
+
+	manifest, err := h.storage.GetDASHManifest(c.Request.Context(), videoID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DASH manifest not found"})
+		return
+	}
+
+	c.Header("Content-Type", "application/dash+xml")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Cache-Control", "max-age=300") // Cache for 5 minutes
+	c.String(http.StatusOK, manifest)
+}
+
 // HandleHLSSegment handles requests for HLS segment files
 func (h *StreamHandler) HandleHLSSegment(c *gin.Context) {
 	videoID := c.Param("videoID")
@@ -102,8 +131,9 @@ func (h *StreamHandler) HandleHLSPlaylist(c *gin.Context) {
 		return
 	}
 
-	// Try to get the playlist content directly
-	objectName := minioStorage.GetHLSObjectPath(videoID, playlistPath)
+	// Try to get the playlist content directly, duplicates share the playlists of their source
+	assetID := minioStorage.AssetID(c.Request.Context(), videoID)
+	objectName := minioStorage.GetHLSObjectPath(assetID, playlistPath)
 	fmt.Printf("HandleHLSPlaylist: Checking for playlist at path: %s\n", objectName)
 
 	content, err := minioStorage.GetObjectContent(c.Request.Context(), objectName)
@@ -122,7 +152,7 @@ func (h *StreamHandler) HandleHLSPlaylist(c *gin.Context) {
 	}
 
 	// Process the playlist to update segment URLs
-	processedContent, err := minioStorage.ProcessM3U8(content, videoID, resolution)
+	processedContent, err := minioStorage.ProcessM3U8(content, assetID, resolution)
 	if err != nil {
 		fmt.Printf("HandleHLSPlaylist: Error processing M3U8: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process playlist"})
@@ -136,6 +166,46 @@ func (h *StreamHandler) HandleHLSPlaylist(c *gin.Context) {
 	c.String(http.StatusOK, processedContent)
 }
 
+// HandleSubtitlePlaylist handles requests for the HLS playlist of a caption track
+func (h *StreamHandler) HandleSubtitlePlaylist(c *gin.Context) {
+	videoID := c.Param("videoID")
+	language := c.Param("lang")
+	if videoID == "" || !storage.ValidLanguage(language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video ID and a valid language are required"})
+		return
+	}
+
+	playlist, err := h.storage.GetSubtitlePlaylist(c.Request.Context(), videoID, language)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "subtitles not found"})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Cache-Control", "max-age=300") // Cache for 5 minutes
+	c.String(http.StatusOK, playlist)
+}
+
+// HandleCaptions handles requests for the WebVTT file of a caption track
+func (h *StreamHandler) HandleCaptions(c *gin.Context) {
+	videoID := c.Param("videoID")
+	language := c.Param("lang")
+	if videoID == "" || !storage.ValidLanguage(language) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video ID and a valid language are required"})
+		return
+	}
+
+	url, err := h.storage.GetSubtitleURL(c.Request.Context(), videoID, language)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "subtitles not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "max-age=300") // Captions can be replaced by the owner
+	c.Redirect(http.StatusTemporaryRedirect, url)
+}
+
 // HandleMP4 handles requests for MP4 video files
 func (h *StreamHandler) HandleMP4(c *gin.Context) {
 	videoID := c.Param("videoID")
@@ -174,14 +244,65 @@ func (h *StreamHandler) HandleThumbnail(c *gin.Context) {
 		return
 	}
 
-	url, err := h.storage.GetThumbnailURL(c.Request.Context(), videoID)
+	size := c.DefaultQuery("size", storage.DefaultThumbnailSize)
+	if !storage.ValidThumbnailSize(size) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be small, medium or large"})
+		return
+	}
+
+	url, err := h.storage.GetThumbnailURL(c.Request.Context(), videoID, size)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get thumbnail URL"})
 		return
 	}
 
-	// Set appropriate cache headers for thumbnails
-	c.Header("Cache-Control", "max-age=86400") // Cache for one day
+	// Owners can replace the thumbnail, only the versioned object it redirects to is immutable
+	c.Header("Cache-Control", "max-age=300") // Cache for 5 minutes
+	c.Redirect(http.StatusTemporaryRedirect, url)
+}
+
+// HandleStoryboard handles requests for the WebVTT file of the seek preview sprite sheets
+func (h *StreamHandler) HandleStoryboard(c *gin.Context) {
+	videoID := c.Param("videoID")
+	if videoID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video ID is required"})
+		return
+	}
+
+	storyboard, err := h.storage.GetStoryboard(c.Request.Context(), videoID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "storyboard not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/vtt; charset=utf-8")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Cache-Control", "max-age=300") // The sprite sheet URLs are signed
+	c.String(http.StatusOK, storyboard)
+}
+
+// HandlePreview handles requests for the silent looping preview shown when a video is hovered.
+// The format query parameter picks the animated WebP or the muted MP4.
+func (h *StreamHandler) HandlePreview(c *gin.Context) {
+	videoID := c.Param("videoID")
+	if videoID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video ID is required"})
+		return
+	}
+
+	format := c.DefaultQuery("format", storage.DefaultPreviewFormat)
+	if !storage.ValidPreviewFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be webp or mp4"})
+		return
+	}
+
+	url, err := h.storage.GetPreviewURL(c.Request.Context(), videoID, format)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "preview not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "max-age=300") // The URL it redirects to is signed
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
@@ -204,9 +325,10 @@ func (h *StreamHandler) ListMP4Qualities(c *gin.Context) {
 	standardQualities := []string{"1080p", "720p", "480p", "360p", "240p"}
 	availableQualities := []string{}
 
-	// Check each quality
+	// Check each quality, duplicates share the MP4 files of their source
+	assetID := minioStorage.AssetID(c.Request.Context(), videoID)
 	for _, quality := range standardQualities {
-		objectName := path.Join(minioStorage.GetMP4Prefix(), videoID, "mp4", quality+".mp4")
+		objectName := path.Join(minioStorage.GetMP4Prefix(), assetID, "mp4", quality+".mp4")
 		exists, err := minioStorage.ObjectExists(c.Request.Context(), objectName)
 		if err == nil && exists {
 			availableQualities = append(availableQualities, quality)
@@ -214,7 +336,7 @@ func (h *StreamHandler) ListMP4Qualities(c *gin.Context) {
 	}
 
 	// Also check for generic video.mp4
-	genericObjectName := path.Join(minioStorage.GetMP4Prefix(), videoID, "mp4", "video.mp4")
+	genericObjectName := path.Join(minioStorage.GetMP4Prefix(), assetID, "mp4", "video.mp4")
 	genericExists, _ := minioStorage.ObjectExists(c.Request.Context(), genericObjectName)
 	if genericExists {
 		availableQualities = append(availableQualities, "default")
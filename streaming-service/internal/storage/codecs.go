@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrNoSupportedVariants is returned when no variant of a master playlist has supported codecs
+var ErrNoSupportedVariants = errors.New("no variant has supported codecs")
+
+// videoCodecFamilies are the codec string prefixes of the video codecs variants are encoded with.
+// Other codecs, like the AAC audio, are not filtered.
+var videoCodecFamilies = []string{"avc1", "avc3", "hvc1", "hev1", "vp09", "av01"}
+
+var codecsRegex = regexp.MustCompile(`CODECS="([^"]*)"`)
+
+// ParseCodecFamilies parses a comma separated list of codec families like "avc1,hvc1" or codec
+// strings like "avc1.640028", only the family of codec strings is kept
+func ParseCodecFamilies(list string) []string {
+	var families []string
+	for _, codec := range strings.Split(list, ",") {
+		family, _, _ := strings.Cut(strings.TrimSpace(codec), ".")
+		if family != "" {
+			families = append(families, strings.ToLower(family))
+		}
+	}
+	return families
+}
+
+// FilterVariants removes the variants of a master playlist whose video codec is not in the given
+// codec families. Variants without a CODECS attribute and audio-only variants are kept.
+// ErrNoSupportedVariants is returned if no variant with video is left.
+func FilterVariants(manifest string, families []string) (string, error) {
+	lines := strings.Split(manifest, "\n")
+	filtered := make([]string, 0, len(lines))
+	variants, kept := 0, 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			filtered = append(filtered, line)
+			continue
+		}
+
+		// Audio-only variants are a fallback, they cannot stand in for the video
+		audioOnly := audioOnlyVariant(line)
+		if !audioOnly {
+			variants++
+		}
+		if supportedVariant(line, families) {
+			if !audioOnly {
+				kept++
+			}
+			filtered = append(filtered, line)
+			continue
+		}
+		// Skip the URI of the variant
+		if i+1 < len(lines) && !strings.HasPrefix(lines[i+1], "#") {
+			i++
+		}
+	}
+
+	if variants > 0 && kept == 0 {
+		return "", ErrNoSupportedVariants
+	}
+	return strings.Join(filtered, "\n"), nil
+}
+
+// supportedVariant reports whether every video codec of a variant is in the codec families
+func supportedVariant(streamInf string, families []string) bool {
+	match := codecsRegex.FindStringSubmatch(streamInf)
+	if match == nil {
+		return true
+	}
+	for _, codec := range strings.Split(match[1], ",") {
+		family, _, _ := strings.Cut(strings.TrimSpace(codec), ".")
+		family = strings.ToLower(family)
+		if slices.Contains(videoCodecFamilies, family) && !slices.Contains(families, family) {
+			return false
+		}
+	}
+	return true
+}
+
+// audioOnlyVariant reports whether a variant lists its codecs and none of them is a video codec
+func audioOnlyVariant(streamInf string) bool {
+	match := codecsRegex.FindStringSubmatch(streamInf)
+	if match == nil {
+		return false
+	}
+	for _, codec := range strings.Split(match[1], ",") {
+		family, _, _ := strings.Cut(strings.TrimSpace(codec), ".")
+		if slices.Contains(videoCodecFamilies, strings.ToLower(family)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// duplicateMarker is the object the metadata service writes next to the HLS output of a duplicate
+// upload. It names the video whose transcoded assets the duplicate shares.
+const duplicateMarker = "duplicate_of"
+
+// maxDuplicateHops limits how many markers are followed, a duplicate may be linked to another one
+// whose source was not known yet
+const maxDuplicateHops = 3
+
+// AssetID returns the ID the transcoded assets of a video are stored under, the ID of its source
+// for duplicate uploads and the video ID otherwise. Captions and custom thumbnails always belong to
+// the video itself.
+func (s *MinIOStorage) AssetID(ctx context.Context, videoID string) string {
+	if id, ok := s.assetIDs.Load(videoID); ok {
+		return id.(string)
+	}
+
+	id := videoID
+	for i := 0; i < maxDuplicateHops; i++ {
+		content, err := s.GetObjectContent(ctx, path.Join(s.hlsPrefix, id, duplicateMarker))
+		if err != nil {
+			if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+				fmt.Printf("Failed to read duplicate marker of video %s: %v\n", id, err)
+			}
+			break
+		}
+		source := strings.TrimSpace(content)
+		if source == "" || source == id {
+			break
+		}
+		id = source
+	}
+
+	// A video never stops being a duplicate, only links are remembered
+	if id != videoID {
+		s.assetIDs.Store(videoID, id)
+	}
+	return id
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/minio-go/v7"
@@ -21,8 +22,12 @@ type MinIOStorage struct {
 	hlsPrefix       string
 	mp4Prefix       string
 	thumbnailPrefix string
+	previewPrefix   string
 	urlExpiry       time.Duration
 	baseURL         string // Base URL for playlist links
+
+	// assetIDs caches the sources of duplicate uploads by video ID
+	assetIDs sync.Map
 }
 
 // MinIOConfig holds the configuration for MinIO
@@ -35,6 +40,7 @@ type MinIOConfig struct {
 	HLSPrefix       string
 	MP4Prefix       string
 	ThumbnailPrefix string
+	PreviewPrefix   string
 	URLExpiry       int
 	BaseURL         string // Base URL to use instead of localhost when specified
 }
@@ -65,6 +71,7 @@ func NewMinIOStorage(cfg *MinIOConfig) (*MinIOStorage, error) {
 		hlsPrefix:       cfg.HLSPrefix,
 		mp4Prefix:       cfg.MP4Prefix,
 		thumbnailPrefix: cfg.ThumbnailPrefix,
+		previewPrefix:   cfg.PreviewPrefix,
 		urlExpiry:       time.Duration(cfg.URLExpiry) * time.Second,
 		baseURL:         baseURL,
 	}, nil
@@ -74,9 +81,10 @@ func NewMinIOStorage(cfg *MinIOConfig) (*MinIOStorage, error) {
 func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (string, error) {
 	fmt.Printf("Looking for HLS manifest for video ID: %s\n", videoID)
 	fmt.Printf("Checking HLS manifests in bucket: %s with prefix: %s\n", s.bucketName, s.hlsPrefix)
+	assetID := s.AssetID(ctx, videoID)
 
 	// First check if master playlist exists
-	masterPath := path.Join(s.hlsPrefix, videoID, "master.m3u8")
+	masterPath := path.Join(s.hlsPrefix, assetID, "master.m3u8")
 	masterExists, err := s.objectExists(ctx, masterPath)
 	if err == nil && masterExists {
 		fmt.Printf("Found existing master.m3u8 for video %s\n", videoID)
@@ -85,7 +93,7 @@ func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (stri
 			return "", err
 		}
 		// Return the master playlist as is - it should already have the proper URLs
-		return content, nil
+		return s.withSubtitles(ctx, videoID, content), nil
 	}
 
 	// If no master playlist exists, we'll generate one based on available resolution playlists
@@ -96,7 +104,7 @@ func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (stri
 
 	fmt.Printf("No master.m3u8 found, checking for resolution-specific playlists for video %s\n", videoID)
 	for _, res := range resolutions {
-		playlistPath := path.Join(s.hlsPrefix, videoID, res, "playlist.m3u8")
+		playlistPath := path.Join(s.hlsPrefix, assetID, res, "playlist.m3u8")
 		exists, err := s.objectExists(ctx, playlistPath)
 		if err == nil && exists {
 			fmt.Printf("Found %s/playlist.m3u8 for video %s\n", res, videoID)
@@ -112,8 +120,8 @@ func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (stri
 	if len(availableResolutions) == 0 {
 		// No resolution-specific playlists found, fall back to looking for a single playlist
 		fallbackPaths := []string{
-			path.Join(s.hlsPrefix, videoID, "playlist.m3u8"),
-			path.Join(s.hlsPrefix, videoID, "index.m3u8"),
+			path.Join(s.hlsPrefix, assetID, "playlist.m3u8"),
+			path.Join(s.hlsPrefix, assetID, "index.m3u8"),
 		}
 
 		fmt.Printf("No resolution playlists found, checking for fallback playlists for video %s\n", videoID)
@@ -164,7 +172,7 @@ func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (stri
 
 		// Generate a presigned URL for the playlist
 		playlistPath := path.Join(res, "playlist.m3u8")
-		playlistURL, err := s.GeneratePresignedURL(ctx, s.GetHLSObjectPath(videoID, playlistPath), s.urlExpiry)
+		playlistURL, err := s.GeneratePresignedURL(ctx, s.GetHLSObjectPath(assetID, playlistPath), s.urlExpiry)
 		if err != nil {
 			return "", fmt.Errorf("failed to generate signed URL for playlist: %w", err)
 		}
@@ -175,15 +183,30 @@ func (s *MinIOStorage) GetHLSManifest(ctx context.Context, videoID string) (stri
 	fmt.Printf("Generated master manifest for video %s with %d resolutions:\n%s\n",
 		videoID, len(availableResolutions), generatedManifest)
 
-	return generatedManifest, nil
+	return s.withSubtitles(ctx, videoID, generatedManifest), nil
+}
+
+// GetDASHManifest returns the DASH manifest (.mpd) of a video packaged as CMAF. Its segment URLs
+// are relative and resolve to the DASH segment endpoint.
+func (s *MinIOStorage) GetDASHManifest(ctx context.Context, videoID string) (string, error) {
+	manifestPath := path.Join(s.hlsPrefix, s.AssetID(ctx, videoID), "manifest.mpd")
+	exists, err := s.objectExists(ctx, manifestPath)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("no DASH manifest found for video ID %s", videoID)
+	}
+	return s.GetObjectContent(ctx, manifestPath)
 }
 
-// GetHLSSegment returns a signed URL for an HLS segment (.ts)
+// GetHLSSegment returns a signed URL for an HLS segment (.ts or .m4s)
 func (s *MinIOStorage) GetHLSSegment(ctx context.Context, videoID string, segmentName string) (string, error) {
 	fmt.Printf("Getting HLS segment for video %s, segment %s\n", videoID, segmentName)
+	assetID := s.AssetID(ctx, videoID)
 
 	// First try the direct path (no resolution subfolder)
-	directObjectName := path.Join(s.hlsPrefix, videoID, segmentName)
+	directObjectName := path.Join(s.hlsPrefix, assetID, segmentName)
 	directExists, err := s.objectExists(ctx, directObjectName)
 	if err == nil && directExists {
 		fmt.Printf("Found segment at direct path: %s\n", directObjectName)
@@ -197,10 +220,10 @@ func (s *MinIOStorage) GetHLSSegment(ctx context.Context, videoID string, segmen
 		var nestedObjectName string
 		if strings.HasPrefix(segmentName, resolution+"/") {
 			// If segmentName already includes resolution, use it as is
-			nestedObjectName = path.Join(s.hlsPrefix, videoID, segmentName)
+			nestedObjectName = path.Join(s.hlsPrefix, assetID, segmentName)
 		} else {
 			// Otherwise, add resolution prefix
-			nestedObjectName = path.Join(s.hlsPrefix, videoID, resolution, segmentName)
+			nestedObjectName = path.Join(s.hlsPrefix, assetID, resolution, segmentName)
 		}
 
 		fmt.Printf("Checking segment at path: %s\n", nestedObjectName)
@@ -220,11 +243,12 @@ func (s *MinIOStorage) GetHLSSegment(ctx context.Context, videoID string, segmen
 func (s *MinIOStorage) GetMP4URLWithQuality(ctx context.Context, videoID string, quality string) (string, error) {
 	fmt.Printf("Looking for MP4 video with ID: %s in bucket '%s' with mp4Prefix '%s', requested quality: '%s'\n",
 		videoID, s.bucketName, s.mp4Prefix, quality)
+	assetID := s.AssetID(ctx, videoID)
 
 	// If specific quality is requested, try that first
 	if quality != "" {
 		// Check if the requested quality exists
-		objectName := path.Join(s.mp4Prefix, videoID, "mp4", quality+".mp4")
+		objectName := path.Join(s.mp4Prefix, assetID, "mp4", quality+".mp4")
 		fmt.Printf("Trying requested quality MP4 object path: '%s'\n", objectName)
 		exists, err := s.objectExists(ctx, objectName)
 		if err == nil && exists {
@@ -242,7 +266,7 @@ func (s *MinIOStorage) GetMP4URLWithQuality(ctx context.Context, videoID string,
 	// If specific quality wasn't requested or wasn't found, try default resolutions in order (highest to lowest)
 	resolutions := []string{"1080p", "720p", "480p", "360p", "240p"}
 	for _, resolution := range resolutions {
-		objectName := path.Join(s.mp4Prefix, videoID, "mp4", resolution+".mp4")
+		objectName := path.Join(s.mp4Prefix, assetID, "mp4", resolution+".mp4")
 		fmt.Printf("Trying MP4 object path: '%s'\n", objectName)
 		exists, err := s.objectExists(ctx, objectName)
 		if err != nil {
@@ -256,7 +280,7 @@ func (s *MinIOStorage) GetMP4URLWithQuality(ctx context.Context, videoID string,
 	}
 
 	// Fallback: Check for a generic video.mp4
-	genericObjectName := path.Join(s.mp4Prefix, videoID, "mp4", "video.mp4")
+	genericObjectName := path.Join(s.mp4Prefix, assetID, "mp4", "video.mp4")
 	fmt.Printf("Trying generic MP4 object path: '%s'\n", genericObjectName)
 	exists, err := s.objectExists(ctx, genericObjectName)
 	if err == nil && exists {
@@ -291,12 +315,23 @@ func (s *MinIOStorage) objectExists(ctx context.Context, objectName string) (boo
 	return true, nil
 }
 
-// GetThumbnailURL returns a signed URL for the video thumbnail
-func (s *MinIOStorage) GetThumbnailURL(ctx context.Context, videoID string) (string, error) {
-	// Try both possible thumbnail paths
+// GetThumbnailURL returns a signed URL for the video thumbnail in the given size. Custom and
+// regenerated thumbnails take precedence over the one created during transcoding, which only
+// exists in the default size.
+func (s *MinIOStorage) GetThumbnailURL(ctx context.Context, videoID string, size string) (string, error) {
+	objectName, err := s.latestThumbnail(ctx, videoID, size)
+	if err != nil {
+		fmt.Printf("Failed to list thumbnail versions for video %s: %v\n", videoID, err)
+	} else if objectName != "" {
+		return s.GeneratePresignedURL(ctx, objectName, s.urlExpiry)
+	}
+
+	// Try both possible thumbnail paths. Duplicates fall back to the thumbnail of their source
+	// from transcoding, never to a custom one.
+	assetID := s.AssetID(ctx, videoID)
 	paths := []string{
-		path.Join(s.thumbnailPrefix, videoID, "thumbnail.jpg"), // New path format
-		path.Join(s.thumbnailPrefix, videoID+".jpg"),           // Old path format
+		path.Join(s.thumbnailPrefix, assetID, "thumbnail.jpg"), // New path format
+		path.Join(s.thumbnailPrefix, assetID+".jpg"),           // Old path format
 	}
 
 	for _, objectName := range paths {
@@ -348,11 +383,23 @@ func (s *MinIOStorage) GetObjectContent(ctx context.Context, objectName string)
 // ProcessM3U8 processes an m3u8 file to replace relative URLs with absolute URLs
 func (s *MinIOStorage) ProcessM3U8(content, videoID, resolution string) (string, error) {
 	// Regular expression to match segment file references
-	segmentRegex := regexp.MustCompile(`([^/\n]+\.ts)`)
+	segmentRegex := regexp.MustCompile(`([^/\n]+\.(ts|m4s))`)
+	// fMP4 playlists reference the init segment of the rendition
+	mapRegex := regexp.MustCompile(`^(#EXT-X-MAP:.*URI=")([^"]+)(".*)$`)
 
 	// Process the content line by line
 	lines := strings.Split(content, "\n")
 	for i, line := range lines {
+		if match := mapRegex.FindStringSubmatch(line); match != nil {
+			initPath := path.Join(resolution, match[2])
+			signedURL, err := s.GeneratePresignedURL(context.Background(), s.GetHLSObjectPath(videoID, initPath), s.urlExpiry)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate signed URL for init segment: %w", err)
+			}
+			lines[i] = match[1] + signedURL + match[3]
+			continue
+		}
+
 		// Skip comments and directives
 		if strings.HasPrefix(line, "#") {
 			continue
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// DefaultPreviewFormat is served when no preview format is requested, an animated WebP plays in
+// an img element
+const DefaultPreviewFormat = "webp"
+
+// ValidPreviewFormat reports whether format names a preview format
+func ValidPreviewFormat(format string) bool {
+	return format == "webp" || format == "mp4"
+}
+
+// GetPreviewURL returns a signed URL for the hover preview of a video, an animated WebP or a muted
+// MP4 depending on format
+func (s *MinIOStorage) GetPreviewURL(ctx context.Context, videoID string, format string) (string, error) {
+	objectName := path.Join(s.previewPrefix, s.AssetID(ctx, videoID), "preview."+format)
+	exists, err := s.objectExists(ctx, objectName)
+	if err != nil {
+		return "", fmt.Errorf("failed to check preview: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("no preview found for video ID %s", videoID)
+	}
+	return s.GeneratePresignedURL(ctx, objectName, s.urlExpiry)
+}
@@ -10,7 +10,10 @@ type Storage interface {
 	// GetHLSManifest returns the HLS manifest (.m3u8) for a video
 	GetHLSManifest(ctx context.Context, videoID string) (string, error)
 
-	// GetHLSSegment returns a signed URL for an HLS segment (.ts)
+	// GetDASHManifest returns the DASH manifest (.mpd) of a video packaged as CMAF
+	GetDASHManifest(ctx context.Context, videoID string) (string, error)
+
+	// GetHLSSegment returns a signed URL for an HLS segment (.ts or .m4s)
 	GetHLSSegment(ctx context.Context, videoID string, segmentName string) (string, error)
 
 	// GetMP4URL returns a signed URL for the MP4 version of a video
@@ -20,8 +23,20 @@ type Storage interface {
 	// If quality is empty, it will return the highest available quality
 	GetMP4URLWithQuality(ctx context.Context, videoID string, quality string) (string, error)
 
-	// GetThumbnailURL returns a signed URL for the video thumbnail
-	GetThumbnailURL(ctx context.Context, videoID string) (string, error)
+	// GetSubtitleURL returns a signed URL for the WebVTT file of a caption track
+	GetSubtitleURL(ctx context.Context, videoID string, language string) (string, error)
+
+	// GetSubtitlePlaylist returns an HLS media playlist for a caption track
+	GetSubtitlePlaylist(ctx context.Context, videoID string, language string) (string, error)
+
+	// GetThumbnailURL returns a signed URL for the video thumbnail in the given size
+	GetThumbnailURL(ctx context.Context, videoID string, size string) (string, error)
+
+	// GetStoryboard returns the WebVTT file of the seek preview sprite sheets of a video
+	GetStoryboard(ctx context.Context, videoID string) (string, error)
+
+	// GetPreviewURL returns a signed URL for the hover preview of a video in the given format
+	GetPreviewURL(ctx context.Context, videoID string, format string) (string, error)
 
 	// CheckHealth checks if the storage is healthy
 	CheckHealth(ctx context.Context) error
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// spriteRegex matches the cue payloads of a storyboard, a sprite sheet name with the tile as a
+// media fragment
+var spriteRegex = regexp.MustCompile(`^([^\s/#]+\.jpg)(#xywh=\d+,\d+,\d+,\d+)$`)
+
+// GetStoryboard returns the WebVTT file that maps time ranges of a video to the tiles of its sprite
+// sheets. The sprite sheets are referenced by signed URLs.
+func (s *MinIOStorage) GetStoryboard(ctx context.Context, videoID string) (string, error) {
+	prefix := path.Join(s.thumbnailPrefix, s.AssetID(ctx, videoID), "storyboard")
+	content, err := s.GetObjectContent(ctx, path.Join(prefix, "storyboard.vtt"))
+	if err != nil {
+		return "", fmt.Errorf("no storyboard found for video ID %s: %w", videoID, err)
+	}
+
+	// Cues of the same sprite sheet share its URL
+	urls := make(map[string]string)
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		match := spriteRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		sprite := match[1]
+		if _, ok := urls[sprite]; !ok {
+			signedURL, err := s.GeneratePresignedURL(ctx, path.Join(prefix, sprite), s.urlExpiry)
+			if err != nil {
+				return "", fmt.Errorf("failed to generate signed URL for sprite sheet: %w", err)
+			}
+			urls[sprite] = signedURL
+		}
+		lines[i] = urls[sprite] + match[2]
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
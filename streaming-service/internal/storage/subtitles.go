@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SubtitleGroupID is the GROUP-ID of the subtitle renditions in generated master playlists
+const SubtitleGroupID = "subs"
+
+// SubtitleTrack is a WebVTT caption track stored next to the HLS output of a video
+type SubtitleTrack struct {
+	Language string `json:"language"`
+	Label    string `json:"label"`
+}
+
+var (
+	languageRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+	cueEndRegex   = regexp.MustCompile(`-->\s*((?:\d+:)?\d{2}:\d{2}\.\d{3})`)
+)
+
+// ValidLanguage reports whether a language tag can name a subtitle track
+func ValidLanguage(language string) bool {
+	return languageRegex.MatchString(language)
+}
+
+// ListSubtitles returns the caption tracks of a video ordered by language
+func (s *MinIOStorage) ListSubtitles(ctx context.Context, videoID string) ([]SubtitleTrack, error) {
+	prefix := s.GetHLSObjectPath(videoID, "subtitles") + "/"
+
+	var tracks []SubtitleTrack
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list subtitles: %w", object.Err)
+		}
+
+		language := strings.TrimSuffix(path.Base(object.Key), ".vtt")
+		if !strings.HasSuffix(object.Key, ".vtt") || !ValidLanguage(language) {
+			continue
+		}
+
+		// The metadata service keeps the display name of the track with the object
+		label := language
+		info, err := s.client.StatObject(ctx, s.bucketName, object.Key, minio.StatObjectOptions{})
+		if err == nil && info.UserMetadata["Label"] != "" {
+			label = info.UserMetadata["Label"]
+		}
+
+		tracks = append(tracks, SubtitleTrack{Language: language, Label: label})
+	}
+
+	return tracks, nil
+}
+
+// GetSubtitleURL returns a signed URL for the WebVTT file of a caption track
+func (s *MinIOStorage) GetSubtitleURL(ctx context.Context, videoID string, language string) (string, error) {
+	objectName := s.subtitleObjectName(videoID, language)
+	exists, err := s.objectExists(ctx, objectName)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("no %s subtitles found for video ID %s", language, videoID)
+	}
+	return s.GeneratePresignedURL(ctx, objectName, s.urlExpiry)
+}
+
+// GetSubtitlePlaylist returns an HLS media playlist for a caption track. The whole WebVTT file is
+// a single segment lasting until the end of its last cue.
+func (s *MinIOStorage) GetSubtitlePlaylist(ctx context.Context, videoID string, language string) (string, error) {
+	objectName := s.subtitleObjectName(videoID, language)
+	content, err := s.GetObjectContent(ctx, objectName)
+	if err != nil {
+		return "", fmt.Errorf("no %s subtitles found for video ID %s: %w", language, videoID, err)
+	}
+
+	vttURL, err := s.GeneratePresignedURL(ctx, objectName, s.urlExpiry)
+	if err != nil {
+		return "", err
+	}
+
+	duration := vttDuration(content)
+	playlist := []string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		fmt.Sprintf("#EXT-X-TARGETDURATION:%d", int(math.Ceil(duration))),
+		"#EXT-X-MEDIA-SEQUENCE:0",
+		"#EXT-X-PLAYLIST-TYPE:VOD",
+		fmt.Sprintf("#EXTINF:%.3f,", duration),
+		vttURL,
+		"#EXT-X-ENDLIST",
+	}
+	return strings.Join(playlist, "\n") + "\n", nil
+}
+
+// addSubtitleGroup adds an EXT-X-MEDIA subtitle rendition for every track to a master playlist and
+// references the group from every variant. Media playlists are returned unchanged.
+func addSubtitleGroup(manifest string, tracks []SubtitleTrack) string {
+	if len(tracks) == 0 || !strings.Contains(manifest, "#EXT-X-STREAM-INF") {
+		return manifest
+	}
+
+	// Captions stay off until the viewer picks a track, AUTOSELECT lets players match the system language
+	media := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		media = append(media, fmt.Sprintf(
+			`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="%s",NAME="%s",LANGUAGE="%s",DEFAULT=NO,AUTOSELECT=YES,FORCED=NO,URI="subtitles/%s/playlist"`,
+			SubtitleGroupID, quoteSafe(track.Label), track.Language, track.Language))
+	}
+
+	var lines []string
+	inserted := false
+	for _, line := range strings.Split(manifest, "\n") {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			if !inserted {
+				lines = append(lines, media...)
+				inserted = true
+			}
+			if !strings.Contains(line, "SUBTITLES=") {
+				line += fmt.Sprintf(`,SUBTITLES="%s"`, SubtitleGroupID)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// withSubtitles adds the caption tracks of a video to its master playlist
+func (s *MinIOStorage) withSubtitles(ctx context.Context, videoID string, manifest string) string {
+	tracks, err := s.ListSubtitles(ctx, videoID)
+	if err != nil {
+		fmt.Printf("Failed to list subtitles for video %s: %v\n", videoID, err)
+		return manifest
+	}
+	return addSubtitleGroup(manifest, tracks)
+}
+
+// vttDuration returns the end time in seconds of the last cue of a WebVTT file
+func vttDuration(content string) float64 {
+	var duration float64
+	for _, match := range cueEndRegex.FindAllStringSubmatch(content, -1) {
+		if end := parseVTTTimestamp(match[1]); end > duration {
+			duration = end
+		}
+	}
+	if duration <= 0 {
+		duration = 1
+	}
+	return duration
+}
+
+// parseVTTTimestamp parses hh:mm:ss.ttt or mm:ss.ttt
+func parseVTTTimestamp(timestamp string) float64 {
+	parts := strings.Split(timestamp, ":")
+	var seconds float64
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds
+}
+
+// quoteSafe removes characters that cannot appear in a quoted playlist attribute
+func quoteSafe(value string) string {
+	return strings.NewReplacer(`"`, "", "\n", " ", "\r", " ").Replace(value)
+}
+
+func (s *MinIOStorage) subtitleObjectName(videoID string, language string) string {
+	return s.GetHLSObjectPath(videoID, path.Join("subtitles", language+".vtt"))
+}
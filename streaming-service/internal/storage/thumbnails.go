@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// DefaultThumbnailSize is served when no size is requested
+const DefaultThumbnailSize = "medium"
+
+// thumbnailSizes are the sizes of custom and regenerated thumbnail sets
+var thumbnailSizes = []string{"small", "medium", "large"}
+
+// ValidThumbnailSize reports whether size names a thumbnail size
+func ValidThumbnailSize(size string) bool {
+	for _, name := range thumbnailSizes {
+		if name == size {
+			return true
+		}
+	}
+	return false
+}
+
+// latestThumbnail returns the object name of a size of the newest thumbnail set of a video. Sets are
+// stored as <thumbnail prefix>/<video ID>/<version>/<size>.jpg, versions sort by creation time.
+// An empty name is returned if the video has no thumbnail set.
+func (s *MinIOStorage) latestThumbnail(ctx context.Context, videoID string, size string) (string, error) {
+	prefix := path.Join(s.thumbnailPrefix, videoID) + "/"
+
+	var latest string
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return "", object.Err
+		}
+
+		// Skip objects of the old layout such as <video ID>/thumbnail.jpg
+		version, name, ok := strings.Cut(strings.TrimPrefix(object.Key, prefix), "/")
+		if !ok || version == "" || name != size+".jpg" {
+			continue
+		}
+		if latest == "" || thumbnailVersionAfter(version, path.Base(path.Dir(latest))) {
+			latest = object.Key
+		}
+	}
+
+	return latest, nil
+}
+
+// thumbnailVersionAfter compares two versions, which are creation times in Unix milliseconds
+func thumbnailVersionAfter(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
@@ -14,8 +14,10 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 
 	"youtube-clone-platform/transcoder-service/internal/config"
+	"youtube-clone-platform/transcoder-service/internal/db"
 	"youtube-clone-platform/transcoder-service/internal/events"
 	"youtube-clone-platform/transcoder-service/internal/handler"
+	"youtube-clone-platform/transcoder-service/internal/jobs"
 	"youtube-clone-platform/transcoder-service/internal/service"
 	"youtube-clone-platform/transcoder-service/internal/storage"
 	"youtube-clone-platform/transcoder-service/internal/transcoder"
@@ -46,6 +48,7 @@ func main() {
 		cfg.MinIO.HLSPrefix,
 		cfg.MinIO.MP4Prefix,
 		cfg.MinIO.ThumbnailPrefix,
+		cfg.MinIO.PreviewPrefix,
 	)
 
 	// Check MinIO health
@@ -60,6 +63,12 @@ func main() {
 		cfg.FFmpeg.Preset,
 		cfg.FFmpeg.CRF,
 		cfg.FFmpeg.SegmentLength,
+		cfg.FFmpeg.StoryboardInterval,
+		cfg.FFmpeg.ThumbnailCandidates,
+		cfg.FFmpeg.PreviewLength,
+		cfg.FFmpeg.LoudnessTarget,
+		cfg.FFmpeg.Packaging,
+		cfg.FFmpeg.PerTitle,
 		cfg.FFmpeg.OutputFormats,
 		cfg.FFmpeg.OutputQualities,
 		cfg.Processing.TempDir,
@@ -68,20 +77,38 @@ func main() {
 		log.Fatalf("Failed to create transcoder: %v", err)
 	}
 
+	// Open the job database
+	database, err := db.Open(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	jobStore := jobs.NewStore(database)
+
 	// Create Kafka consumer
 	consumer, err := events.NewKafkaConsumer(
 		cfg.Kafka.Brokers,
 		cfg.Kafka.Topic,
 		cfg.Kafka.GroupID,
+		cfg.Processing.MaxConcurrentJobs,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create Kafka consumer: %v", err)
 	}
 
 	// Create Kafka producer
-	producer := events.NewKafkaProducer(
+	producer := events.NewKafkaProducer(cfg.Kafka.Brokers, events.ProducerTopics{
+		Complete:   "transcoding-complete",
+		Progress:   cfg.Kafka.ProgressTopic,
+		Failed:     cfg.Kafka.FailedTopic,
+		DeadLetter: cfg.Kafka.DeadLetterTopic,
+	})
+
+	// Create dead-letter consumer for re-drives
+	deadLetters := events.NewKafkaDeadLetterConsumer(
 		cfg.Kafka.Brokers,
-		"transcoding-complete",
+		cfg.Kafka.DeadLetterTopic,
+		cfg.Kafka.DeadLetterGroupID,
 	)
 
 	// Create transcoder service
@@ -90,8 +117,15 @@ func main() {
 		transcoderInstance,
 		consumer,
 		producer,
+		deadLetters,
+		jobStore,
 		cfg.Processing.MaxConcurrentJobs,
 		cfg.Processing.JobTimeout,
+		service.RetryPolicy{
+			MaxAttempts: cfg.Processing.MaxAttempts,
+			Backoff:     cfg.Processing.RetryBackoff,
+			MaxBackoff:  cfg.Processing.RetryMaxBackoff,
+		},
 		cfg.Processing.TempDir,
 	)
 
@@ -110,6 +144,10 @@ func main() {
 		"transcoding-complete",
 	)
 
+	jobHandler := handler.NewJobHandler(transcoderService)
+	adminHandler := handler.NewAdminHandler(transcoderService)
+	thumbnailHandler := handler.NewThumbnailHandler(transcoderService)
+
 	// Run initial health check
 	log.Printf("Running initial health check...")
 	status := healthHandler.RunHealthCheck()
@@ -126,15 +164,17 @@ func main() {
 	api := router.Group("/api/v1/transcoder")
 	{
 		api.GET("/health", healthHandler.HandleHealthCheck)
-		// TODO: Add transcoder routes once handler is implemented
-		api.POST("/jobs", func(c *gin.Context) {
-			// TODO: Implement job creation handler
-			c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
-		})
-		api.GET("/jobs/:id", func(c *gin.Context) {
-			// TODO: Implement job status handler
-			c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
-		})
+		// Used by the metadata service when an owner picks a new thumbnail frame
+		api.POST("/videos/:videoID/thumbnail", thumbnailHandler.HandleRegenerateThumbnail)
+		api.POST("/jobs", jobHandler.HandleCreateJob)
+		api.GET("/jobs", jobHandler.HandleListJobs)
+		api.GET("/jobs/:id", jobHandler.HandleGetJob)
+		api.GET("/jobs/:id/progress", jobHandler.HandleJobProgress)
+		api.POST("/jobs/:id/cancel", jobHandler.HandleCancelJob)
+
+		// Admin endpoints
+		admin := api.Group("/admin", handler.RequireAdmin())
+		admin.POST("/dlq/redrive", adminHandler.HandleRedriveDeadLetters)
 	}
 
 	// Create HTTP server
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -12,6 +13,9 @@ type Config struct {
 	// Server configuration
 	Port string
 
+	// SQLite database of transcoding jobs
+	DatabasePath string
+
 	// Kafka configuration
 	Kafka KafkaConfig
 
@@ -36,28 +40,45 @@ type MinIOConfig struct {
 	HLSPrefix       string
 	MP4Prefix       string
 	ThumbnailPrefix string
+	PreviewPrefix   string
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers       []string
+	Topic         string
+	GroupID       string
+	ProgressTopic string
+	FailedTopic   string
+	// Upload events of jobs that failed for good, re-driven through the admin API
+	DeadLetterTopic   string
+	DeadLetterGroupID string
 }
 
 type FFmpegConfig struct {
-	Path            string
-	Threads         int
-	Preset          string
-	CRF             int
-	SegmentLength   int
-	OutputFormats   []string
-	OutputQualities []string
+	Path                string
+	Threads             int
+	Preset              string
+	CRF                 int
+	SegmentLength       int
+	StoryboardInterval  time.Duration
+	ThumbnailCandidates int
+	PreviewLength       time.Duration
+	LoudnessTarget      float64
+	Packaging           string
+	PerTitle            bool
+	OutputFormats       []string
+	OutputQualities     []string
 }
 
 type ProcessingConfig struct {
 	MaxConcurrentJobs int
 	JobTimeout        time.Duration
 	TempDir           string
+	// Failed jobs are retried until they made MaxAttempts attempts, waiting RetryBackoff
+	// before the first retry and twice as long before each further one, up to RetryMaxBackoff
+	MaxAttempts     int
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
 }
 
 func Load() (*Config, error) {
@@ -70,6 +91,7 @@ func Load() (*Config, error) {
 
 	// Set default values
 	viper.SetDefault("PORT", "8083")
+	viper.SetDefault("DATABASE_PATH", "./data/transcoder.db")
 	viper.SetDefault("MINIO_ENDPOINT", "localhost:9000")
 	viper.SetDefault("MINIO_ACCESS_KEY", "minioadmin")
 	viper.SetDefault("MINIO_SECRET_KEY", "minioadmin")
@@ -80,19 +102,33 @@ func Load() (*Config, error) {
 	viper.SetDefault("MINIO_HLS_PREFIX", "hls")
 	viper.SetDefault("MINIO_MP4_PREFIX", "mp4")
 	viper.SetDefault("MINIO_THUMBNAIL_PREFIX", "thumbnails")
+	viper.SetDefault("MINIO_PREVIEW_PREFIX", "previews")
 	viper.SetDefault("KAFKA_BROKERS", []string{"localhost:29092"})
 	viper.SetDefault("KAFKA_TOPIC", "video-uploads")
 	viper.SetDefault("KAFKA_GROUP_ID", "transcoder-service")
+	viper.SetDefault("KAFKA_PROGRESS_TOPIC", "transcoding-progress")
+	viper.SetDefault("KAFKA_FAILED_TOPIC", "transcoding-failed")
+	viper.SetDefault("KAFKA_DLQ_TOPIC", "video-uploads-dlq")
+	viper.SetDefault("KAFKA_DLQ_GROUP_ID", "transcoder-service-dlq")
 	viper.SetDefault("FFMPEG_PATH", "ffmpeg")
 	viper.SetDefault("FFMPEG_THREADS", 4)
 	viper.SetDefault("FFMPEG_PRESET", "medium")
 	viper.SetDefault("FFMPEG_CRF", 23)
 	viper.SetDefault("FFMPEG_SEGMENT_LENGTH", 10)
+	viper.SetDefault("FFMPEG_PACKAGING", "ts")
+	viper.SetDefault("STORYBOARD_INTERVAL", "5s")
+	viper.SetDefault("THUMBNAIL_CANDIDATES", 5)
+	viper.SetDefault("PREVIEW_LENGTH", "4s")
+	viper.SetDefault("LOUDNESS_TARGET", -16.0)
+	viper.SetDefault("FFMPEG_PER_TITLE", true)
 	viper.SetDefault("FFMPEG_OUTPUT_FORMATS", []string{"h264"})
 	viper.SetDefault("FFMPEG_OUTPUT_QUALITIES", []string{"1080p", "720p", "480p", "360p"})
 	viper.SetDefault("MAX_CONCURRENT_JOBS", 2)
 	viper.SetDefault("JOB_TIMEOUT", "30m")
 	viper.SetDefault("TEMP_DIR", "/tmp/transcoder")
+	viper.SetDefault("MAX_ATTEMPTS", 3)
+	viper.SetDefault("RETRY_BACKOFF", "30s")
+	viper.SetDefault("RETRY_MAX_BACKOFF", "10m")
 
 	// Also read from environment variables
 	viper.AutomaticEnv()
@@ -103,12 +139,36 @@ func Load() (*Config, error) {
 		jobTimeout = 30 * time.Minute // Default fallback
 	}
 
+	storyboardInterval, err := time.ParseDuration(viper.GetString("STORYBOARD_INTERVAL"))
+	if err != nil {
+		storyboardInterval = 5 * time.Second
+	}
+
+	previewLength, err := time.ParseDuration(viper.GetString("PREVIEW_LENGTH"))
+	if err != nil {
+		previewLength = 4 * time.Second
+	}
+
+	retryBackoff, err := time.ParseDuration(viper.GetString("RETRY_BACKOFF"))
+	if err != nil {
+		retryBackoff = 30 * time.Second
+	}
+	retryMaxBackoff, err := time.ParseDuration(viper.GetString("RETRY_MAX_BACKOFF"))
+	if err != nil {
+		retryMaxBackoff = 10 * time.Minute
+	}
+
 	return &Config{
-		Port: viper.GetString("PORT"),
+		Port:         viper.GetString("PORT"),
+		DatabasePath: viper.GetString("DATABASE_PATH"),
 		Kafka: KafkaConfig{
-			Brokers: viper.GetStringSlice("KAFKA_BROKERS"),
-			Topic:   viper.GetString("KAFKA_TOPIC"),
-			GroupID: viper.GetString("KAFKA_GROUP_ID"),
+			Brokers:           viper.GetStringSlice("KAFKA_BROKERS"),
+			Topic:             viper.GetString("KAFKA_TOPIC"),
+			GroupID:           viper.GetString("KAFKA_GROUP_ID"),
+			ProgressTopic:     viper.GetString("KAFKA_PROGRESS_TOPIC"),
+			FailedTopic:       viper.GetString("KAFKA_FAILED_TOPIC"),
+			DeadLetterTopic:   viper.GetString("KAFKA_DLQ_TOPIC"),
+			DeadLetterGroupID: viper.GetString("KAFKA_DLQ_GROUP_ID"),
 		},
 		MinIO: MinIOConfig{
 			Endpoint:        viper.GetString("MINIO_ENDPOINT"),
@@ -121,24 +181,47 @@ func Load() (*Config, error) {
 			HLSPrefix:       viper.GetString("MINIO_HLS_PREFIX"),
 			MP4Prefix:       viper.GetString("MINIO_MP4_PREFIX"),
 			ThumbnailPrefix: viper.GetString("MINIO_THUMBNAIL_PREFIX"),
+			PreviewPrefix:   viper.GetString("MINIO_PREVIEW_PREFIX"),
 		},
 		FFmpeg: FFmpegConfig{
-			Path:            viper.GetString("FFMPEG_PATH"),
-			Threads:         viper.GetInt("FFMPEG_THREADS"),
-			Preset:          viper.GetString("FFMPEG_PRESET"),
-			CRF:             viper.GetInt("FFMPEG_CRF"),
-			SegmentLength:   viper.GetInt("FFMPEG_SEGMENT_LENGTH"),
-			OutputFormats:   viper.GetStringSlice("FFMPEG_OUTPUT_FORMATS"),
-			OutputQualities: viper.GetStringSlice("FFMPEG_OUTPUT_QUALITIES"),
+			Path:                viper.GetString("FFMPEG_PATH"),
+			Threads:             viper.GetInt("FFMPEG_THREADS"),
+			Preset:              viper.GetString("FFMPEG_PRESET"),
+			CRF:                 viper.GetInt("FFMPEG_CRF"),
+			SegmentLength:       viper.GetInt("FFMPEG_SEGMENT_LENGTH"),
+			StoryboardInterval:  storyboardInterval,
+			ThumbnailCandidates: viper.GetInt("THUMBNAIL_CANDIDATES"),
+			PreviewLength:       previewLength,
+			LoudnessTarget:      viper.GetFloat64("LOUDNESS_TARGET"),
+			Packaging:           viper.GetString("FFMPEG_PACKAGING"),
+			PerTitle:            viper.GetBool("FFMPEG_PER_TITLE"),
+			OutputFormats:       listSetting("FFMPEG_OUTPUT_FORMATS"),
+			OutputQualities:     viper.GetStringSlice("FFMPEG_OUTPUT_QUALITIES"),
 		},
 		Processing: ProcessingConfig{
 			MaxConcurrentJobs: viper.GetInt("MAX_CONCURRENT_JOBS"),
 			JobTimeout:        jobTimeout,
 			TempDir:           viper.GetString("TEMP_DIR"),
+			MaxAttempts:       viper.GetInt("MAX_ATTEMPTS"),
+			RetryBackoff:      retryBackoff,
+			RetryMaxBackoff:   retryMaxBackoff,
 		},
 	}, nil
 }
 
+// listSetting returns a list setting. Environment variables separate the items with commas.
+func listSetting(key string) []string {
+	var items []string
+	for _, value := range viper.GetStringSlice(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if len(c.Kafka.Brokers) == 0 {
@@ -153,6 +236,18 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("Kafka group ID cannot be empty")
 	}
 
+	if c.Kafka.ProgressTopic == "" {
+		return fmt.Errorf("Kafka progress topic cannot be empty")
+	}
+
+	if c.Kafka.FailedTopic == "" {
+		return fmt.Errorf("Kafka failed topic cannot be empty")
+	}
+
+	if c.Kafka.DeadLetterTopic == "" || c.Kafka.DeadLetterGroupID == "" {
+		return fmt.Errorf("Kafka dead-letter topic and group ID cannot be empty")
+	}
+
 	if c.MinIO.Endpoint == "" {
 		return fmt.Errorf("MinIO endpoint cannot be empty")
 	}
@@ -189,10 +284,43 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("FFmpeg segment length must be greater than 0")
 	}
 
+	if c.FFmpeg.StoryboardInterval != 0 && c.FFmpeg.StoryboardInterval < time.Second {
+		return fmt.Errorf("Storyboard interval must be 0 or at least 1s")
+	}
+
+	if c.FFmpeg.ThumbnailCandidates <= 0 {
+		return fmt.Errorf("Thumbnail candidates must be greater than 0")
+	}
+
+	if c.FFmpeg.PreviewLength != 0 && (c.FFmpeg.PreviewLength < 3*time.Second || c.FFmpeg.PreviewLength > 6*time.Second) {
+		return fmt.Errorf("Preview length must be 0 or between 3s and 6s")
+	}
+
+	if c.FFmpeg.LoudnessTarget != 0 && (c.FFmpeg.LoudnessTarget < -70 || c.FFmpeg.LoudnessTarget > -5) {
+		return fmt.Errorf("Loudness target must be 0 or between -70 and -5 LUFS")
+	}
+
+	if c.FFmpeg.Packaging != "ts" && c.FFmpeg.Packaging != "cmaf" {
+		return fmt.Errorf("FFmpeg packaging must be ts or cmaf")
+	}
+
 	if len(c.FFmpeg.OutputFormats) == 0 {
 		return fmt.Errorf("FFmpeg output formats cannot be empty")
 	}
 
+	for _, format := range c.FFmpeg.OutputFormats {
+		switch format {
+		case "h264":
+		case "hevc", "vp9", "av1":
+			// MPEG-TS segments can only carry H.264
+			if c.FFmpeg.Packaging != "cmaf" {
+				return fmt.Errorf("FFmpeg output format %s requires cmaf packaging", format)
+			}
+		default:
+			return fmt.Errorf("FFmpeg output format must be h264, hevc, vp9 or av1")
+		}
+	}
+
 	if len(c.FFmpeg.OutputQualities) == 0 {
 		return fmt.Errorf("FFmpeg output qualities cannot be empty")
 	}
@@ -209,5 +337,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("Temp directory cannot be empty")
 	}
 
+	if c.Processing.MaxAttempts <= 0 {
+		return fmt.Errorf("Max attempts must be greater than 0")
+	}
+
+	if c.Processing.RetryBackoff <= 0 || c.Processing.RetryMaxBackoff < c.Processing.RetryBackoff {
+		return fmt.Errorf("Retry backoff must be greater than 0 and not exceed the max retry backoff")
+	}
+
 	return nil
 }
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed schema.sql
+var schema string
+
+// migrations add the columns of schema.sql that were added after the tables were first created
+var migrations = []string{
+	`ALTER TABLE jobs ADD COLUMN ladder BLOB`,
+}
+
+// Open opens the SQLite database of the transcoder service and creates its tables
+func Open(dbPath string) (*sql.DB, error) {
+	// Ensure the directory exists
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	// WAL lets the API read jobs while workers update them, immediate transactions take the write lock
+	// up front so status transitions never fail upgrading a read lock
+	database, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test the connection
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	if _, err := database.Exec(schema); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	// Add columns that databases created by older versions lack
+	for _, migration := range migrations {
+		if _, err := database.Exec(migration); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			database.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	return database, nil
+}
@@ -0,0 +1,35 @@
+-- Transcoding jobs. Times are unix milliseconds (UTC).
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    video_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    -- The upload event the job transcodes, as JSON
+    request BLOB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    -- Percentage of the current attempt that is done
+    progress INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    started_at INTEGER,
+    completed_at INTEGER,
+    -- Queued jobs waiting for a retry are not claimed before this time
+    next_attempt_at INTEGER,
+    -- The encoding ladder picked for the video, as JSON
+    ladder BLOB
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_video ON jobs(video_id, created_at);
+
+-- Every status a job went through
+CREATE TABLE IF NOT EXISTS job_transitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id TEXT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    error TEXT,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_transitions_job ON job_transitions(job_id, id);
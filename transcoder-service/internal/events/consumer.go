@@ -3,8 +3,11 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -19,6 +22,7 @@ type VideoUploadEvent struct {
 	Size        int64         `json:"size"`
 	Metadata    VideoMetadata `json:"metadata"`
 	UploadedAt  string        `json:"uploaded_at"`
+	DuplicateOf string        `json:"duplicate_of,omitempty"`
 }
 
 // VideoMetadata represents the metadata extracted from a video file
@@ -45,7 +49,8 @@ type VideoMetadata struct {
 
 // Consumer defines the interface for consuming events
 type Consumer interface {
-	// Start starts consuming messages from Kafka
+	// Start starts consuming messages from Kafka. A message is committed once handler returned
+	// without an error.
 	Start(ctx context.Context, handler func(ctx context.Context, event VideoUploadEvent) error) error
 
 	// Close closes the consumer
@@ -54,13 +59,17 @@ type Consumer interface {
 
 // KafkaConsumer implements the Consumer interface using Kafka
 type KafkaConsumer struct {
-	reader  *kafka.Reader
-	topic   string
-	groupID string
+	reader      *kafka.Reader
+	topic       string
+	groupID     string
+	maxInFlight int
 }
 
-// NewKafkaConsumer creates a new Kafka consumer
-func NewKafkaConsumer(brokers []string, topic string, groupID string) (*KafkaConsumer, error) {
+// maxHandlerBackoff caps the delay before a message whose handler failed is handled again
+const maxHandlerBackoff = 30 * time.Second
+
+// NewKafkaConsumer creates a new Kafka consumer that handles up to maxInFlight messages at a time
+func NewKafkaConsumer(brokers []string, topic string, groupID string, maxInFlight int) (*KafkaConsumer, error) {
 	// Try to create topic with retries
 	var conn *kafka.Conn
 	var err error
@@ -104,46 +113,168 @@ func NewKafkaConsumer(brokers []string, topic string, groupID string) (*KafkaCon
 	})
 
 	return &KafkaConsumer{
-		reader:  reader,
-		topic:   topic,
-		groupID: groupID,
+		reader:      reader,
+		topic:       topic,
+		groupID:     groupID,
+		maxInFlight: maxInFlight,
 	}, nil
 }
 
-// Start starts consuming messages from Kafka
+// Start starts consuming messages from Kafka. Messages are handled concurrently and fetching pauses
+// while maxInFlight of them are being handled. A message is only committed once it and every
+// message before it on its partition were handled, so every upload is processed at least once.
 func (c *KafkaConsumer) Start(ctx context.Context, handler func(ctx context.Context, event VideoUploadEvent) error) error {
 	log.Printf("Starting Kafka consumer for topic: %s, group: %s", c.topic, c.groupID)
 
+	slots := make(chan struct{}, c.maxInFlight)
+	offsets := newOffsetTracker(c.reader)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
 	for {
+		// Wait for a free slot before fetching the next message
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
-			msg, err := c.reader.ReadMessage(ctx)
-			if err != nil {
-				log.Printf("Error reading message: %v", err)
-				continue
+		case slots <- struct{}{}:
+		}
+
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			<-slots
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
+			if errors.Is(err, io.EOF) {
+				// The reader was closed
+				return nil
+			}
+			log.Printf("Error fetching message: %v", err)
+			continue
+		}
+		offsets.fetched(msg)
 
-			log.Printf("Received message: %s", string(msg.Value))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
 
-			var event VideoUploadEvent
-			if err := json.Unmarshal(msg.Value, &event); err != nil {
-				log.Printf("Error unmarshaling message: %v", err)
-				log.Printf("Message content: %s", string(msg.Value))
-				continue
+			if c.handle(ctx, msg, handler) {
+				offsets.commit(ctx, msg)
 			}
+		}()
+	}
+}
 
-			log.Printf("Successfully unmarshaled event for video ID: %s", event.VideoID)
+// handle passes a message to handler, retrying until it succeeds. It returns false if ctx was
+// canceled first, the message is delivered again then.
+func (c *KafkaConsumer) handle(ctx context.Context, msg kafka.Message, handler func(ctx context.Context, event VideoUploadEvent) error) bool {
+	log.Printf("Received message: %s", string(msg.Value))
 
-			// Process the event
-			if err := handler(ctx, event); err != nil {
-				log.Printf("Error processing event: %v", err)
-				continue
-			}
+	var event VideoUploadEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		log.Printf("Error unmarshaling message: %v", err)
+		log.Printf("Message content: %s", string(msg.Value))
+		return true
+	}
 
+	log.Printf("Successfully unmarshaled event for video ID: %s", event.VideoID)
+
+	// Duplicates reuse the assets of the original video, there is nothing to transcode
+	if event.DuplicateOf != "" {
+		log.Printf("Skipping video %s, it is a duplicate of %s", event.VideoID, event.DuplicateOf)
+		return true
+	}
+
+	for backoff := time.Second; ; backoff = min(2*backoff, maxHandlerBackoff) {
+		err := handler(ctx, event)
+		if err == nil {
 			log.Printf("Successfully processed video upload event for video ID: %s", event.VideoID)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
 		}
+
+		log.Printf("Error processing event for video ID %s, retrying in %s: %v", event.VideoID, backoff, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// committer commits the offsets of messages, like a kafka.Reader of a consumer group
+type committer interface {
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// offsetTracker commits handled messages in partition order. Messages are handled concurrently,
+// committing one whose predecessors are still being handled would skip them after a restart.
+type offsetTracker struct {
+	committer committer
+
+	mu      sync.Mutex
+	pending map[int][]*pendingMessage
+}
+
+type pendingMessage struct {
+	offset  int64
+	handled bool
+}
+
+func newOffsetTracker(committer committer) *offsetTracker {
+	return &offsetTracker{
+		committer: committer,
+		pending:   make(map[int][]*pendingMessage),
+	}
+}
+
+// fetched records a message that is about to be handled
+func (t *offsetTracker) fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending[msg.Partition]
+	// After a rebalance the partition starts over at its committed offset, messages fetched
+	// before are delivered again
+	if n := len(pending); n > 0 && msg.Offset <= pending[n-1].offset {
+		pending = nil
+	}
+	t.pending[msg.Partition] = append(pending, &pendingMessage{offset: msg.Offset})
+}
+
+// commit records that a message was handled and commits every handled message at the start of
+// its partition
+func (t *offsetTracker) commit(ctx context.Context, msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.pending[msg.Partition]
+	for _, p := range pending {
+		if p.offset == msg.Offset {
+			p.handled = true
+		}
+	}
+
+	handled := 0
+	for handled < len(pending) && pending[handled].handled {
+		handled++
+	}
+	if handled == 0 {
+		return
+	}
+	t.pending[msg.Partition] = pending[handled:]
+
+	last := msg
+	last.Offset = pending[handled-1].offset
+	// Commit even if consuming stops meanwhile, the message was handled
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := t.committer.CommitMessages(commitCtx, last); err != nil {
+		log.Printf("Error committing offset %d of partition %d: %v", last.Offset, last.Partition, err)
 	}
 }
 
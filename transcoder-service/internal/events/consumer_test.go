@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeCommitter records the committed offsets as partition:offset
+type fakeCommitter struct {
+	committed []string
+	ctxErrs   []error
+}
+
+func (c *fakeCommitter) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		c.committed = append(c.committed, fmt.Sprintf("%d:%d", msg.Partition, msg.Offset))
+		c.ctxErrs = append(c.ctxErrs, ctx.Err())
+	}
+	return nil
+}
+
+// trackerStep fetches or commits the message at an offset of a partition
+type trackerStep struct {
+	commit    bool
+	partition int
+	offset    int64
+}
+
+func fetch(partition int, offsets ...int64) []trackerStep {
+	steps := make([]trackerStep, len(offsets))
+	for i, offset := range offsets {
+		steps[i] = trackerStep{partition: partition, offset: offset}
+	}
+	return steps
+}
+
+func commit(partition int, offsets ...int64) []trackerStep {
+	steps := fetch(partition, offsets...)
+	for i := range steps {
+		steps[i].commit = true
+	}
+	return steps
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps [][]trackerStep
+		want  []string
+	}{
+		{
+			name:  "in order",
+			steps: [][]trackerStep{fetch(0, 0, 1, 2), commit(0, 0, 1, 2)},
+			want:  []string{"0:0", "0:1", "0:2"},
+		},
+		{
+			name:  "out of order",
+			steps: [][]trackerStep{fetch(0, 0, 1, 2), commit(0, 2, 1, 0)},
+			want:  []string{"0:2"},
+		},
+		{
+			name:  "gap at the head",
+			steps: [][]trackerStep{fetch(0, 5, 6, 7, 8), commit(0, 6, 7, 5)},
+			want:  []string{"0:7"},
+		},
+		{
+			name:  "gap in the middle",
+			steps: [][]trackerStep{fetch(0, 5, 6, 7, 8), commit(0, 5, 7, 8, 6)},
+			want:  []string{"0:5", "0:8"},
+		},
+		{
+			name:  "offsets skipped by compaction",
+			steps: [][]trackerStep{fetch(0, 3, 7, 12), commit(0, 7, 3, 12)},
+			want:  []string{"0:7", "0:12"},
+		},
+		{
+			name:  "partitions are independent",
+			steps: [][]trackerStep{fetch(0, 0, 1), fetch(1, 0, 1), commit(1, 0), commit(0, 1), commit(1, 1), commit(0, 0)},
+			want:  []string{"1:0", "1:1", "0:1"},
+		},
+		{
+			name:  "unknown message",
+			steps: [][]trackerStep{fetch(0, 0, 1), commit(0, 4), commit(1, 0)},
+		},
+		{
+			name: "reset after a rebalance",
+			steps: [][]trackerStep{
+				fetch(0, 0, 1, 2), commit(0, 1),
+				// The partition starts over at the committed offset
+				fetch(0, 0, 1),
+				// The message handled before the rebalance is no longer pending
+				commit(0, 2),
+				commit(0, 1, 0),
+			},
+			want: []string{"0:1"},
+		},
+		{
+			name: "rebalance after commits",
+			steps: [][]trackerStep{
+				fetch(0, 0, 1, 2, 3), commit(0, 0, 2),
+				fetch(0, 1, 2, 3),
+				commit(0, 1, 2, 3),
+			},
+			want: []string{"0:0", "0:1", "0:2", "0:3"},
+		},
+		{
+			name: "rebalance of another partition",
+			steps: [][]trackerStep{
+				fetch(0, 0, 1), fetch(1, 5),
+				fetch(1, 5),
+				commit(0, 1, 0), commit(1, 5),
+			},
+			want: []string{"0:1", "1:5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			committer := &fakeCommitter{}
+			tracker := newOffsetTracker(committer)
+
+			for _, step := range slices.Concat(tt.steps...) {
+				msg := kafka.Message{Topic: "video-uploads", Partition: step.partition, Offset: step.offset}
+				if step.commit {
+					tracker.commit(context.Background(), msg)
+				} else {
+					tracker.fetched(msg)
+				}
+			}
+
+			if !slices.Equal(committer.committed, tt.want) {
+				t.Errorf("committed %v, want %v", committer.committed, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerCommitsAfterCancel(t *testing.T) {
+	committer := &fakeCommitter{}
+	tracker := newOffsetTracker(committer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracker.fetched(kafka.Message{Offset: 0})
+	cancel()
+	tracker.commit(ctx, kafka.Message{Offset: 0})
+
+	if !slices.Equal(committer.committed, []string{"0:0"}) {
+		t.Fatalf("committed %v, want [0:0]", committer.committed)
+	}
+	if err := committer.ctxErrs[0]; err != nil {
+		t.Errorf("commit context error = %v, want none", err)
+	}
+}
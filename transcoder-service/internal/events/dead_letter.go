@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// redriveIdleTimeout is how long a re-drive waits for the next dead letter before it assumes the
+// topic is drained. Joining the consumer group takes a few seconds on its own.
+const redriveIdleTimeout = 10 * time.Second
+
+// DeadLetterConsumer reads the dead-letter topic
+type DeadLetterConsumer interface {
+	// Redrive reads up to limit dead letters and passes them to handler. A dead letter is only
+	// committed once handler accepted it, the first error stops the re-drive.
+	Redrive(ctx context.Context, limit int, handler func(ctx context.Context, letter DeadLetter) error) (int, error)
+}
+
+// KafkaDeadLetterConsumer implements DeadLetterConsumer using Kafka
+type KafkaDeadLetterConsumer struct {
+	brokers []string
+	topic   string
+	groupID string
+	// Only one re-drive reads the topic at a time
+	mu sync.Mutex
+}
+
+// NewKafkaDeadLetterConsumer creates a dead-letter consumer. Re-driven offsets are committed for groupID.
+func NewKafkaDeadLetterConsumer(brokers []string, topic string, groupID string) *KafkaDeadLetterConsumer {
+	return &KafkaDeadLetterConsumer{
+		brokers: brokers,
+		topic:   topic,
+		groupID: groupID,
+	}
+}
+
+// Redrive implements DeadLetterConsumer
+func (c *KafkaDeadLetterConsumer) Redrive(ctx context.Context, limit int, handler func(ctx context.Context, letter DeadLetter) error) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     c.brokers,
+		Topic:       c.topic,
+		GroupID:     c.groupID,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6, // 10MB
+	})
+	defer reader.Close()
+
+	redriven := 0
+	for redriven < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, redriveIdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			// The topic is drained
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return redriven, nil
+			}
+			return redriven, fmt.Errorf("failed to read dead letter: %w", err)
+		}
+
+		letter, err := parseDeadLetter(msg)
+		if err != nil {
+			// Skip messages that can never be re-driven
+			log.Printf("Dropping dead letter at offset %d: %v", msg.Offset, err)
+		} else if err := handler(ctx, letter); err != nil {
+			return redriven, err
+		} else {
+			redriven++
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return redriven, fmt.Errorf("failed to commit dead letter: %w", err)
+		}
+	}
+
+	return redriven, nil
+}
+
+// parseDeadLetter reads a dead letter written by PublishDeadLetter
+func parseDeadLetter(msg kafka.Message) (DeadLetter, error) {
+	var letter DeadLetter
+	if err := json.Unmarshal(msg.Value, &letter.Event); err != nil {
+		return letter, fmt.Errorf("failed to unmarshal upload event: %w", err)
+	}
+	if letter.Event.VideoID == "" {
+		return letter, fmt.Errorf("upload event has no video ID")
+	}
+
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case headerJobID:
+			letter.JobID = string(header.Value)
+		case headerErrorClass:
+			letter.ErrorClass = string(header.Value)
+		case headerError:
+			letter.Error = string(header.Value)
+		case headerAttempts:
+			letter.Attempts, _ = strconv.Atoi(string(header.Value))
+		}
+	}
+	return letter, nil
+}
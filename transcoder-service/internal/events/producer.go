@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/segmentio/kafka-go"
@@ -17,27 +18,148 @@ type TranscodingCompleteEvent struct {
 	HLSPath       string `json:"hls_path"`
 	MP4Path       string `json:"mp4_path"`
 	ThumbnailPath string `json:"thumbnail_path"`
-	Status        string `json:"status"`
-	CompletedAt   string `json:"completed_at"`
+	// ThumbnailCandidates are the frames the thumbnail was picked from, best first
+	ThumbnailCandidates []ThumbnailCandidate `json:"thumbnail_candidates,omitempty"`
+	// StoryboardPath is the WebVTT file of the seek preview sprite sheets, empty without a storyboard
+	StoryboardPath string `json:"storyboard_path,omitempty"`
+	// PreviewWebPPath and PreviewMP4Path are the hover preview clips, empty without a preview
+	PreviewWebPPath string `json:"preview_webp_path,omitempty"`
+	PreviewMP4Path  string `json:"preview_mp4_path,omitempty"`
+	Status          string `json:"status"`
+	CompletedAt     string `json:"completed_at"`
+	// Ladder is the encoding ladder the video was transcoded with
+	Ladder *EncodingLadder `json:"ladder,omitempty"`
+	// Loudness is the loudness of the audio before it was normalized, nil if it was not
+	Loudness *Loudness `json:"loudness,omitempty"`
 }
 
+// Loudness is the EBU R128 loudness of the audio of a video and the integrated loudness it was
+// normalized to
+type Loudness struct {
+	IntegratedLUFS float64 `json:"integrated_lufs"`
+	TruePeakDBTP   float64 `json:"true_peak_dbtp"`
+	RangeLU        float64 `json:"range_lu"`
+	ThresholdLUFS  float64 `json:"threshold_lufs"`
+	TargetLUFS     float64 `json:"target_lufs"`
+}
+
+// ThumbnailCandidate is a frame a creator can pick as the thumbnail of a video. Scores are between
+// 0 and 1, higher is better.
+type ThumbnailCandidate struct {
+	Path       string  `json:"path"`
+	Timestamp  float64 `json:"timestamp"`
+	Score      float64 `json:"score"`
+	Brightness float64 `json:"brightness"`
+	Contrast   float64 `json:"contrast"`
+	Sharpness  float64 `json:"sharpness"`
+}
+
+// EncodingLadder is the set of renditions a video was transcoded to and, for per-title ladders,
+// the content analysis it is based on
+type EncodingLadder struct {
+	Rungs    []LadderRung     `json:"rungs"`
+	Analysis *ContentAnalysis `json:"analysis,omitempty"`
+}
+
+// LadderRung is one rendition of an encoding ladder. Bitrates are the H.264 maximum bitrates.
+type LadderRung struct {
+	Name             string `json:"name"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	BitrateKbps      int    `json:"bitrate_kbps"`
+	AudioBitrateKbps int    `json:"audio_bitrate_kbps"`
+}
+
+// ContentAnalysis is the probe encode a per-title ladder is based on
+type ContentAnalysis struct {
+	ProbeResolution  string   `json:"probe_resolution"`
+	ProbeCRF         int      `json:"probe_crf"`
+	ProbeBitrateKbps int      `json:"probe_bitrate_kbps"`
+	Samples          int      `json:"samples"`
+	SampledSeconds   float64  `json:"sampled_seconds"`
+	Complexity       float64  `json:"complexity"`
+	DroppedRungs     []string `json:"dropped_rungs,omitempty"`
+}
+
+// TranscodingProgressEvent represents the progress of a transcoding job
+type TranscodingProgressEvent struct {
+	JobID     string `json:"job_id"`
+	VideoID   string `json:"video_id"`
+	UserID    string `json:"user_id"`
+	Status    string `json:"status"`
+	Progress  int    `json:"progress"`
+	Rendition string `json:"rendition,omitempty"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// TranscodingFailedEvent represents a transcoding job that failed for good, after its retries ran
+// out, because the input cannot be transcoded or because it was cancelled
+type TranscodingFailedEvent struct {
+	JobID      string `json:"job_id"`
+	VideoID    string `json:"video_id"`
+	UserID     string `json:"user_id"`
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+	Attempts   int    `json:"attempts"`
+	FailedAt   string `json:"failed_at"`
+}
+
+// DeadLetter is an upload event whose transcoding failed for good. The event is written to the
+// dead-letter topic unchanged, the failure is carried in message headers.
+type DeadLetter struct {
+	Event      VideoUploadEvent
+	JobID      string
+	ErrorClass string
+	Error      string
+	Attempts   int
+}
+
+// Dead-letter message headers
+const (
+	headerJobID      = "job_id"
+	headerErrorClass = "error_class"
+	headerError      = "error"
+	headerAttempts   = "attempts"
+)
+
 // Producer defines the interface for producing events
 type Producer interface {
 	// PublishTranscodingComplete publishes a transcoding completion event
 	PublishTranscodingComplete(ctx context.Context, event TranscodingCompleteEvent) error
 
+	// PublishTranscodingProgress publishes a transcoding progress event. Progress events are
+	// written asynchronously and may be lost.
+	PublishTranscodingProgress(ctx context.Context, event TranscodingProgressEvent) error
+
+	// PublishTranscodingFailed publishes a transcoding failure event
+	PublishTranscodingFailed(ctx context.Context, event TranscodingFailedEvent) error
+
+	// PublishDeadLetter writes an upload event that could not be transcoded to the dead-letter topic
+	PublishDeadLetter(ctx context.Context, letter DeadLetter) error
+
 	// Close closes the producer
 	Close() error
 }
 
+// ProducerTopics are the topics the producer writes to
+type ProducerTopics struct {
+	Complete   string
+	Progress   string
+	Failed     string
+	DeadLetter string
+}
+
 // KafkaProducer implements the Producer interface using Kafka
 type KafkaProducer struct {
-	writer *kafka.Writer
-	topic  string
+	writer           *kafka.Writer
+	progressWriter   *kafka.Writer
+	failedWriter     *kafka.Writer
+	deadLetterWriter *kafka.Writer
+	topic            string
 }
 
 // NewKafkaProducer creates a new Kafka producer
-func NewKafkaProducer(brokers []string, topic string) *KafkaProducer {
+func NewKafkaProducer(brokers []string, topics ProducerTopics) *KafkaProducer {
 	// Try to create topic with retries
 	var conn *kafka.Conn
 	var err error
@@ -55,39 +177,103 @@ func NewKafkaProducer(brokers []string, topic string) *KafkaProducer {
 	} else {
 		defer conn.Close()
 
-		// Create topic with 3 partitions and replication factor of 1
-		topicConfigs := []kafka.TopicConfig{
-			{
+		// Create topics with 3 partitions and replication factor of 1
+		var topicConfigs []kafka.TopicConfig
+		for _, topic := range []string{topics.Complete, topics.Progress, topics.Failed, topics.DeadLetter} {
+			topicConfigs = append(topicConfigs, kafka.TopicConfig{
 				Topic:             topic,
 				NumPartitions:     3,
 				ReplicationFactor: 1,
-			},
+			})
 		}
 
 		err = conn.CreateTopics(topicConfigs...)
 		if err != nil {
 			fmt.Printf("Failed to create topic (this is normal if it already exists): %v\n", err)
 		} else {
-			fmt.Printf("Created Kafka topic: %s\n", topic)
+			fmt.Printf("Created Kafka topics: %s, %s, %s, %s\n", topics.Complete, topics.Progress, topics.Failed, topics.DeadLetter)
 		}
 	}
 
 	return &KafkaProducer{
-		writer: &kafka.Writer{
+		writer:           newWriter(brokers, topics.Complete),
+		failedWriter:     newWriter(brokers, topics.Failed),
+		deadLetterWriter: newWriter(brokers, topics.DeadLetter),
+		// Progress is superseded by the next event, a slow broker must not hold up transcoding
+		progressWriter: &kafka.Writer{
 			Addr:         kafka.TCP(brokers...),
-			Topic:        topic,
-			Balancer:     &kafka.LeastBytes{},
+			Topic:        topics.Progress,
+			Balancer:     &kafka.Hash{},
 			RequiredAcks: kafka.RequireOne,
-			Async:        false, // Synchronous writes for better reliability
+			Async:        true,
 			BatchTimeout: 10 * time.Millisecond,
-			MaxAttempts:  3,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					fmt.Printf("Failed to publish %d progress events: %v\n", len(messages), err)
+				}
+			},
 		},
-		topic: topic,
+		topic: topics.Complete,
+	}
+}
+
+// newWriter creates a synchronous writer for topic
+func newWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireOne,
+		Async:        false, // Synchronous writes for better reliability
+		BatchTimeout: 10 * time.Millisecond,
+		MaxAttempts:  3,
 	}
 }
 
 // PublishTranscodingComplete publishes a transcoding completion event
 func (p *KafkaProducer) PublishTranscodingComplete(ctx context.Context, event TranscodingCompleteEvent) error {
+	return publish(ctx, p.writer, kafka.Message{}, event)
+}
+
+// PublishTranscodingProgress publishes a transcoding progress event. Events are keyed by job ID
+// so the events of a job stay in order.
+func (p *KafkaProducer) PublishTranscodingProgress(ctx context.Context, event TranscodingProgressEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	err = p.progressWriter.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.JobID),
+		Value: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return nil
+}
+
+// PublishTranscodingFailed publishes a transcoding failure event
+func (p *KafkaProducer) PublishTranscodingFailed(ctx context.Context, event TranscodingFailedEvent) error {
+	return publish(ctx, p.failedWriter, kafka.Message{Key: []byte(event.VideoID)}, event)
+}
+
+// PublishDeadLetter writes an upload event that could not be transcoded to the dead-letter topic
+func (p *KafkaProducer) PublishDeadLetter(ctx context.Context, letter DeadLetter) error {
+	return publish(ctx, p.deadLetterWriter, kafka.Message{
+		Key: []byte(letter.Event.VideoID),
+		Headers: []kafka.Header{
+			{Key: headerJobID, Value: []byte(letter.JobID)},
+			{Key: headerErrorClass, Value: []byte(letter.ErrorClass)},
+			{Key: headerError, Value: []byte(letter.Error)},
+			{Key: headerAttempts, Value: []byte(strconv.Itoa(letter.Attempts))},
+		},
+	}, letter.Event)
+}
+
+// publish writes event as the value of msg
+func publish(ctx context.Context, writer *kafka.Writer, msg kafka.Message, event interface{}) error {
 	payload, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
@@ -97,10 +283,8 @@ func (p *KafkaProducer) PublishTranscodingComplete(ctx context.Context, event Tr
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err = p.writer.WriteMessages(ctx, kafka.Message{
-		Value: payload,
-	})
-	if err != nil {
+	msg.Value = payload
+	if err := writer.WriteMessages(ctx, msg); err != nil {
 		return fmt.Errorf("failed to publish event: %w", err)
 	}
 
@@ -109,5 +293,11 @@ func (p *KafkaProducer) PublishTranscodingComplete(ctx context.Context, event Tr
 
 // Close closes the producer
 func (p *KafkaProducer) Close() error {
-	return p.writer.Close()
+	var firstErr error
+	for _, writer := range []*kafka.Writer{p.writer, p.progressWriter, p.failedWriter, p.deadLetterWriter} {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
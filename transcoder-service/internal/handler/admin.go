@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"youtube-clone-platform/transcoder-service/internal/jobs"
+	"youtube-clone-platform/transcoder-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// AdminRole is the role required for the admin endpoints
+	AdminRole = "admin"
+
+	defaultRedriveLimit = 10
+	maxRedriveLimit     = 100
+)
+
+// RequireAdmin rejects requests whose gateway forwarded role is not admin
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminHandler serves operational endpoints of the transcoder service
+type AdminHandler struct {
+	transcoderService *service.TranscoderService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(transcoderService *service.TranscoderService) *AdminHandler {
+	return &AdminHandler{
+		transcoderService: transcoderService,
+	}
+}
+
+// HandleRedriveDeadLetters handles POST /api/v1/transcoder/admin/dlq/redrive. Up to limit upload
+// events are read from the dead-letter topic and queued as new jobs.
+func (h *AdminHandler) HandleRedriveDeadLetters(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRedriveLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultRedriveLimit
+	}
+	if limit > maxRedriveLimit {
+		limit = maxRedriveLimit
+	}
+
+	redriven, err := h.transcoderService.RedriveDeadLetters(c.Request.Context(), limit)
+	if redriven == nil {
+		redriven = []*jobs.Job{}
+	}
+	if err != nil {
+		// Events re-driven before the error stay queued
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+			"count": len(redriven),
+			"jobs":  redriven,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(redriven),
+		"jobs":  redriven,
+	})
+}
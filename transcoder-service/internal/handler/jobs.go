@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"youtube-clone-platform/transcoder-service/internal/events"
+	"youtube-clone-platform/transcoder-service/internal/jobs"
+	"youtube-clone-platform/transcoder-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultJobLimit = 20
+	maxJobLimit     = 100
+
+	// progressKeepAlive is how often an idle progress stream sends a comment so that proxies do
+	// not close it
+	progressKeepAlive = 15 * time.Second
+)
+
+// JobHandler handles transcoding job requests
+type JobHandler struct {
+	transcoderService *service.TranscoderService
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(transcoderService *service.TranscoderService) *JobHandler {
+	return &JobHandler{
+		transcoderService: transcoderService,
+	}
+}
+
+// createJobRequest asks for an uploaded video to be transcoded again. The dimensions are probed
+// from the original file when they are not given. The job belongs to the owner of the video, which
+// has to be given as UserID for videos that were never transcoded.
+type createJobRequest struct {
+	VideoID       string `json:"video_id" binding:"required"`
+	UserID        string `json:"user_id"`
+	Title         string `json:"title"`
+	FileExtension string `json:"file_extension"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+}
+
+// HandleCreateJob handles POST /api/v1/transcoder/jobs. Only the owner of the video, known from its
+// earlier jobs, and admins can transcode it again.
+func (h *JobHandler) HandleCreateJob(c *gin.Context) {
+	var req createJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "video_id is required"})
+		return
+	}
+	if req.FileExtension == "" {
+		req.FileExtension = ".mp4"
+	}
+	if !fileExtensionRegex.MatchString(req.FileExtension) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file extension"})
+		return
+	}
+	if req.Width < 0 || req.Height < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "width and height must not be negative"})
+		return
+	}
+
+	owner, err := h.transcoderService.VideoOwner(c.Request.Context(), req.VideoID)
+	if err != nil && !errors.Is(err, jobs.ErrJobNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Videos that were never transcoded have no known owner, only admins can queue them
+	if !isAdmin(c) && (err != nil || owner != c.GetHeader("X-User-ID")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner of the video can transcode it"})
+		return
+	}
+	if err != nil {
+		if req.UserID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required for videos that were never transcoded"})
+			return
+		}
+		owner = req.UserID
+	}
+
+	job, created, err := h.transcoderService.EnqueueJob(c.Request.Context(), events.VideoUploadEvent{
+		VideoID: req.VideoID,
+		UserID:  owner,
+		Title:   req.Title,
+		Metadata: events.VideoMetadata{
+			Width:         req.Width,
+			Height:        req.Height,
+			FileExtension: req.FileExtension,
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The video already has a job that is queued or running
+	if !created {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+	c.JSON(http.StatusCreated, job)
+}
+
+// HandleGetJob handles GET /api/v1/transcoder/jobs/:id
+func (h *JobHandler) HandleGetJob(c *gin.Context) {
+	job, err := h.transcoderService.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	if !canAccessJob(c, job) {
+		writeJobForbidden(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// HandleJobProgress handles GET /api/v1/transcoder/jobs/:id/progress. The progress of the job is
+// streamed as Server-Sent Events until the job finishes or the client disconnects. Jobs waiting
+// for a retry keep their stream open.
+func (h *JobHandler) HandleJobProgress(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	// Subscribe before reading the job so no update is missed
+	updates, unsubscribe := h.transcoderService.SubscribeProgress(id)
+	defer func() { unsubscribe() }()
+
+	job, progress, err := h.transcoderService.JobProgress(ctx, id)
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	if !canAccessJob(c, job) {
+		writeJobForbidden(c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("progress", progress)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+
+	for !jobs.IsTerminal(job.Status) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			c.Writer.WriteString(": keep-alive\n\n")
+			c.Writer.Flush()
+		case update, ok := <-updates:
+			if ok {
+				progress = update
+				c.SSEvent("progress", progress)
+				c.Writer.Flush()
+				continue
+			}
+
+			// The job stopped running, follow it if it is retried
+			unsubscribe()
+			updates, unsubscribe = h.transcoderService.SubscribeProgress(id)
+
+			var current events.TranscodingProgressEvent
+			if job, current, err = h.transcoderService.JobProgress(ctx, id); err != nil {
+				return
+			}
+			// Skip the final state if it was the last update
+			if current.Status != progress.Status || current.Progress != progress.Progress {
+				progress = current
+				c.SSEvent("progress", progress)
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+// HandleListJobs handles GET /api/v1/transcoder/jobs. Admins see every job, other users the jobs of
+// their videos.
+func (h *JobHandler) HandleListJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultJobLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultJobLimit
+	}
+	if limit > maxJobLimit {
+		limit = maxJobLimit
+	}
+
+	status := c.Query("status")
+	if status != "" && !jobs.ValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job status"})
+		return
+	}
+
+	filter := jobs.Filter{
+		Status:  status,
+		VideoID: c.Query("video_id"),
+		Limit:   limit,
+	}
+	if !isAdmin(c) {
+		filter.UserID = c.GetHeader("X-User-ID")
+		if filter.UserID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user ID required"})
+			return
+		}
+	}
+
+	list, err := h.transcoderService.ListJobs(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []*jobs.Job{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(list),
+		"jobs":  list,
+	})
+}
+
+// HandleCancelJob handles POST /api/v1/transcoder/jobs/:id/cancel
+func (h *JobHandler) HandleCancelJob(c *gin.Context) {
+	job, err := h.transcoderService.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	if !canAccessJob(c, job) {
+		writeJobForbidden(c)
+		return
+	}
+
+	job, err = h.transcoderService.CancelJob(c.Request.Context(), job.ID)
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+
+	// Running jobs are cancelled asynchronously
+	if jobs.IsRunning(job.Status) {
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// isAdmin reports whether the gateway forwarded the admin role
+func isAdmin(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("X-User-Role"), AdminRole)
+}
+
+// canAccessJob reports whether the caller owns the video of a job or is an admin
+func canAccessJob(c *gin.Context, job *jobs.Job) bool {
+	if isAdmin(c) {
+		return true
+	}
+	userID := c.GetHeader("X-User-ID")
+	return userID != "" && userID == job.UserID
+}
+
+// writeJobForbidden rejects access to a job of another user
+func writeJobForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "job belongs to another user"})
+}
+
+// writeJobError maps job store errors to HTTP responses
+func writeJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, jobs.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"youtube-clone-platform/transcoder-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+var fileExtensionRegex = regexp.MustCompile(`^\.[a-zA-Z0-9]{1,8}$`)
+
+// ThumbnailHandler handles thumbnail regeneration requests of the metadata service
+type ThumbnailHandler struct {
+	transcoderService *service.TranscoderService
+}
+
+// NewThumbnailHandler creates a new thumbnail handler
+func NewThumbnailHandler(transcoderService *service.TranscoderService) *ThumbnailHandler {
+	return &ThumbnailHandler{
+		transcoderService: transcoderService,
+	}
+}
+
+// thumbnailRequest selects the frame a thumbnail is taken from
+type thumbnailRequest struct {
+	SourceVideoID string   `json:"source_video_id"`
+	FileExtension string   `json:"file_extension" binding:"required"`
+	Timestamp     *float64 `json:"timestamp" binding:"required"`
+}
+
+// HandleRegenerateThumbnail handles POST /api/v1/transcoder/videos/:videoID/thumbnail
+func (h *ThumbnailHandler) HandleRegenerateThumbnail(c *gin.Context) {
+	videoID := c.Param("videoID")
+
+	var req thumbnailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_extension and timestamp are required"})
+		return
+	}
+	if *req.Timestamp < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timestamp must not be negative"})
+		return
+	}
+	if !fileExtensionRegex.MatchString(req.FileExtension) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file extension"})
+		return
+	}
+	if req.SourceVideoID == "" {
+		req.SourceVideoID = videoID
+	}
+
+	thumbnailPath, err := h.transcoderService.RegenerateThumbnail(c.Request.Context(), videoID, req.SourceVideoID, req.FileExtension, *req.Timestamp)
+	if err != nil {
+		fmt.Printf("Failed to regenerate thumbnail for video %s: %v\n", videoID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"thumbnail_path": thumbnailPath})
+}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"youtube-clone-platform/transcoder-service/internal/events"
+)
+
+// Job statuses. A job moves through downloading, transcoding and uploading once per attempt and
+// ends as completed, failed or cancelled.
+const (
+	StatusQueued      = "queued"
+	StatusDownloading = "downloading"
+	StatusTranscoding = "transcoding"
+	StatusUploading   = "uploading"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusCancelled   = "cancelled"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrInvalidTransition = errors.New("invalid job status transition")
+)
+
+// transitions lists the statuses a job can move to from each status. Running jobs go back to
+// queued when they are interrupted by a shutdown or fail with attempts left.
+var transitions = map[string][]string{
+	StatusQueued:      {StatusDownloading, StatusFailed, StatusCancelled},
+	StatusDownloading: {StatusTranscoding, StatusQueued, StatusFailed, StatusCancelled},
+	StatusTranscoding: {StatusUploading, StatusQueued, StatusFailed, StatusCancelled},
+	StatusUploading:   {StatusCompleted, StatusQueued, StatusFailed, StatusCancelled},
+}
+
+// CanTransition reports whether a job can move from one status to another
+func CanTransition(from, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether a job in this status will not change anymore
+func IsTerminal(status string) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusCancelled
+}
+
+// IsRunning reports whether a job in this status is being worked on
+func IsRunning(status string) bool {
+	return status == StatusDownloading || status == StatusTranscoding || status == StatusUploading
+}
+
+// ValidStatus reports whether status is a job status
+func ValidStatus(status string) bool {
+	return status == StatusQueued || IsRunning(status) || IsTerminal(status)
+}
+
+// Job is a request to transcode an uploaded video
+type Job struct {
+	ID          string                  `json:"job_id"`
+	VideoID     string                  `json:"video_id"`
+	UserID      string                  `json:"user_id"`
+	Status      string                  `json:"status"`
+	Request     events.VideoUploadEvent `json:"-"`
+	Attempts    int                     `json:"attempts"`
+	Progress    int                     `json:"progress"`
+	Error       string                  `json:"error,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
+	StartedAt   *time.Time              `json:"started_at,omitempty"`
+	CompletedAt *time.Time              `json:"completed_at,omitempty"`
+	// NextAttemptAt is set while a failed job waits to be retried
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// Ladder is the encoding ladder picked for the video, set once transcoding starts
+	Ladder  *events.EncodingLadder `json:"ladder,omitempty"`
+	History []Transition           `json:"history,omitempty"`
+}
+
+// Transition is a status a job went through
+type Transition struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transitionError describes a rejected status change
+func transitionError(id, from, to string) error {
+	return fmt.Errorf("%w: job %s is %s, cannot become %s", ErrInvalidTransition, id, from, to)
+}
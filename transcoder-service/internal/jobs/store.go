@@ -0,0 +1,392 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"youtube-clone-platform/transcoder-service/internal/events"
+)
+
+const jobColumns = `id, video_id, user_id, status, request, attempts, progress, error,
+	created_at, updated_at, started_at, completed_at, next_attempt_at, ladder`
+
+// Filter selects the jobs returned by List. Empty fields match every job.
+type Filter struct {
+	Status  string
+	VideoID string
+	// UserID limits the jobs to the videos of a user
+	UserID string
+	Limit  int
+}
+
+// Store keeps transcoding jobs in SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a job store on an opened database
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create records a queued job for an upload event
+func (s *Store) Create(ctx context.Context, request events.VideoUploadEvent) (*Job, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job request: %w", err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        uuid.NewString(),
+		VideoID:   request.VideoID,
+		UserID:    request.UserID,
+		Status:    StatusQueued,
+		Request:   request,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO jobs (id, video_id, user_id, status, request, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.VideoID, job.UserID, job.Status, payload, toMillis(now), toMillis(now)); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	if err := addTransition(ctx, tx, job.ID, StatusQueued, "", now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job: %w", err)
+	}
+
+	job.History = []Transition{{Status: StatusQueued, CreatedAt: now}}
+	return job, nil
+}
+
+// Get returns a job with its status history
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	job, err := s.get(ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT status, error, created_at FROM job_transitions
+		WHERE job_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			transition Transition
+			errMsg     sql.NullString
+			createdAt  int64
+		)
+		if err := rows.Scan(&transition.Status, &errMsg, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job history: %w", err)
+		}
+		transition.Error = errMsg.String
+		transition.CreatedAt = fromMillis(createdAt)
+		job.History = append(job.History, transition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+
+	return job, nil
+}
+
+// List returns jobs matching the filter, newest first
+func (s *Store) List(ctx context.Context, filter Filter) ([]*Job, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.VideoID != "" {
+		conditions = append(conditions, "video_id = ?")
+		args = append(args, filter.VideoID)
+	}
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	return s.query(ctx, query, args...)
+}
+
+// ActiveForVideo returns the queued or running job of a video, or nil if there is none
+func (s *Store) ActiveForVideo(ctx context.Context, videoID string) (*Job, error) {
+	jobs, err := s.query(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE video_id = ? AND status NOT IN (?, ?, ?)
+		ORDER BY created_at
+		LIMIT 1`,
+		videoID, StatusCompleted, StatusFailed, StatusCancelled)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// ClaimNext moves the oldest queued job that is not waiting for a retry to downloading and
+// returns it, or nil if no job is ready
+func (s *Store) ClaimNext(ctx context.Context) (*Job, error) {
+	jobs, err := s.query(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		ORDER BY created_at
+		LIMIT 1`,
+		StatusQueued, toMillis(time.Now()))
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return s.Transition(ctx, jobs[0].ID, StatusDownloading, "")
+}
+
+// Transition moves a job to another status and records it in the job history. Moving to
+// downloading starts a new attempt. errMsg is recorded as the job error if it is not empty.
+func (s *Store) Transition(ctx context.Context, id string, to string, errMsg string) (*Job, error) {
+	return s.transition(ctx, id, to, errMsg, nil)
+}
+
+// Retry queues a running job that failed again. It is not claimed before nextAttemptAt.
+func (s *Store) Retry(ctx context.Context, id string, errMsg string, nextAttemptAt time.Time) (*Job, error) {
+	return s.transition(ctx, id, StatusQueued, errMsg, &nextAttemptAt)
+}
+
+func (s *Store) transition(ctx context.Context, id string, to string, errMsg string, nextAttemptAt *time.Time) (*Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := s.get(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(job.Status, to) {
+		return nil, transitionError(id, job.Status, to)
+	}
+
+	now := time.Now().UTC()
+	job.Status = to
+	job.UpdatedAt = now
+	job.NextAttemptAt = nextAttemptAt
+	switch {
+	case to == StatusDownloading:
+		job.Attempts++
+		job.Progress = 0
+		job.StartedAt = &now
+		job.CompletedAt = nil
+	case IsTerminal(to):
+		job.CompletedAt = &now
+	}
+	if to == StatusCompleted {
+		job.Progress = 100
+		job.Error = ""
+	} else if errMsg != "" {
+		job.Error = errMsg
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = ?, attempts = ?, progress = ?, error = ?, updated_at = ?, started_at = ?, completed_at = ?,
+			next_attempt_at = ?
+		WHERE id = ?`,
+		job.Status, job.Attempts, job.Progress, nullString(job.Error), toMillis(now),
+		nullMillis(job.StartedAt), nullMillis(job.CompletedAt), nullMillis(job.NextAttemptAt), id); err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+	if err := addTransition(ctx, tx, id, to, errMsg, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job transition: %w", err)
+	}
+
+	return job, nil
+}
+
+// SetProgress records the percentage of a running job that is done. Jobs that are not running
+// are left unchanged.
+func (s *Store) SetProgress(ctx context.Context, id string, progress int) error {
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET progress = ?
+		WHERE id = ? AND status IN (?, ?, ?)`,
+		progress, id, StatusDownloading, StatusTranscoding, StatusUploading); err != nil {
+		return fmt.Errorf("failed to update job progress: %w", err)
+	}
+	return nil
+}
+
+// SetLadder records the encoding ladder picked for the video of a job
+func (s *Store) SetLadder(ctx context.Context, id string, ladder *events.EncodingLadder) error {
+	payload, err := json.Marshal(ladder)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job ladder: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE jobs SET ladder = ? WHERE id = ?`, payload, id); err != nil {
+		return fmt.Errorf("failed to update job ladder: %w", err)
+	}
+	return nil
+}
+
+// RequeueRunning moves jobs that were running when the service stopped back to queued
+func (s *Store) RequeueRunning(ctx context.Context, reason string) (int, error) {
+	jobs, err := s.query(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE status IN (?, ?, ?)`,
+		StatusDownloading, StatusTranscoding, StatusUploading)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		if _, err := s.Transition(ctx, job.ID, StatusQueued, reason); err != nil {
+			return 0, err
+		}
+	}
+	return len(jobs), nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *Store) get(ctx context.Context, db queryer, id string) (*Job, error) {
+	jobs, err := scanJobs(db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrJobNotFound
+	}
+	return jobs[0], nil
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]*Job, error) {
+	return scanJobs(s.db.QueryContext(ctx, query, args...))
+}
+
+func scanJobs(rows *sql.Rows, err error) ([]*Job, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		var (
+			job                                   Job
+			request, ladder                       []byte
+			errMsg                                sql.NullString
+			createdAt, updatedAt                  int64
+			startedAt, completedAt, nextAttemptAt sql.NullInt64
+		)
+		if err := rows.Scan(
+			&job.ID,
+			&job.VideoID,
+			&job.UserID,
+			&job.Status,
+			&request,
+			&job.Attempts,
+			&job.Progress,
+			&errMsg,
+			&createdAt,
+			&updatedAt,
+			&startedAt,
+			&completedAt,
+			&nextAttemptAt,
+			&ladder,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		if err := json.Unmarshal(request, &job.Request); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal request of job %s: %w", job.ID, err)
+		}
+		if ladder != nil {
+			if err := json.Unmarshal(ladder, &job.Ladder); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal ladder of job %s: %w", job.ID, err)
+			}
+		}
+
+		job.Error = errMsg.String
+		job.CreatedAt = fromMillis(createdAt)
+		job.UpdatedAt = fromMillis(updatedAt)
+		if startedAt.Valid {
+			started := fromMillis(startedAt.Int64)
+			job.StartedAt = &started
+		}
+		if completedAt.Valid {
+			completed := fromMillis(completedAt.Int64)
+			job.CompletedAt = &completed
+		}
+		if nextAttemptAt.Valid {
+			next := fromMillis(nextAttemptAt.Int64)
+			job.NextAttemptAt = &next
+		}
+		jobs = append(jobs, &job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func addTransition(ctx context.Context, tx *sql.Tx, id string, status string, errMsg string, at time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO job_transitions (job_id, status, error, created_at)
+		VALUES (?, ?, ?, ?)`,
+		id, status, nullString(errMsg), toMillis(at)); err != nil {
+		return fmt.Errorf("failed to record job transition: %w", err)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullMillis(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: toMillis(*t), Valid: true}
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"youtube-clone-platform/transcoder-service/internal/events"
+	"youtube-clone-platform/transcoder-service/internal/jobs"
+)
+
+// Error classes of failed jobs, published with the failure event
+const (
+	ErrorClassDownload     = "download"
+	ErrorClassInvalidInput = "invalid_input"
+	ErrorClassTranscode    = "transcode"
+	ErrorClassUpload       = "upload"
+	ErrorClassPublish      = "publish"
+	ErrorClassTimeout      = "timeout"
+	ErrorClassCancelled    = "cancelled"
+	ErrorClassInternal     = "internal"
+)
+
+// RetryPolicy decides how often and when failed jobs are tried again
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts a job gets, including the first one
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles with every further retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+}
+
+// delay returns how long to wait after the given number of failed attempts
+func (p RetryPolicy) delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// jobError is a processing error with the class it is reported as
+type jobError struct {
+	class string
+	err   error
+}
+
+func (e *jobError) Error() string { return e.err.Error() }
+func (e *jobError) Unwrap() error { return e.err }
+
+// classify wraps err with an error class
+func classify(class string, err error) error {
+	return &jobError{class: class, err: err}
+}
+
+// errorClass returns the class of a processing error. Errors caused by the job timeout are
+// classified as timeouts whatever step they happened in.
+func errorClass(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+	var jobErr *jobError
+	if errors.As(err, &jobErr) {
+		return jobErr.class
+	}
+	return ErrorClassInternal
+}
+
+// retryable reports whether a job that failed with an error of this class can succeed on
+// another attempt
+func retryable(class string) bool {
+	return class != ErrorClassInvalidInput && class != ErrorClassCancelled
+}
+
+// failJob retries a failed job if it has attempts left, otherwise it marks the job failed,
+// publishes the failure and sends the upload event to the dead-letter topic
+func (s *TranscoderService) failJob(job *jobs.Job, tracker *progressTracker, err error) {
+	class := errorClass(err)
+	if retryable(class) && job.Attempts < s.retry.MaxAttempts {
+		delay := s.retry.delay(job.Attempts)
+		if _, retryErr := s.jobs.Retry(context.Background(), job.ID, err.Error(), time.Now().Add(delay)); retryErr != nil {
+			fmt.Printf("Failed to queue retry of job %s: %v\n", job.ID, retryErr)
+		} else {
+			fmt.Printf("Retrying transcoding job %s for video %s in %s (attempt %d of %d failed: %v)\n",
+				job.ID, job.VideoID, delay, job.Attempts, s.retry.MaxAttempts, err)
+		}
+		tracker.finish(jobs.StatusQueued)
+		return
+	}
+
+	fmt.Printf("Transcoding job %s for video %s failed after %d attempts: %v\n", job.ID, job.VideoID, job.Attempts, err)
+	s.finishJob(job, jobs.StatusFailed, err.Error())
+	tracker.finish(jobs.StatusFailed)
+	s.publishFailure(job, class, err.Error())
+
+	letter := events.DeadLetter{
+		Event:      job.Request,
+		JobID:      job.ID,
+		ErrorClass: class,
+		Error:      err.Error(),
+		Attempts:   job.Attempts,
+	}
+	if err := s.producer.PublishDeadLetter(context.Background(), letter); err != nil {
+		fmt.Printf("Failed to dead-letter upload event of video %s: %v\n", job.VideoID, err)
+	}
+}
+
+// publishFailure tells other services that a video will not be transcoded
+func (s *TranscoderService) publishFailure(job *jobs.Job, class string, reason string) {
+	event := events.TranscodingFailedEvent{
+		JobID:      job.ID,
+		VideoID:    job.VideoID,
+		UserID:     job.UserID,
+		ErrorClass: class,
+		Error:      reason,
+		Attempts:   job.Attempts,
+		FailedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := s.producer.PublishTranscodingFailed(context.Background(), event); err != nil {
+		fmt.Printf("Failed to publish failure of video %s: %v\n", job.VideoID, err)
+	}
+}
+
+// RedriveDeadLetters queues a new job for up to limit upload events from the dead-letter topic
+// and returns the jobs
+func (s *TranscoderService) RedriveDeadLetters(ctx context.Context, limit int) ([]*jobs.Job, error) {
+	var redriven []*jobs.Job
+	_, err := s.deadLetters.Redrive(ctx, limit, func(ctx context.Context, letter events.DeadLetter) error {
+		job, _, err := s.EnqueueJob(ctx, letter.Event)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Re-drove video %s from the dead-letter topic as job %s (was job %s, %s)\n",
+			letter.Event.VideoID, job.ID, letter.JobID, letter.ErrorClass)
+		redriven = append(redriven, job)
+		return nil
+	})
+	return redriven, err
+}
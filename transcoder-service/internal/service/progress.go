@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"youtube-clone-platform/transcoder-service/internal/events"
+	"youtube-clone-platform/transcoder-service/internal/jobs"
+	"youtube-clone-platform/transcoder-service/internal/transcoder"
+)
+
+// progressPublishInterval is how often the progress of a job is published and stored at most.
+// Status changes are always published.
+const progressPublishInterval = time.Second
+
+// stageSpans is the range of the overall percentage each stage of a job covers. Transcoding takes
+// most of the time.
+var stageSpans = map[string][2]float64{
+	jobs.StatusDownloading: {0, 5},
+	jobs.StatusTranscoding: {5, 90},
+	jobs.StatusUploading:   {90, 100},
+}
+
+// progressTracker turns the stages and FFmpeg output positions of a running job into a percentage.
+// Every change is passed to subscribers, Kafka and the job store only get throttled updates.
+type progressTracker struct {
+	service  *TranscoderService
+	jobID    string
+	videoID  string
+	userID   string
+	duration time.Duration
+
+	mu        sync.Mutex
+	current   events.TranscodingProgressEvent
+	percent   float64
+	published time.Time
+}
+
+// newProgressTracker creates the tracker of a claimed job. duration is the length of the source
+// video, without it transcoding only advances when a rendition is finished.
+func (s *TranscoderService) newProgressTracker(job *jobs.Job, duration time.Duration) *progressTracker {
+	return &progressTracker{
+		service:  s,
+		jobID:    job.ID,
+		videoID:  job.VideoID,
+		userID:   job.UserID,
+		duration: duration,
+		current: events.TranscodingProgressEvent{
+			JobID:   job.ID,
+			VideoID: job.VideoID,
+			UserID:  job.UserID,
+		},
+	}
+}
+
+// update records that a fraction, between 0 and 1, of a stage is done. The percentage never goes
+// back during an attempt.
+func (t *progressTracker) update(status string, fraction float64, rendition string) {
+	span := stageSpans[status]
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if percent := span[0] + (span[1]-span[0])*fraction; percent > t.percent {
+		t.percent = percent
+	}
+	t.set(status, int(t.percent), rendition, false)
+}
+
+// transcoding returns the progress callback of the run-th of runs transcoding runs
+func (t *progressTracker) transcoding(run, runs int) transcoder.ProgressFunc {
+	return func(progress transcoder.Progress) {
+		fraction := (float64(run) + progress.Fraction(t.duration)) / float64(runs)
+		t.update(jobs.StatusTranscoding, fraction, progress.Rendition)
+	}
+}
+
+// finish publishes the final status of the job and closes the progress streams of its subscribers
+func (t *progressTracker) finish(status string) {
+	t.mu.Lock()
+	progress := int(t.percent)
+	if status == jobs.StatusCompleted {
+		progress = 100
+	}
+	t.set(status, progress, "", true)
+	t.mu.Unlock()
+
+	t.service.progress.finish(t.jobID)
+}
+
+// set stores a new state and passes it on. t.mu must be held.
+func (t *progressTracker) set(status string, progress int, rendition string, final bool) {
+	changed := status != t.current.Status
+	if !changed && progress == t.current.Progress && rendition == t.current.Rendition {
+		return
+	}
+
+	t.current.Status = status
+	t.current.Progress = progress
+	t.current.Rendition = rendition
+	t.current.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	t.service.progress.update(t.current)
+
+	if !changed && !final && time.Since(t.published) < progressPublishInterval {
+		return
+	}
+	t.published = time.Now()
+
+	// The job context may already be canceled when the final status is published
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.service.producer.PublishTranscodingProgress(ctx, t.current); err != nil {
+		fmt.Printf("Failed to publish progress of job %s: %v\n", t.jobID, err)
+	}
+	if !final {
+		if err := t.service.jobs.SetProgress(ctx, t.jobID, progress); err != nil {
+			fmt.Printf("Failed to store progress of job %s: %v\n", t.jobID, err)
+		}
+	}
+}
+
+// progressHub keeps the latest progress of running jobs and passes it on to subscribers
+type progressHub struct {
+	mu   sync.Mutex
+	jobs map[string]*jobProgress
+}
+
+type jobProgress struct {
+	latest      *events.TranscodingProgressEvent
+	subscribers map[chan events.TranscodingProgressEvent]struct{}
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{jobs: make(map[string]*jobProgress)}
+}
+
+// entry returns the progress of a job, creating it if needed. h.mu must be held.
+func (h *progressHub) entry(jobID string) *jobProgress {
+	entry, ok := h.jobs[jobID]
+	if !ok {
+		entry = &jobProgress{subscribers: make(map[chan events.TranscodingProgressEvent]struct{})}
+		h.jobs[jobID] = entry
+	}
+	return entry
+}
+
+// update stores the progress of a job and sends it to its subscribers. Subscribers that are
+// behind only receive the latest progress.
+func (h *progressHub) update(event events.TranscodingProgressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := h.entry(event.JobID)
+	entry.latest = &event
+	for ch := range entry.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Replace the progress the subscriber has not read yet
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- event
+		}
+	}
+}
+
+// latest returns the last progress of a running job
+func (h *progressHub) latest(jobID string) (events.TranscodingProgressEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if entry, ok := h.jobs[jobID]; ok && entry.latest != nil {
+		return *entry.latest, true
+	}
+	return events.TranscodingProgressEvent{}, false
+}
+
+// subscribe returns a channel that receives the progress of a job until it stops running, it is
+// closed then. The returned function ends the subscription.
+func (h *progressHub) subscribe(jobID string) (<-chan events.TranscodingProgressEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan events.TranscodingProgressEvent, 1)
+	h.entry(jobID).subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		entry, ok := h.jobs[jobID]
+		if !ok {
+			return
+		}
+		delete(entry.subscribers, ch)
+		// Drop entries of jobs that were only watched, running jobs are dropped by finish
+		if len(entry.subscribers) == 0 && entry.latest == nil {
+			delete(h.jobs, jobID)
+		}
+	}
+}
+
+// finish closes the channels of the subscribers of a job and forgets its progress
+func (h *progressHub) finish(jobID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry, ok := h.jobs[jobID]
+	if !ok {
+		return
+	}
+	for ch := range entry.subscribers {
+		close(ch)
+	}
+	delete(h.jobs, jobID)
+}
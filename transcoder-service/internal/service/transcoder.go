@@ -2,197 +2,720 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	"youtube-clone-platform/transcoder-service/internal/events"
+	"youtube-clone-platform/transcoder-service/internal/jobs"
 	"youtube-clone-platform/transcoder-service/internal/storage"
 	"youtube-clone-platform/transcoder-service/internal/transcoder"
 )
 
+var (
+	errJobCancelled    = errors.New("job cancelled")
+	errServiceStopping = errors.New("transcoder service stopping")
+)
+
+// dispatchInterval is how often queued jobs are checked for retries that are due
+const dispatchInterval = 5 * time.Second
+
 // TranscoderService handles video transcoding operations
 type TranscoderService struct {
 	storage       storage.Storage
 	transcoder    transcoder.Transcoder
 	consumer      events.Consumer
 	producer      events.Producer
+	deadLetters   events.DeadLetterConsumer
+	jobs          *jobs.Store
 	maxJobs       int
 	jobTimeout    time.Duration
+	retry         RetryPolicy
 	tempDir       string
-	activeJobs    map[string]context.CancelFunc
+	ctx           context.Context
+	stop          context.CancelCauseFunc
+	activeJobs    map[string]context.CancelCauseFunc
 	activeJobsMux sync.Mutex
+	progress      *progressHub
 }
 
-// NewTranscoderService creates a new TranscoderService instance
+// NewTranscoderService creates a new TranscoderService instance. Jobs are persisted in jobStore
+// and at most maxJobs of them run at the same time. Failed jobs are retried according to retry,
+// the upload events of jobs that failed for good are re-driven from deadLetters.
 func NewTranscoderService(
 	storage storage.Storage,
 	transcoder transcoder.Transcoder,
 	consumer events.Consumer,
 	producer events.Producer,
+	deadLetters events.DeadLetterConsumer,
+	jobStore *jobs.Store,
 	maxJobs int,
 	jobTimeout time.Duration,
+	retry RetryPolicy,
 	tempDir string,
 ) *TranscoderService {
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		panic(fmt.Sprintf("failed to create temp directory: %v", err))
 	}
 
+	ctx, stop := context.WithCancelCause(context.Background())
 	return &TranscoderService{
-		storage:    storage,
-		transcoder: transcoder,
-		consumer:   consumer,
-		producer:   producer,
-		maxJobs:    maxJobs,
-		jobTimeout: jobTimeout,
-		tempDir:    tempDir,
-		activeJobs: make(map[string]context.CancelFunc),
+		storage:     storage,
+		transcoder:  transcoder,
+		consumer:    consumer,
+		producer:    producer,
+		deadLetters: deadLetters,
+		jobs:        jobStore,
+		maxJobs:     maxJobs,
+		jobTimeout:  jobTimeout,
+		retry:       retry,
+		tempDir:     tempDir,
+		ctx:         ctx,
+		stop:        stop,
+		activeJobs:  make(map[string]context.CancelCauseFunc),
+		progress:    newProgressHub(),
 	}
 }
 
-// Start starts the transcoder service
+// Start resumes the queued jobs and starts consuming upload events
 func (s *TranscoderService) Start(ctx context.Context) error {
+	// Jobs that were running when the service stopped start over
+	requeued, err := s.jobs.RequeueRunning(ctx, "interrupted by a restart")
+	if err != nil {
+		return fmt.Errorf("failed to requeue interrupted jobs: %w", err)
+	}
+	if requeued > 0 {
+		fmt.Printf("Requeued %d interrupted transcoding jobs\n", requeued)
+	}
+	s.dispatch()
+	go s.dispatchLoop()
+
+	// Upload events are committed once their job ended, the consumer stops fetching while all
+	// workers are busy with them
 	return s.consumer.Start(ctx, func(ctx context.Context, event events.VideoUploadEvent) error {
-		return s.handleVideoUpload(ctx, &event)
+		job, _, err := s.EnqueueJob(ctx, event)
+		if err != nil {
+			return err
+		}
+		_, err = s.waitForJob(ctx, job.ID)
+		return err
 	})
 }
 
-// Stop stops the transcoder service
+// Stop stops the transcoder service. Running jobs are interrupted and requeued on the next start.
 func (s *TranscoderService) Stop() {
-	s.activeJobsMux.Lock()
-	defer s.activeJobsMux.Unlock()
-
-	for _, cancel := range s.activeJobs {
-		cancel()
-	}
+	s.stop(errServiceStopping)
 
 	s.consumer.Close()
 	s.producer.Close()
 }
 
-// handleVideoUpload handles a video upload event
-func (s *TranscoderService) handleVideoUpload(ctx context.Context, event *events.VideoUploadEvent) error {
+// EnqueueJob queues a transcoding job for an uploaded video. If the video already has a queued or
+// running job, that job is returned and created is false.
+func (s *TranscoderService) EnqueueJob(ctx context.Context, event events.VideoUploadEvent) (job *jobs.Job, created bool, err error) {
+	// Upload events can be delivered more than once
+	active, err := s.jobs.ActiveForVideo(ctx, event.VideoID)
+	if err != nil {
+		return nil, false, err
+	}
+	if active != nil {
+		return active, false, nil
+	}
+
+	job, err = s.jobs.Create(ctx, event)
+	if err != nil {
+		return nil, false, err
+	}
+	fmt.Printf("Queued transcoding job %s for video %s\n", job.ID, job.VideoID)
+
+	s.dispatch()
+	return job, true, nil
+}
+
+// GetJob returns a job with its status history
+func (s *TranscoderService) GetJob(ctx context.Context, id string) (*jobs.Job, error) {
+	job, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.withLiveProgress(job)
+	return job, nil
+}
+
+// ListJobs returns jobs matching the filter, newest first
+func (s *TranscoderService) ListJobs(ctx context.Context, filter jobs.Filter) ([]*jobs.Job, error) {
+	list, err := s.jobs.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range list {
+		s.withLiveProgress(job)
+	}
+	return list, nil
+}
+
+// VideoOwner returns the user a video belongs to as recorded by its latest job. It returns
+// jobs.ErrJobNotFound if the video was never transcoded.
+func (s *TranscoderService) VideoOwner(ctx context.Context, videoID string) (string, error) {
+	list, err := s.jobs.List(ctx, jobs.Filter{VideoID: videoID, Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", jobs.ErrJobNotFound
+	}
+	return list[0].UserID, nil
+}
+
+// JobProgress returns a job and its current progress
+func (s *TranscoderService) JobProgress(ctx context.Context, id string) (*jobs.Job, events.TranscodingProgressEvent, error) {
+	job, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return nil, events.TranscodingProgressEvent{}, err
+	}
+
+	if jobs.IsRunning(job.Status) {
+		if latest, ok := s.progress.latest(id); ok {
+			return job, latest, nil
+		}
+	}
+	return job, events.TranscodingProgressEvent{
+		JobID:     job.ID,
+		VideoID:   job.VideoID,
+		UserID:    job.UserID,
+		Status:    job.Status,
+		Progress:  job.Progress,
+		UpdatedAt: job.UpdatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+// SubscribeProgress returns a channel that receives the progress of a job while it runs. The
+// channel is closed when the job stops running. The returned function ends the subscription.
+func (s *TranscoderService) SubscribeProgress(id string) (<-chan events.TranscodingProgressEvent, func()) {
+	return s.progress.subscribe(id)
+}
+
+// withLiveProgress replaces the stored progress of a running job, which is only updated
+// periodically, with its latest progress
+func (s *TranscoderService) withLiveProgress(job *jobs.Job) {
+	if !jobs.IsRunning(job.Status) {
+		return
+	}
+	if latest, ok := s.progress.latest(job.ID); ok {
+		job.Progress = latest.Progress
+	}
+}
+
+// waitForJob blocks until a job completed, failed for good or was cancelled
+func (s *TranscoderService) waitForJob(ctx context.Context, id string) (*jobs.Job, error) {
+	for {
+		// Subscribe before reading the job so its end is not missed
+		updates, unsubscribe := s.progress.subscribe(id)
+
+		job, err := s.jobs.Get(ctx, id)
+		if err != nil || jobs.IsTerminal(job.Status) {
+			unsubscribe()
+			return job, err
+		}
+
+		// The channel is closed whenever the job stops running, also when it is queued for a retry
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return nil, ctx.Err()
+			case _, open = <-updates:
+			}
+		}
+		unsubscribe()
+	}
+}
+
+// CancelJob cancels a queued or running job. Running jobs stop at the next FFmpeg or storage
+// call, the returned job is still running in that case.
+func (s *TranscoderService) CancelJob(ctx context.Context, id string) (*jobs.Job, error) {
+	// Hold the lock so the job cannot be claimed while it is cancelled
 	s.activeJobsMux.Lock()
 	defer s.activeJobsMux.Unlock()
 
-	// Check if job already exists
-	if _, exists := s.activeJobs[event.VideoID]; exists {
-		return fmt.Errorf("job already exists for video %s", event.VideoID)
+	if cancel, running := s.activeJobs[id]; running {
+		cancel(errJobCancelled)
+		return s.jobs.Get(ctx, id)
+	}
+
+	job, err := s.jobs.Transition(ctx, id, jobs.StatusCancelled, "cancelled by request")
+	if err != nil {
+		return nil, err
 	}
+	// End the progress streams of the queued job
+	s.progress.finish(id)
+	s.publishFailure(job, ErrorClassCancelled, "cancelled by request")
+	return job, nil
+}
 
-	// Check if we've reached the maximum number of jobs
-	if len(s.activeJobs) >= s.maxJobs {
-		return fmt.Errorf("maximum number of concurrent jobs reached")
+// dispatchLoop starts retries once they are due until the service stops
+func (s *TranscoderService) dispatchLoop() {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.dispatch()
+		}
 	}
+}
 
-	// Create a new context with timeout
-	jobCtx, cancel := context.WithTimeout(ctx, s.jobTimeout)
-	s.activeJobs[event.VideoID] = cancel
+// dispatch starts queued jobs until maxJobs jobs are running
+func (s *TranscoderService) dispatch() {
+	s.activeJobsMux.Lock()
+	defer s.activeJobsMux.Unlock()
+
+	for len(s.activeJobs) < s.maxJobs && s.ctx.Err() == nil {
+		job, err := s.jobs.ClaimNext(s.ctx)
+		if err != nil {
+			fmt.Printf("Failed to claim transcoding job: %v\n", err)
+			return
+		}
+		if job == nil {
+			return
+		}
 
-	// Start processing in a goroutine
-	go func() {
-		defer func() {
-			s.activeJobsMux.Lock()
-			delete(s.activeJobs, event.VideoID)
-			s.activeJobsMux.Unlock()
-		}()
+		jobCtx, cancel := context.WithCancelCause(s.ctx)
+		s.activeJobs[job.ID] = cancel
+		go s.runJob(jobCtx, job)
+	}
+}
 
-		if err := s.processVideo(jobCtx, event); err != nil {
-			fmt.Printf("Failed to process video %s: %v\n", event.VideoID, err)
+// runJob processes a claimed job and records how it ended
+func (s *TranscoderService) runJob(ctx context.Context, job *jobs.Job) {
+	defer func() {
+		s.activeJobsMux.Lock()
+		if cancel, ok := s.activeJobs[job.ID]; ok {
+			cancel(nil)
+			delete(s.activeJobs, job.ID)
 		}
+		s.activeJobsMux.Unlock()
+
+		// Make room for the next queued job
+		s.dispatch()
 	}()
 
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.jobTimeout)
+	defer cancel()
+
+	duration := time.Duration(job.Request.Metadata.Duration * float64(time.Second))
+	tracker := s.newProgressTracker(job, duration)
+	tracker.update(jobs.StatusDownloading, 0, "")
+
+	err := s.processVideo(timeoutCtx, job, tracker)
+	if err == nil {
+		tracker.finish(jobs.StatusCompleted)
+		return
+	}
+	if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+		err = classify(ErrorClassTimeout, err)
+	}
+
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, errServiceStopping):
+		// Left running, the job is requeued on the next start
+		fmt.Printf("Interrupted transcoding job %s for video %s\n", job.ID, job.VideoID)
+		s.progress.finish(job.ID)
+	case errors.Is(cause, errJobCancelled):
+		s.finishJob(job, jobs.StatusCancelled, "cancelled by request")
+		tracker.finish(jobs.StatusCancelled)
+		s.publishFailure(job, ErrorClassCancelled, "cancelled by request")
+	default:
+		s.failJob(job, tracker, err)
+	}
+}
+
+// advance moves a job to the next processing stage. The transition is recorded even if the job
+// context was canceled meanwhile.
+func (s *TranscoderService) advance(ctx context.Context, job *jobs.Job, status string) error {
+	updated, err := s.jobs.Transition(context.WithoutCancel(ctx), job.ID, status, "")
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+	*job = *updated
 	return nil
 }
 
-// processVideo processes a video
-func (s *TranscoderService) processVideo(ctx context.Context, event *events.VideoUploadEvent) error {
+// finishJob records that a job ended without completing
+func (s *TranscoderService) finishJob(job *jobs.Job, status string, reason string) {
+	if _, err := s.jobs.Transition(context.Background(), job.ID, status, reason); err != nil {
+		fmt.Printf("Failed to mark job %s %s: %v\n", job.ID, status, err)
+	}
+}
+
+// processVideo downloads, transcodes and uploads the video of a claimed job, which starts out
+// downloading, and publishes the completion event. Progress is reported to tracker.
+func (s *TranscoderService) processVideo(ctx context.Context, job *jobs.Job, tracker *progressTracker) error {
+	event := &job.Request
+
 	// Create temporary directory for the video
 	videoDir := filepath.Join(s.tempDir, event.VideoID)
 	if err := os.MkdirAll(videoDir, 0755); err != nil {
-		return fmt.Errorf("failed to create video directory: %w", err)
+		return classify(ErrorClassInternal, fmt.Errorf("failed to create video directory: %w", err))
 	}
 	defer os.RemoveAll(videoDir)
 
-	// Determine file extension from content type
-	fileExtension := ".mp4" // Default
-	if event.ContentType == "video/webm" {
-		fileExtension = ".webm"
-	} else if event.ContentType == "video/quicktime" {
-		fileExtension = ".mov"
+	// Determine file extension from the upload metadata or the content type
+	fileExtension := event.Metadata.FileExtension
+	if fileExtension == "" {
+		fileExtension = ".mp4" // Default
+		if event.ContentType == "video/webm" {
+			fileExtension = ".webm"
+		} else if event.ContentType == "video/quicktime" {
+			fileExtension = ".mov"
+		}
 	}
 
 	// Download video from MinIO
 	videoPath := filepath.Join(videoDir, "original"+fileExtension)
 	if err := s.storage.DownloadVideo(ctx, event.VideoID, fileExtension, videoPath); err != nil {
-		return fmt.Errorf("failed to download video: %w", err)
+		return classify(ErrorClassDownload, fmt.Errorf("failed to download video: %w", err))
 	}
 
-	// Get video dimensions
+	// Get video dimensions and duration. The upload metadata is only used if probing fails, jobs
+	// created through the API may not have it and it does not account for rotation.
 	width := event.Metadata.Width
 	height := event.Metadata.Height
+	probedWidth, probedHeight, duration, err := s.probeVideo(ctx, videoPath)
+	switch {
+	case err != nil && (width == 0 || height == 0):
+		return err
+	case err != nil:
+		// Without the duration progress only advances per rendition
+		fmt.Printf("Failed to probe video %s, using the upload metadata: %v\n", event.VideoID, err)
+	default:
+		width, height = probedWidth, probedHeight
+		if tracker.duration <= 0 {
+			// Set before any progress callback runs
+			tracker.duration = duration
+		}
+	}
+
+	if err := s.advance(ctx, job, jobs.StatusTranscoding); err != nil {
+		return err
+	}
+	tracker.update(jobs.StatusTranscoding, 0, "")
 
 	// Create output directories
 	hlsDir := filepath.Join(videoDir, "hls")
 	mp4Dir := filepath.Join(videoDir, "mp4")
 	if err := os.MkdirAll(hlsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create HLS directory: %w", err)
+		return classify(ErrorClassInternal, fmt.Errorf("failed to create HLS directory: %w", err))
 	}
 	if err := os.MkdirAll(mp4Dir, 0755); err != nil {
-		return fmt.Errorf("failed to create MP4 directory: %w", err)
+		return classify(ErrorClassInternal, fmt.Errorf("failed to create MP4 directory: %w", err))
+	}
+
+	// Pick the quality levels, per-title ladders analyze the content first
+	ladder, err := s.transcoder.PlanLadder(ctx, videoPath, width, height, tracker.duration)
+	if err != nil {
+		return classify(ErrorClassTranscode, fmt.Errorf("failed to plan encoding ladder: %w", err))
+	}
+	encodingLadder := newEncodingLadder(ladder)
+	if err := s.jobs.SetLadder(ctx, job.ID, encodingLadder); err != nil {
+		fmt.Printf("Failed to store encoding ladder of job %s: %v\n", job.ID, err)
 	}
 
-	// Transcode to HLS
-	if err := s.transcoder.TranscodeToHLS(ctx, videoPath, hlsDir, width, height); err != nil {
-		return fmt.Errorf("failed to transcode to HLS: %w", err)
+	// Measure the loudness of the audio, transcoding normalizes it. Videos are transcoded without
+	// normalization if the measurement fails.
+	loudness, err := s.transcoder.MeasureLoudness(ctx, videoPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return classify(ErrorClassTranscode, fmt.Errorf("failed to measure loudness: %w", err))
+		}
+		fmt.Printf("Failed to measure loudness of video %s, its audio is not normalized: %v\n", event.VideoID, err)
 	}
 
-	// Transcode to MP4
-	if err := s.transcoder.TranscodeToMP4(ctx, videoPath, mp4Dir, width, height); err != nil {
-		return fmt.Errorf("failed to transcode to MP4: %w", err)
+	// Transcode to HLS and MP4
+	if err := s.transcoder.TranscodeRenditions(ctx, videoPath, hlsDir, mp4Dir, ladder.Levels, loudness, tracker.transcoding(0, 1)); err != nil {
+		return classify(ErrorClassTranscode, fmt.Errorf("failed to transcode video: %w", err))
 	}
 
 	// Generate thumbnail
 	localThumbnailPath := filepath.Join(videoDir, "thumbnail.jpg")
-	if err := s.transcoder.GenerateThumbnail(ctx, videoPath, localThumbnailPath); err != nil {
-		return fmt.Errorf("failed to generate thumbnail: %w", err)
+	candidateDir := filepath.Join(videoDir, "candidates")
+	candidates, err := s.transcoder.GenerateThumbnail(ctx, videoPath, localThumbnailPath, candidateDir, tracker.duration)
+	if err != nil {
+		return classify(ErrorClassTranscode, fmt.Errorf("failed to generate thumbnail: %w", err))
+	}
+	thumbnailCandidates := newThumbnailCandidates(path.Join(s.storage.GetThumbnailPrefix(), event.VideoID, "candidates"), candidates)
+	if err := writeCandidateManifest(candidateDir, thumbnailCandidates); err != nil {
+		return classify(ErrorClassInternal, err)
+	}
+
+	// Generate the storyboard for seek previews, its cues need the duration
+	storyboardDir := filepath.Join(videoDir, "storyboard")
+	var localStoryboardPath string
+	if tracker.duration > 0 {
+		localStoryboardPath, err = s.transcoder.GenerateStoryboard(ctx, videoPath, storyboardDir, width, height, tracker.duration)
+		if err != nil {
+			return classify(ErrorClassTranscode, fmt.Errorf("failed to generate storyboard: %w", err))
+		}
+	} else {
+		fmt.Printf("Skipping the storyboard of video %s, its duration is unknown\n", event.VideoID)
+	}
+
+	// Generate the hover preview from segments spread over the video
+	previewDir := filepath.Join(videoDir, "preview")
+	var preview *transcoder.Preview
+	if tracker.duration > 0 {
+		preview, err = s.transcoder.GeneratePreview(ctx, videoPath, previewDir, width, height, tracker.duration)
+		if err != nil {
+			return classify(ErrorClassTranscode, fmt.Errorf("failed to generate preview: %w", err))
+		}
+	} else {
+		fmt.Printf("Skipping the preview of video %s, its duration is unknown\n", event.VideoID)
 	}
 
+	if err := s.advance(ctx, job, jobs.StatusUploading); err != nil {
+		return err
+	}
+	tracker.update(jobs.StatusUploading, 0, "")
+
 	// Upload HLS files
 	hlsPath, err := s.storage.UploadHLSFiles(ctx, event.VideoID, hlsDir)
 	if err != nil {
-		return fmt.Errorf("failed to upload HLS files: %w", err)
+		return classify(ErrorClassUpload, fmt.Errorf("failed to upload HLS files: %w", err))
 	}
+	tracker.update(jobs.StatusUploading, 0.5, "")
 
 	// Upload MP4 files
 	mp4Path := filepath.Join(s.storage.GetMP4Prefix(), event.VideoID)
 	if err := s.storage.UploadMP4Files(ctx, event.VideoID, mp4Dir); err != nil {
-		return fmt.Errorf("failed to upload MP4 files: %w", err)
+		return classify(ErrorClassUpload, fmt.Errorf("failed to upload MP4 files: %w", err))
 	}
+	tracker.update(jobs.StatusUploading, 0.95, "")
 
 	// Upload thumbnail
 	thumbnailPath, err := s.storage.UploadThumbnail(ctx, event.VideoID, localThumbnailPath)
 	if err != nil {
-		return fmt.Errorf("failed to upload thumbnail: %w", err)
+		return classify(ErrorClassUpload, fmt.Errorf("failed to upload thumbnail: %w", err))
+	}
+
+	// Upload the other thumbnail candidates for the creator to choose from
+	if err := s.storage.UploadThumbnailCandidates(ctx, event.VideoID, candidateDir); err != nil {
+		return classify(ErrorClassUpload, fmt.Errorf("failed to upload thumbnail candidates: %w", err))
+	}
+
+	// Upload storyboard
+	var storyboardPath string
+	if localStoryboardPath != "" {
+		if storyboardPath, err = s.storage.UploadStoryboard(ctx, event.VideoID, storyboardDir); err != nil {
+			return classify(ErrorClassUpload, fmt.Errorf("failed to upload storyboard: %w", err))
+		}
+	}
+
+	// Upload preview
+	var previewWebPPath, previewMP4Path string
+	if preview != nil {
+		if previewWebPPath, previewMP4Path, err = s.storage.UploadPreview(ctx, event.VideoID, previewDir); err != nil {
+			return classify(ErrorClassUpload, fmt.Errorf("failed to upload preview: %w", err))
+		}
 	}
 
 	// Publish completion event
 	completionEvent := events.TranscodingCompleteEvent{
-		VideoID:       event.VideoID,
-		UserID:        event.UserID,
-		Title:         event.Title,
-		HLSPath:       hlsPath,
-		MP4Path:       mp4Path,
-		ThumbnailPath: thumbnailPath,
-		Status:        "completed",
-		CompletedAt:   time.Now().UTC().Format(time.RFC3339),
+		VideoID:             event.VideoID,
+		UserID:              event.UserID,
+		Title:               event.Title,
+		HLSPath:             hlsPath,
+		MP4Path:             mp4Path,
+		ThumbnailPath:       thumbnailPath,
+		ThumbnailCandidates: thumbnailCandidates,
+		StoryboardPath:      storyboardPath,
+		PreviewWebPPath:     previewWebPPath,
+		PreviewMP4Path:      previewMP4Path,
+		Status:              "completed",
+		CompletedAt:         time.Now().UTC().Format(time.RFC3339),
+		Ladder:              encodingLadder,
+		Loudness:            newLoudness(loudness),
 	}
 
 	if err := s.producer.PublishTranscodingComplete(ctx, completionEvent); err != nil {
-		return fmt.Errorf("failed to publish completion event: %w", err)
+		return classify(ErrorClassPublish, fmt.Errorf("failed to publish completion event: %w", err))
+	}
+
+	return s.advance(ctx, job, jobs.StatusCompleted)
+}
+
+// candidateManifestName is the name of the JSON list of thumbnail candidates stored with them
+const candidateManifestName = "candidates.json"
+
+// newThumbnailCandidates describes the thumbnail candidates of a video stored under prefix
+func newThumbnailCandidates(prefix string, candidates []transcoder.ThumbnailCandidate) []events.ThumbnailCandidate {
+	thumbnailCandidates := make([]events.ThumbnailCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		thumbnailCandidates = append(thumbnailCandidates, events.ThumbnailCandidate{
+			Path:       path.Join(prefix, candidate.Name),
+			Timestamp:  candidate.Timestamp,
+			Score:      candidate.Score,
+			Brightness: candidate.Brightness,
+			Contrast:   candidate.Contrast,
+			Sharpness:  candidate.Sharpness,
+		})
 	}
+	return thumbnailCandidates
+}
 
+// writeCandidateManifest writes the list of thumbnail candidates to candidateDir, the metadata
+// service reads it to let creators choose a thumbnail
+func writeCandidateManifest(candidateDir string, candidates []events.ThumbnailCandidate) error {
+	manifest, err := json.MarshalIndent(candidates, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal thumbnail candidates: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(candidateDir, candidateManifestName), manifest, 0644); err != nil {
+		return fmt.Errorf("failed to write thumbnail candidates: %w", err)
+	}
 	return nil
 }
+
+// newEncodingLadder describes the quality levels of a video for jobs and events
+func newEncodingLadder(ladder *transcoder.Ladder) *events.EncodingLadder {
+	encodingLadder := &events.EncodingLadder{Rungs: make([]events.LadderRung, 0, len(ladder.Levels))}
+	for _, level := range ladder.Levels {
+		encodingLadder.Rungs = append(encodingLadder.Rungs, events.LadderRung{
+			Name:             level.Name,
+			Width:            level.Width,
+			Height:           level.Height,
+			BitrateKbps:      level.Bitrate,
+			AudioBitrateKbps: level.AudioBitrate,
+		})
+	}
+
+	if analysis := ladder.Analysis; analysis != nil {
+		encodingLadder.Analysis = &events.ContentAnalysis{
+			ProbeResolution:  fmt.Sprintf("%dx%d", analysis.ProbeLevel.Width, analysis.ProbeLevel.Height),
+			ProbeCRF:         analysis.ProbeCRF,
+			ProbeBitrateKbps: analysis.ProbeBitrate,
+			Samples:          analysis.Samples,
+			SampledSeconds:   analysis.SampledDuration.Seconds(),
+			Complexity:       analysis.Complexity,
+			DroppedRungs:     analysis.Dropped,
+		}
+	}
+	return encodingLadder
+}
+
+// newLoudness describes the loudness measurement of a video for events, nil if its audio was not
+// normalized
+func newLoudness(loudness *transcoder.Loudness) *events.Loudness {
+	if loudness == nil {
+		return nil
+	}
+	return &events.Loudness{
+		IntegratedLUFS: loudness.Integrated,
+		TruePeakDBTP:   loudness.TruePeak,
+		RangeLU:        loudness.Range,
+		ThresholdLUFS:  loudness.Threshold,
+		TargetLUFS:     loudness.Target,
+	}
+}
+
+// probeVideo reads the display size of the first video stream and the duration of a video with
+// ffprobe. Streams rotated by a quarter turn, like portrait phone videos, have their width and
+// height swapped. The duration is 0 if ffprobe does not know it. Videos ffprobe cannot read are
+// invalid input.
+func (s *TranscoderService) probeVideo(ctx context.Context, videoPath string) (int, int, time.Duration, error) {
+	metadata, err := s.transcoder.ExtractMetadata(ctx, videoPath)
+	if err != nil {
+		return 0, 0, 0, classify(ErrorClassInvalidInput, fmt.Errorf("failed to probe video: %w", err))
+	}
+	return parseProbe(metadata["ffprobe_output"], filepath.Base(videoPath))
+}
+
+// parseProbe reads the display size and duration from the JSON output of ffprobe for the file name
+func parseProbe(output string, name string) (int, int, time.Duration, error) {
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Tags      struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideDataList []struct {
+				SideDataType string  `json:"side_data_type"`
+				Rotation     float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(output), &probe); err != nil {
+		return 0, 0, 0, classify(ErrorClassInvalidInput, fmt.Errorf("failed to parse ffprobe output: %w", err))
+	}
+
+	var duration time.Duration
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && seconds > 0 {
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" || stream.Width <= 0 || stream.Height <= 0 {
+			continue
+		}
+
+		// Newer FFmpeg versions report the rotation as a display matrix, older ones as a tag
+		rotation, _ := strconv.ParseFloat(stream.Tags.Rotate, 64)
+		for _, sideData := range stream.SideDataList {
+			if sideData.SideDataType == "Display Matrix" {
+				rotation = sideData.Rotation
+			}
+		}
+		if quarterTurns := int(math.Round(rotation / 90)); quarterTurns%2 != 0 {
+			return stream.Height, stream.Width, duration, nil
+		}
+		return stream.Width, stream.Height, duration, nil
+	}
+	return 0, 0, 0, classify(ErrorClassInvalidInput, fmt.Errorf("no video stream found in %s", name))
+}
+
+// RegenerateThumbnail creates a new thumbnail set for a video from the frame at timestamp seconds of
+// the original upload of sourceVideoID and returns the path of its default size
+func (s *TranscoderService) RegenerateThumbnail(ctx context.Context, videoID string, sourceVideoID string, fileExtension string, timestamp float64) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.jobTimeout)
+	defer cancel()
+
+	workDir, err := os.MkdirTemp(s.tempDir, "thumbnail-"+videoID+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	videoPath := filepath.Join(workDir, "original"+fileExtension)
+	if err := s.storage.DownloadVideo(ctx, sourceVideoID, fileExtension, videoPath); err != nil {
+		return "", fmt.Errorf("failed to download video: %w", err)
+	}
+
+	thumbnailDir := filepath.Join(workDir, "thumbnails")
+	if err := os.MkdirAll(thumbnailDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	if err := s.transcoder.GenerateThumbnailSet(ctx, videoPath, thumbnailDir, timestamp); err != nil {
+		return "", fmt.Errorf("failed to generate thumbnail: %w", err)
+	}
+
+	thumbnailPath, err := s.storage.UploadThumbnailSet(ctx, videoID, thumbnailDir, transcoder.DefaultThumbnailSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload thumbnail: %w", err)
+	}
+
+	return thumbnailPath, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		width, height int
+		duration      time.Duration
+		wantErr       bool
+	}{
+		{
+			name:   "landscape",
+			output: `{"streams":[{"codec_type":"video","width":1920,"height":1080}],"format":{"duration":"12.500000"}}`,
+			width:  1920, height: 1080, duration: 12500 * time.Millisecond,
+		},
+		{
+			name:   "portrait",
+			output: `{"streams":[{"codec_type":"video","width":1080,"height":1920}],"format":{"duration":"3.0"}}`,
+			width:  1080, height: 1920, duration: 3 * time.Second,
+		},
+		{
+			name:   "rotated by a display matrix",
+			output: `{"streams":[{"codec_type":"video","width":1920,"height":1080,"side_data_list":[{"side_data_type":"Display Matrix","rotation":-90}]}],"format":{"duration":"1"}}`,
+			width:  1080, height: 1920, duration: time.Second,
+		},
+		{
+			name:   "rotated by a tag",
+			output: `{"streams":[{"codec_type":"video","width":1920,"height":1080,"tags":{"rotate":"90"}}],"format":{"duration":"1"}}`,
+			width:  1080, height: 1920, duration: time.Second,
+		},
+		{
+			name:   "rotated by 270 degrees",
+			output: `{"streams":[{"codec_type":"video","width":1280,"height":720,"tags":{"rotate":"270"}}],"format":{"duration":"1"}}`,
+			width:  720, height: 1280, duration: time.Second,
+		},
+		{
+			name:   "upside down",
+			output: `{"streams":[{"codec_type":"video","width":1920,"height":1080,"side_data_list":[{"side_data_type":"Display Matrix","rotation":180}]}],"format":{"duration":"1"}}`,
+			width:  1920, height: 1080, duration: time.Second,
+		},
+		{
+			name:   "display matrix wins over the tag",
+			output: `{"streams":[{"codec_type":"video","width":1920,"height":1080,"tags":{"rotate":"90"},"side_data_list":[{"side_data_type":"Display Matrix","rotation":0}]}],"format":{"duration":"1"}}`,
+			width:  1920, height: 1080, duration: time.Second,
+		},
+		{
+			name:   "audio stream first",
+			output: `{"streams":[{"codec_type":"audio"},{"codec_type":"video","width":320,"height":180}],"format":{"duration":"N/A"}}`,
+			width:  320, height: 180,
+		},
+		{
+			name:    "no video stream",
+			output:  `{"streams":[{"codec_type":"audio"}],"format":{"duration":"1"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			output:  `not json`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, duration, err := parseProbe(tt.output, "video.mp4")
+			if tt.wantErr {
+				if errorClass(err) != ErrorClassInvalidInput {
+					t.Fatalf("parseProbe() error = %v, want an invalid input error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProbe() error = %v", err)
+			}
+			if width != tt.width || height != tt.height || duration != tt.duration {
+				t.Errorf("parseProbe() = %dx%d %v, want %dx%d %v", width, height, duration, tt.width, tt.height, tt.duration)
+			}
+		})
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 )
@@ -20,6 +23,7 @@ type MinIOStorage struct {
 	hlsPrefix       string
 	mp4Prefix       string
 	thumbnailPrefix string
+	previewPrefix   string
 }
 
 // NewMinIOStorage creates a new MinIOStorage instance
@@ -31,6 +35,7 @@ func NewMinIOStorage(
 	hlsPrefix string,
 	mp4Prefix string,
 	thumbnailPrefix string,
+	previewPrefix string,
 ) Storage {
 	// Create context for bucket operations
 	ctx := context.Background()
@@ -61,6 +66,7 @@ func NewMinIOStorage(
 		hlsPrefix:       hlsPrefix,
 		mp4Prefix:       mp4Prefix,
 		thumbnailPrefix: thumbnailPrefix,
+		previewPrefix:   previewPrefix,
 	}
 }
 
@@ -137,10 +143,18 @@ func (s *MinIOStorage) UploadHLSFiles(ctx context.Context, videoID string, local
 
 		// Determine content type
 		contentType := "application/octet-stream"
-		if filepath.Ext(path) == ".m3u8" {
+		switch filepath.Ext(path) {
+		case ".m3u8":
 			contentType = "application/vnd.apple.mpegurl"
-		} else if filepath.Ext(path) == ".ts" {
+		case ".ts":
 			contentType = "video/mp2t"
+		case ".m4s":
+			contentType = "video/iso.segment"
+		case ".mp4":
+			// fMP4 init segments
+			contentType = "video/mp4"
+		case ".mpd":
+			contentType = "application/dash+xml"
 		}
 
 		// Upload the file to MinIO processed bucket
@@ -166,6 +180,11 @@ func (s *MinIOStorage) GetMP4Prefix() string {
 	return s.mp4Prefix
 }
 
+// GetThumbnailPrefix returns the thumbnail prefix
+func (s *MinIOStorage) GetThumbnailPrefix() string {
+	return s.thumbnailPrefix
+}
+
 // UploadMP4Files uploads MP4 files to MinIO
 func (s *MinIOStorage) UploadMP4Files(ctx context.Context, videoID string, mp4Dir string) error {
 	return filepath.Walk(mp4Dir, func(path string, info os.FileInfo, err error) error {
@@ -224,6 +243,149 @@ func (s *MinIOStorage) UploadThumbnail(ctx context.Context, videoID string, loca
 	return objectName, nil
 }
 
+// UploadThumbnailSet uploads the thumbnail sizes in localDir to <thumbnail prefix>/<video ID>/<version>/.
+// Every set gets a new version, so the URLs of a replaced thumbnail are never served again.
+func (s *MinIOStorage) UploadThumbnailSet(ctx context.Context, videoID string, localDir string, defaultSize string) (string, error) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read thumbnail directory: %w", err)
+	}
+
+	version := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	prefix := path.Join(s.thumbnailPrefix, videoID, version)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".jpg" {
+			continue
+		}
+
+		objectName := path.Join(prefix, entry.Name())
+		if _, err := s.client.FPutObject(ctx, s.processedBucket, objectName, filepath.Join(localDir, entry.Name()), minio.PutObjectOptions{
+			ContentType: "image/jpeg",
+		}); err != nil {
+			return "", fmt.Errorf("failed to upload thumbnail %s: %w", entry.Name(), err)
+		}
+	}
+
+	return path.Join(prefix, defaultSize+".jpg"), nil
+}
+
+// UploadThumbnailCandidates uploads the thumbnail candidates and their JSON manifest in localDir to
+// <thumbnail prefix>/<video ID>/candidates/
+func (s *MinIOStorage) UploadThumbnailCandidates(ctx context.Context, videoID string, localDir string) error {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return fmt.Errorf("failed to read candidate directory: %w", err)
+	}
+
+	prefix := path.Join(s.thumbnailPrefix, videoID, "candidates")
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var contentType string
+		switch filepath.Ext(entry.Name()) {
+		case ".jpg":
+			contentType = "image/jpeg"
+		case ".json":
+			contentType = "application/json"
+		default:
+			continue
+		}
+
+		objectName := path.Join(prefix, entry.Name())
+		if _, err := s.client.FPutObject(ctx, s.processedBucket, objectName, filepath.Join(localDir, entry.Name()), minio.PutObjectOptions{
+			ContentType: contentType,
+		}); err != nil {
+			return fmt.Errorf("failed to upload thumbnail candidate %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// UploadStoryboard uploads the sprite sheets and WebVTT file in localDir to
+// <thumbnail prefix>/<video ID>/storyboard/. The WebVTT file references the sprite sheets by name.
+func (s *MinIOStorage) UploadStoryboard(ctx context.Context, videoID string, localDir string) (string, error) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read storyboard directory: %w", err)
+	}
+
+	prefix := path.Join(s.thumbnailPrefix, videoID, "storyboard")
+	vttPath := ""
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var contentType string
+		switch filepath.Ext(entry.Name()) {
+		case ".jpg":
+			contentType = "image/jpeg"
+		case ".vtt":
+			contentType = "text/vtt"
+		default:
+			continue
+		}
+
+		objectName := path.Join(prefix, entry.Name())
+		if _, err := s.client.FPutObject(ctx, s.processedBucket, objectName, filepath.Join(localDir, entry.Name()), minio.PutObjectOptions{
+			ContentType: contentType,
+		}); err != nil {
+			return "", fmt.Errorf("failed to upload storyboard file %s: %w", entry.Name(), err)
+		}
+		if contentType == "text/vtt" {
+			vttPath = objectName
+		}
+	}
+
+	if vttPath == "" {
+		return "", fmt.Errorf("no storyboard found in %s", localDir)
+	}
+	return vttPath, nil
+}
+
+// UploadPreview uploads the animated WebP and muted MP4 hover previews in localDir to
+// <preview prefix>/<video ID>/ and returns the paths of the WebP and the MP4
+func (s *MinIOStorage) UploadPreview(ctx context.Context, videoID string, localDir string) (string, string, error) {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read preview directory: %w", err)
+	}
+
+	prefix := path.Join(s.previewPrefix, videoID)
+	var webpPath, mp4Path string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		objectName := path.Join(prefix, entry.Name())
+		var contentType string
+		switch filepath.Ext(entry.Name()) {
+		case ".webp":
+			contentType = "image/webp"
+			webpPath = objectName
+		case ".mp4":
+			contentType = "video/mp4"
+			mp4Path = objectName
+		default:
+			continue
+		}
+
+		if _, err := s.client.FPutObject(ctx, s.processedBucket, objectName, filepath.Join(localDir, entry.Name()), minio.PutObjectOptions{
+			ContentType: contentType,
+		}); err != nil {
+			return "", "", fmt.Errorf("failed to upload preview file %s: %w", entry.Name(), err)
+		}
+	}
+
+	if webpPath == "" || mp4Path == "" {
+		return "", "", fmt.Errorf("no preview found in %s", localDir)
+	}
+	return webpPath, mp4Path, nil
+}
+
 // CheckHealth verifies the MinIO connection is working
 func (s *MinIOStorage) CheckHealth(ctx context.Context) error {
 	// Check if the bucket exists as a simple health check
@@ -14,8 +14,18 @@ type Storage interface {
 	UploadMP4Files(ctx context.Context, videoID string, mp4Dir string) error
 	// UploadThumbnail uploads a thumbnail to storage
 	UploadThumbnail(ctx context.Context, videoID string, thumbnailPath string) (string, error)
+	// UploadThumbnailSet uploads the thumbnail sizes in localDir as a new version and returns the path of the default size
+	UploadThumbnailSet(ctx context.Context, videoID string, localDir string, defaultSize string) (string, error)
+	// UploadThumbnailCandidates uploads the thumbnail candidates and their manifest in localDir
+	UploadThumbnailCandidates(ctx context.Context, videoID string, localDir string) error
+	// UploadStoryboard uploads the sprite sheets and WebVTT file in localDir and returns the path of the WebVTT file
+	UploadStoryboard(ctx context.Context, videoID string, localDir string) (string, error)
+	// UploadPreview uploads the WebP and MP4 hover previews in localDir and returns their paths
+	UploadPreview(ctx context.Context, videoID string, localDir string) (string, string, error)
 	// CheckHealth checks if the storage is healthy
 	CheckHealth(ctx context.Context) error
 	// GetMP4Prefix returns the MP4 prefix
 	GetMP4Prefix() string
+	// GetThumbnailPrefix returns the thumbnail prefix
+	GetThumbnailPrefix() string
 }
@@ -0,0 +1,140 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// audioTrack is an audio stream of a video. Every track is carried through to its own HLS audio
+// renditions, the first one is the primary track.
+type audioTrack struct {
+	// index is the index of the stream among the audio streams, like 1 for 0:a:1
+	index int
+	// language is the language tag of the stream, empty if it is not tagged
+	language string
+	// label is the name players show for the track
+	label string
+}
+
+// ffprobeAudioStreams is what probeAudioTracks reads from ffprobe
+type ffprobeAudioStreams struct {
+	Streams []struct {
+		Tags map[string]string `json:"tags"`
+	} `json:"streams"`
+}
+
+// probeAudioTracks returns the audio streams of a video. Streams of the HLS renditions have to be
+// mapped explicitly, a missing audio stream would fail the run.
+func probeAudioTracks(ctx context.Context, inputPath string) ([]audioTrack, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a",
+		"-show_entries", "stream=index:stream_tags=language,title",
+		"-of", "json",
+		inputPath,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe audio streams: %w", err)
+	}
+	return parseAudioTracks(output)
+}
+
+// parseAudioTracks reads the audio tracks from the JSON output of ffprobe
+func parseAudioTracks(output []byte) ([]audioTrack, error) {
+	var probed ffprobeAudioStreams
+	if err := json.Unmarshal(output, &probed); err != nil {
+		return nil, fmt.Errorf("failed to parse audio streams: %w", err)
+	}
+
+	tracks := make([]audioTrack, 0, len(probed.Streams))
+	for i, stream := range probed.Streams {
+		tracks = append(tracks, audioTrack{
+			index:    i,
+			language: audioLanguage(stream.Tags["language"]),
+			label:    audioLabel(i, stream.Tags["title"], stream.Tags["language"], tracks),
+		})
+	}
+	return tracks, nil
+}
+
+// audioLanguage returns the language tag of an audio stream, usually ISO 639-2 like eng. Streams
+// tagged und have no language.
+func audioLanguage(tag string) string {
+	language := strings.ToLower(strings.TrimSpace(tag))
+	if language == "und" || strings.ContainsAny(language, "\",\r\n") {
+		return ""
+	}
+	return language
+}
+
+// audioLabel returns the name of an audio track: its title, its language or its number. Names are
+// unique among the tracks, which HLS requires within a group.
+func audioLabel(index int, title, language string, tracks []audioTrack) string {
+	label := strings.TrimSpace(strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ").Replace(title))
+	if label == "" {
+		label = audioLanguage(language)
+	}
+	if label == "" {
+		label = fmt.Sprintf("Audio %d", index+1)
+	}
+
+	taken := func(name string) bool {
+		return slices.ContainsFunc(tracks, func(t audioTrack) bool { return t.label == name })
+	}
+	if !taken(label) {
+		return label
+	}
+	for n := 2; ; n++ {
+		if name := fmt.Sprintf("%s %d", label, n); !taken(name) {
+			return name
+		}
+	}
+}
+
+// audioRendition is an HLS audio rendition of an audio track at one bitrate. It is stored like the
+// variants. The renditions of all tracks at a bitrate form a group, the variants of the quality
+// levels with that bitrate reference the group.
+type audioRendition struct {
+	// name is the directory of the rendition, the group for the primary track and the group and
+	// track like audio_128k_1 for the others
+	name string
+	// group is the name of the group, like audio_128k
+	group   string
+	bitrate int
+	track   audioTrack
+}
+
+// primary reports whether the rendition is of the primary audio track
+func (a audioRendition) primary() bool {
+	return a.track.index == 0
+}
+
+// newAudioRenditions returns an audio rendition for every audio track at every audio bitrate of
+// the quality levels, grouped by bitrate in the order of the quality levels
+func newAudioRenditions(qualityLevels []QualityLevel, tracks []audioTrack) []audioRendition {
+	var renditions []audioRendition
+	for _, quality := range qualityLevels {
+		group := audioGroupName(quality.AudioBitrate)
+		if slices.ContainsFunc(renditions, func(a audioRendition) bool { return a.group == group }) {
+			continue
+		}
+		for _, track := range tracks {
+			name := group
+			if track.index > 0 {
+				name = fmt.Sprintf("%s_%d", group, track.index)
+			}
+			renditions = append(renditions, audioRendition{name: name, group: group, bitrate: quality.AudioBitrate, track: track})
+		}
+	}
+	return renditions
+}
+
+// audioGroupName returns the name of the audio group at a bitrate in kbps
+func audioGroupName(bitrate int) string {
+	return fmt.Sprintf("audio_%dk", bitrate)
+}
@@ -0,0 +1,240 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultThumbnailCandidates is the number of thumbnail candidates kept for creators to choose from
+const DefaultThumbnailCandidates = 5
+
+const (
+	// thumbnailWidth is the width of the generated thumbnail and its candidates
+	thumbnailWidth = 320
+	// sceneThreshold is the scene change score, between 0 and 1, a frame needs to be a candidate
+	sceneThreshold = 0.3
+	// maxCandidateFrames caps the frames sampled from videos of unknown duration
+	maxCandidateFrames = 200
+
+	// Scores saturate at these values, frames above them count as fully sharp or contrasted
+	sharpnessReference = 200
+	contrastReference  = 64
+)
+
+// ThumbnailCandidate is a frame that can be the thumbnail of a video. Scores are between 0 and 1.
+type ThumbnailCandidate struct {
+	// Name is the file name of the candidate in the candidate directory
+	Name string
+	// Timestamp is the position of the frame in seconds
+	Timestamp float64
+	// Brightness is the mean luma of the frame
+	Brightness float64
+	// Contrast is the standard deviation of the luma, a quarter of its range or more counts as 1
+	Contrast float64
+	// Sharpness grows with the variance of the Laplacian of the luma, blurry frames have little
+	Sharpness float64
+	// Score rates the frame as a thumbnail, higher is better
+	Score float64
+}
+
+// showinfoRegex matches the output positions FFmpeg's showinfo filter logs for every frame
+var showinfoRegex = regexp.MustCompile(`Parsed_showinfo.*\bn:\s*(\d+).*\bpts_time:\s*([0-9.]+)`)
+
+// candidateGaps returns the minimum time between two sampled frames and the time after which a
+// frame is sampled without a scene change. Both grow with the duration, so that long videos are
+// not sampled more often than short ones.
+func candidateGaps(duration time.Duration) (float64, float64) {
+	if duration <= 0 {
+		return 2, 10
+	}
+	seconds := duration.Seconds()
+	minGap := max(1, seconds/60)
+	maxGap := min(max(5, seconds/20), 60)
+	return minGap, max(minGap, maxGap)
+}
+
+// candidateArgs builds the FFmpeg arguments that write a frame after every scene change, and every
+// so often in long shots, to outputDir as frame_NNNN.jpg. showinfo logs the position of every frame.
+func candidateArgs(inputPath, outputDir string, duration time.Duration) []string {
+	minGap, maxGap := candidateGaps(duration)
+	selectExpr := fmt.Sprintf("isnan(prev_selected_t)+gte(t-prev_selected_t,%[2]s)+gt(scene,%[3]s)*gte(t-prev_selected_t,%[1]s)",
+		strconv.FormatFloat(minGap, 'f', 3, 64), strconv.FormatFloat(maxGap, 'f', 3, 64), strconv.FormatFloat(sceneThreshold, 'f', -1, 64))
+
+	args := []string{
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("select='%s',scale=%d:-2,setsar=1,showinfo", selectExpr, thumbnailWidth),
+		"-fps_mode", "vfr",
+		"-q:v", "2",
+	}
+	if duration <= 0 {
+		args = append(args, "-frames:v", strconv.Itoa(maxCandidateFrames))
+	}
+	return append(args, "-y", filepath.Join(outputDir, "frame_%04d.jpg"))
+}
+
+// generateThumbnailCandidates samples frames of a video at scene changes and scores them by
+// brightness, contrast and sharpness. The best frame is written to outputPath, the best count
+// frames are kept in candidateDir as candidate_NN.jpg and returned, best first.
+func generateThumbnailCandidates(ctx context.Context, ffmpegPath string, inputPath, outputPath, candidateDir string, duration time.Duration, count int) ([]ThumbnailCandidate, error) {
+	framesDir, err := os.MkdirTemp(filepath.Dir(outputPath), "frames-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create frame directory: %w", err)
+	}
+	defer os.RemoveAll(framesDir)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, candidateArgs(inputPath, framesDir, duration)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	// Frames are numbered from 1 in the order showinfo logs them
+	var candidates []ThumbnailCandidate
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		match := showinfoRegex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(match[1])
+		timestamp, _ := strconv.ParseFloat(match[2], 64)
+
+		name := fmt.Sprintf("frame_%04d.jpg", n+1)
+		candidate, err := scoreFrame(filepath.Join(framesDir, name))
+		if err != nil {
+			// The last frames may be dropped when the input ends
+			continue
+		}
+		candidate.Name = name
+		candidate.Timestamp = timestamp
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no frames sampled")
+	}
+
+	// Earlier frames win ties, they are more likely to show what the video is about
+	slices.SortStableFunc(candidates, func(a, b ThumbnailCandidate) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	candidates = candidates[:min(count, len(candidates))]
+
+	if err := os.MkdirAll(candidateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create candidate directory: %w", err)
+	}
+	for i := range candidates {
+		name := fmt.Sprintf("candidate_%02d.jpg", i+1)
+		if err := os.Rename(filepath.Join(framesDir, candidates[i].Name), filepath.Join(candidateDir, name)); err != nil {
+			return nil, fmt.Errorf("failed to keep thumbnail candidate: %w", err)
+		}
+		candidates[i].Name = name
+	}
+
+	if err := copyFile(filepath.Join(candidateDir, candidates[0].Name), outputPath); err != nil {
+		return nil, fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	return candidates, nil
+}
+
+// scoreFrame measures the brightness, contrast and sharpness of a JPEG frame. Frames that are
+// nearly black or white, flat or blurry score low.
+func scoreFrame(framePath string) (ThumbnailCandidate, error) {
+	file, err := os.Open(framePath)
+	if err != nil {
+		return ThumbnailCandidate{}, err
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		return ThumbnailCandidate{}, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	luma, width, height := lumaPlane(img)
+	if width < 3 || height < 3 {
+		return ThumbnailCandidate{}, fmt.Errorf("frame is too small")
+	}
+
+	var sum, sumSquares float64
+	for _, y := range luma {
+		sum += y
+		sumSquares += y * y
+	}
+	mean := sum / float64(len(luma))
+	stddev := math.Sqrt(max(0, sumSquares/float64(len(luma))-mean*mean))
+
+	// Variance of the 4-neighbour Laplacian over the inner pixels
+	var lapSum, lapSquares float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			lap := luma[i-width] + luma[i+width] + luma[i-1] + luma[i+1] - 4*luma[i]
+			lapSum += lap
+			lapSquares += lap * lap
+		}
+	}
+	inner := float64((width - 2) * (height - 2))
+	lapVariance := max(0, lapSquares/inner-(lapSum/inner)*(lapSum/inner))
+
+	candidate := ThumbnailCandidate{
+		Brightness: round3(mean / 255),
+		Contrast:   round3(min(1, stddev/contrastReference)),
+		Sharpness:  round3(lapVariance / (lapVariance + sharpnessReference)),
+	}
+	// Mid-grey brightness scores best, sharpness matters most
+	exposure := 1 - math.Abs(candidate.Brightness-0.5)*2
+	candidate.Score = round3(0.25*exposure + 0.25*candidate.Contrast + 0.5*candidate.Sharpness)
+	return candidate, nil
+}
+
+// lumaPlane returns the luma of every pixel of an image, row by row, with its width and height
+func lumaPlane(img image.Image) ([]float64, int, int) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	luma := make([]float64, 0, width*height)
+
+	// JPEG frames are decoded as YCbCr, their Y plane is the luma
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				luma = append(luma, float64(ycbcr.Y[ycbcr.YOffset(x, y)]))
+			}
+		}
+		return luma, width, height
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			luma = append(luma, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/257)
+		}
+	}
+	return luma, width, height
+}
+
+// round3 rounds a score to three decimals
+func round3(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
@@ -0,0 +1,215 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Video codec families that can be configured as output formats
+const (
+	CodecH264 = "h264"
+	CodecHEVC = "hevc"
+	CodecVP9  = "vp9"
+	CodecAV1  = "av1"
+)
+
+// audioCodecs is the codec string of the AAC audio of every rendition
+const audioCodecs = "mp4a.40.2"
+
+// codec is a video codec family with its encoder settings and bitrate ladder
+type codec struct {
+	name string
+	// encoders are the FFmpeg encoders of the codec in order of preference
+	encoders []string
+	// crfOffset is added to the configured CRF, which is on the libx264 scale
+	crfOffset int
+	// ladder is the maximum bitrate in kbps of each quality level for content of average
+	// complexity. Codecs without a ladder use the bitrates of the quality levels.
+	ladder map[string]int
+	// levels are the codec strings of renditions up to a short side, in increasing order. The codec
+	// levels assume frame rates up to 30 fps.
+	levels []codecLevel
+}
+
+// codecLevel is the codec string of renditions whose short side is up to maxShortSide
+type codecLevel struct {
+	maxShortSide int
+	codecs       string
+}
+
+// codecs are the supported codec families by name
+var codecs = map[string]*codec{
+	CodecH264: {
+		name:     CodecH264,
+		encoders: []string{"libx264"},
+		levels: []codecLevel{
+			{maxShortSide: 480, codecs: "avc1.64001e"},
+			{maxShortSide: 720, codecs: "avc1.64001f"},
+			{maxShortSide: 1080, codecs: "avc1.640028"},
+			{maxShortSide: 2160, codecs: "avc1.640033"},
+		},
+	},
+	CodecHEVC: {
+		name:      CodecHEVC,
+		encoders:  []string{"libx265"},
+		crfOffset: 5,
+		ladder:    map[string]int{"4k": 9000, "1080p": 3000, "720p": 1700, "480p": 850, "360p": 500, "240p": 250},
+		levels: []codecLevel{
+			{maxShortSide: 480, codecs: "hvc1.1.6.L90.90"},
+			{maxShortSide: 720, codecs: "hvc1.1.6.L93.90"},
+			{maxShortSide: 1080, codecs: "hvc1.1.6.L120.90"},
+			{maxShortSide: 2160, codecs: "hvc1.1.6.L150.90"},
+		},
+	},
+	CodecVP9: {
+		name:      CodecVP9,
+		encoders:  []string{"libvpx-vp9"},
+		crfOffset: 10,
+		ladder:    map[string]int{"4k": 9500, "1080p": 3200, "720p": 1800, "480p": 900, "360p": 500, "240p": 250},
+		levels: []codecLevel{
+			{maxShortSide: 480, codecs: "vp09.00.30.08"},
+			{maxShortSide: 720, codecs: "vp09.00.31.08"},
+			{maxShortSide: 1080, codecs: "vp09.00.40.08"},
+			{maxShortSide: 2160, codecs: "vp09.00.51.08"},
+		},
+	},
+	CodecAV1: {
+		name:      CodecAV1,
+		encoders:  []string{"libsvtav1", "libaom-av1"},
+		crfOffset: 12,
+		ladder:    map[string]int{"4k": 7500, "1080p": 2500, "720p": 1400, "480p": 700, "360p": 400, "240p": 200},
+		levels: []codecLevel{
+			{maxShortSide: 480, codecs: "av01.0.04M.08"},
+			{maxShortSide: 720, codecs: "av01.0.05M.08"},
+			{maxShortSide: 1080, codecs: "av01.0.08M.08"},
+			{maxShortSide: 2160, codecs: "av01.0.13M.08"},
+		},
+	},
+}
+
+// videoCodec is a codec family with the encoder that was picked for it
+type videoCodec struct {
+	*codec
+	encoder string
+}
+
+// resolveCodecs looks up the codec families of the output formats and picks the first encoder
+// of each one that FFmpeg provides. FFmpeg is only asked for its encoders if there is a choice.
+func resolveCodecs(ffmpegPath string, outputFormats []string) ([]videoCodec, error) {
+	var available map[string]bool
+	resolved := make([]videoCodec, 0, len(outputFormats))
+	for _, format := range outputFormats {
+		c, ok := codecs[format]
+		if !ok {
+			return nil, fmt.Errorf("unknown output format: %s", format)
+		}
+		for _, other := range resolved {
+			if other.name == c.name {
+				return nil, fmt.Errorf("duplicate output format: %s", format)
+			}
+		}
+
+		encoder := c.encoders[0]
+		if len(c.encoders) > 1 {
+			if available == nil {
+				var err error
+				if available, err = listEncoders(ffmpegPath); err != nil {
+					return nil, err
+				}
+			}
+			encoder = ""
+			for _, candidate := range c.encoders {
+				if available[candidate] {
+					encoder = candidate
+					break
+				}
+			}
+			if encoder == "" {
+				return nil, fmt.Errorf("FFmpeg has none of the %s encoders %s", format, strings.Join(c.encoders, ", "))
+			}
+		}
+		resolved = append(resolved, videoCodec{codec: c, encoder: encoder})
+	}
+	return resolved, nil
+}
+
+// listEncoders returns the names of the encoders FFmpeg provides
+func listEncoders(ffmpegPath string) (map[string]bool, error) {
+	output, err := exec.CommandContext(context.Background(), ffmpegPath, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list FFmpeg encoders: %w", err)
+	}
+
+	// Encoders are listed as "<flags> <name> <description>" after a legend
+	encoders := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && len(fields[0]) == 6 {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders, nil
+}
+
+// bitrate returns the maximum bitrate in kbps of a quality level. Per-title ladders scale the
+// ladder of the codec like the H.264 bitrate of the quality level.
+func (c *codec) bitrate(quality QualityLevel) int {
+	bitrate, ok := c.ladder[quality.Name]
+	standard := standardBitrate(quality.Name)
+	if !ok || standard == 0 {
+		return quality.Bitrate
+	}
+	return bitrate * quality.Bitrate / standard
+}
+
+// codecString returns the codec string of a rendition of the given size
+func (c *codec) codecString(width, height int) string {
+	for _, level := range c.levels {
+		if min(width, height) <= level.maxShortSide {
+			return level.codecs
+		}
+	}
+	return c.levels[len(c.levels)-1].codecs
+}
+
+// videoArgs returns the encoder options of video streams. stream is the stream specifier the
+// options apply to, ":v" for every video stream of an output or like ":v:2" for a single one.
+func (c videoCodec) videoArgs(stream string, preset string, crf int, bitrate int) []string {
+	crf += c.crfOffset
+	options := []string{"-c", c.encoder}
+	switch c.encoder {
+	case "libx264", "libx265":
+		options = append(options, "-preset", preset, "-crf", strconv.Itoa(crf))
+	case "libvpx-vp9", "libaom-av1":
+		// Constrained quality, the target bitrate caps the quality
+		options = append(options,
+			"-crf", strconv.Itoa(crf),
+			"-b", fmt.Sprintf("%dk", bitrate),
+			"-cpu-used", "4",
+			"-row-mt", "1",
+		)
+	case "libsvtav1":
+		options = append(options, "-preset", "8", "-crf", strconv.Itoa(crf))
+	}
+	options = append(options,
+		"-maxrate", fmt.Sprintf("%dk", bitrate),
+		"-bufsize", fmt.Sprintf("%dk", bitrate*2),
+	)
+	if c.name == CodecHEVC {
+		// Apple players only accept HEVC tagged as hvc1
+		options = append(options, "-tag", "hvc1")
+	}
+
+	// Options are name and value pairs, the stream specifier is added to the names
+	args := make([]string, 0, len(options))
+	for i := 0; i < len(options); i += 2 {
+		args = append(args, options[i]+stream, options[i+1])
+	}
+	return args
+}
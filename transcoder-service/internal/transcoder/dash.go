@@ -0,0 +1,249 @@
+package transcoder
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dashTimescale is the number of timeline units per second in the DASH manifest
+const dashTimescale = 1000
+
+// mpd is a static DASH manifest with a single period
+type mpd struct {
+	XMLName                   xml.Name  `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                  string    `xml:"profiles,attr"`
+	Type                      string    `xml:"type,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string    `xml:"minBufferTime,attr"`
+	Period                    mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ID               int                 `xml:"id,attr"`
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	Lang             string              `xml:"lang,attr,omitempty"`
+	Label            string              `xml:"Label,omitempty"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                 `xml:"startWithSAP,attr"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID                        string             `xml:"id,attr"`
+	Bandwidth                 int                `xml:"bandwidth,attr"`
+	Codecs                    string             `xml:"codecs,attr"`
+	Width                     int                `xml:"width,attr,omitempty"`
+	Height                    int                `xml:"height,attr,omitempty"`
+	AudioSamplingRate         int                `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration *mpdDescriptor     `xml:"AudioChannelConfiguration,omitempty"`
+	SegmentTemplate           mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale      int          `xml:"timescale,attr"`
+	Initialization string       `xml:"initialization,attr"`
+	Media          string       `xml:"media,attr"`
+	StartNumber    int          `xml:"startNumber,attr"`
+	Timeline       []mpdSegment `xml:"SegmentTimeline>S"`
+}
+
+// mpdSegment is an entry of a segment timeline, R more segments of the same duration follow it
+type mpdSegment struct {
+	T *int64 `xml:"t,attr,omitempty"`
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr,omitempty"`
+}
+
+// mediaPlaylist is what the DASH manifest needs from an fMP4 HLS media playlist
+type mediaPlaylist struct {
+	// initSegment is the URI of the init segment relative to the playlist
+	initSegment string
+	// durations are the segment durations in seconds
+	durations []float64
+}
+
+// writeDASHManifest writes a DASH manifest to hlsDir that references the fMP4 segments of the HLS
+// variants and audio renditions. Players cannot switch codecs within an adaptation set, so there is
+// one per codec, and one per audio track with its renditions.
+func (t *ffmpegGoImpl) writeDASHManifest(hlsDir string, variants []variant, audioRenditions []audioRendition) error {
+	var adaptationSets []mpdAdaptationSet
+	sets := make(map[string]int)
+	var duration float64
+	for _, v := range variants {
+		template, total, err := segmentTemplate(hlsDir, v.name)
+		if err != nil {
+			return err
+		}
+		duration = math.Max(duration, total)
+
+		set, ok := sets[v.codec.name]
+		if !ok {
+			set = len(adaptationSets)
+			sets[v.codec.name] = set
+			adaptationSets = append(adaptationSets, mpdAdaptationSet{
+				ID:               set,
+				ContentType:      "video",
+				MimeType:         "video/mp4",
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+			})
+		}
+		adaptationSets[set].Representations = append(adaptationSets[set].Representations, mpdRepresentation{
+			ID:              v.name,
+			Bandwidth:       v.bitrate * 1000,
+			Codecs:          v.codecs(false),
+			Width:           v.quality.Width,
+			Height:          v.quality.Height,
+			SegmentTemplate: template,
+		})
+	}
+
+	manifest := mpd{
+		Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                      "static",
+		MediaPresentationDuration: isoDuration(duration),
+		MinBufferTime:             isoDuration(float64(t.ffmpegSegmentLength)),
+		Period: mpdPeriod{
+			ID:             "0",
+			Start:          "PT0S",
+			AdaptationSets: adaptationSets,
+		},
+	}
+
+	audioSets := make(map[int]int)
+	for _, a := range audioRenditions {
+		set, ok := audioSets[a.track.index]
+		if !ok {
+			set = len(manifest.Period.AdaptationSets)
+			audioSets[a.track.index] = set
+			manifest.Period.AdaptationSets = append(manifest.Period.AdaptationSets, mpdAdaptationSet{
+				ID:               set,
+				ContentType:      "audio",
+				MimeType:         "audio/mp4",
+				Lang:             a.track.language,
+				Label:            a.track.label,
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+			})
+		}
+
+		template, _, err := segmentTemplate(hlsDir, a.name)
+		if err != nil {
+			return err
+		}
+		manifest.Period.AdaptationSets[set].Representations = append(manifest.Period.AdaptationSets[set].Representations, mpdRepresentation{
+			ID:                a.name,
+			Bandwidth:         a.bitrate * 1000,
+			Codecs:            audioCodecs,
+			AudioSamplingRate: 48000,
+			AudioChannelConfiguration: &mpdDescriptor{
+				SchemeIDURI: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+				Value:       "2",
+			},
+			SegmentTemplate: template,
+		})
+	}
+
+	output, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode DASH manifest: %w", err)
+	}
+	content := append([]byte(xml.Header), output...)
+	return os.WriteFile(filepath.Join(hlsDir, DASHManifestName), append(content, '\n'), 0644)
+}
+
+// segmentTemplate returns the segment template of a rendition and its duration in seconds. The
+// segments are named like the HLS segments of the rendition.
+func segmentTemplate(hlsDir, rendition string) (mpdSegmentTemplate, float64, error) {
+	playlist, err := readMediaPlaylist(filepath.Join(hlsDir, rendition, "playlist.m3u8"))
+	if err != nil {
+		return mpdSegmentTemplate{}, 0, err
+	}
+
+	template := mpdSegmentTemplate{
+		Timescale:      dashTimescale,
+		Initialization: rendition + "/" + playlist.initSegment,
+		Media:          rendition + "/segment_$Number%03d$.m4s",
+		StartNumber:    0,
+	}
+
+	// Segment boundaries are rounded so that the timeline does not drift
+	var total float64
+	var start int64
+	for _, duration := range playlist.durations {
+		total += duration
+		end := int64(math.Round(total * dashTimescale))
+		d := end - start
+		start = end
+
+		if n := len(template.Timeline); n > 0 && template.Timeline[n-1].D == d {
+			template.Timeline[n-1].R++
+			continue
+		}
+		segment := mpdSegment{D: d}
+		if len(template.Timeline) == 0 {
+			zero := int64(0)
+			segment.T = &zero
+		}
+		template.Timeline = append(template.Timeline, segment)
+	}
+
+	return template, total, nil
+}
+
+// readMediaPlaylist reads the init segment and the segment durations of an fMP4 media playlist
+func readMediaPlaylist(path string) (*mediaPlaylist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media playlist: %w", err)
+	}
+	defer file.Close()
+
+	playlist := &mediaPlaylist{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			playlist.initSegment = playlistAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"]
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q in %s", value, path)
+			}
+			playlist.durations = append(playlist.durations, duration)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read media playlist: %w", err)
+	}
+
+	if playlist.initSegment == "" || len(playlist.durations) == 0 {
+		return nil, fmt.Errorf("%s is not an fMP4 media playlist", path)
+	}
+	return playlist, nil
+}
+
+// isoDuration formats seconds as an ISO 8601 duration
+func isoDuration(seconds float64) string {
+	return fmt.Sprintf("PT%.3fS", seconds)
+}
@@ -0,0 +1,55 @@
+package transcoder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+)
+
+// TestSegmentTemplate builds the segment templates of media playlists written by FFmpeg in
+// testdata/dash and compares them with the golden files
+func TestSegmentTemplate(t *testing.T) {
+	tests := []struct {
+		rendition string
+		duration  float64
+		wantErr   bool
+	}{
+		{rendition: "360p", duration: 13.966667},
+		// AAC frames do not fit the segment length, segments alternate in length
+		{rendition: "audio_96k", duration: 16.021333},
+		// Segments of 29.97 fps video are rounded to the timescale without drift
+		{rendition: "240p_ntsc", duration: 26.259567},
+		{rendition: "ts", wantErr: true},
+		{rendition: "empty", wantErr: true},
+		{rendition: "invalid", wantErr: true},
+		{rendition: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rendition, func(t *testing.T) {
+			template, duration, err := segmentTemplate(filepath.Join("testdata", "dash"), tt.rendition)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("segmentTemplate() = %+v, want error", template)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("segmentTemplate() error = %v", err)
+			}
+			if diff := duration - tt.duration; diff > 1e-6 || diff < -1e-6 {
+				t.Errorf("duration = %f, want %f", duration, tt.duration)
+			}
+
+			// The template is compared as it appears in the manifest
+			var got bytes.Buffer
+			encoder := xml.NewEncoder(&got)
+			encoder.Indent("", "  ")
+			if err := encoder.EncodeElement(template, xml.StartElement{Name: xml.Name{Local: "SegmentTemplate"}}); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, filepath.Join("testdata", "dash", tt.rendition+".golden"), append(got.Bytes(), '\n'))
+		})
+	}
+}
@@ -1,13 +1,14 @@
 package transcoder
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -28,13 +29,38 @@ type ffmpegGoImpl struct {
 	ffmpegPreset        string
 	ffmpegCRF           int
 	ffmpegSegmentLength int
-	outputFormats       []string
-	outputQualities     []Quality
-	tempDir             string
+	storyboardInterval  time.Duration
+	thumbnailCandidates int
+	previewLength       time.Duration
+	loudnessTarget      float64
+	packaging           string
+	perTitle            bool
+	// codecs are the codec families of the output formats, MP4 files use the first one
+	codecs          []videoCodec
+	outputQualities []Quality
+	tempDir         string
 }
 
 // newFFmpegGoImpl creates a new transcoder
-func newFFmpegGoImpl(ffmpegPath string, ffmpegThreads int, ffmpegPreset string, ffmpegCRF int, ffmpegSegmentLength int, outputFormats []string, outputQualities []string, tempDir string) (*ffmpegGoImpl, error) {
+func newFFmpegGoImpl(ffmpegPath string, ffmpegThreads int, ffmpegPreset string, ffmpegCRF int, ffmpegSegmentLength int, storyboardInterval time.Duration, thumbnailCandidates int, previewLength time.Duration, loudnessTarget float64, packaging string, perTitle bool, outputFormats []string, outputQualities []string, tempDir string) (*ffmpegGoImpl, error) {
+	if packaging != PackagingTS && packaging != PackagingCMAF {
+		return nil, fmt.Errorf("unknown packaging: %s", packaging)
+	}
+
+	videoCodecs, err := resolveCodecs(ffmpegPath, outputFormats)
+	if err != nil {
+		return nil, err
+	}
+	if len(videoCodecs) == 0 {
+		return nil, fmt.Errorf("no output formats")
+	}
+	for _, c := range videoCodecs {
+		// MPEG-TS segments can only carry H.264 in HLS
+		if c.name != CodecH264 && packaging != PackagingCMAF {
+			return nil, fmt.Errorf("output format %s requires %s packaging", c.name, PackagingCMAF)
+		}
+	}
+
 	// Parse quality strings into Quality structs
 	qualities := make([]Quality, 0, len(outputQualities))
 	for _, q := range outputQualities {
@@ -51,7 +77,13 @@ func newFFmpegGoImpl(ffmpegPath string, ffmpegThreads int, ffmpegPreset string,
 		ffmpegPreset:        ffmpegPreset,
 		ffmpegCRF:           ffmpegCRF,
 		ffmpegSegmentLength: ffmpegSegmentLength,
-		outputFormats:       outputFormats,
+		storyboardInterval:  storyboardInterval,
+		thumbnailCandidates: thumbnailCandidates,
+		previewLength:       previewLength,
+		loudnessTarget:      loudnessTarget,
+		packaging:           packaging,
+		perTitle:            perTitle,
+		codecs:              videoCodecs,
 		outputQualities:     qualities,
 		tempDir:             tempDir,
 	}, nil
@@ -96,7 +128,81 @@ func setupFFmpegLogging(videoID string, tempDir string) (*os.File, error) {
 }
 
 // TranscodeToHLS transcodes a video to HLS format with multiple quality levels
-func (t *ffmpegGoImpl) TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error {
+func (t *ffmpegGoImpl) TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error {
+	return t.transcode(ctx, inputPath, outputDir, "", getQualityLevels(inputWidth, inputHeight), nil, onProgress)
+}
+
+// TranscodeToMP4 transcodes a video to MP4 format with multiple quality levels
+func (t *ffmpegGoImpl) TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error {
+	return t.transcode(ctx, inputPath, "", filepath.Join(outputDir, "mp4"), getQualityLevels(inputWidth, inputHeight), nil, onProgress)
+}
+
+// TranscodeRenditions transcodes a video to HLS and MP4 in a single FFmpeg run
+func (t *ffmpegGoImpl) TranscodeRenditions(ctx context.Context, inputPath, hlsDir, mp4OutputDir string, qualityLevels []QualityLevel, loudness *Loudness, onProgress ProgressFunc) error {
+	mp4Dir := ""
+	if mp4OutputDir != "" {
+		mp4Dir = filepath.Join(mp4OutputDir, "mp4")
+	}
+	return t.transcode(ctx, inputPath, hlsDir, mp4Dir, qualityLevels, loudness, onProgress)
+}
+
+// MeasureLoudness measures the loudness of the audio of a video for normalization to the loudness
+// target. It returns nil if normalization is disabled or there is no audio to normalize.
+func (t *ffmpegGoImpl) MeasureLoudness(ctx context.Context, inputPath string) (*Loudness, error) {
+	if t.loudnessTarget == 0 {
+		return nil, nil
+	}
+	return measureLoudness(ctx, t.ffmpegPath, t.ffmpegThreads, inputPath, t.loudnessTarget)
+}
+
+// variant is an HLS rendition of a quality level in one codec
+type variant struct {
+	// name is the directory of the rendition, the quality level for the first codec and the
+	// quality level and codec like 720p_hevc for the others
+	name string
+	// level is the index of the quality level
+	level   int
+	quality QualityLevel
+	codec   videoCodec
+	// bitrate is the maximum bitrate in kbps from the ladder of the codec
+	bitrate int
+}
+
+// codecs returns the codec string of the variant
+func (v variant) codecs(audio bool) string {
+	codecs := v.codec.codecString(v.quality.Width, v.quality.Height)
+	if audio {
+		codecs += "," + audioCodecs
+	}
+	return codecs
+}
+
+// variants returns the HLS renditions of the quality levels, grouped by codec
+func (t *ffmpegGoImpl) variants(qualityLevels []QualityLevel) []variant {
+	variants := make([]variant, 0, len(t.codecs)*len(qualityLevels))
+	for i, c := range t.codecs {
+		for level, quality := range qualityLevels {
+			name := quality.Name
+			if i > 0 {
+				name += "_" + c.name
+			}
+			variants = append(variants, variant{
+				name:    name,
+				level:   level,
+				quality: quality,
+				codec:   c,
+				bitrate: c.bitrate(quality),
+			})
+		}
+	}
+	return variants
+}
+
+// transcode encodes the quality levels in a single FFmpeg run, writing the HLS variants of every
+// codec, their audio renditions and the master playlist to hlsDir and an MP4 file per quality level
+// to mp4Dir. Either directory may be empty to skip that format. The audio is normalized with the
+// loudness measurement if there is one.
+func (t *ffmpegGoImpl) transcode(ctx context.Context, inputPath, hlsDir, mp4Dir string, qualityLevels []QualityLevel, loudness *Loudness, onProgress ProgressFunc) error {
 	// Extract videoID from inputPath
 	videoID := filepath.Base(filepath.Dir(inputPath))
 
@@ -107,245 +213,346 @@ func (t *ffmpegGoImpl) TranscodeToHLS(ctx context.Context, inputPath, outputDir
 	}
 	defer logFile.Close()
 
-	// Get appropriate quality levels based on input resolution
-	qualityLevels := getQualityLevels(inputWidth, inputHeight)
-
-	log.Printf("Starting HLS transcoding for video %s with %d quality levels", videoID, len(qualityLevels))
+	names := make([]string, len(qualityLevels))
+	for i, quality := range qualityLevels {
+		names[i] = quality.Name
+	}
+	rendition := strings.Join(names, ",")
 
-	// Ensure the output directory exists
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	var variants []variant
+	if hlsDir != "" {
+		variants = t.variants(qualityLevels)
 	}
 
-	// Create a master playlist
-	masterPlaylistPath := filepath.Join(outputDir, "master.m3u8")
-	masterPlaylist, err := os.Create(masterPlaylistPath)
+	tracks, err := probeAudioTracks(ctx, inputPath)
 	if err != nil {
-		return fmt.Errorf("failed to create master playlist: %w", err)
+		return err
+	}
+	var audioRenditions []audioRendition
+	if hlsDir != "" {
+		audioRenditions = newAudioRenditions(qualityLevels, tracks)
 	}
-	defer masterPlaylist.Close()
-
-	// Write the master playlist header
-	masterPlaylist.WriteString("#EXTM3U\n")
-	masterPlaylist.WriteString("#EXT-X-VERSION:3\n")
-
-	// Transcode for each quality
-	for i, quality := range qualityLevels {
-		log.Printf("Transcoding quality level %d/%d: %s (%dx%d)", i+1, len(qualityLevels), quality.Name, quality.Width, quality.Height)
 
-		// Create a directory for this quality
-		qualityDir := filepath.Join(outputDir, quality.Name)
-		if err := os.MkdirAll(qualityDir, 0755); err != nil {
-			return fmt.Errorf("failed to create quality directory: %w", err)
+	// Create the output directories, one per HLS rendition
+	if hlsDir != "" {
+		renditions := make([]string, 0, len(variants)+len(audioRenditions))
+		for _, v := range variants {
+			renditions = append(renditions, v.name)
 		}
-
-		// Create a playlist for this quality
-		playlistPath := filepath.Join(qualityDir, "playlist.m3u8")
-		playlist, err := os.Create(playlistPath)
-		if err != nil {
-			return fmt.Errorf("failed to create playlist: %w", err)
+		for _, a := range audioRenditions {
+			renditions = append(renditions, a.name)
 		}
-		defer playlist.Close()
-
-		// Write the playlist header
-		playlist.WriteString("#EXTM3U\n")
-		playlist.WriteString("#EXT-X-VERSION:3\n")
-		playlist.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", t.ffmpegSegmentLength))
-		playlist.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
-
-		// Build the FFmpeg command
-		args := []string{
-			"-i", inputPath,
-			"-c:v", "libx264",
-			"-preset", t.ffmpegPreset,
-			"-crf", strconv.Itoa(t.ffmpegCRF),
-			"-maxrate", fmt.Sprintf("%dk", quality.Bitrate),
-			"-bufsize", fmt.Sprintf("%dk", quality.Bitrate*2),
-			"-vf", fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height),
-			"-c:a", "aac",
-			"-b:a", fmt.Sprintf("%dk", quality.AudioBitrate),
-			"-ar", "48000",
-			"-ac", "2",
-			"-f", "hls",
-			"-hls_time", strconv.Itoa(t.ffmpegSegmentLength),
-			"-hls_list_size", "0",
-			"-hls_segment_filename", filepath.Join(qualityDir, "segment_%03d.ts"),
-			"-hls_flags", "independent_segments",
-			"-threads", strconv.Itoa(t.ffmpegThreads),
-			"-progress", "pipe:1", // Add progress output
-			playlistPath,
+		for _, name := range renditions {
+			if err := os.MkdirAll(filepath.Join(hlsDir, name), 0755); err != nil {
+				return fmt.Errorf("failed to create quality directory: %w", err)
+			}
 		}
+	}
+	if mp4Dir != "" {
+		if err := os.MkdirAll(mp4Dir, 0755); err != nil {
+			return fmt.Errorf("failed to create MP4 directory: %w", err)
+		}
+	}
 
-		// Run the FFmpeg command
-		cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	log.Printf("Starting transcoding for video %s with quality levels %s (HLS: %d variants, audio tracks: %d, MP4: %t)", videoID, rendition, len(variants), len(tracks), mp4Dir != "")
+	started := time.Now()
 
-		// Create a pipe for progress output
-		progressPipe, err := cmd.StdoutPipe()
-		if err != nil {
-			return fmt.Errorf("failed to create progress pipe: %w", err)
-		}
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, t.renditionArgs(inputPath, qualityLevels, variants, audioRenditions, tracks, loudness, hlsDir, mp4Dir)...)
 
-		// Set stderr to the log file
-		cmd.Stderr = logFile
+	// Create a pipe for progress output
+	progressPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create progress pipe: %w", err)
+	}
 
-		// Start the command
-		if err := cmd.Start(); err != nil {
-			return fmt.Errorf("failed to start ffmpeg: %w", err)
-		}
+	// Set stderr to the log file
+	cmd.Stderr = logFile
 
-		// Read progress in a goroutine
-		go func() {
-			scanner := bufio.NewScanner(progressPipe)
-			for scanner.Scan() {
-				line := scanner.Text()
-				if strings.HasPrefix(line, "out_time_ms=") {
-					timeMs := strings.TrimPrefix(line, "out_time_ms=")
-					if ms, err := strconv.ParseInt(timeMs, 10, 64); err == nil {
-						duration := time.Duration(ms) * time.Microsecond
-						log.Printf("Progress for %s: %v", quality.Name, duration.Round(time.Second))
-					}
-				}
-			}
-		}()
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
 
-		// Wait for the command to complete
-		if err := cmd.Wait(); err != nil {
-			return fmt.Errorf("failed to transcode video: %w", err)
-		}
+	// Read progress in a goroutine. All quality levels advance together.
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		readProgress(progressPipe, func(outTime time.Duration) {
+			log.Printf("Progress for %s: %v", videoID, outTime.Round(time.Second))
+			report(onProgress, Progress{Rendition: rendition, Weight: 1, OutTime: outTime})
+		})
+	}()
+
+	// Wait for the command to complete, the progress output has to be read first
+	<-progressDone
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to transcode video: %w", err)
+	}
 
-		log.Printf("Completed transcoding for quality level %s", quality.Name)
+	if hlsDir != "" {
+		// FFmpeg does not know the codec strings of every codec
+		masterPath := filepath.Join(hlsDir, "master.m3u8")
+		if err := setVariantAttributes(masterPath, variants, len(tracks) > 0); err != nil {
+			return fmt.Errorf("failed to update master playlist: %w", err)
+		}
+		if err := setAudioAttributes(masterPath, audioRenditions); err != nil {
+			return fmt.Errorf("failed to update audio renditions: %w", err)
+		}
+		if err := addAudioOnlyVariants(masterPath, audioRenditions); err != nil {
+			return fmt.Errorf("failed to add audio-only variants: %w", err)
+		}
 
-		// Add this quality to the master playlist
-		masterPlaylist.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d\n", quality.Bitrate*1000, quality.Width, quality.Height))
-		masterPlaylist.WriteString(fmt.Sprintf("%s/playlist.m3u8\n", quality.Name))
+		// The DASH manifest references the segments of the HLS renditions
+		if t.packaging == PackagingCMAF {
+			if err := t.writeDASHManifest(hlsDir, variants, audioRenditions); err != nil {
+				return fmt.Errorf("failed to write DASH manifest: %w", err)
+			}
+		}
 	}
 
-	log.Printf("Completed HLS transcoding for video %s", videoID)
+	log.Printf("Completed transcoding for video %s in %s", videoID, time.Since(started).Round(time.Millisecond))
+	report(onProgress, Progress{Rendition: rendition, Done: 1})
+
 	return nil
 }
 
-// TranscodeToMP4 transcodes a video to MP4 format with multiple quality levels
-func (t *ffmpegGoImpl) TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error {
-	// Extract videoID from inputPath
-	videoID := filepath.Base(filepath.Dir(inputPath))
-
-	// Setup logging
-	logFile, err := setupFFmpegLogging(videoID, t.tempDir)
-	if err != nil {
-		return fmt.Errorf("failed to setup logging: %w", err)
+// renditionArgs builds the FFmpeg arguments of a transcoding run. The input is decoded once and
+// scaled once per quality level, the scaled video is split between the HLS variants of every codec
+// and the MP4 output. Every audio track is normalized once and split between its audio renditions,
+// the MP4 files get the primary track.
+func (t *ffmpegGoImpl) renditionArgs(inputPath string, qualityLevels []QualityLevel, variants []variant, audioRenditions []audioRendition, tracks []audioTrack, loudness *Loudness, hlsDir, mp4Dir string) []string {
+	// Build the filter graph
+	split := fmt.Sprintf("[0:v:0]split=%d", len(qualityLevels))
+	for i := range qualityLevels {
+		split += fmt.Sprintf("[s%d]", i)
 	}
-	defer logFile.Close()
+	graph := []string{split}
+	for i, quality := range qualityLevels {
+		var outputs []string
+		for k, v := range variants {
+			if v.level == i {
+				outputs = append(outputs, fmt.Sprintf("[h%d]", k))
+			}
+		}
+		if mp4Dir != "" {
+			outputs = append(outputs, fmt.Sprintf("[m%d]", i))
+		}
 
-	// Get appropriate quality levels based on input resolution
-	qualityLevels := getQualityLevels(inputWidth, inputHeight)
-
-	// Create MP4 directory
-	mp4Dir := filepath.Join(outputDir, "mp4")
-	if err := os.MkdirAll(mp4Dir, 0755); err != nil {
-		return fmt.Errorf("failed to create MP4 directory: %w", err)
-	}
-
-	// Add progress logging for MP4 transcoding
-	for _, quality := range qualityLevels {
-		outputPath := filepath.Join(mp4Dir, fmt.Sprintf("%s.mp4", quality.Name))
-
-		// Build FFmpeg command for MP4
-		args := []string{
-			"-i", inputPath,
-			"-c:v", "libx264",
-			"-preset", t.ffmpegPreset,
-			"-crf", strconv.Itoa(t.ffmpegCRF),
-			"-maxrate", fmt.Sprintf("%dk", quality.Bitrate),
-			"-bufsize", fmt.Sprintf("%dk", quality.Bitrate*2),
-			"-vf", fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height),
-			"-c:a", "aac",
-			"-b:a", fmt.Sprintf("%dk", quality.AudioBitrate),
-			"-ar", "48000",
-			"-ac", "2",
-			"-movflags", "+faststart",
-			"-threads", strconv.Itoa(t.ffmpegThreads),
-			"-progress", "pipe:1", // Add progress output
-			outputPath,
+		// The quality levels keep the aspect ratio of the input, square pixels avoid rounding
+		// artifacts in the sample aspect ratio
+		scale := fmt.Sprintf("[s%d]scale=%d:%d,setsar=1", i, quality.Width, quality.Height)
+		if len(outputs) > 1 {
+			scale += fmt.Sprintf(",split=%d", len(outputs))
 		}
+		graph = append(graph, scale+strings.Join(outputs, ""))
+	}
 
-		cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	// Audio streams [a0], [a1], ... of the audio renditions first, then of the MP4 files. The
+	// measurement is of the primary track, the other tracks are normalized in a single pass.
+	// loudnorm resamples to 192 kHz.
+	mp4Audio := len(audioRenditions)
+	audio := len(tracks) > 0
+	for _, track := range tracks {
+		var outputs []string
+		for j, a := range audioRenditions {
+			if a.track.index == track.index {
+				outputs = append(outputs, fmt.Sprintf("[a%d]", j))
+			}
+		}
+		if mp4Dir != "" && track.index == 0 {
+			for i := range qualityLevels {
+				outputs = append(outputs, fmt.Sprintf("[a%d]", mp4Audio+i))
+			}
+		}
+		if len(outputs) == 0 {
+			continue
+		}
 
-		// Create a pipe for progress output
-		progressPipe, err := cmd.StdoutPipe()
-		if err != nil {
-			return fmt.Errorf("failed to create progress pipe: %w", err)
+		filter := fmt.Sprintf("[0:a:%d]", track.index)
+		if loudness != nil {
+			measured := loudness
+			if track.index > 0 {
+				measured = nil
+			}
+			filter += loudnormFilter(loudness.Target, measured) + ","
 		}
+		filter += fmt.Sprintf("aresample=48000,asplit=%d", len(outputs))
+		graph = append(graph, filter+strings.Join(outputs, ""))
+	}
 
-		// Set stderr to the log file
-		cmd.Stderr = logFile
+	// FFmpeg rotates inputs with a display matrix upright before the filters run, the quality
+	// levels are sized for the rotated frames
+	args := []string{
+		"-y",
+		"-i", inputPath,
+		"-filter_complex", strings.Join(graph, ";"),
+		"-progress", "pipe:1", // Add progress output
+	}
 
-		// Start the command
-		if err := cmd.Start(); err != nil {
-			return fmt.Errorf("failed to start ffmpeg: %w", err)
+	audioArgs := []string{
+		"-c:a", "aac",
+		"-ar", "48000",
+		"-ac", "2",
+	}
+
+	// HLS variants are streams of a single output, options are addressed by stream index. The
+	// variants carry no audio, they reference the audio group at the audio bitrate of their quality
+	// level.
+	if hlsDir != "" {
+		cmaf := t.packaging == PackagingCMAF
+
+		for k := range variants {
+			args = append(args, "-map", fmt.Sprintf("[h%d]", k))
+		}
+		for j := range audioRenditions {
+			args = append(args, "-map", fmt.Sprintf("[a%d]", j))
+		}
+		if len(audioRenditions) > 0 {
+			args = append(args, audioArgs...)
 		}
 
-		// Read progress in a goroutine
-		go func(qualityName string) {
-			scanner := bufio.NewScanner(progressPipe)
-			for scanner.Scan() {
-				line := scanner.Text()
-				if strings.HasPrefix(line, "out_time_ms=") {
-					timeMs := strings.TrimPrefix(line, "out_time_ms=")
-					if ms, err := strconv.ParseInt(timeMs, 10, 64); err == nil {
-						duration := time.Duration(ms) * time.Microsecond
-						log.Printf("Progress for %s: %v", qualityName, duration.Round(time.Second))
-					}
-				}
+		args = append(args, "-threads", strconv.Itoa(t.ffmpegThreads))
+
+		streamMap := make([]string, 0, len(variants)+len(audioRenditions))
+		for k, v := range variants {
+			args = append(args, v.codec.videoArgs(fmt.Sprintf(":v:%d", k), t.ffmpegPreset, t.ffmpegCRF, v.bitrate)...)
+			entry := fmt.Sprintf("v:%d", k)
+			if len(audioRenditions) > 0 {
+				entry += ",agroup:" + audioGroupName(v.quality.AudioBitrate)
 			}
-		}(quality.Name)
+			streamMap = append(streamMap, entry+",name:"+v.name)
+		}
+		for j, a := range audioRenditions {
+			args = append(args, fmt.Sprintf("-b:a:%d", j), fmt.Sprintf("%dk", a.bitrate))
+			streamMap = append(streamMap, fmt.Sprintf("a:%d,agroup:%s,name:%s", j, a.group, a.name))
+		}
 
-		// Wait for the command to complete
-		if err := cmd.Wait(); err != nil {
-			return fmt.Errorf("failed to transcode video: %w", err)
+		args = append(args,
+			// Keyframes at every segment boundary so players can switch between variants
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", t.ffmpegSegmentLength),
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(t.ffmpegSegmentLength),
+			"-hls_list_size", "0",
+		)
+		if cmaf {
+			// The init segments are written next to the playlists
+			args = append(args,
+				"-hls_segment_type", "fmp4",
+				"-hls_fmp4_init_filename", "init_%v.mp4",
+				"-hls_segment_filename", filepath.Join(hlsDir, "%v", "segment_%03d.m4s"),
+			)
+		} else {
+			args = append(args, "-hls_segment_filename", filepath.Join(hlsDir, "%v", "segment_%03d.ts"))
 		}
+		args = append(args,
+			"-hls_flags", "independent_segments",
+			"-master_pl_name", "master.m3u8",
+			"-var_stream_map", strings.Join(streamMap, " "),
+			filepath.Join(hlsDir, "%v", "playlist.m3u8"),
+		)
+	}
 
-		log.Printf("Completed transcoding for quality level %s", quality.Name)
+	// One MP4 output per quality level in the first codec
+	if mp4Dir != "" {
+		primary := t.codecs[0]
+		for i, quality := range qualityLevels {
+			args = append(args, "-map", fmt.Sprintf("[m%d]", i))
+			args = append(args, primary.videoArgs(":v", t.ffmpegPreset, t.ffmpegCRF, primary.bitrate(quality))...)
+			args = append(args, "-threads", strconv.Itoa(t.ffmpegThreads))
+			if audio {
+				args = append(args, "-map", fmt.Sprintf("[a%d]", mp4Audio+i))
+				args = append(args, audioArgs...)
+				args = append(args, "-b:a", fmt.Sprintf("%dk", quality.AudioBitrate))
+			}
+			args = append(args,
+				"-movflags", "+faststart",
+				filepath.Join(mp4Dir, quality.Name+".mp4"),
+			)
+		}
 	}
 
-	// Log final completion message
-	log.Printf("Completed MP4 transcoding for video %s", videoID)
+	return args
+}
 
-	return nil
+// standardLevels is the standard ladder, its bitrates suit content of average complexity. The
+// height of a quality level is the short side of its renditions.
+var standardLevels = []QualityLevel{
+	{Name: "4k", Width: 3840, Height: 2160, Bitrate: 15000, AudioBitrate: 192},
+	{Name: "1080p", Width: 1920, Height: 1080, Bitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Width: 1280, Height: 720, Bitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Width: 854, Height: 480, Bitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Width: 640, Height: 360, Bitrate: 800, AudioBitrate: 96},
+	{Name: "240p", Width: 426, Height: 240, Bitrate: 400, AudioBitrate: 64},
 }
 
-// getQualityLevels returns the appropriate quality levels based on input resolution
-func getQualityLevels(inputWidth, inputHeight int) []QualityLevel {
-	// Define all possible quality levels
-	allLevels := []QualityLevel{
-		{Name: "4k", Width: 3840, Height: 2160, Bitrate: 15000, AudioBitrate: 192},
-		{Name: "1080p", Width: 1920, Height: 1080, Bitrate: 5000, AudioBitrate: 192},
-		{Name: "720p", Width: 1280, Height: 720, Bitrate: 2800, AudioBitrate: 128},
-		{Name: "480p", Width: 854, Height: 480, Bitrate: 1400, AudioBitrate: 128},
-		{Name: "360p", Width: 640, Height: 360, Bitrate: 800, AudioBitrate: 96},
-		{Name: "240p", Width: 426, Height: 240, Bitrate: 400, AudioBitrate: 64},
+// standardBitrate returns the bitrate of a quality level in the standard ladder
+func standardBitrate(name string) int {
+	for _, level := range standardLevels {
+		if level.Name == name {
+			return level.Bitrate
+		}
 	}
+	return 0
+}
+
+// getQualityLevels returns the appropriate quality levels based on input resolution. Levels are
+// picked by the short side of the input, so portrait videos get the same ladder as landscape ones,
+// and their size keeps the aspect ratio of the input.
+func getQualityLevels(inputWidth, inputHeight int) []QualityLevel {
+	shortSide := min(inputWidth, inputHeight)
 
 	// Filter quality levels based on input resolution
 	var levels []QualityLevel
-	for _, level := range allLevels {
-		if level.Width <= inputWidth && level.Height <= inputHeight {
+	for _, level := range standardLevels {
+		if level.Height <= shortSide {
 			levels = append(levels, level)
 		}
 	}
 
-	// Ensure we have at least 2 quality levels
+	// Ensure we have at least 2 quality levels, small inputs are scaled up to 360p and 240p
 	if len(levels) < 2 {
-		// If input is lower than 240p, add 240p as the lowest quality
-		if inputWidth < 426 || inputHeight < 240 {
-			levels = append(levels, allLevels[5]) // 240p
-		}
-		// If input is lower than 360p, add 360p
-		if inputWidth < 640 || inputHeight < 360 {
-			levels = append(levels, allLevels[4]) // 360p
+		levels = slices.Clone(standardLevels[len(standardLevels)-2:])
+	}
+
+	if inputWidth <= 0 || inputHeight <= 0 {
+		return levels
+	}
+
+	// Scale the long side of the input like the short side
+	scaled := make([]QualityLevel, len(levels))
+	for i, level := range levels {
+		longSide := evenDimension(float64(max(inputWidth, inputHeight)) * float64(level.Height) / float64(shortSide))
+		if inputWidth >= inputHeight {
+			level.Width = longSide
+		} else {
+			level.Width, level.Height = level.Height, longSide
 		}
+		scaled[i] = level
+	}
+	return scaled
+}
+
+// evenDimension rounds a frame dimension to the nearest even number, which 4:2:0 chroma
+// subsampling requires
+func evenDimension(size float64) int {
+	return max(2, int(math.Round(size/2))*2)
+}
+
+// GenerateStoryboard writes the sprite sheets and WebVTT file of a video with a tile every
+// storyboard interval
+func (t *ffmpegGoImpl) GenerateStoryboard(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (string, error) {
+	if t.storyboardInterval <= 0 {
+		return "", nil
 	}
+	return generateStoryboard(ctx, t.ffmpegPath, t.ffmpegThreads, inputPath, outputDir, inputWidth, inputHeight, duration, t.storyboardInterval)
+}
 
-	return levels
+// GeneratePreview writes the WebP and MP4 previews of a video, preview length long
+func (t *ffmpegGoImpl) GeneratePreview(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (*Preview, error) {
+	if t.previewLength <= 0 {
+		return nil, nil
+	}
+	return generatePreview(ctx, t.ffmpegPath, t.ffmpegThreads, t.ffmpegPreset, inputPath, outputDir, inputWidth, inputHeight, duration, t.previewLength)
 }
 
 // ExtractMetadata extracts metadata from a video file
@@ -373,56 +580,25 @@ func (t *ffmpegGoImpl) ExtractMetadata(ctx context.Context, inputPath string) (m
 	return metadata, nil
 }
 
-// GenerateThumbnail generates a thumbnail from a video
-func (t *ffmpegGoImpl) GenerateThumbnail(ctx context.Context, inputPath, outputPath string) error {
-	// First get the duration
-	durationCmd := exec.CommandContext(ctx, t.ffmpegPath,
-		"-i", inputPath,
-		"-f", "null",
-		"-",
-	)
-	durationOutput, err := durationCmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to get video duration: %w\nOutput: %s", err, string(durationOutput))
-	}
-
-	// Extract duration from output
-	durationStr := string(durationOutput)
-	var duration float64
-	if _, err := fmt.Sscanf(durationStr, "Duration: %f", &duration); err != nil {
-		// If we can't parse duration, use a small offset
-		duration = 0.1
-	}
-
-	// Calculate seek time (10% of duration, but at least 0.1s and at most 5s)
-	seekTime := duration * 0.1
-	if seekTime < 0.1 {
-		seekTime = 0.1
-	} else if seekTime > 5.0 {
-		seekTime = 5.0
-	}
-
-	// Format seek time as HH:MM:SS.mmm
-	seekTimeStr := fmt.Sprintf("%02d:%02d:%02.3f",
-		int(seekTime)/3600,
-		(int(seekTime)%3600)/60,
-		seekTime-float64(int(seekTime)/3600*3600)-float64((int(seekTime)%3600)/60*60),
-	)
-
-	args := []string{
-		"-i", inputPath,
-		"-ss", seekTimeStr,
-		"-vframes", "1",
-		"-q:v", "2",
-		"-vf", "scale=320:-1,format=yuv420p",
-		"-y",
-		outputPath,
-	}
+// GenerateThumbnail picks the best of the frames at scene changes of a video as its thumbnail
+func (t *ffmpegGoImpl) GenerateThumbnail(ctx context.Context, inputPath, outputPath, candidateDir string, duration time.Duration) ([]ThumbnailCandidate, error) {
+	return generateThumbnailCandidates(ctx, t.ffmpegPath, inputPath, outputPath, candidateDir, duration, t.thumbnailCandidates)
+}
 
-	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+// GenerateThumbnailSet writes the frame at timestamp seconds to outputDir in every thumbnail size
+func (t *ffmpegGoImpl) GenerateThumbnailSet(ctx context.Context, inputPath, outputDir string, timestamp float64) error {
+	// Seeking before the input is fast and exact for a single frame
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, thumbnailArgs(inputPath, outputDir, timestamp)...)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
 	}
 
+	// A timestamp past the last frame produces no output but does not fail
+	for _, size := range ThumbnailSizes {
+		if _, err := os.Stat(filepath.Join(outputDir, size.Name+".jpg")); err != nil {
+			return fmt.Errorf("no frame at %.3fs: %w", timestamp, err)
+		}
+	}
+
 	return nil
 }
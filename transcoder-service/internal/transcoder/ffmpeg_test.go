@@ -0,0 +1,415 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// argValue returns the argument following the first occurrence of flag
+func argValue(args []string, flag string) string {
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		return ""
+	}
+	return args[i+1]
+}
+
+func newTestTranscoder(t *testing.T, packaging string, loudnessTarget float64) *ffmpegGoImpl {
+	t.Helper()
+	impl, err := newFFmpegGoImpl("ffmpeg", 2, "ultrafast", 28, 2, 0, 0, 0, loudnessTarget, packaging, false, []string{CodecH264}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("newFFmpegGoImpl: %v", err)
+	}
+	return impl
+}
+
+func TestRenditionArgs(t *testing.T) {
+	loudness := &Loudness{Integrated: -23.5, TruePeak: -4.2, Range: 6.1, Threshold: -34.0, Offset: 0.3, Target: -16}
+	twoTracks := []audioTrack{{index: 0, language: "eng", label: "eng"}, {index: 1, language: "fra", label: "fra"}}
+	oneTrack := []audioTrack{{index: 0, label: "Audio 1"}}
+
+	tests := []struct {
+		name      string
+		packaging string
+		tracks    []audioTrack
+		loudness  *Loudness
+		hls       bool
+		mp4       bool
+		graph     string
+		streamMap string
+		initName  string
+		segment   string
+	}{
+		{
+			name:      "cmaf with two normalized tracks and mp4",
+			packaging: PackagingCMAF,
+			tracks:    twoTracks,
+			loudness:  loudness,
+			hls:       true,
+			mp4:       true,
+			graph: "[0:v:0]split=2[s0][s1];" +
+				"[s0]scale=640:360,setsar=1,split=2[h0][m0];" +
+				"[s1]scale=426:240,setsar=1,split=2[h1][m1];" +
+				"[0:a:0]loudnorm=I=-16.00:TP=-1.50:LRA=11.00:measured_I=-23.50:measured_TP=-4.20:measured_LRA=6.10:measured_thresh=-34.00:offset=0.30:linear=true:print_format=none,aresample=48000,asplit=4[a0][a2][a4][a5];" +
+				"[0:a:1]loudnorm=I=-16.00:TP=-1.50:LRA=11.00,aresample=48000,asplit=2[a1][a3]",
+			streamMap: "v:0,agroup:audio_96k,name:360p v:1,agroup:audio_64k,name:240p " +
+				"a:0,agroup:audio_96k,name:audio_96k a:1,agroup:audio_96k,name:audio_96k_1 " +
+				"a:2,agroup:audio_64k,name:audio_64k a:3,agroup:audio_64k,name:audio_64k_1",
+			initName: "init_%v.mp4",
+			segment:  "segment_%03d.m4s",
+		},
+		{
+			name:      "ts with one track without normalization",
+			packaging: PackagingTS,
+			tracks:    oneTrack,
+			hls:       true,
+			graph: "[0:v:0]split=2[s0][s1];" +
+				"[s0]scale=640:360,setsar=1[h0];" +
+				"[s1]scale=426:240,setsar=1[h1];" +
+				"[0:a:0]aresample=48000,asplit=2[a0][a1]",
+			streamMap: "v:0,agroup:audio_96k,name:360p v:1,agroup:audio_64k,name:240p " +
+				"a:0,agroup:audio_96k,name:audio_96k a:1,agroup:audio_64k,name:audio_64k",
+			segment: "segment_%03d.ts",
+		},
+		{
+			name:      "mp4 only without audio",
+			packaging: PackagingTS,
+			mp4:       true,
+			graph: "[0:v:0]split=2[s0][s1];" +
+				"[s0]scale=640:360,setsar=1[m0];" +
+				"[s1]scale=426:240,setsar=1[m1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impl := newTestTranscoder(t, tt.packaging, -16)
+			levels := getQualityLevels(640, 360)
+
+			hlsDir, mp4Dir := "", ""
+			var variants []variant
+			var renditions []audioRendition
+			if tt.hls {
+				hlsDir = "/out/hls"
+				variants = impl.variants(levels)
+				renditions = newAudioRenditions(levels, tt.tracks)
+			}
+			if tt.mp4 {
+				mp4Dir = "/out/mp4"
+			}
+
+			args := impl.renditionArgs("/in/video.mp4", levels, variants, renditions, tt.tracks, tt.loudness, hlsDir, mp4Dir)
+
+			if got := argValue(args, "-filter_complex"); got != tt.graph {
+				t.Errorf("filter_complex:\n got %s\nwant %s", got, tt.graph)
+			}
+			if got := argValue(args, "-var_stream_map"); got != tt.streamMap {
+				t.Errorf("var_stream_map:\n got %s\nwant %s", got, tt.streamMap)
+			}
+			if got := argValue(args, "-hls_fmp4_init_filename"); got != tt.initName {
+				t.Errorf("hls_fmp4_init_filename = %q, want %q", got, tt.initName)
+			}
+			if tt.hls {
+				want := filepath.Join(hlsDir, "%v", tt.segment)
+				if got := argValue(args, "-hls_segment_filename"); got != want {
+					t.Errorf("hls_segment_filename = %q, want %q", got, want)
+				}
+			}
+
+			for _, quality := range levels {
+				output := filepath.Join(mp4Dir, quality.Name+".mp4")
+				if got := slices.Contains(args, output); got != tt.mp4 {
+					t.Errorf("MP4 output %s present = %t, want %t", output, got, tt.mp4)
+				}
+			}
+		})
+	}
+}
+
+func TestGetQualityLevels(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		// want holds name:WxH of every level
+		want []string
+	}{
+		{
+			name:  "1080p landscape",
+			width: 1920, height: 1080,
+			want: []string{"1080p:1920x1080", "720p:1280x720", "480p:854x480", "360p:640x360", "240p:426x240"},
+		},
+		{
+			// A 1920x1080 stream rotated by 90 degrees is probed as 1080x1920
+			name:  "1080p portrait",
+			width: 1080, height: 1920,
+			want: []string{"1080p:1080x1920", "720p:720x1280", "480p:480x854", "360p:360x640", "240p:240x426"},
+		},
+		{
+			name:  "720p portrait",
+			width: 720, height: 1280,
+			want: []string{"720p:720x1280", "480p:480x854", "360p:360x640", "240p:240x426"},
+		},
+		{
+			name:  "4k",
+			width: 3840, height: 2160,
+			want: []string{"4k:3840x2160", "1080p:1920x1080", "720p:1280x720", "480p:854x480", "360p:640x360", "240p:426x240"},
+		},
+		{
+			name:  "short side between rungs",
+			width: 1366, height: 768,
+			want: []string{"720p:1280x720", "480p:854x480", "360p:640x360", "240p:426x240"},
+		},
+		{
+			name:  "ultrawide",
+			width: 2560, height: 1080,
+			want: []string{"1080p:2560x1080", "720p:1706x720", "480p:1138x480", "360p:854x360", "240p:568x240"},
+		},
+		{
+			name:  "240p keeps two levels",
+			width: 426, height: 240,
+			want: []string{"360p:640x360", "240p:426x240"},
+		},
+		{
+			name:  "below 240p is scaled up",
+			width: 320, height: 180,
+			want: []string{"360p:640x360", "240p:426x240"},
+		},
+		{
+			name:  "below 240p with an odd scaled side",
+			width: 174, height: 144,
+			want: []string{"360p:436x360", "240p:290x240"},
+		},
+		{
+			name:  "below 240p portrait",
+			width: 144, height: 256,
+			want: []string{"360p:360x640", "240p:240x426"},
+		},
+		{
+			name: "unknown size",
+			want: []string{"360p:640x360", "240p:426x240"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := getQualityLevels(tt.width, tt.height)
+
+			got := make([]string, len(levels))
+			for i, level := range levels {
+				got[i] = fmt.Sprintf("%s:%dx%d", level.Name, level.Width, level.Height)
+				if level.Width%2 != 0 || level.Height%2 != 0 {
+					t.Errorf("%s has odd size %dx%d", level.Name, level.Width, level.Height)
+				}
+				if level.Bitrate != standardBitrate(level.Name) {
+					t.Errorf("%s has bitrate %d, want %d", level.Name, level.Bitrate, standardBitrate(level.Name))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getQualityLevels(%d, %d) = %v, want %v", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeSample writes a short test video with a tone per audio language
+func writeSample(t *testing.T, path string, languages []string) {
+	t.Helper()
+	args := []string{"-y", "-f", "lavfi", "-i", "testsrc2=size=640x360:rate=30:duration=6"}
+	for i := range languages {
+		args = append(args, "-f", "lavfi", "-i", "sine=frequency="+strconv.Itoa(440+220*i)+":duration=6")
+	}
+	args = append(args, "-map", "0:v")
+	for i, language := range languages {
+		args = append(args, "-map", strconv.Itoa(i+1)+":a", "-metadata:s:a:"+strconv.Itoa(i), "language="+language)
+	}
+	args = append(args, "-c:v", "libx264", "-preset", "ultrafast", "-c:a", "aac", "-shortest", path)
+
+	if output, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+		t.Fatalf("failed to write sample: %v\n%s", err, output)
+	}
+}
+
+// TestTranscodeRenditionsFFmpeg runs the single FFmpeg run against a generated sample. It needs
+// ffmpeg and ffprobe on PATH and logs the time of the single run next to separate HLS and MP4 runs.
+func TestTranscodeRenditionsFFmpeg(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping FFmpeg integration test in short mode")
+	}
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not on PATH", tool)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		packaging      string
+		loudnessTarget float64
+		languages      []string
+	}{
+		{name: "cmaf with two normalized tracks", packaging: PackagingCMAF, loudnessTarget: -16, languages: []string{"eng", "fra"}},
+		{name: "ts with one track", packaging: PackagingTS, languages: []string{"eng"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			impl := newTestTranscoder(t, tt.packaging, tt.loudnessTarget)
+
+			inputDir := filepath.Join(t.TempDir(), "sample")
+			if err := os.MkdirAll(inputDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			inputPath := filepath.Join(inputDir, "video.mp4")
+			writeSample(t, inputPath, tt.languages)
+
+			loudness, err := impl.MeasureLoudness(ctx, inputPath)
+			if err != nil {
+				t.Fatalf("MeasureLoudness: %v", err)
+			}
+			if (loudness != nil) != (tt.loudnessTarget != 0) {
+				t.Fatalf("loudness = %+v with target %v", loudness, tt.loudnessTarget)
+			}
+
+			levels := getQualityLevels(640, 360)
+			outputDir := t.TempDir()
+			hlsDir := filepath.Join(outputDir, "hls")
+
+			started := time.Now()
+			if err := impl.TranscodeRenditions(ctx, inputPath, hlsDir, outputDir, levels, loudness, nil); err != nil {
+				t.Fatalf("TranscodeRenditions: %v", err)
+			}
+			single := time.Since(started)
+
+			master, err := os.ReadFile(filepath.Join(hlsDir, "master.m3u8"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// FFmpeg prefixes the audio groups of the stream map
+			for _, want := range []string{`TYPE=AUDIO`, `GROUP-ID="group_audio_96k"`, `GROUP-ID="group_audio_64k"`, `AUDIO="group_audio_96k"`} {
+				if !strings.Contains(string(master), want) {
+					t.Errorf("master playlist misses %s:\n%s", want, master)
+				}
+			}
+			for _, language := range tt.languages {
+				if !strings.Contains(string(master), `LANGUAGE="`+language+`"`) {
+					t.Errorf("master playlist misses language %s:\n%s", language, master)
+				}
+			}
+			// A variant per quality level and an audio-only variant per audio group
+			if got := strings.Count(string(master), streamInfTag); got != 4 {
+				t.Errorf("master playlist has %d variants, want 4:\n%s", got, master)
+			}
+
+			segmentPattern := "segment_*.ts"
+			if tt.packaging == PackagingCMAF {
+				segmentPattern = "segment_*.m4s"
+			}
+			tracks := make([]audioTrack, len(tt.languages))
+			for i := range tracks {
+				tracks[i].index = i
+			}
+			for _, r := range newAudioRenditions(levels, tracks) {
+				assertFiles(t, filepath.Join(hlsDir, r.name), "playlist.m3u8", segmentPattern)
+			}
+			for _, v := range impl.variants(levels) {
+				assertFiles(t, filepath.Join(hlsDir, v.name), "playlist.m3u8", segmentPattern)
+				if tt.packaging == PackagingCMAF {
+					assertFiles(t, filepath.Join(hlsDir, v.name), "init_*.mp4")
+				}
+			}
+			if tt.packaging == PackagingCMAF {
+				assertFiles(t, hlsDir, DASHManifestName)
+			}
+			for _, quality := range levels {
+				assertFiles(t, filepath.Join(outputDir, "mp4"), quality.Name+".mp4")
+			}
+
+			// The renditions used to be encoded by a run per format
+			separateDir := t.TempDir()
+			started = time.Now()
+			if err := impl.TranscodeToHLS(ctx, inputPath, filepath.Join(separateDir, "hls"), 640, 360, nil); err != nil {
+				t.Fatalf("TranscodeToHLS: %v", err)
+			}
+			if err := impl.TranscodeToMP4(ctx, inputPath, separateDir, 640, 360, nil); err != nil {
+				t.Fatalf("TranscodeToMP4: %v", err)
+			}
+			t.Logf("single run: %s, separate HLS and MP4 runs: %s", single.Round(time.Millisecond), time.Since(started).Round(time.Millisecond))
+		})
+	}
+}
+
+// TestTranscodeTimingsFFmpeg times the single FFmpeg run against the per-quality runs it replaced on
+// the file in TRANSCODER_SAMPLE, with the default encoder settings of the service. It is skipped unless
+// the variable is set, see "Transcoding Performance" in the README.
+func TestTranscodeTimingsFFmpeg(t *testing.T) {
+	sample := os.Getenv("TRANSCODER_SAMPLE")
+	if sample == "" {
+		t.Skip("TRANSCODER_SAMPLE is not set")
+	}
+
+	output, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=width,height", "-of", "csv=p=0:s=x", sample).Output()
+	if err != nil {
+		t.Fatalf("ffprobe: %v", err)
+	}
+	var width, height int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(output)), "%dx%d", &width, &height); err != nil {
+		t.Fatalf("unexpected ffprobe output %q: %v", output, err)
+	}
+
+	ctx := context.Background()
+	impl, err := newFFmpegGoImpl("ffmpeg", 4, "medium", 23, 10, 0, 0, 0, 0, PackagingTS, false, []string{CodecH264}, nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("newFFmpegGoImpl: %v", err)
+	}
+	levels := getQualityLevels(width, height)
+
+	// Before: one FFmpeg run per quality level for HLS and again for MP4
+	perQualityDir := t.TempDir()
+	started := time.Now()
+	for _, level := range levels {
+		hlsDir := filepath.Join(perQualityDir, "hls", level.Name)
+		if err := impl.transcode(ctx, sample, hlsDir, "", []QualityLevel{level}, nil, nil); err != nil {
+			t.Fatalf("HLS run for %s: %v", level.Name, err)
+		}
+		if err := impl.transcode(ctx, sample, "", filepath.Join(perQualityDir, "mp4"), []QualityLevel{level}, nil, nil); err != nil {
+			t.Fatalf("MP4 run for %s: %v", level.Name, err)
+		}
+	}
+	perQuality := time.Since(started)
+
+	// After: a single run decoding the input once
+	singleDir := t.TempDir()
+	started = time.Now()
+	if err := impl.TranscodeRenditions(ctx, sample, filepath.Join(singleDir, "hls"), singleDir, levels, nil, nil); err != nil {
+		t.Fatalf("TranscodeRenditions: %v", err)
+	}
+	single := time.Since(started)
+
+	t.Logf("%s (%dx%d, %d quality levels): per-quality runs %s, single run %s",
+		filepath.Base(sample), width, height, len(levels), perQuality.Round(time.Millisecond), single.Round(time.Millisecond))
+}
+
+// assertFiles fails the test unless every pattern matches a non-empty file in dir
+func assertFiles(t *testing.T, dir string, patterns ...string) {
+	t.Helper()
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil || len(matches) == 0 {
+			t.Errorf("no %s in %s", pattern, dir)
+			continue
+		}
+		if info, err := os.Stat(matches[0]); err != nil || info.Size() == 0 {
+			t.Errorf("%s is empty", matches[0])
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Ladder is the set of quality levels a video is transcoded to
+type Ladder struct {
+	Levels []QualityLevel
+	// Analysis is the content analysis a per-title ladder is based on, nil for the standard ladder
+	Analysis *ContentAnalysis
+}
+
+// ContentAnalysis is the result of the probe encode a per-title ladder is based on
+type ContentAnalysis struct {
+	// ProbeLevel is the quality level the samples were encoded at
+	ProbeLevel QualityLevel
+	// ProbeCRF is the CRF of the probe encode
+	ProbeCRF int
+	// ProbeBitrate is the average bitrate in kbps of the probe encode
+	ProbeBitrate int
+	// Samples is the number of samples taken from the video
+	Samples int
+	// SampledDuration is the total length of the samples
+	SampledDuration time.Duration
+	// Complexity is the bitrate the content needs relative to the standard ladder, 1 for content of
+	// average complexity
+	Complexity float64
+	// Dropped are the quality levels left out because a higher one needs about the same bitrate
+	Dropped []string
+}
+
+const (
+	// analysisSamples is the number of samples of a video the probe encode covers
+	analysisSamples = 5
+	// analysisSampleLength is the length of each sample
+	analysisSampleLength = 4 * time.Second
+	// analysisPreset trades accuracy of the probe encode for speed
+	analysisPreset = "veryfast"
+	// analysisMaxShortSide is the size of the probe encode, the largest quality level up to it
+	// is used
+	analysisMaxShortSide = 720
+
+	// peakHeadroom is how far the maximum bitrate of a quality level is above the average bitrate
+	// the content needs
+	peakHeadroom = 1.5
+	// maxComplexity caps the bitrates of a per-title ladder relative to the standard ladder
+	maxComplexity = 1.5
+	// minLevelBitrate is the lowest bitrate in kbps of a quality level
+	minLevelBitrate = 200
+	// minBitrateStep is how many times the bitrate of the next lower quality level a quality level
+	// has to need, lower levels that are closer add nothing. The standard ladder steps by at least
+	// 1.75, so only levels held up by minLevelBitrate come that close.
+	minBitrateStep = 1.3
+)
+
+// PlanLadder returns the quality levels a video of the given size is transcoded to. With per-title
+// encoding, a probe encode of samples of the video measures the complexity of its content and the
+// bitrates of the standard ladder are scaled to it. The standard ladder is used if the duration is
+// unknown or the analysis fails.
+func (t *ffmpegGoImpl) PlanLadder(ctx context.Context, inputPath string, inputWidth, inputHeight int, duration time.Duration) (*Ladder, error) {
+	levels := getQualityLevels(inputWidth, inputHeight)
+	if !t.perTitle || duration <= 0 {
+		return &Ladder{Levels: levels}, nil
+	}
+
+	analysis, err := t.analyzeContent(ctx, inputPath, levels, duration)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Content analysis of %s failed, using the standard ladder: %v", inputPath, err)
+		return &Ladder{Levels: levels}, nil
+	}
+
+	levels, analysis.Dropped = perTitleLevels(levels, analysis.Complexity)
+	log.Printf("Content complexity of %s is %.2f (%d kbps at %dx%d), dropped quality levels: %v",
+		inputPath, analysis.Complexity, analysis.ProbeBitrate, analysis.ProbeLevel.Width, analysis.ProbeLevel.Height, analysis.Dropped)
+	return &Ladder{Levels: levels, Analysis: analysis}, nil
+}
+
+// analyzeContent encodes evenly spread samples of a video with a constant rate factor at one of
+// its quality levels. The bitrate the encoder needs for that quality tells how complex the content is.
+func (t *ffmpegGoImpl) analyzeContent(ctx context.Context, inputPath string, levels []QualityLevel, duration time.Duration) (*ContentAnalysis, error) {
+	probeLevel := levels[len(levels)-1]
+	for _, level := range levels {
+		if min(level.Width, level.Height) <= analysisMaxShortSide {
+			probeLevel = level
+			break
+		}
+	}
+
+	// Short videos are encoded as a whole
+	samples := analysisSamples
+	sampleLength := analysisSampleLength
+	if duration <= time.Duration(2*analysisSamples)*analysisSampleLength {
+		samples = 1
+		sampleLength = min(duration, time.Duration(analysisSamples)*analysisSampleLength)
+	}
+
+	analysis := &ContentAnalysis{
+		ProbeLevel: probeLevel,
+		ProbeCRF:   t.ffmpegCRF,
+		Samples:    samples,
+	}
+	var size int64
+	for i := range samples {
+		// Samples are centered in equal parts of the video
+		start := time.Duration(0)
+		if samples > 1 {
+			start = duration*time.Duration(2*i+1)/time.Duration(2*samples) - sampleLength/2
+		}
+
+		sampleSize, err := t.probeEncode(ctx, inputPath, probeLevel, start, sampleLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode sample at %s: %w", start, err)
+		}
+		size += sampleSize
+		analysis.SampledDuration += sampleLength
+	}
+
+	analysis.ProbeBitrate = int(float64(size*8) / analysis.SampledDuration.Seconds() / 1000)
+	analysis.Complexity = math.Round(float64(analysis.ProbeBitrate)*peakHeadroom/float64(probeLevel.Bitrate)*100) / 100
+	return analysis, nil
+}
+
+// probeEncode encodes a sample of a video at a quality level and returns the size of the encoded
+// video in bytes. Nothing is written to disk.
+func (t *ffmpegGoImpl) probeEncode(ctx context.Context, inputPath string, level QualityLevel, start, length time.Duration) (int64, error) {
+	cmd := exec.CommandContext(ctx, t.ffmpegPath,
+		"-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+		"-t", strconv.FormatFloat(length.Seconds(), 'f', 3, 64),
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("scale=%d:%d,setsar=1", level.Width, level.Height),
+		"-c:v", "libx264",
+		"-preset", analysisPreset,
+		"-crf", strconv.Itoa(t.ffmpegCRF),
+		"-threads", strconv.Itoa(t.ffmpegThreads),
+		"-an",
+		"-f", "matroska",
+		"pipe:1",
+	)
+	var output countingWriter
+	var stderr bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("%w\nOutput: %s", err, stderr.String())
+	}
+	if output.n == 0 {
+		return 0, fmt.Errorf("no video encoded")
+	}
+	return output.n, nil
+}
+
+// perTitleLevels scales the bitrates of the quality levels by the complexity of the content and
+// drops the levels that are too close in bitrate to the next higher one. The two highest levels
+// are always kept.
+//
+// Every level is scaled by the same factor, so the steps of the standard ladder stay as they are
+// and complex content only gets higher bitrates. Levels are dropped for simple content, whose lower
+// levels are raised to minLevelBitrate and would be encoded at about the bitrate of a higher one.
+func perTitleLevels(levels []QualityLevel, complexity float64) ([]QualityLevel, []string) {
+	scale := min(complexity, maxComplexity)
+
+	kept := make([]QualityLevel, 0, len(levels))
+	var dropped []string
+	for _, level := range levels {
+		level.Bitrate = max(minLevelBitrate, int(math.Round(float64(level.Bitrate)*scale)))
+
+		// A higher resolution at about the same bitrate looks at least as good
+		if len(kept) >= 2 && float64(kept[len(kept)-1].Bitrate) < float64(level.Bitrate)*minBitrateStep {
+			dropped = append(dropped, level.Name)
+			continue
+		}
+		kept = append(kept, level)
+	}
+	return kept, dropped
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,80 @@
+package transcoder
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestPerTitleLevels(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		complexity float64
+		// want holds name:bitrate of every kept level
+		want    []string
+		dropped []string
+	}{
+		{
+			name:  "average content",
+			width: 1920, height: 1080, complexity: 1,
+			want: []string{"1080p:5000", "720p:2800", "480p:1400", "360p:800", "240p:400"},
+		},
+		{
+			name:  "complex content",
+			width: 1920, height: 1080, complexity: 1.2,
+			want: []string{"1080p:6000", "720p:3360", "480p:1680", "360p:960", "240p:480"},
+		},
+		{
+			name:  "complexity above the cap",
+			width: 1920, height: 1080, complexity: 3,
+			want: []string{"1080p:7500", "720p:4200", "480p:2100", "360p:1200", "240p:600"},
+		},
+		{
+			name:  "simple content above the floor",
+			width: 1920, height: 1080, complexity: 0.5,
+			want: []string{"1080p:2500", "720p:1400", "480p:700", "360p:400", "240p:200"},
+		},
+		{
+			name:  "simple content drops the lowest level",
+			width: 1920, height: 1080, complexity: 0.3,
+			want:    []string{"1080p:1500", "720p:840", "480p:420", "360p:240"},
+			dropped: []string{"240p"},
+		},
+		{
+			name:  "very simple content drops the levels at the floor",
+			width: 1920, height: 1080, complexity: 0.1,
+			want:    []string{"1080p:500", "720p:280", "480p:200"},
+			dropped: []string{"360p", "240p"},
+		},
+		{
+			name:  "two highest levels are kept",
+			width: 1920, height: 1080, complexity: 0.02,
+			want:    []string{"1080p:200", "720p:200"},
+			dropped: []string{"480p", "360p", "240p"},
+		},
+		{
+			name:  "small input",
+			width: 640, height: 360, complexity: 0.1,
+			want: []string{"360p:200", "240p:200"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, dropped := perTitleLevels(getQualityLevels(tt.width, tt.height), tt.complexity)
+
+			got := make([]string, len(levels))
+			for i, level := range levels {
+				got[i] = fmt.Sprintf("%s:%d", level.Name, level.Bitrate)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("levels = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(dropped, tt.dropped) {
+				t.Errorf("dropped = %v, want %v", dropped, tt.dropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// loudnessTruePeak is the maximum true peak in dBTP of normalized audio
+	loudnessTruePeak = -1.5
+	// loudnessRange is the loudness range in LU of normalized audio. Audio with a wider range is
+	// compressed, loudnorm cannot normalize it linearly.
+	loudnessRange = 11.0
+)
+
+// Loudness is the EBU R128 loudness of the audio of a video, measured by the first pass of the
+// loudnorm filter. The second pass corrects the audio with it while transcoding.
+type Loudness struct {
+	// Integrated is the integrated loudness in LUFS
+	Integrated float64
+	// TruePeak is the maximum true peak in dBTP
+	TruePeak float64
+	// Range is the loudness range in LU
+	Range float64
+	// Threshold is the gating threshold in LUFS
+	Threshold float64
+	// Offset is the gain in LU loudnorm applies after its correction to hit the target
+	Offset float64
+	// Target is the integrated loudness in LUFS the audio is normalized to
+	Target float64
+}
+
+// loudnormStats is the JSON loudnorm logs at the end of a run with print_format=json
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// measureLoudness runs the first loudnorm pass over the primary audio track of a video. It returns
+// nil if the video has no audio or the audio is silent, there is nothing to normalize then.
+func measureLoudness(ctx context.Context, ffmpegPath string, threads int, inputPath string, target float64) (*Loudness, error) {
+	tracks, err := probeAudioTracks(ctx, inputPath)
+	if err != nil || len(tracks) == 0 {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-hide_banner",
+		"-i", inputPath,
+		"-map", "0:a:0",
+		"-af", loudnormFilter(target, nil)+":print_format=json",
+		"-threads", strconv.Itoa(threads),
+		"-f", "null",
+		"-",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+	return parseLoudnormStats(string(output), target)
+}
+
+// parseLoudnormStats reads the measurement loudnorm logs as its last JSON object. Values are
+// logged as strings, silent audio is measured as -inf.
+func parseLoudnormStats(output string, target float64) (*Loudness, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no loudnorm measurement in FFmpeg output")
+	}
+
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse loudnorm measurement: %w", err)
+	}
+
+	values := []string{stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset}
+	parsed := make([]float64, len(values))
+	for i, value := range values {
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid loudnorm value %q", value)
+		}
+		if math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, nil
+		}
+		parsed[i] = number
+	}
+
+	return &Loudness{
+		Integrated: parsed[0],
+		TruePeak:   parsed[1],
+		Range:      parsed[2],
+		Threshold:  parsed[3],
+		Offset:     parsed[4],
+		Target:     target,
+	}, nil
+}
+
+// loudnormFilter returns the loudnorm filter for a target loudness. Without a measurement it is
+// the first pass, with one it is the second pass, which corrects the audio linearly.
+func loudnormFilter(target float64, measured *Loudness) string {
+	filter := fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s", formatLU(target), formatLU(loudnessTruePeak), formatLU(loudnessRange))
+	if measured == nil {
+		return filter
+	}
+	return filter + fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=none",
+		formatLU(measured.Integrated), formatLU(measured.TruePeak), formatLU(measured.Range), formatLU(measured.Threshold), formatLU(measured.Offset))
+}
+
+// formatLU formats a loudness value for a filter option
+func formatLU(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,217 @@
+package transcoder
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	streamInfTag = "#EXT-X-STREAM-INF:"
+	mediaTag     = "#EXT-X-MEDIA:"
+)
+
+// playlistAttribute is an attribute of a playlist tag
+type playlistAttribute struct {
+	name   string
+	value  string
+	quoted bool
+}
+
+// parseAttributeList parses the attribute list of a playlist tag. Quotes are removed from values.
+func parseAttributeList(list string) []playlistAttribute {
+	var attributes []playlistAttribute
+	for list != "" {
+		name, rest, found := strings.Cut(list, "=")
+		if !found {
+			break
+		}
+
+		attribute := playlistAttribute{name: strings.TrimSpace(name)}
+		if strings.HasPrefix(rest, `"`) {
+			// Quoted values may contain commas
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			attribute.value = rest[1 : end+1]
+			attribute.quoted = true
+			rest = strings.TrimPrefix(rest[end+2:], ",")
+		} else {
+			attribute.value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attributes = append(attributes, attribute)
+		list = rest
+	}
+	return attributes
+}
+
+// playlistAttributes returns the attributes of a playlist tag by name
+func playlistAttributes(list string) map[string]string {
+	attributes := make(map[string]string)
+	for _, attribute := range parseAttributeList(list) {
+		attributes[attribute.name] = attribute.value
+	}
+	return attributes
+}
+
+// formatAttributeList formats the attribute list of a playlist tag
+func formatAttributeList(attributes []playlistAttribute) string {
+	formatted := make([]string, len(attributes))
+	for i, attribute := range attributes {
+		value := attribute.value
+		if attribute.quoted {
+			value = `"` + value + `"`
+		}
+		formatted[i] = attribute.name + "=" + value
+	}
+	return strings.Join(formatted, ",")
+}
+
+// setVariantAttributes sets the CODECS and RESOLUTION attributes of every variant in a master
+// playlist, replacing the values FFmpeg wrote
+func setVariantAttributes(masterPath string, variants []variant, audio bool) error {
+	content, err := os.ReadFile(masterPath)
+	if err != nil {
+		return err
+	}
+
+	byURI := make(map[string]variant, len(variants))
+	for _, v := range variants {
+		byURI[v.name+"/playlist.m3u8"] = v
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], streamInfTag) {
+			continue
+		}
+		// The URI of the variant follows its attributes
+		v, ok := byURI[strings.TrimSpace(lines[i+1])]
+		if !ok {
+			continue
+		}
+
+		attributes := parseAttributeList(strings.TrimPrefix(lines[i], streamInfTag))
+		attributes = setAttribute(attributes, playlistAttribute{name: "RESOLUTION", value: fmt.Sprintf("%dx%d", v.quality.Width, v.quality.Height)})
+		attributes = setAttribute(attributes, playlistAttribute{name: "CODECS", value: v.codecs(audio), quoted: true})
+		lines[i] = streamInfTag + formatAttributeList(attributes)
+	}
+
+	return os.WriteFile(masterPath, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// setAudioAttributes sets the NAME, LANGUAGE, DEFAULT and AUTOSELECT attributes of every audio
+// rendition in a master playlist. FFmpeg names audio renditions by stream index. The primary track
+// is the default of its group.
+func setAudioAttributes(masterPath string, renditions []audioRendition) error {
+	if len(renditions) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(masterPath)
+	if err != nil {
+		return err
+	}
+
+	byURI := make(map[string]audioRendition, len(renditions))
+	for _, a := range renditions {
+		byURI[a.name+"/playlist.m3u8"] = a
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, mediaTag) {
+			continue
+		}
+		a, ok := byURI[playlistAttributes(strings.TrimPrefix(line, mediaTag))["URI"]]
+		if !ok {
+			continue
+		}
+
+		attributes := parseAttributeList(strings.TrimPrefix(line, mediaTag))
+		defaultValue := "NO"
+		if a.primary() {
+			defaultValue = "YES"
+		}
+		attributes = setAttribute(attributes, playlistAttribute{name: "NAME", value: a.track.label, quoted: true})
+		attributes = setAttribute(attributes, playlistAttribute{name: "DEFAULT", value: defaultValue})
+		attributes = setAttribute(attributes, playlistAttribute{name: "AUTOSELECT", value: "YES"})
+		if a.track.language != "" {
+			attributes = setAttribute(attributes, playlistAttribute{name: "LANGUAGE", value: a.track.language, quoted: true})
+		} else {
+			attributes = slices.DeleteFunc(attributes, func(attribute playlistAttribute) bool { return attribute.name == "LANGUAGE" })
+		}
+		lines[i] = mediaTag + formatAttributeList(attributes)
+	}
+
+	return os.WriteFile(masterPath, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// addAudioOnlyVariants adds a variant without video for every audio group to a master playlist, so
+// that players can keep playing the audio in the background or on connections too slow for video.
+// FFmpeg only lists audio renditions as EXT-X-MEDIA. The variants point to the rendition of the
+// primary track and reference its group, players switch tracks within the group.
+func addAudioOnlyVariants(masterPath string, renditions []audioRendition) error {
+	if len(renditions) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(masterPath)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	groups := make(map[string]string)
+	variantURIs := make(map[string]bool)
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, mediaTag):
+			attributes := playlistAttributes(strings.TrimPrefix(line, mediaTag))
+			if attributes["TYPE"] == "AUDIO" {
+				groups[attributes["URI"]] = attributes["GROUP-ID"]
+			}
+		case strings.HasPrefix(line, streamInfTag) && i+1 < len(lines):
+			variantURIs[strings.TrimSpace(lines[i+1])] = true
+		}
+	}
+
+	for _, a := range renditions {
+		if !a.primary() {
+			continue
+		}
+		uri := a.name + "/playlist.m3u8"
+		group, ok := groups[uri]
+		if !ok {
+			return fmt.Errorf("no audio group for rendition %s", a.name)
+		}
+		if variantURIs[uri] {
+			continue
+		}
+
+		// Like FFmpeg, 10% are added to the bitrate for the container
+		attributes := []playlistAttribute{
+			{name: "BANDWIDTH", value: strconv.Itoa(a.bitrate * 1100)},
+			{name: "CODECS", value: audioCodecs, quoted: true},
+			{name: "AUDIO", value: group, quoted: true},
+		}
+		lines = append(lines, streamInfTag+formatAttributeList(attributes), uri)
+	}
+
+	return os.WriteFile(masterPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// setAttribute replaces the attribute with the same name or appends it
+func setAttribute(attributes []playlistAttribute, attribute playlistAttribute) []playlistAttribute {
+	for i := range attributes {
+		if attributes[i].name == attribute.name {
+			attributes[i] = attribute
+			return attributes
+		}
+	}
+	return append(attributes, attribute)
+}
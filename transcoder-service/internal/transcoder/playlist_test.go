@@ -0,0 +1,110 @@
+package transcoder
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// assertGolden compares got with the golden file at path, or writes it with -update
+func assertGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run the test with -update to write it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// TestMasterPlaylist rewrites master playlists written by FFmpeg in testdata/playlist like a
+// transcoding run does and compares them with the golden files
+func TestMasterPlaylist(t *testing.T) {
+	twoTracks := []audioTrack{{index: 0, language: "eng", label: "eng"}, {index: 1, language: "fra", label: "fra"}}
+
+	tests := []struct {
+		name   string
+		codecs []string
+		tracks []audioTrack
+	}{
+		// FFmpeg writes no codec string for HEVC
+		{name: "cmaf_two_tracks", codecs: []string{CodecH264, CodecHEVC}, tracks: twoTracks},
+		// Untagged streams are written as und
+		{name: "ts_one_track", codecs: []string{CodecH264}, tracks: []audioTrack{{index: 0, label: "Audio 1"}}},
+		{name: "no_audio", codecs: []string{CodecH264}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impl := &ffmpegGoImpl{}
+			for _, name := range tt.codecs {
+				impl.codecs = append(impl.codecs, videoCodec{codec: codecs[name]})
+			}
+			levels := getQualityLevels(640, 360)
+			variants := impl.variants(levels)
+			renditions := newAudioRenditions(levels, tt.tracks)
+
+			input, err := os.ReadFile(filepath.Join("testdata", "playlist", tt.name, "master.m3u8"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			masterPath := filepath.Join(t.TempDir(), "master.m3u8")
+			if err := os.WriteFile(masterPath, input, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Rewriting is repeated when a failed upload of the renditions is retried
+			var first []byte
+			for run := 0; run < 2; run++ {
+				if err := setVariantAttributes(masterPath, variants, len(tt.tracks) > 0); err != nil {
+					t.Fatalf("setVariantAttributes: %v", err)
+				}
+				if err := setAudioAttributes(masterPath, renditions); err != nil {
+					t.Fatalf("setAudioAttributes: %v", err)
+				}
+				if err := addAudioOnlyVariants(masterPath, renditions); err != nil {
+					t.Fatalf("addAudioOnlyVariants: %v", err)
+				}
+
+				got, err := os.ReadFile(masterPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if run == 0 {
+					first = got
+					assertGolden(t, filepath.Join("testdata", "playlist", tt.name, "master.m3u8.golden"), got)
+				} else if !bytes.Equal(got, first) {
+					t.Errorf("rewriting again changed the master playlist:\n%s", got)
+				}
+			}
+		})
+	}
+}
+
+func TestAddAudioOnlyVariantsWithoutGroup(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "playlist", "no_audio", "master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterPath := filepath.Join(t.TempDir(), "master.m3u8")
+	if err := os.WriteFile(masterPath, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions := newAudioRenditions(getQualityLevels(640, 360), []audioTrack{{index: 0, label: "Audio 1"}})
+	if err := addAudioOnlyVariants(masterPath, renditions); err == nil {
+		t.Error("addAudioOnlyVariants succeeded for renditions missing from the master playlist")
+	}
+}
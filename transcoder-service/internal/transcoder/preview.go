@@ -0,0 +1,127 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the hover preview clips
+const (
+	PreviewWebPName = "preview.webp"
+	PreviewMP4Name  = "preview.mp4"
+)
+
+// DefaultPreviewLength is the length of the hover preview clips
+const DefaultPreviewLength = 4 * time.Second
+
+const (
+	// previewSegments is the number of short segments of a video a preview is stitched from
+	previewSegments = 4
+	// previewSize is the long side of a preview, the short side keeps the aspect ratio of the video
+	previewSize = 320
+	// previewFrameRate keeps the animated WebP small
+	previewFrameRate = 15
+	// previewMargin is the part of a video at its start and at its end no segment is taken from.
+	// Intros and credits rarely show what a video is about.
+	previewMargin = 0.05
+	// previewCRF is the CRF of the MP4 preview, previews are small enough to hide artifacts
+	previewCRF = 28
+)
+
+// Preview is a short silent clip that loops while a video is hovered on browse pages
+type Preview struct {
+	// WebPPath is the animated WebP, it loops forever
+	WebPPath string
+	// MP4Path is the muted MP4, players loop it
+	MP4Path string
+}
+
+// previewSegmentStarts returns the start of every segment of a preview with the length of the
+// segments. Segments are centered in equal parts of a video without its margins, videos that are
+// not much longer than the preview are taken from the start in one segment.
+func previewSegmentStarts(duration, length time.Duration) ([]time.Duration, time.Duration) {
+	if duration <= 2*length {
+		return []time.Duration{0}, min(duration, length)
+	}
+
+	segmentLength := length / previewSegments
+	margin := time.Duration(float64(duration) * previewMargin)
+	span := duration - 2*margin
+	starts := make([]time.Duration, 0, previewSegments)
+	for i := range previewSegments {
+		starts = append(starts, margin+span*time.Duration(2*i+1)/(2*previewSegments)-segmentLength/2)
+	}
+	return starts, segmentLength
+}
+
+// previewArgs builds the FFmpeg arguments that stitch the segments of a video into the WebP and
+// MP4 previews in outputDir. Every segment is a separate input, so FFmpeg only decodes the segments.
+func previewArgs(inputPath, outputDir string, starts []time.Duration, segmentLength time.Duration, width, height int, preset string, threads int) []string {
+	args := []string{"-y"}
+	for _, start := range starts {
+		args = append(args,
+			"-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+			"-t", strconv.FormatFloat(segmentLength.Seconds(), 'f', 3, 64),
+			"-i", inputPath,
+		)
+	}
+
+	var filter strings.Builder
+	for i := range starts {
+		fmt.Fprintf(&filter, "[%d:v:0]fps=%d,scale=%d:%d,setsar=1,format=yuv420p[s%d];", i, previewFrameRate, width, height, i)
+	}
+	for i := range starts {
+		fmt.Fprintf(&filter, "[s%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=1:a=0,split=2[webp][mp4]", len(starts))
+
+	return append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[webp]",
+		"-c:v", "libwebp",
+		"-threads", strconv.Itoa(threads),
+		"-quality", "60",
+		"-compression_level", "4",
+		"-loop", "0",
+		"-an",
+		filepath.Join(outputDir, PreviewWebPName),
+		"-map", "[mp4]",
+		"-c:v", "libx264",
+		"-preset", preset,
+		"-crf", strconv.Itoa(previewCRF),
+		"-profile:v", "main",
+		"-threads", strconv.Itoa(threads),
+		"-movflags", "+faststart",
+		"-an",
+		filepath.Join(outputDir, PreviewMP4Name),
+	)
+}
+
+// generatePreview stitches short segments sampled across a video into a preview of the given
+// length and writes it to outputDir as an animated WebP and a muted MP4
+func generatePreview(ctx context.Context, ffmpegPath string, threads int, preset string, inputPath, outputDir string, inputWidth, inputHeight int, duration, length time.Duration) (*Preview, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("the duration of the video is unknown")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create preview directory: %w", err)
+	}
+
+	starts, segmentLength := previewSegmentStarts(duration, length)
+	width, height := fitLongSide(inputWidth, inputHeight, previewSize)
+	cmd := exec.CommandContext(ctx, ffmpegPath, previewArgs(inputPath, outputDir, starts, segmentLength, width, height, preset, threads)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return &Preview{
+		WebPPath: filepath.Join(outputDir, PreviewWebPName),
+		MP4Path:  filepath.Join(outputDir, PreviewMP4Name),
+	}, nil
+}
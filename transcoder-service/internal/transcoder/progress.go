@@ -0,0 +1,94 @@
+package transcoder
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is how far a transcoding run over several quality levels got. Quality levels are
+// weighted by their pixel count so that larger renditions count for more of the run.
+type Progress struct {
+	// Rendition is the name of the quality level being transcoded, or the comma separated names of
+	// all of them when they are transcoded together
+	Rendition string
+	// Done is the weight of the quality levels that are finished
+	Done float64
+	// Weight is the weight of the current quality level
+	Weight float64
+	// OutTime is the position FFmpeg reached in the current quality level
+	OutTime time.Duration
+}
+
+// ProgressFunc receives the progress of a transcoding run
+type ProgressFunc func(progress Progress)
+
+// Fraction returns the share of the run that is finished, between 0 and 1, for an input of the
+// given duration. Without a duration only finished quality levels are counted.
+func (p Progress) Fraction(duration time.Duration) float64 {
+	fraction := p.Done
+	if duration > 0 && p.OutTime > 0 {
+		current := float64(p.OutTime) / float64(duration)
+		if current > 1 {
+			current = 1
+		}
+		fraction += p.Weight * current
+	}
+	if fraction > 1 {
+		return 1
+	}
+	return fraction
+}
+
+// part returns the progress callback of the run-th of runs consecutive runs
+func (f ProgressFunc) part(run, runs int) ProgressFunc {
+	if f == nil {
+		return nil
+	}
+	return func(progress Progress) {
+		progress.Done = (float64(run) + progress.Done) / float64(runs)
+		progress.Weight /= float64(runs)
+		f(progress)
+	}
+}
+
+// qualityWeights returns the share of the work of each quality level
+func qualityWeights(levels []QualityLevel) []float64 {
+	var total float64
+	for _, level := range levels {
+		total += float64(level.Width * level.Height)
+	}
+
+	weights := make([]float64, len(levels))
+	for i, level := range levels {
+		if total > 0 {
+			weights[i] = float64(level.Width*level.Height) / total
+		}
+	}
+	return weights
+}
+
+// report calls onProgress if it is set
+func report(onProgress ProgressFunc, progress Progress) {
+	if onProgress != nil {
+		onProgress(progress)
+	}
+}
+
+// readProgress reads the key=value lines FFmpeg writes with -progress and calls onOutTime with
+// every output position. It returns when r is closed.
+func readProgress(r io.Reader, onOutTime func(outTime time.Duration)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Despite its name out_time_ms is in microseconds
+		if strings.HasPrefix(line, "out_time_ms=") {
+			timeUs := strings.TrimPrefix(line, "out_time_ms=")
+			if us, err := strconv.ParseInt(timeUs, 10, 64); err == nil && us >= 0 {
+				onOutTime(time.Duration(us) * time.Microsecond)
+			}
+		}
+	}
+}
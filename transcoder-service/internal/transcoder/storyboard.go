@@ -0,0 +1,114 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StoryboardName is the name of the WebVTT file that maps time ranges to the storyboard tiles
+const StoryboardName = "storyboard.vtt"
+
+// DefaultStoryboardInterval is the time between two storyboard tiles
+const DefaultStoryboardInterval = 5 * time.Second
+
+const (
+	// storyboardTileSize is the long side of a storyboard tile, the short side keeps the aspect
+	// ratio of the video
+	storyboardTileSize = 160
+	// storyboardColumns and storyboardRows are the number of tiles on a sprite sheet
+	storyboardColumns = 10
+	storyboardRows    = 10
+)
+
+// storyboardTile returns the size of the storyboard tiles of a video
+func storyboardTile(inputWidth, inputHeight int) (int, int) {
+	return fitLongSide(inputWidth, inputHeight, storyboardTileSize)
+}
+
+// fitLongSide scales a video of unknown or any aspect ratio to longSide pixels on its long side.
+// Sizes are even like the quality levels, videos of unknown size are taken to be 16:9.
+func fitLongSide(inputWidth, inputHeight, longSide int) (int, int) {
+	if inputWidth <= 0 || inputHeight <= 0 {
+		inputWidth, inputHeight = 16, 9
+	}
+	if inputWidth >= inputHeight {
+		return longSide, evenDimension(float64(longSide*inputHeight) / float64(inputWidth))
+	}
+	return evenDimension(float64(longSide*inputWidth) / float64(inputHeight)), longSide
+}
+
+// spriteName returns the name of a sprite sheet
+func spriteName(sheet int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", sheet)
+}
+
+// storyboardArgs builds the FFmpeg arguments that write a frame every interval as tiles of
+// sprite sheets named like spriteName to outputDir
+func storyboardArgs(inputPath, outputDir string, tileWidth, tileHeight int, interval time.Duration, threads int) []string {
+	return []string{
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("fps=1/%s,scale=%d:%d,setsar=1,tile=%dx%d",
+			strconv.FormatFloat(interval.Seconds(), 'f', -1, 64), tileWidth, tileHeight, storyboardColumns, storyboardRows),
+		"-q:v", "5",
+		"-threads", strconv.Itoa(threads),
+		"-start_number", "0",
+		"-y",
+		filepath.Join(outputDir, "sprite_%03d.jpg"),
+	}
+}
+
+// storyboardVTT returns the WebVTT file of a storyboard. Every cue covers an interval of the video
+// and points to its tile with a media fragment like sprite_000.jpg#xywh=160,0,160,90.
+func storyboardVTT(duration time.Duration, interval time.Duration, tileWidth, tileHeight int) string {
+	tiles := int(math.Ceil(float64(duration) / float64(interval)))
+	perSheet := storyboardColumns * storyboardRows
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i := range tiles {
+		start := time.Duration(i) * interval
+		end := min(start+interval, duration)
+		position := i % perSheet
+		fmt.Fprintf(&vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), spriteName(i/perSheet),
+			position%storyboardColumns*tileWidth, position/storyboardColumns*tileHeight, tileWidth, tileHeight)
+	}
+	return vtt.String()
+}
+
+// vttTimestamp formats a position as a WebVTT timestamp
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// generateStoryboard writes the sprite sheets of a video and the WebVTT file that maps its time
+// ranges to their tiles to outputDir and returns the path of the WebVTT file
+func generateStoryboard(ctx context.Context, ffmpegPath string, threads int, inputPath, outputDir string, inputWidth, inputHeight int, duration, interval time.Duration) (string, error) {
+	if duration <= 0 {
+		return "", fmt.Errorf("the duration of the video is unknown")
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create storyboard directory: %w", err)
+	}
+
+	tileWidth, tileHeight := storyboardTile(inputWidth, inputHeight)
+	cmd := exec.CommandContext(ctx, ffmpegPath, storyboardArgs(inputPath, outputDir, tileWidth, tileHeight, interval, threads)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
+	}
+
+	vttPath := filepath.Join(outputDir, StoryboardName)
+	if err := os.WriteFile(vttPath, []byte(storyboardVTT(duration, interval, tileWidth, tileHeight)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write storyboard: %w", err)
+	}
+	return vttPath, nil
+}
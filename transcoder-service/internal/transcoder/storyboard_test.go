@@ -0,0 +1,95 @@
+package transcoder
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoryboardVTT(t *testing.T) {
+	tests := []struct {
+		name                  string
+		duration              time.Duration
+		interval              time.Duration
+		tileWidth, tileHeight int
+		cues                  int
+		// want maps the index of a cue to its timing and tile
+		want map[int]string
+	}{
+		{
+			name:     "partial final interval",
+			duration: 12 * time.Second, interval: 5 * time.Second, tileWidth: 160, tileHeight: 90,
+			cues: 3,
+			want: map[int]string{
+				0: "00:00:00.000 --> 00:00:05.000\nsprite_000.jpg#xywh=0,0,160,90",
+				1: "00:00:05.000 --> 00:00:10.000\nsprite_000.jpg#xywh=160,0,160,90",
+				2: "00:00:10.000 --> 00:00:12.000\nsprite_000.jpg#xywh=320,0,160,90",
+			},
+		},
+		{
+			name:     "whole final interval",
+			duration: 10 * time.Second, interval: 5 * time.Second, tileWidth: 160, tileHeight: 90,
+			cues: 2,
+			want: map[int]string{
+				1: "00:00:05.000 --> 00:00:10.000\nsprite_000.jpg#xywh=160,0,160,90",
+			},
+		},
+		{
+			name:     "sheet boundaries",
+			duration: 1000 * time.Second, interval: 5 * time.Second, tileWidth: 160, tileHeight: 90,
+			cues: 200,
+			want: map[int]string{
+				9:   "00:00:45.000 --> 00:00:50.000\nsprite_000.jpg#xywh=1440,0,160,90",
+				10:  "00:00:50.000 --> 00:00:55.000\nsprite_000.jpg#xywh=0,90,160,90",
+				99:  "00:08:15.000 --> 00:08:20.000\nsprite_000.jpg#xywh=1440,810,160,90",
+				100: "00:08:20.000 --> 00:08:25.000\nsprite_001.jpg#xywh=0,0,160,90",
+				101: "00:08:25.000 --> 00:08:30.000\nsprite_001.jpg#xywh=160,0,160,90",
+				199: "00:16:35.000 --> 00:16:40.000\nsprite_001.jpg#xywh=1440,810,160,90",
+			},
+		},
+		{
+			name:     "partial final interval on a new sheet",
+			duration: 502500 * time.Millisecond, interval: 5 * time.Second, tileWidth: 160, tileHeight: 90,
+			cues: 101,
+			want: map[int]string{
+				100: "00:08:20.000 --> 00:08:22.500\nsprite_001.jpg#xywh=0,0,160,90",
+			},
+		},
+		{
+			name:     "portrait tiles",
+			duration: 60 * time.Second, interval: 2 * time.Second, tileWidth: 90, tileHeight: 160,
+			cues: 30,
+			want: map[int]string{
+				11: "00:00:22.000 --> 00:00:24.000\nsprite_000.jpg#xywh=90,160,90,160",
+			},
+		},
+		{
+			name:     "over an hour",
+			duration: 3601 * time.Second, interval: 10 * time.Second, tileWidth: 160, tileHeight: 90,
+			cues: 361,
+			want: map[int]string{
+				360: "01:00:00.000 --> 01:00:01.000\nsprite_003.jpg#xywh=0,540,160,90",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vtt := storyboardVTT(tt.duration, tt.interval, tt.tileWidth, tt.tileHeight)
+
+			header, body, _ := strings.Cut(vtt, "\n\n")
+			if header != "WEBVTT" {
+				t.Fatalf("storyboard starts with %q, want WEBVTT", header)
+			}
+			cues := strings.Split(strings.TrimSuffix(body, "\n"), "\n\n")
+			if len(cues) != tt.cues {
+				t.Fatalf("storyboard has %d cues, want %d", len(cues), tt.cues)
+			}
+			for i, want := range tt.want {
+				if cues[i] != want {
+					t.Errorf("cue %d = %q, want %q", i, cues[i], want)
+				}
+			}
+		})
+	}
+}
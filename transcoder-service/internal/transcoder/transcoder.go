@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // QualityLevel represents a video quality level
@@ -24,14 +25,84 @@ type OutputFormat struct {
 	Quality QualityLevel
 }
 
+// ThumbnailSize is one of the standard 16:9 thumbnail sizes
+type ThumbnailSize struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// ThumbnailSizes are the sizes of a thumbnail set, stored as <name>.jpg
+var ThumbnailSizes = []ThumbnailSize{
+	{Name: "small", Width: 320, Height: 180},
+	{Name: "medium", Width: 640, Height: 360},
+	{Name: "large", Width: 1280, Height: 720},
+}
+
+// DefaultThumbnailSize is the size thumbnail paths point to
+const DefaultThumbnailSize = "medium"
+
+// Packaging modes of the HLS output
+const (
+	// PackagingTS writes MPEG-TS segments, every variant carries its own audio
+	PackagingTS = "ts"
+	// PackagingCMAF writes fragmented MP4 segments with a separate audio rendition. The segments
+	// are shared by the HLS master playlist and a DASH manifest.
+	PackagingCMAF = "cmaf"
+)
+
+// DASHManifestName is the name of the DASH manifest written next to the HLS master playlist
+const DASHManifestName = "manifest.mpd"
+
+// thumbnailArgs builds the FFmpeg arguments that write the frame at timestamp in every thumbnail
+// size. Frames with another aspect ratio are letterboxed.
+func thumbnailArgs(inputPath, outputDir string, timestamp float64) []string {
+	args := []string{
+		"-ss", strconv.FormatFloat(timestamp, 'f', 3, 64),
+		"-i", inputPath,
+		"-y",
+	}
+	for _, size := range ThumbnailSizes {
+		args = append(args,
+			"-map", "0:v:0",
+			"-frames:v", "1",
+			"-q:v", "2",
+			"-vf", fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2,format=yuvj420p", size.Width, size.Height),
+			filepath.Join(outputDir, size.Name+".jpg"),
+		)
+	}
+	return args
+}
+
 // Transcoder handles video transcoding operations
 type Transcoder interface {
-	// TranscodeToHLS transcodes a video to HLS format with multiple quality levels
-	TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error
-	// TranscodeToMP4 transcodes a video to MP4 format with multiple quality levels
-	TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error
-	// GenerateThumbnail generates a thumbnail from a video
-	GenerateThumbnail(ctx context.Context, inputPath, outputPath string) error
+	// TranscodeToHLS transcodes a video to HLS format with multiple quality levels. onProgress may be nil.
+	TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error
+	// TranscodeToMP4 transcodes a video to MP4 format with multiple quality levels. onProgress may be nil.
+	TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error
+	// PlanLadder returns the quality levels a video of the given size and duration is transcoded to
+	PlanLadder(ctx context.Context, inputPath string, inputWidth, inputHeight int, duration time.Duration) (*Ladder, error)
+	// MeasureLoudness measures the loudness of the audio of a video. It returns nil if loudness
+	// normalization is disabled or the video has no audio to normalize.
+	MeasureLoudness(ctx context.Context, inputPath string) (*Loudness, error)
+	// TranscodeRenditions transcodes a video to HLS in hlsDir and, unless mp4OutputDir is empty, to MP4
+	// in mp4OutputDir like TranscodeToMP4, in the given quality levels. The input is only decoded once.
+	// The audio is normalized with loudness unless it is nil. onProgress may be nil.
+	TranscodeRenditions(ctx context.Context, inputPath, hlsDir, mp4OutputDir string, qualityLevels []QualityLevel, loudness *Loudness, onProgress ProgressFunc) error
+	// GenerateThumbnail writes the best frame of a video to outputPath. Frames are sampled at scene
+	// changes and scored by brightness, contrast and sharpness, the best ones are kept in candidateDir
+	// and returned, best first. duration may be 0 if it is unknown.
+	GenerateThumbnail(ctx context.Context, inputPath, outputPath, candidateDir string, duration time.Duration) ([]ThumbnailCandidate, error)
+	// GenerateThumbnailSet writes the frame at timestamp seconds to outputDir in every thumbnail size
+	GenerateThumbnailSet(ctx context.Context, inputPath, outputDir string, timestamp float64) error
+	// GenerateStoryboard writes sprite sheets of frames of a video and a WebVTT file that maps time
+	// ranges to their tiles to outputDir. It returns the path of the WebVTT file, or an empty path if
+	// storyboards are disabled.
+	GenerateStoryboard(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (string, error)
+	// GeneratePreview stitches short segments sampled across a video into a silent looping preview
+	// and writes it to outputDir as an animated WebP and a muted MP4. It returns nil if previews are
+	// disabled.
+	GeneratePreview(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (*Preview, error)
 	// ExtractMetadata extracts metadata from a video file
 	ExtractMetadata(ctx context.Context, inputPath string) (map[string]string, error)
 }
@@ -47,13 +118,23 @@ type FFmpegTranscoder struct {
 	outputQualities []string
 }
 
-// NewTranscoder creates a new FFmpegTranscoder instance
+// NewTranscoder creates a new transcoder. packaging is PackagingTS or PackagingCMAF. perTitle
+// enables the content analysis of PlanLadder. Storyboards get a tile every storyboardInterval, 0
+// disables them. thumbnailCandidates frames are kept for creators to pick a thumbnail from. Hover
+// previews are previewLength long, 0 disables them. Audio is normalized to loudnessTarget LUFS, 0
+// disables normalization.
 func NewTranscoder(
 	ffmpegPath string,
 	ffmpegThreads int,
 	ffmpegPreset string,
 	ffmpegCRF int,
 	segmentLength int,
+	storyboardInterval time.Duration,
+	thumbnailCandidates int,
+	previewLength time.Duration,
+	loudnessTarget float64,
+	packaging string,
+	perTitle bool,
 	outputFormats []string,
 	outputQualities []string,
 	tempDir string,
@@ -64,6 +145,12 @@ func NewTranscoder(
 		ffmpegPreset,
 		ffmpegCRF,
 		segmentLength,
+		storyboardInterval,
+		thumbnailCandidates,
+		previewLength,
+		loudnessTarget,
+		packaging,
+		perTitle,
 		outputFormats,
 		outputQualities,
 		tempDir,
@@ -106,8 +193,10 @@ func (t *FFmpegTranscoder) getQualityLevels(inputWidth, inputHeight int) []Quali
 }
 
 // TranscodeToHLS transcodes a video to HLS format with multiple quality levels
-func (t *FFmpegTranscoder) TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error {
+func (t *FFmpegTranscoder) TranscodeToHLS(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error {
 	qualityLevels := t.getQualityLevels(inputWidth, inputHeight)
+	weights := qualityWeights(qualityLevels)
+	var done float64
 
 	// Create master playlist
 	masterPlaylist := "#EXTM3U\n#EXT-X-VERSION:3\n"
@@ -121,7 +210,7 @@ func (t *FFmpegTranscoder) TranscodeToHLS(ctx context.Context, inputPath, output
 	}
 
 	// Transcode each quality level
-	for _, level := range qualityLevels {
+	for i, level := range qualityLevels {
 		qualityDir := filepath.Join(outputDir, level.Name)
 		if err := os.MkdirAll(qualityDir, 0755); err != nil {
 			return fmt.Errorf("failed to create quality directory: %w", err)
@@ -158,14 +247,20 @@ func (t *FFmpegTranscoder) TranscodeToHLS(ctx context.Context, inputPath, output
 		if output, err := cmd.CombinedOutput(); err != nil {
 			return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
 		}
+
+		// Progress is only reported per quality level
+		done += weights[i]
+		report(onProgress, Progress{Rendition: level.Name, Done: done})
 	}
 
 	return nil
 }
 
 // TranscodeToMP4 transcodes a video to MP4 format with multiple quality levels
-func (t *FFmpegTranscoder) TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int) error {
+func (t *FFmpegTranscoder) TranscodeToMP4(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, onProgress ProgressFunc) error {
 	qualityLevels := t.getQualityLevels(inputWidth, inputHeight)
+	weights := qualityWeights(qualityLevels)
+	var done float64
 
 	// Create MP4 directory
 	mp4Dir := filepath.Join(outputDir, "mp4")
@@ -174,7 +269,7 @@ func (t *FFmpegTranscoder) TranscodeToMP4(ctx context.Context, inputPath, output
 	}
 
 	// Transcode each quality level
-	for _, level := range qualityLevels {
+	for i, level := range qualityLevels {
 		outputPath := filepath.Join(mp4Dir, fmt.Sprintf("%s.mp4", level.Name))
 
 		// Build FFmpeg command for MP4
@@ -199,23 +294,53 @@ func (t *FFmpegTranscoder) TranscodeToMP4(ctx context.Context, inputPath, output
 		if output, err := cmd.CombinedOutput(); err != nil {
 			return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
 		}
+
+		// Progress is only reported per quality level
+		done += weights[i]
+		report(onProgress, Progress{Rendition: level.Name, Done: done})
 	}
 
 	return nil
 }
 
-// GenerateThumbnail generates a thumbnail from a video
-func (t *FFmpegTranscoder) GenerateThumbnail(ctx context.Context, inputPath, outputPath string) error {
-	args := []string{
-		"-i", inputPath,
-		"-ss", "00:00:05",
-		"-vframes", "1",
-		"-q:v", "2",
-		"-y",
-		outputPath,
+// PlanLadder returns the standard quality levels for the size of a video
+func (t *FFmpegTranscoder) PlanLadder(ctx context.Context, inputPath string, inputWidth, inputHeight int, duration time.Duration) (*Ladder, error) {
+	return &Ladder{Levels: t.getQualityLevels(inputWidth, inputHeight)}, nil
+}
+
+// MeasureLoudness returns nil, the audio is not normalized
+func (t *FFmpegTranscoder) MeasureLoudness(ctx context.Context, inputPath string) (*Loudness, error) {
+	return nil, nil
+}
+
+// TranscodeRenditions transcodes a video to HLS and MP4, one quality level after another. The
+// standard quality levels up to the size of the highest given level are used, the audio is not
+// normalized.
+func (t *FFmpegTranscoder) TranscodeRenditions(ctx context.Context, inputPath, hlsDir, mp4OutputDir string, qualityLevels []QualityLevel, loudness *Loudness, onProgress ProgressFunc) error {
+	if len(qualityLevels) == 0 {
+		return fmt.Errorf("no quality levels")
+	}
+	inputWidth, inputHeight := qualityLevels[0].Width, qualityLevels[0].Height
+
+	if mp4OutputDir == "" {
+		return t.TranscodeToHLS(ctx, inputPath, hlsDir, inputWidth, inputHeight, onProgress)
 	}
 
-	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
+	if err := t.TranscodeToHLS(ctx, inputPath, hlsDir, inputWidth, inputHeight, onProgress.part(0, 2)); err != nil {
+		return err
+	}
+	return t.TranscodeToMP4(ctx, inputPath, mp4OutputDir, inputWidth, inputHeight, onProgress.part(1, 2))
+}
+
+// GenerateThumbnail picks the best of the frames at scene changes of a video as its thumbnail and
+// keeps DefaultThumbnailCandidates candidates
+func (t *FFmpegTranscoder) GenerateThumbnail(ctx context.Context, inputPath, outputPath, candidateDir string, duration time.Duration) ([]ThumbnailCandidate, error) {
+	return generateThumbnailCandidates(ctx, t.ffmpegPath, inputPath, outputPath, candidateDir, duration, DefaultThumbnailCandidates)
+}
+
+// GenerateThumbnailSet writes the frame at timestamp seconds to outputDir in every thumbnail size
+func (t *FFmpegTranscoder) GenerateThumbnailSet(ctx context.Context, inputPath, outputDir string, timestamp float64) error {
+	cmd := exec.CommandContext(ctx, t.ffmpegPath, thumbnailArgs(inputPath, outputDir, timestamp)...)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("ffmpeg failed: %w\nOutput: %s", err, string(output))
 	}
@@ -223,6 +348,17 @@ func (t *FFmpegTranscoder) GenerateThumbnail(ctx context.Context, inputPath, out
 	return nil
 }
 
+// GenerateStoryboard writes the sprite sheets and WebVTT file of a video with a tile every
+// DefaultStoryboardInterval
+func (t *FFmpegTranscoder) GenerateStoryboard(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (string, error) {
+	return generateStoryboard(ctx, t.ffmpegPath, t.ffmpegThreads, inputPath, outputDir, inputWidth, inputHeight, duration, DefaultStoryboardInterval)
+}
+
+// GeneratePreview writes the WebP and MP4 previews of a video, DefaultPreviewLength long
+func (t *FFmpegTranscoder) GeneratePreview(ctx context.Context, inputPath, outputDir string, inputWidth, inputHeight int, duration time.Duration) (*Preview, error) {
+	return generatePreview(ctx, t.ffmpegPath, t.ffmpegThreads, t.ffmpegPreset, inputPath, outputDir, inputWidth, inputHeight, duration, DefaultPreviewLength)
+}
+
 // ExtractMetadata extracts metadata from a video file
 func (t *FFmpegTranscoder) ExtractMetadata(ctx context.Context, inputPath string) (map[string]string, error) {
 	args := []string{
@@ -11,10 +11,17 @@ import (
 
 	sharedlog "youtube-clone-platform/internal/shared/log"
 	"youtube-clone-platform/video-upload-service/internal/config"
+	"youtube-clone-platform/video-upload-service/internal/db"
+	"youtube-clone-platform/video-upload-service/internal/dedup"
+	"youtube-clone-platform/video-upload-service/internal/direct"
 	"youtube-clone-platform/video-upload-service/internal/events"
 	"youtube-clone-platform/video-upload-service/internal/handler"
+	"youtube-clone-platform/video-upload-service/internal/outbox"
+	"youtube-clone-platform/video-upload-service/internal/policy"
+	"youtube-clone-platform/video-upload-service/internal/quota"
 	"youtube-clone-platform/video-upload-service/internal/service"
 	"youtube-clone-platform/video-upload-service/internal/storage"
+	"youtube-clone-platform/video-upload-service/internal/tus"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,6 +37,8 @@ func main() {
 	// Initialize MinIO storage
 	minioStorage, err := storage.NewMinIOStorage(
 		cfg.MinIO.Endpoint,
+		cfg.MinIO.PublicEndpoint,
+		cfg.MinIO.Region,
 		cfg.MinIO.AccessKeyID,
 		cfg.MinIO.SecretAccessKey,
 		cfg.MinIO.UseSSL,
@@ -44,11 +53,73 @@ func main() {
 	kafkaPublisher := events.NewKafkaPublisher(cfg.Kafka.Brokers, cfg.Kafka.Topic)
 	defer kafkaPublisher.Close()
 
+	// Initialize the database holding the event outbox and quota usage
+	database, err := db.Open(cfg.DatabasePath)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to initialize database: %v", err))
+		return
+	}
+	defer database.Close()
+
+	// Upload events are recorded in the outbox and relayed to Kafka in the background,
+	// quota usage is recorded in the same transaction
+	quotaStore := quota.NewStore(database)
+	outboxStore := outbox.NewStore(database)
+	outboxRelay := outbox.NewRelay(outboxStore, kafkaPublisher, cfg.Outbox.PollInterval, cfg.Outbox.MaxAttempts)
+	outboxPublisher := outbox.NewPublisher(outboxStore, outboxRelay, quotaStore.RecordUpload)
+
+	relayCtx, relayCancel := context.WithCancel(context.Background())
+	defer relayCancel()
+	go outboxRelay.Run(relayCtx)
+
+	// Deleted videos no longer count against the quota of their user
+	deletionConsumer := events.NewDeletionConsumer(cfg.Kafka.Brokers, cfg.Kafka.DeleteTopic, cfg.Kafka.DeleteGroupID)
+	defer deletionConsumer.Close()
+	go deletionConsumer.Run(relayCtx, quotaStore.RecordDeletion)
+
+	// Load upload policy
+	uploadPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to load upload policy: %v", err))
+		return
+	}
+
+	// Initialize duplicate detection
+	duplicateAction, err := dedup.ParseAction(cfg.Duplicates.Action)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to configure duplicate detection: %v", err))
+		return
+	}
+	duplicateScope, err := dedup.ParseScope(cfg.Duplicates.Scope)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to configure duplicate detection: %v", err))
+		return
+	}
+	duplicates := dedup.NewDetector(dedup.NewMetadataClient(cfg.Duplicates.MetadataServiceURL), duplicateAction, duplicateScope)
+
 	// Initialize upload service
-	uploadService := service.NewUploadService(minioStorage, kafkaPublisher, cfg.MaxBytes)
+	uploadService := service.NewUploadService(minioStorage, outboxPublisher, uploadPolicy, duplicates, quotaStore, cfg.MaxBytes, cfg.ChecksumMD5)
+
+	// Initialize resumable upload store
+	tusStore, err := tus.NewFileStore(cfg.Tus.Dir, cfg.Tus.Expiry)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to initialize resumable upload store: %v", err))
+		return
+	}
+
+	// Initialize direct-to-storage upload sessions
+	directStore, err := direct.NewStore(cfg.Direct.Dir)
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to initialize direct upload store: %v", err))
+		return
+	}
+	directService := service.NewDirectUploadService(uploadService, directStore, cfg.Direct.PartSize, cfg.Direct.Expiry)
 
 	// Initialize handlers
 	uploadHandler := handler.NewUploadHandler(uploadService)
+	tusHandler := handler.NewTusHandler(tusStore, uploadService, cfg.MaxBytes, "/api/v1/upload/files")
+	directHandler := handler.NewDirectUploadHandler(directService, "/api/v1/upload/uploads")
+	adminHandler := handler.NewAdminHandler(outboxStore, outboxRelay, cfg.Outbox.StuckAfter)
 	healthHandler := handler.NewHealthHandler(minioStorage, cfg.Kafka.Brokers, cfg.Kafka.Topic)
 
 	// Setup Gin router
@@ -62,8 +133,64 @@ func main() {
 
 		// Upload endpoint
 		api.POST("/videos", uploadHandler.HandleUpload)
+
+		// Quota usage of the requesting user
+		api.GET("/quota", uploadHandler.HandleQuota)
+
+		// Resumable upload endpoints (tus 1.0)
+		api.OPTIONS("/files", tusHandler.HandleOptions)
+		api.POST("/files", tusHandler.HandleCreate)
+		api.HEAD("/files/:id", tusHandler.HandleHead)
+		api.PATCH("/files/:id", tusHandler.HandlePatch)
+		api.DELETE("/files/:id", tusHandler.HandleDelete)
+		api.POST("/files/:id/finalize", tusHandler.HandleFinalize)
+
+		// Direct-to-storage upload endpoints (presigned multipart URLs)
+		api.POST("/uploads", directHandler.HandleInitiate)
+		api.POST("/uploads/:id/complete", directHandler.HandleComplete)
+		api.DELETE("/uploads/:id", directHandler.HandleAbort)
+
+		// Admin endpoints
+		admin := api.Group("/admin", handler.RequireAdmin())
+		admin.GET("/outbox/stuck", adminHandler.HandleStuckEvents)
+		admin.POST("/outbox/redrive", adminHandler.HandleRedriveEvents)
 	}
 
+	// Periodically remove expired resumable and direct uploads and old outbox events
+	purgeCtx, purgeCancel := context.WithCancel(context.Background())
+	defer purgeCancel()
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-purgeCtx.Done():
+				return
+			case <-ticker.C:
+				purged, err := tusStore.PurgeExpired()
+				if err != nil {
+					sharedlog.Error(fmt.Sprintf("Failed to purge expired uploads: %v", err))
+				} else if purged > 0 {
+					sharedlog.Info(fmt.Sprintf("Purged %d expired resumable uploads", purged))
+				}
+
+				purged, err = directService.PurgeExpired(purgeCtx)
+				if err != nil {
+					sharedlog.Error(fmt.Sprintf("Failed to purge expired direct uploads: %v", err))
+				} else if purged > 0 {
+					sharedlog.Info(fmt.Sprintf("Purged %d expired direct uploads", purged))
+				}
+
+				deleted, err := outboxStore.DeleteDelivered(purgeCtx, time.Now().Add(-cfg.Outbox.Retention))
+				if err != nil {
+					sharedlog.Error(fmt.Sprintf("Failed to delete delivered outbox events: %v", err))
+				} else if deleted > 0 {
+					sharedlog.Info(fmt.Sprintf("Deleted %d delivered outbox events", deleted))
+				}
+			}
+		}
+	}()
+
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
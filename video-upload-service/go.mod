@@ -7,6 +7,7 @@ require (
 	github.com/gabriel-vasile/mimetype v1.4.2
 	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/minio/minio-go/v7 v7.0.69
 	github.com/segmentio/kafka-go v0.4.47
 	github.com/spf13/viper v1.18.2
@@ -0,0 +1,145 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"youtube-clone-platform/video-upload-service/internal/validation"
+)
+
+// Algorithm is the algorithm used for VideoMetadata.Checksum
+const Algorithm = "sha256"
+
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Digests holds the hex encoded digests of an uploaded file
+type Digests struct {
+	SHA256 string
+	MD5    string
+}
+
+// Expected holds the hex encoded digests a client expects the upload to have
+type Expected struct {
+	SHA256 string
+	MD5    string
+}
+
+// IsZero reports whether the client did not send any digest
+func (e Expected) IsZero() bool {
+	return e.SHA256 == "" && e.MD5 == ""
+}
+
+// Verify compares the expected digests with the computed ones
+func (e Expected) Verify(d Digests) error {
+	if e.SHA256 != "" && e.SHA256 != d.SHA256 {
+		return fmt.Errorf("%w: expected sha256 %s, got %s", ErrMismatch, e.SHA256, d.SHA256)
+	}
+	if e.MD5 != "" && e.MD5 != d.MD5 {
+		return fmt.Errorf("%w: expected md5 %s, got %s", ErrMismatch, e.MD5, d.MD5)
+	}
+	return nil
+}
+
+// Hasher computes the digests of everything written to it
+type Hasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+// NewHasher creates a hasher computing SHA-256 and, if withMD5 is set, MD5
+func NewHasher(withMD5 bool) *Hasher {
+	h := &Hasher{sha256: sha256.New()}
+	if withMD5 {
+		h.md5 = md5.New()
+	}
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.md5 != nil {
+		h.md5.Write(p)
+	}
+	return len(p), nil
+}
+
+// Sum returns the digests of the data written so far
+func (h *Hasher) Sum() Digests {
+	digests := Digests{SHA256: hex.EncodeToString(h.sha256.Sum(nil))}
+	if h.md5 != nil {
+		digests.MD5 = hex.EncodeToString(h.md5.Sum(nil))
+	}
+	return digests
+}
+
+// ParseHeaders reads the digests a client expects from the request headers.
+// Supported are "Digest: sha-256=<base64>, md5=<base64>" (RFC 3230),
+// "X-Checksum-SHA256: <hex>" and "X-Checksum-MD5: <hex>".
+func ParseHeaders(header http.Header) (Expected, error) {
+	var expected Expected
+
+	if digest := header.Get("Digest"); digest != "" {
+		for _, item := range strings.Split(digest, ",") {
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				return Expected{}, invalidDigest("Digest")
+			}
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return Expected{}, invalidDigest("Digest")
+			}
+			switch strings.ToLower(algorithm) {
+			case "sha-256":
+				if len(decoded) != sha256.Size {
+					return Expected{}, invalidDigest("Digest")
+				}
+				expected.SHA256 = hex.EncodeToString(decoded)
+			case "md5":
+				if len(decoded) != md5.Size {
+					return Expected{}, invalidDigest("Digest")
+				}
+				expected.MD5 = hex.EncodeToString(decoded)
+			}
+		}
+	}
+
+	if value := header.Get("X-Checksum-SHA256"); value != "" {
+		parsed, err := ParseHex(value, sha256.Size)
+		if err != nil {
+			return Expected{}, invalidDigest("X-Checksum-SHA256")
+		}
+		expected.SHA256 = parsed
+	}
+	if value := header.Get("X-Checksum-MD5"); value != "" {
+		parsed, err := ParseHex(value, md5.Size)
+		if err != nil {
+			return Expected{}, invalidDigest("X-Checksum-MD5")
+		}
+		expected.MD5 = parsed
+	}
+
+	return expected, nil
+}
+
+// ParseHex normalizes a hex encoded digest of the given length in bytes
+func ParseHex(value string, size int) (string, error) {
+	decoded, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(decoded) != size {
+		return "", fmt.Errorf("invalid digest %q", value)
+	}
+	return hex.EncodeToString(decoded), nil
+}
+
+func invalidDigest(header string) error {
+	return &validation.ValidationError{
+		Field:   "digest",
+		Message: fmt.Sprintf("invalid %s header", header),
+	}
+}
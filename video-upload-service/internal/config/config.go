@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -8,11 +10,27 @@ type Config struct {
 	Port     string
 	MinIO    MinIOConfig
 	Kafka    KafkaConfig
+	Tus      TusConfig
+	Direct   DirectUploadConfig
 	MaxBytes int64
+
+	// Path to the JSON upload policy, built-in defaults are used when empty
+	PolicyFile string
+
+	// Also compute an MD5 digest next to the SHA-256 checksum
+	ChecksumMD5 bool
+
+	Duplicates DuplicateConfig
+	Outbox     OutboxConfig
+
+	// SQLite database holding the event outbox and quota usage
+	DatabasePath string
 }
 
 type MinIOConfig struct {
 	Endpoint        string
+	PublicEndpoint  string
+	Region          string
 	AccessKeyID     string
 	SecretAccessKey string
 	UseSSL          bool
@@ -22,6 +40,38 @@ type MinIOConfig struct {
 type KafkaConfig struct {
 	Brokers []string
 	Topic   string
+	// Video deletion events, published by the metadata service, release the quota used by the deleted videos
+	DeleteTopic   string
+	DeleteGroupID string
+}
+
+type TusConfig struct {
+	Dir    string
+	Expiry time.Duration
+}
+
+type DuplicateConfig struct {
+	// allow, reject, return_existing or reuse
+	Action string
+	// user or global
+	Scope string
+	// Metadata service used to look up existing checksums
+	MetadataServiceURL string
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	// Pending events older than this are reported as stuck
+	StuckAfter time.Duration
+	// How long delivered events are kept
+	Retention time.Duration
+}
+
+type DirectUploadConfig struct {
+	Dir      string
+	PartSize int64
+	Expiry   time.Duration
 }
 
 func Load() (*Config, error) {
@@ -36,20 +86,67 @@ func Load() (*Config, error) {
 	viper.SetDefault("PORT", "8081")
 	viper.SetDefault("MAX_BYTES", 1024*1024*1024*5) // 1GB default max upload size
 	viper.SetDefault("MINIO_ENDPOINT", "localhost:9000")
+	viper.SetDefault("MINIO_PUBLIC_ENDPOINT", "")
+	viper.SetDefault("MINIO_REGION", "us-east-1")
 	viper.SetDefault("MINIO_ACCESS_KEY", "minioadmin")
 	viper.SetDefault("MINIO_SECRET_KEY", "minioadmin")
 	viper.SetDefault("MINIO_USE_SSL", false)
 	viper.SetDefault("MINIO_BUCKET", "rawvideos")
 	viper.SetDefault("KAFKA_BROKERS", []string{"localhost:29092"})
 	viper.SetDefault("KAFKA_TOPIC", "video-uploads")
+	viper.SetDefault("KAFKA_DELETE_TOPIC", "video-deletions")
+	viper.SetDefault("KAFKA_DELETE_GROUP_ID", "video-upload-service")
+	viper.SetDefault("TUS_DIR", "/tmp/video-upload/tus")
+	viper.SetDefault("TUS_UPLOAD_EXPIRY", "24h")
+	viper.SetDefault("UPLOAD_POLICY_FILE", "")
+	viper.SetDefault("CHECKSUM_MD5", false)
+	viper.SetDefault("DIRECT_UPLOAD_DIR", "/tmp/video-upload/direct")
+	viper.SetDefault("DIRECT_UPLOAD_PART_SIZE", 64*1024*1024) // 64MB parts
+	viper.SetDefault("DIRECT_UPLOAD_EXPIRY", "1h")
+	viper.SetDefault("DUPLICATE_ACTION", "allow")
+	viper.SetDefault("DUPLICATE_SCOPE", "user")
+	viper.SetDefault("METADATA_SERVICE_URL", "http://localhost:8082")
+	viper.SetDefault("DATABASE_PATH", "/tmp/video-upload/upload.db")
+	viper.SetDefault("OUTBOX_POLL_INTERVAL", "5s")
+	viper.SetDefault("OUTBOX_MAX_ATTEMPTS", 10)
+	viper.SetDefault("OUTBOX_STUCK_AFTER", "5m")
+	viper.SetDefault("OUTBOX_RETENTION", "168h")
 
 	// Also read from environment variables (higher priority than .env)
 	viper.AutomaticEnv()
 
+	// Parse resumable upload expiry
+	tusExpiry, err := time.ParseDuration(viper.GetString("TUS_UPLOAD_EXPIRY"))
+	if err != nil {
+		tusExpiry = 24 * time.Hour // Default fallback
+	}
+
+	// Parse direct upload expiry
+	directExpiry, err := time.ParseDuration(viper.GetString("DIRECT_UPLOAD_EXPIRY"))
+	if err != nil {
+		directExpiry = time.Hour // Default fallback
+	}
+
+	// Parse outbox durations
+	outboxPoll, err := time.ParseDuration(viper.GetString("OUTBOX_POLL_INTERVAL"))
+	if err != nil || outboxPoll <= 0 {
+		outboxPoll = 5 * time.Second // Default fallback
+	}
+	outboxStuck, err := time.ParseDuration(viper.GetString("OUTBOX_STUCK_AFTER"))
+	if err != nil {
+		outboxStuck = 5 * time.Minute // Default fallback
+	}
+	outboxRetention, err := time.ParseDuration(viper.GetString("OUTBOX_RETENTION"))
+	if err != nil {
+		outboxRetention = 7 * 24 * time.Hour // Default fallback
+	}
+
 	return &Config{
 		Port: viper.GetString("PORT"),
 		MinIO: MinIOConfig{
 			Endpoint:        viper.GetString("MINIO_ENDPOINT"),
+			PublicEndpoint:  viper.GetString("MINIO_PUBLIC_ENDPOINT"),
+			Region:          viper.GetString("MINIO_REGION"),
 			AccessKeyID:     viper.GetString("MINIO_ACCESS_KEY"),
 			SecretAccessKey: viper.GetString("MINIO_SECRET_KEY"),
 			UseSSL:          viper.GetBool("MINIO_USE_SSL"),
@@ -58,7 +155,33 @@ func Load() (*Config, error) {
 		Kafka: KafkaConfig{
 			Brokers: viper.GetStringSlice("KAFKA_BROKERS"),
 			Topic:   viper.GetString("KAFKA_TOPIC"),
+
+			DeleteTopic:   viper.GetString("KAFKA_DELETE_TOPIC"),
+			DeleteGroupID: viper.GetString("KAFKA_DELETE_GROUP_ID"),
+		},
+		Tus: TusConfig{
+			Dir:    viper.GetString("TUS_DIR"),
+			Expiry: tusExpiry,
+		},
+		Direct: DirectUploadConfig{
+			Dir:      viper.GetString("DIRECT_UPLOAD_DIR"),
+			PartSize: viper.GetInt64("DIRECT_UPLOAD_PART_SIZE"),
+			Expiry:   directExpiry,
+		},
+		MaxBytes:    viper.GetInt64("MAX_BYTES"),
+		PolicyFile:  viper.GetString("UPLOAD_POLICY_FILE"),
+		ChecksumMD5: viper.GetBool("CHECKSUM_MD5"),
+		Duplicates: DuplicateConfig{
+			Action:             viper.GetString("DUPLICATE_ACTION"),
+			Scope:              viper.GetString("DUPLICATE_SCOPE"),
+			MetadataServiceURL: viper.GetString("METADATA_SERVICE_URL"),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: outboxPoll,
+			MaxAttempts:  viper.GetInt("OUTBOX_MAX_ATTEMPTS"),
+			StuckAfter:   outboxStuck,
+			Retention:    outboxRetention,
 		},
-		MaxBytes: viper.GetInt64("MAX_BYTES"),
+		DatabasePath: viper.GetString("DATABASE_PATH"),
 	}, nil
 }
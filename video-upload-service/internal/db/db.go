@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed schema.sql
+var schema string
+
+// Open opens the SQLite database of the upload service and creates its tables
+func Open(dbPath string) (*sql.DB, error) {
+	// Ensure the directory exists
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	// WAL lets the relay read while uploads write, the busy timeout covers the remaining lock waits
+	database, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test the connection
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	if _, err := database.Exec(schema); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	return database, nil
+}
@@ -0,0 +1,29 @@
+-- Events recorded with an upload and relayed to Kafka by the outbox relay.
+-- Times are unix milliseconds (UTC).
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    aggregate_id TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at INTEGER NOT NULL,
+    next_attempt_at INTEGER NOT NULL,
+    delivered_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_aggregate ON outbox_events(aggregate_id);
+
+-- Videos counted against user quotas, recorded together with their upload event
+CREATE TABLE IF NOT EXISTS quota_videos (
+    video_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    duration REAL NOT NULL,
+    uploaded_at INTEGER NOT NULL,
+    deleted_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_videos_user ON quota_videos(user_id, uploaded_at);
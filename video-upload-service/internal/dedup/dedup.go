@@ -0,0 +1,224 @@
+package dedup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Action is what happens when an upload has the same checksum as an existing video
+type Action string
+
+const (
+	// ActionAllow disables duplicate detection
+	ActionAllow Action = "allow"
+	// ActionReject refuses the upload
+	ActionReject Action = "reject"
+	// ActionReturnExisting discards the upload and returns the existing video ID
+	ActionReturnExisting Action = "return_existing"
+	// ActionReuse creates a new video that reuses the transcoded assets of the existing one
+	ActionReuse Action = "reuse"
+)
+
+// Scope controls which existing videos an upload is compared against
+type Scope string
+
+const (
+	// ScopeUser only matches videos of the same user
+	ScopeUser Scope = "user"
+	// ScopeGlobal matches videos of any user
+	ScopeGlobal Scope = "global"
+)
+
+var ErrDuplicate = errors.New("duplicate upload")
+
+// DuplicateError is returned when an upload is rejected as a duplicate. ExistingVideoID is empty
+// when the existing video belongs to another user, its ID is not revealed.
+type DuplicateError struct {
+	ExistingVideoID string
+}
+
+func (e *DuplicateError) Error() string {
+	if e.ExistingVideoID == "" {
+		return "duplicate upload: the same content was already uploaded"
+	}
+	return fmt.Sprintf("duplicate upload: video %s has the same content", e.ExistingVideoID)
+}
+
+// Is makes errors.Is(err, ErrDuplicate) match
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+// ParseAction parses the configured duplicate action
+func ParseAction(value string) (Action, error) {
+	switch action := Action(strings.ToLower(strings.TrimSpace(value))); action {
+	case "":
+		return ActionAllow, nil
+	case ActionAllow, ActionReject, ActionReturnExisting, ActionReuse:
+		return action, nil
+	default:
+		return "", fmt.Errorf("invalid duplicate action %q", value)
+	}
+}
+
+// ParseScope parses the configured duplicate scope
+func ParseScope(value string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(strings.TrimSpace(value))); scope {
+	case "":
+		return ScopeUser, nil
+	case ScopeUser, ScopeGlobal:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("invalid duplicate scope %q", value)
+	}
+}
+
+// Match is an existing video with the same checksum
+type Match struct {
+	VideoID     string
+	UserID      string
+	Status      string
+	DuplicateOf string
+}
+
+// OwnedBy reports whether the matched video belongs to a user. The IDs of videos of other users
+// must not be returned to the uploader, they may be drafts or unpublished.
+func (m *Match) OwnedBy(userID string) bool {
+	return m.UserID == userID
+}
+
+// SourceID returns the video that owns the transcoded assets of the match
+func (m *Match) SourceID() string {
+	if m.DuplicateOf != "" {
+		return m.DuplicateOf
+	}
+	return m.VideoID
+}
+
+// Finder looks up existing videos by checksum, oldest first.
+// An empty userID searches the videos of all users.
+type Finder interface {
+	FindByChecksum(ctx context.Context, checksum string, userID string) ([]Match, error)
+}
+
+// MetadataClient finds videos through the metadata service
+type MetadataClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewMetadataClient creates a client for the metadata service at baseURL
+func NewMetadataClient(baseURL string) *MetadataClient {
+	return &MetadataClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// metadataVideo is the subset of the metadata service video used for matching
+type metadataVideo struct {
+	ID          string `json:"id"`
+	UserID      string `json:"user_id"`
+	Status      string `json:"status"`
+	DuplicateOf struct {
+		String string `json:"String"`
+		Valid  bool   `json:"Valid"`
+	} `json:"duplicate_of"`
+}
+
+// FindByChecksum implements Finder
+func (c *MetadataClient) FindByChecksum(ctx context.Context, checksum string, userID string) ([]Match, error) {
+	query := url.Values{}
+	query.Set("limit", "1")
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/metadata/checksums/%s/videos?%s", c.baseURL, url.PathEscape(checksum), query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checksum lookup request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up checksum: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to look up checksum: metadata service returned %s", resp.Status)
+	}
+
+	var videos []metadataVideo
+	if err := json.NewDecoder(resp.Body).Decode(&videos); err != nil {
+		return nil, fmt.Errorf("failed to decode checksum lookup: %w", err)
+	}
+
+	matches := make([]Match, 0, len(videos))
+	for _, video := range videos {
+		match := Match{
+			VideoID: video.ID,
+			UserID:  video.UserID,
+			Status:  video.Status,
+		}
+		if video.DuplicateOf.Valid {
+			match.DuplicateOf = video.DuplicateOf.String
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// Detector decides whether an upload duplicates an existing video
+type Detector struct {
+	finder Finder
+	action Action
+	scope  Scope
+}
+
+// NewDetector creates a detector. With ActionAllow no lookups are made.
+func NewDetector(finder Finder, action Action, scope Scope) *Detector {
+	return &Detector{
+		finder: finder,
+		action: action,
+		scope:  scope,
+	}
+}
+
+// Action returns the configured duplicate action
+func (d *Detector) Action() Action {
+	if d == nil {
+		return ActionAllow
+	}
+	return d.action
+}
+
+// Find returns the oldest existing video with the given checksum, or nil if there is none
+func (d *Detector) Find(ctx context.Context, checksum string, userID string) (*Match, error) {
+	if d.Action() == ActionAllow || checksum == "" {
+		return nil, nil
+	}
+
+	owner := ""
+	if d.scope == ScopeUser {
+		owner = userID
+	}
+
+	matches, err := d.finder.FindByChecksum(ctx, checksum, owner)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	return &matches[0], nil
+}
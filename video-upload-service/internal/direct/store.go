@@ -0,0 +1,162 @@
+package direct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound  = errors.New("upload not found")
+	ErrExpired   = errors.New("upload has expired")
+	ErrLocked    = errors.New("upload is locked by another request")
+	ErrCompleted = errors.New("upload already completed")
+)
+
+// Session describes a direct-to-storage multipart upload.
+// The client uploads the parts straight to object storage using presigned URLs,
+// the service only keeps track of what it expects to receive.
+type Session struct {
+	ID               string     `json:"id"`
+	ObjectName       string     `json:"object_name"`
+	UploadID         string     `json:"upload_id"`
+	UserID           string     `json:"user_id"`
+	Role             string     `json:"role"`
+	Title            string     `json:"title"`
+	OriginalFilename string     `json:"original_filename"`
+	ContentType      string     `json:"content_type"`
+	Size             int64      `json:"size"`
+	PartSize         int64      `json:"part_size"`
+	PartCount        int        `json:"part_count"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	Completed        bool       `json:"completed"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// PartSizeOf returns the expected size of the given 1-based part
+func (s *Session) PartSizeOf(partNumber int) int64 {
+	if partNumber < s.PartCount {
+		return s.PartSize
+	}
+	return s.Size - int64(s.PartCount-1)*s.PartSize
+}
+
+// Store keeps direct upload sessions on the local filesystem as <id>.json
+type Store struct {
+	dir string
+
+	locksMux sync.Mutex
+	locks    map[string]bool
+}
+
+// NewStore creates a new Store rooted at dir
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	return &Store{
+		dir:   dir,
+		locks: make(map[string]bool),
+	}, nil
+}
+
+// Save writes the session state atomically
+func (s *Store) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload session: %w", err)
+	}
+
+	tmpPath := s.path(session.ID) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload session: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path(session.ID)); err != nil {
+		return fmt.Errorf("failed to write upload session: %w", err)
+	}
+
+	return nil
+}
+
+// Get loads a session
+func (s *Store) Get(id string) (*Session, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse upload session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// Delete removes a session
+func (s *Store) Delete(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload session: %w", err)
+	}
+	return nil
+}
+
+// Expired returns the sessions whose expiry time has passed
+func (s *Store) Expired() ([]*Session, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload sessions: %w", err)
+	}
+
+	var expired []*Session
+	now := time.Now()
+	for _, match := range matches {
+		session, err := s.Get(strings.TrimSuffix(filepath.Base(match), ".json"))
+		if err != nil || now.Before(session.ExpiresAt) {
+			continue
+		}
+		expired = append(expired, session)
+	}
+
+	return expired, nil
+}
+
+// Lock prevents concurrent requests from completing or aborting the same upload
+func (s *Store) Lock(id string) error {
+	s.locksMux.Lock()
+	defer s.locksMux.Unlock()
+
+	if s.locks[id] {
+		return ErrLocked
+	}
+	s.locks[id] = true
+	return nil
+}
+
+// Unlock releases a lock taken with Lock
+func (s *Store) Unlock(id string) {
+	s.locksMux.Lock()
+	defer s.locksMux.Unlock()
+
+	delete(s.locks, id)
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
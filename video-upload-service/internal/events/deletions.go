@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	sharedlog "youtube-clone-platform/internal/shared/log"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// VideoDeletedEvent is published when a video is deleted
+type VideoDeletedEvent struct {
+	VideoID   string `json:"video_id"`
+	UserID    string `json:"user_id"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+// DeletionHandler is called for every video deletion
+type DeletionHandler func(ctx context.Context, videoID string, deletedAt time.Time) error
+
+// DeletionConsumer reads video deletion events from Kafka
+type DeletionConsumer struct {
+	reader *kafka.Reader
+}
+
+func NewDeletionConsumer(brokers []string, topic string, groupID string) *DeletionConsumer {
+	return &DeletionConsumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  brokers,
+			Topic:    topic,
+			GroupID:  groupID,
+			MinBytes: 1,
+			MaxBytes: 10e6, // 10MB
+		}),
+	}
+}
+
+// Run passes deletion events to handle until the context is cancelled
+func (c *DeletionConsumer) Run(ctx context.Context, handle DeletionHandler) {
+	for {
+		msg, err := c.reader.ReadMessage(ctx)
+		if err != nil {
+			// The reader returns io.EOF once it has been closed
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return
+			}
+			sharedlog.Error(fmt.Sprintf("Failed to read deletion event: %v", err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		var event VideoDeletedEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil || event.VideoID == "" {
+			sharedlog.Warn(fmt.Sprintf("Skipping invalid deletion event: %s", string(msg.Value)))
+			continue
+		}
+
+		deletedAt, err := time.Parse(time.RFC3339, event.DeletedAt)
+		if err != nil {
+			deletedAt = time.Now()
+		}
+
+		if err := handle(ctx, event.VideoID, deletedAt); err != nil {
+			sharedlog.Error(fmt.Sprintf("Failed to process deletion of video %s: %v", event.VideoID, err))
+			continue
+		}
+		sharedlog.Info(fmt.Sprintf("Processed deletion of video %s", event.VideoID))
+	}
+}
+
+func (c *DeletionConsumer) Close() error {
+	return c.reader.Close()
+}
@@ -19,6 +19,9 @@ type VideoUploadEvent struct {
 	Size        int64                  `json:"size"`
 	Metadata    metadata.VideoMetadata `json:"metadata"`
 	UploadedAt  string                 `json:"uploaded_at"`
+
+	// DuplicateOf is set when the video reuses the transcoded assets of an existing video
+	DuplicateOf string `json:"duplicate_of,omitempty"`
 }
 
 type Publisher interface {
@@ -85,11 +88,17 @@ func (p *KafkaPublisher) PublishVideoUpload(ctx context.Context, event VideoUplo
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
+	return p.PublishMessage(ctx, event.VideoID, payload)
+}
+
+// PublishMessage writes an already encoded event to the topic
+func (p *KafkaPublisher) PublishMessage(ctx context.Context, key string, payload []byte) error {
 	// Add timeout to context
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err = p.writer.WriteMessages(ctx, kafka.Message{
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(key),
 		Value: payload,
 	})
 	if err != nil {
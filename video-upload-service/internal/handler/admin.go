@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"youtube-clone-platform/video-upload-service/internal/outbox"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// AdminRole is the role required for the admin endpoints
+	AdminRole = "admin"
+
+	defaultRedriveLimit = 100
+	maxRedriveLimit     = 1000
+)
+
+// RequireAdmin rejects requests whose gateway forwarded role is not admin
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(c.GetHeader("X-User-Role"), AdminRole) {
+			c.AbortWithStatusJSON(http.StatusForbidden, &UploadError{
+				Code:    http.StatusForbidden,
+				Message: "admin role required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminHandler serves operational endpoints of the upload service
+type AdminHandler struct {
+	outbox     *outbox.Store
+	relay      *outbox.Relay
+	stuckAfter time.Duration
+}
+
+// NewAdminHandler creates a new admin handler. Pending outbox events older than stuckAfter are reported as stuck.
+func NewAdminHandler(store *outbox.Store, relay *outbox.Relay, stuckAfter time.Duration) *AdminHandler {
+	return &AdminHandler{
+		outbox:     store,
+		relay:      relay,
+		stuckAfter: stuckAfter,
+	}
+}
+
+// HandleStuckEvents lists outbox events that failed or have been pending for too long
+func (h *AdminHandler) HandleStuckEvents(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	events, err := h.outbox.Stuck(c.Request.Context(), time.Now().Add(-h.stuckAfter), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, &UploadError{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to list outbox events",
+			Details: err.Error(),
+		})
+		return
+	}
+	if events == nil {
+		events = []*outbox.Event{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":      events,
+		"count":       len(events),
+		"stuck_after": h.stuckAfter.String(),
+	})
+}
+
+// HandleRedriveEvents handles POST /api/v1/upload/admin/outbox/redrive. Up to limit failed outbox
+// events are returned to pending and delivered again by the relay.
+func (h *AdminHandler) HandleRedriveEvents(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRedriveLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultRedriveLimit
+	}
+	if limit > maxRedriveLimit {
+		limit = maxRedriveLimit
+	}
+
+	redriven, err := h.outbox.Redrive(c.Request.Context(), limit)
+	if len(redriven) > 0 {
+		h.relay.Notify()
+	}
+	if redriven == nil {
+		redriven = []*outbox.Event{}
+	}
+	if err != nil {
+		// Events re-driven before the error stay pending
+		c.JSON(http.StatusInternalServerError, &UploadError{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to re-drive outbox events",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": redriven,
+		"count":  len(redriven),
+	})
+}
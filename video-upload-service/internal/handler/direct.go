@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"youtube-clone-platform/video-upload-service/internal/checksum"
+	"youtube-clone-platform/video-upload-service/internal/direct"
+	"youtube-clone-platform/video-upload-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DirectUploadHandler handles uploads that go straight to object storage via presigned URLs
+type DirectUploadHandler struct {
+	service  *service.DirectUploadService
+	basePath string
+}
+
+// NewDirectUploadHandler creates a new direct upload handler.
+// basePath is the route the uploads are mounted on and is used to build the completion URL.
+func NewDirectUploadHandler(s *service.DirectUploadService, basePath string) *DirectUploadHandler {
+	return &DirectUploadHandler{
+		service:  s,
+		basePath: basePath,
+	}
+}
+
+type initiateDirectUploadRequest struct {
+	Title       string `json:"title" binding:"required"`
+	UserID      string `json:"user_id"`
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size" binding:"required"`
+}
+
+// HandleInitiate creates a direct upload and returns presigned URLs for every part
+func (h *DirectUploadHandler) HandleInitiate(c *gin.Context) {
+	var req initiateDirectUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, &UploadError{
+			Code:    http.StatusBadRequest,
+			Message: "invalid request body",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Get user ID and role (set by gateway in production)
+	userID, role := requestIdentity(c, req.UserID)
+
+	upload, err := h.service.Initiate(c.Request.Context(), userID, role, req.Title, req.Filename, req.ContentType, req.Size)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload_id":    upload.Session.ID,
+		"video_id":     upload.Session.ID,
+		"part_size":    upload.Session.PartSize,
+		"part_count":   upload.Session.PartCount,
+		"parts":        upload.Parts,
+		"expires_at":   upload.Session.ExpiresAt.Format(time.RFC3339),
+		"complete_url": h.basePath + "/" + upload.Session.ID + "/complete",
+	})
+}
+
+// HandleComplete verifies the uploaded object and hands it to the regular upload pipeline
+func (h *DirectUploadHandler) HandleComplete(c *gin.Context) {
+	startTime := time.Now()
+
+	// Get the digest the client expects, if any
+	expected, err := checksum.ParseHeaders(c.Request.Header)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	if !h.checkOwner(c) {
+		return
+	}
+
+	result, err := h.service.Complete(c.Request.Context(), c.Param("id"), expected)
+	if err != nil {
+		writeDirectUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, uploadResponse(result, result.Title, result.UserID, startTime))
+}
+
+// HandleAbort cancels a direct upload
+func (h *DirectUploadHandler) HandleAbort(c *gin.Context) {
+	if !h.checkOwner(c) {
+		return
+	}
+
+	if err := h.service.Abort(c.Request.Context(), c.Param("id")); err != nil {
+		writeDirectUploadError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkOwner rejects requests for uploads of other users, it reports whether the request may proceed
+func (h *DirectUploadHandler) checkOwner(c *gin.Context) bool {
+	session, err := h.service.Session(c.Param("id"))
+	if err != nil {
+		writeDirectUploadError(c, err)
+		return false
+	}
+	if !ownsUpload(c, session.UserID) {
+		writeUploadForbidden(c)
+		return false
+	}
+	return true
+}
+
+// writeDirectUploadError maps direct upload errors to HTTP responses
+func writeDirectUploadError(c *gin.Context, err error) {
+	status := 0
+	switch {
+	case errors.Is(err, direct.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, direct.ErrExpired):
+		status = http.StatusGone
+	case errors.Is(err, direct.ErrCompleted), errors.Is(err, service.ErrUploadIncomplete):
+		status = http.StatusConflict
+	case errors.Is(err, direct.ErrLocked):
+		status = http.StatusLocked
+	case errors.Is(err, service.ErrUploadCorrupt):
+		status = http.StatusUnprocessableEntity
+	}
+
+	if status == 0 {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.JSON(status, &UploadError{
+		Code:    status,
+		Message: err.Error(),
+	})
+}
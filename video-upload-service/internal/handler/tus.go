@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"youtube-clone-platform/video-upload-service/internal/checksum"
+	"youtube-clone-platform/video-upload-service/internal/dedup"
+	"youtube-clone-platform/video-upload-service/internal/quota"
+	"youtube-clone-platform/video-upload-service/internal/service"
+	"youtube-clone-platform/video-upload-service/internal/tus"
+	"youtube-clone-platform/video-upload-service/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+// TusHandler implements the tus 1.0 resumable upload protocol
+type TusHandler struct {
+	store    *tus.FileStore
+	service  *service.UploadService
+	maxBytes int64
+	basePath string
+}
+
+// NewTusHandler creates a new resumable upload handler.
+// basePath is the route the uploads are mounted on and is used to build Location headers.
+func NewTusHandler(store *tus.FileStore, s *service.UploadService, maxBytes int64, basePath string) *TusHandler {
+	return &TusHandler{
+		store:    store,
+		service:  s,
+		maxBytes: maxBytes,
+		basePath: basePath,
+	}
+}
+
+// HandleOptions advertises the supported tus version and extensions
+func (h *TusHandler) HandleOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.maxBytes, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// HandleCreate creates a new resumable upload
+func (h *TusHandler) HandleCreate(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, &UploadError{
+			Code:    http.StatusBadRequest,
+			Message: "Upload-Length header is required",
+		})
+		return
+	}
+	if length > h.maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, &UploadError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: "upload too large",
+			Details: fmt.Sprintf("max size is %d bytes", h.maxBytes),
+		})
+		return
+	}
+
+	meta, err := tus.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &UploadError{
+			Code:    http.StatusBadRequest,
+			Message: "invalid Upload-Metadata header",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Get user ID and role (set by gateway in production), never trust a role sent by the client
+	meta["user_id"], meta["role"] = requestIdentity(c, meta["user_id"])
+
+	// The expected digest can be sent as a header or in the upload metadata
+	expected, err := expectedDigest(c, meta)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+	delete(meta, "sha256")
+	delete(meta, "md5")
+	if expected.SHA256 != "" {
+		meta["sha256"] = expected.SHA256
+	}
+	if expected.MD5 != "" {
+		meta["md5"] = expected.MD5
+	}
+
+	// Validate what we can before accepting any bytes
+	checks := []error{
+		validation.ValidateTitle(meta["title"]),
+		h.service.Policy().ValidateUserID(meta["user_id"]),
+		validation.ValidateFileSize(length),
+		h.service.Policy().ValidateFileSize(meta["role"], length),
+		validation.ValidateVideoExtension(meta["filename"], meta["filetype"]),
+	}
+	for _, err := range checks {
+		if err != nil {
+			c.JSON(http.StatusBadRequest, &UploadError{
+				Code:    http.StatusBadRequest,
+				Message: "validation failed",
+				Details: err.Error(),
+			})
+			return
+		}
+	}
+	if err := h.service.CheckQuota(c.Request.Context(), meta["user_id"], meta["role"], length); err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	upload, err := h.store.Create(length, meta)
+	if err != nil {
+		writeServiceError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", h.basePath+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// HandleHead returns the current offset of an upload
+func (h *TusHandler) HandleHead(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	upload, ok := h.ownUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if len(upload.Metadata) > 0 {
+		c.Header("Upload-Metadata", tus.EncodeMetadata(upload.Metadata))
+	}
+	if upload.Finalized {
+		c.Header("X-Video-ID", upload.ID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandlePatch appends a chunk to an upload. Once the final chunk has been
+// received the upload is finalized and handed to the regular upload pipeline.
+func (h *TusHandler) HandlePatch(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, &UploadError{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: "Content-Type must be application/offset+octet-stream",
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, &UploadError{
+			Code:    http.StatusBadRequest,
+			Message: "Upload-Offset header is required",
+		})
+		return
+	}
+
+	if _, ok := h.ownUpload(c); !ok {
+		return
+	}
+
+	id := c.Param("id")
+	upload, err := h.store.WriteChunk(id, offset, c.Request.Body)
+	if err != nil {
+		if upload != nil && errors.Is(err, tus.ErrOffsetMismatch) {
+			c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		}
+		h.writeStoreError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+
+	if upload.IsComplete() && !upload.Finalized {
+		result, err := h.finalize(c, upload)
+		if err != nil {
+			h.writeFinalizeError(c, err)
+			return
+		}
+		c.Header("X-Video-ID", result.VideoID)
+		if result.Warning != "" {
+			c.Header("X-Upload-Warning", result.Warning)
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleFinalize explicitly finalizes a fully received upload.
+// Clients use it to retry when finalization failed on the last PATCH.
+func (h *TusHandler) HandleFinalize(c *gin.Context) {
+	startTime := time.Now()
+
+	if !h.checkVersion(c) {
+		return
+	}
+
+	upload, ok := h.ownUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Finalized {
+		h.writeStoreError(c, tus.ErrFinalized)
+		return
+	}
+	if !upload.IsComplete() {
+		h.writeStoreError(c, tus.ErrIncomplete)
+		return
+	}
+
+	result, err := h.finalize(c, upload)
+	if err != nil {
+		h.writeFinalizeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, uploadResponse(result, upload.Metadata["title"], upload.Metadata["user_id"], startTime))
+}
+
+// HandleDelete terminates an upload and discards the received bytes
+func (h *TusHandler) HandleDelete(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if _, ok := h.ownUpload(c); !ok {
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.store.Lock(id); err != nil {
+		h.writeStoreError(c, err)
+		return
+	}
+	defer h.store.Unlock(id)
+
+	if err := h.store.Delete(id); err != nil {
+		h.writeStoreError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// finalize moves the assembled file into object storage and publishes the upload event
+func (h *TusHandler) finalize(c *gin.Context, upload *tus.Upload) (*service.UploadResult, error) {
+	if err := h.store.Lock(upload.ID); err != nil {
+		return nil, err
+	}
+	defer h.store.Unlock(upload.ID)
+
+	// Another request may have finalized the upload while we waited for the lock
+	current, err := h.store.Get(upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Finalized {
+		return nil, tus.ErrFinalized
+	}
+
+	result, err := h.service.CompleteUpload(
+		c.Request.Context(),
+		upload.ID,
+		upload.Metadata["user_id"],
+		upload.Metadata["role"],
+		upload.Metadata["title"],
+		h.store.DataPath(upload.ID),
+		upload.Metadata["filetype"],
+		upload.Metadata["filename"],
+		checksum.Expected{SHA256: upload.Metadata["sha256"], MD5: upload.Metadata["md5"]},
+	)
+	if err != nil {
+		// Rejected videos can never be finalized, drop the received bytes right away
+		if _, rejected := validation.ValidationErrors(err); rejected || errors.Is(err, checksum.ErrMismatch) || errors.Is(err, dedup.ErrDuplicate) || errors.Is(err, quota.ErrQuotaExceeded) {
+			if delErr := h.store.Delete(upload.ID); delErr != nil {
+				fmt.Printf("Failed to delete rejected upload %s: %v\n", upload.ID, delErr)
+			}
+		}
+		return nil, err
+	}
+
+	if err := h.store.MarkFinalized(upload.ID); err != nil {
+		return nil, err
+	}
+	if err := h.store.RemoveData(upload.ID); err != nil {
+		fmt.Printf("Failed to remove data for finalized upload %s: %v\n", upload.ID, err)
+	}
+
+	return result, nil
+}
+
+// expectedDigest reads the digest the client expects from the request headers or the
+// "sha256"/"md5" upload metadata keys (hex encoded)
+func expectedDigest(c *gin.Context, meta map[string]string) (checksum.Expected, error) {
+	expected, err := checksum.ParseHeaders(c.Request.Header)
+	if err != nil {
+		return checksum.Expected{}, err
+	}
+
+	if expected.SHA256 == "" && meta["sha256"] != "" {
+		if expected.SHA256, err = checksum.ParseHex(meta["sha256"], sha256.Size); err != nil {
+			return checksum.Expected{}, &validation.ValidationError{Field: "digest", Message: "invalid sha256 metadata"}
+		}
+	}
+	if expected.MD5 == "" && meta["md5"] != "" {
+		if expected.MD5, err = checksum.ParseHex(meta["md5"], md5.Size); err != nil {
+			return checksum.Expected{}, &validation.ValidationError{Field: "digest", Message: "invalid md5 metadata"}
+		}
+	}
+
+	return expected, nil
+}
+
+// ownUpload loads the upload of the request, it reports whether the upload exists and belongs to the caller
+func (h *TusHandler) ownUpload(c *gin.Context) (*tus.Upload, bool) {
+	upload, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		h.writeStoreError(c, err)
+		return nil, false
+	}
+	if !ownsUpload(c, upload.Metadata["user_id"]) {
+		c.Header("Tus-Resumable", tusVersion)
+		// HEAD responses must not carry a body
+		if c.Request.Method == http.MethodHead {
+			c.Status(http.StatusForbidden)
+		} else {
+			writeUploadForbidden(c)
+		}
+		return nil, false
+	}
+	return upload, true
+}
+
+// checkVersion rejects requests that do not speak a supported tus version
+func (h *TusHandler) checkVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, &UploadError{
+			Code:    http.StatusPreconditionFailed,
+			Message: "unsupported tus version",
+			Details: fmt.Sprintf("Tus-Resumable must be %s", tusVersion),
+		})
+		return false
+	}
+	return true
+}
+
+// writeFinalizeError reports a failed finalization. Unless the video was rejected the received
+// bytes are kept so it can be retried.
+func (h *TusHandler) writeFinalizeError(c *gin.Context, err error) {
+	if errors.Is(err, tus.ErrLocked) || errors.Is(err, tus.ErrFinalized) || errors.Is(err, tus.ErrNotFound) {
+		h.writeStoreError(c, err)
+		return
+	}
+	writeServiceError(c, err)
+}
+
+// writeStoreError maps upload store errors to tus status codes
+func (h *TusHandler) writeStoreError(c *gin.Context, err error) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, tus.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, tus.ErrExpired):
+		status = http.StatusGone
+	case errors.Is(err, tus.ErrOffsetMismatch), errors.Is(err, tus.ErrIncomplete), errors.Is(err, tus.ErrFinalized):
+		status = http.StatusConflict
+	case errors.Is(err, tus.ErrLocked):
+		status = http.StatusLocked
+	case errors.Is(err, tus.ErrSizeExceeded):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		status = http.StatusBadRequest
+	}
+
+	// HEAD responses must not carry a body
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+
+	c.JSON(status, &UploadError{
+		Code:    status,
+		Message: err.Error(),
+	})
+}
@@ -4,8 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"youtube-clone-platform/video-upload-service/internal/checksum"
+	"youtube-clone-platform/video-upload-service/internal/dedup"
+	"youtube-clone-platform/video-upload-service/internal/policy"
+	"youtube-clone-platform/video-upload-service/internal/quota"
 	"youtube-clone-platform/video-upload-service/internal/service"
 	"youtube-clone-platform/video-upload-service/internal/validation"
 
@@ -21,9 +27,16 @@ func NewUploadHandler(s *service.UploadService) *UploadHandler {
 }
 
 type UploadError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code    int                           `json:"code"`
+	Message string                        `json:"message"`
+	Details string                        `json:"details,omitempty"`
+	Errors  []*validation.ValidationError `json:"errors,omitempty"`
+
+	// ExistingVideoID is set when the upload was rejected as a duplicate of one of the uploader's videos
+	ExistingVideoID string `json:"existing_video_id,omitempty"`
+
+	// ErrorCode identifies the quota that was exceeded
+	ErrorCode string `json:"error_code,omitempty"`
 }
 
 func (e *UploadError) Error() string {
@@ -33,6 +46,16 @@ func (e *UploadError) Error() string {
 func (h *UploadHandler) HandleUpload(c *gin.Context) {
 	startTime := time.Now()
 
+	// Reading the form buffers the whole file, users over their quota are turned away before that.
+	// The body is a little larger than the file, the exact size is checked again once it is known.
+	if c.GetHeader("X-User-ID") != "" && c.Request.ContentLength > 0 {
+		userID, role := requestIdentity(c, "")
+		if err := h.service.CheckQuota(c.Request.Context(), userID, role, c.Request.ContentLength); err != nil {
+			writeServiceError(c, err)
+			return
+		}
+	}
+
 	// Get video title from form
 	title := c.PostForm("title")
 	if title == "" {
@@ -43,10 +66,14 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from form (will be set by gateway in production)
-	userID := c.PostForm("user_id")
-	if userID == "" {
-		userID = "anonymous" // Default value if not provided
+	// Get user ID and role (set by gateway in production)
+	userID, role := requestIdentity(c, c.PostForm("user_id"))
+
+	// Get the digest the client expects, if any
+	expected, err := checksum.ParseHeaders(c.Request.Header)
+	if err != nil {
+		writeServiceError(c, err)
+		return
 	}
 
 	// Get the video file
@@ -82,40 +109,73 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 	result, err := h.service.HandleUpload(
 		c.Request.Context(),
 		userID,
+		role,
 		title,
 		file,
 		header.Size,
 		header.Header.Get("Content-Type"),
 		header.Filename,
+		expected,
 	)
 	if err != nil {
-		var uploadErr *UploadError
-		if errors.As(err, &uploadErr) {
-			c.JSON(uploadErr.Code, uploadErr)
-			return
-		}
+		writeServiceError(c, err)
+		return
+	}
 
-		var validationErr *validation.ValidationError
-		if errors.As(err, &validationErr) {
-			c.JSON(http.StatusBadRequest, &UploadError{
-				Code:    http.StatusBadRequest,
-				Message: "validation failed",
-				Details: validationErr.Error(),
-			})
-			return
-		}
+	c.JSON(http.StatusOK, uploadResponse(result, title, userID, startTime))
+}
 
-		// Log the error for debugging
-		fmt.Printf("Upload error: %v\n", err)
+// HandleQuota returns the usage of the requesting user against their quotas
+func (h *UploadHandler) HandleQuota(c *gin.Context) {
+	userID, role := requestIdentity(c, c.Query("user_id"))
 
-		c.JSON(http.StatusInternalServerError, &UploadError{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to process upload",
-			Details: "an unexpected error occurred",
-		})
+	report, err := h.service.QuotaReport(c.Request.Context(), userID, role)
+	if err != nil {
+		writeServiceError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, report)
+}
+
+// requestIdentity returns the uploading user and their role. The gateway forwards both from the
+// access token as X-User-ID and X-User-Role; fallbackUserID is used when the service is called directly.
+func requestIdentity(c *gin.Context, fallbackUserID string) (string, string) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		userID = fallbackUserID
+	}
+	if userID == "" {
+		userID = "anonymous" // Default value if not provided
+	}
+
+	role := c.GetHeader("X-User-Role")
+	if role == "" {
+		role = policy.DefaultRole
+	}
+
+	return userID, role
+}
+
+// ownsUpload reports whether the caller started an upload of userID or is an admin
+func ownsUpload(c *gin.Context, userID string) bool {
+	if strings.EqualFold(c.GetHeader("X-User-Role"), AdminRole) {
+		return true
+	}
+	callerID, _ := requestIdentity(c, "")
+	return callerID == userID
+}
+
+// writeUploadForbidden rejects access to an upload of another user
+func writeUploadForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, &UploadError{
+		Code:    http.StatusForbidden,
+		Message: "upload belongs to another user",
+	})
+}
+
+// uploadResponse builds the JSON body returned once an upload has been processed
+func uploadResponse(result *service.UploadResult, title string, userID string, startTime time.Time) gin.H {
 	// Calculate processing time
 	processingTime := time.Since(startTime)
 
@@ -135,5 +195,99 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		response["metadata"] = result.Metadata
 	}
 
-	c.JSON(http.StatusOK, response)
+	if result.DuplicateOf != "" {
+		response["duplicate_of"] = result.DuplicateOf
+	}
+
+	return response
+}
+
+// writeServiceError maps an error returned by the upload service to an HTTP response
+func writeServiceError(c *gin.Context, err error) {
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) {
+		c.JSON(uploadErr.Code, uploadErr)
+		return
+	}
+
+	// Upload is larger than the service accepts at all
+	if errors.Is(err, service.ErrFileTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, &UploadError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: "upload too large",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Same content was already uploaded and duplicates are rejected
+	var duplicateErr *dedup.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		c.JSON(http.StatusConflict, &UploadError{
+			Code:            http.StatusConflict,
+			Message:         "duplicate upload",
+			Details:         err.Error(),
+			ExistingVideoID: duplicateErr.ExistingVideoID,
+		})
+		return
+	}
+
+	// Upload would exceed a user quota, the daily upload count frees up by itself
+	var quotaErr *quota.ExceededError
+	if errors.As(err, &quotaErr) {
+		status := http.StatusRequestEntityTooLarge
+		if quotaErr.RetryAfter > 0 {
+			status = http.StatusTooManyRequests
+			c.Header("Retry-After", strconv.Itoa(int(quotaErr.RetryAfter.Seconds())))
+		}
+		c.JSON(status, &UploadError{
+			Code:      status,
+			Message:   "quota exceeded",
+			Details:   quotaErr.Error(),
+			ErrorCode: quotaErr.Code,
+		})
+		return
+	}
+
+	// Stored bytes do not match the digest sent by the client
+	if errors.Is(err, checksum.ErrMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, &UploadError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "checksum mismatch",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Videos rejected after inspecting their metadata
+	var metadataErr *validation.MetadataError
+	if errors.As(err, &metadataErr) {
+		c.JSON(http.StatusUnprocessableEntity, &UploadError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "video rejected by upload policy",
+			Details: metadataErr.Error(),
+			Errors:  metadataErr.Errors,
+		})
+		return
+	}
+
+	var validationErr *validation.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, &UploadError{
+			Code:    http.StatusBadRequest,
+			Message: "validation failed",
+			Details: validationErr.Error(),
+			Errors:  []*validation.ValidationError{validationErr},
+		})
+		return
+	}
+
+	// Log the error for debugging
+	fmt.Printf("Upload error: %v\n", err)
+
+	c.JSON(http.StatusInternalServerError, &UploadError{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to process upload",
+		Details: "an unexpected error occurred",
+	})
 }
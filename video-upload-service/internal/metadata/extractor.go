@@ -20,6 +20,8 @@ type VideoMetadata struct {
 	Bitrate           int64   `json:"bitrate"`
 	FileSize          int64   `json:"file_size"`
 	Checksum          string  `json:"checksum"`
+	ChecksumAlgorithm string  `json:"checksum_algorithm,omitempty"`
+	MD5               string  `json:"md5,omitempty"`
 	CreatedAt         string  `json:"created_at"`
 	Codec             string  `json:"codec"`
 	FrameRate         float64 `json:"frame_rate"`
@@ -31,6 +33,19 @@ type VideoMetadata struct {
 	OriginalFilename  string  `json:"original_filename"`
 	FileExtension     string  `json:"file_extension"`
 	SanitizedFilename string  `json:"sanitized_filename"`
+	// AudioTracks are all audio streams, the Audio fields describe the first one
+	AudioTracks []AudioTrack `json:"audio_tracks,omitempty"`
+}
+
+// AudioTrack is an audio stream of a video, like a dubbed language or a commentary track
+type AudioTrack struct {
+	// Index is the index of the stream among the audio streams
+	Index    int    `json:"index"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	// Language is the language tag of the stream, usually ISO 639-2 like eng, empty if it is not tagged
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
 }
 
 type ffprobeFormat struct {
@@ -44,21 +59,22 @@ type ffprobeFormat struct {
 }
 
 type ffprobeStream struct {
-	CodecType          string `json:"codec_type"`
-	CodecName          string `json:"codec_name"`
-	Width              int    `json:"width"`
-	Height             int    `json:"height"`
-	RFrameRate         string `json:"r_frame_rate"`
-	Channels           int    `json:"channels"`
-	BitRate            string `json:"bit_rate"`
-	SampleRate         string `json:"sample_rate"`
-	DisplayAspectRatio string `json:"display_aspect_ratio"`
-	Profile            string `json:"profile"`
-	Level              int    `json:"level"`
-	PixFmt             string `json:"pix_fmt"`
-	ColorSpace         string `json:"color_space"`
-	ColorRange         string `json:"color_range"`
-	Index              int    `json:"index"`
+	CodecType          string            `json:"codec_type"`
+	CodecName          string            `json:"codec_name"`
+	Width              int               `json:"width"`
+	Height             int               `json:"height"`
+	RFrameRate         string            `json:"r_frame_rate"`
+	Channels           int               `json:"channels"`
+	BitRate            string            `json:"bit_rate"`
+	SampleRate         string            `json:"sample_rate"`
+	DisplayAspectRatio string            `json:"display_aspect_ratio"`
+	Profile            string            `json:"profile"`
+	Level              int               `json:"level"`
+	PixFmt             string            `json:"pix_fmt"`
+	ColorSpace         string            `json:"color_space"`
+	ColorRange         string            `json:"color_range"`
+	Index              int               `json:"index"`
+	Tags               map[string]string `json:"tags"`
 }
 
 type ffprobeOutput struct {
@@ -74,20 +90,40 @@ func runCommandWithTimeout(parentCtx context.Context, timeout time.Duration, nam
 	return cmd.Output()
 }
 
-// ExtractMetadata extracts metadata from a video file using ffprobe with retries
+// ExtractMetadata extracts metadata from a video file using ffprobe with retries.
+// filePath may also be an http(s) URL. The checksum is computed by the caller while the upload streams.
+// The MP4/MOV or WebM/Matroska headers are also parsed natively: they fill in what ffprobe could not
+// determine and are used on their own when ffprobe is missing or keeps failing.
 func ExtractMetadata(ctx context.Context, filePath string) (*VideoMetadata, error) {
+	probed, probeErr := ProbeContainer(ctx, filePath)
+
+	// Retrying will not make ffprobe appear
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		if probeErr != nil {
+			return nil, fmt.Errorf("ffprobe not found (%v) and container probe failed: %w", err, probeErr)
+		}
+		return probed, nil
+	}
+
 	const maxRetries = 3
 	var lastErr error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		metadata, err := extractMetadataOnce(ctx, filePath)
 		if err == nil {
+			if probeErr == nil {
+				crossCheck(metadata, probed)
+			}
 			return metadata, nil
 		}
 		lastErr = err
 		time.Sleep(time.Duration(attempt+1) * time.Second)
 	}
 
+	if probeErr == nil {
+		return probed, nil
+	}
+
 	return nil, fmt.Errorf("failed after %d attempts: %w", maxRetries, lastErr)
 }
 
@@ -102,7 +138,14 @@ func extractMetadataOnce(ctx context.Context, filePath string) (*VideoMetadata,
 	fileExtension := filepath.Ext(originalFilename)
 	sanitizedFilename := SanitizeFilename(originalFilename)
 
-	output, err := runCommandWithTimeout(ctx, 5*time.Second,
+	// Probing over HTTP needs range requests and takes longer than a local file
+	remote := isRemote(filePath)
+	probeTimeout := 5 * time.Second
+	if remote {
+		probeTimeout = 30 * time.Second
+	}
+
+	output, err := runCommandWithTimeout(ctx, probeTimeout,
 		"ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", filePath)
 
 	if err != nil {
@@ -127,12 +170,16 @@ func extractMetadataOnce(ctx context.Context, filePath string) (*VideoMetadata,
 	// Find video and audio streams
 	var videoStream *ffprobeStream
 	var audioStream *ffprobeStream
+	var audioTracks []AudioTrack
 	for i := range ffprobe.Streams {
 		stream := ffprobe.Streams[i]
 		if stream.CodecType == "video" && videoStream == nil {
 			videoStream = &stream
-		} else if stream.CodecType == "audio" && audioStream == nil {
-			audioStream = &stream
+		} else if stream.CodecType == "audio" {
+			if audioStream == nil {
+				audioStream = &stream
+			}
+			audioTracks = append(audioTracks, newAudioTrack(len(audioTracks), stream))
 		}
 	}
 
@@ -174,21 +221,8 @@ func extractMetadataOnce(ctx context.Context, filePath string) (*VideoMetadata,
 	// Get aspect ratio
 	aspectRatio := videoStream.DisplayAspectRatio
 	if aspectRatio == "" {
-		if videoStream.Width > 0 && videoStream.Height > 0 {
-			gcd := greatestCommonDivisor(videoStream.Width, videoStream.Height)
-			aspectRatio = fmt.Sprintf("%d:%d", videoStream.Width/gcd, videoStream.Height/gcd)
-		} else {
-			aspectRatio = "unknown"
-		}
-	}
-
-	// Calculate checksum (MD5)
-	checksumOutput, err := runCommandWithTimeout(ctx, 3*time.Second, "md5sum", filePath)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+		aspectRatio = aspectRatioOf(videoStream.Width, videoStream.Height)
 	}
-	checksum := strings.Fields(string(checksumOutput))[0]
 
 	// Parse audio metadata
 	audioBitrate := int64(0)
@@ -212,7 +246,6 @@ func extractMetadataOnce(ctx context.Context, filePath string) (*VideoMetadata,
 		Format:            ffprobe.Format.FormatName,
 		Bitrate:           bitrate,
 		FileSize:          size,
-		Checksum:          checksum,
 		CreatedAt:         time.Now().UTC().Format(time.RFC3339),
 		Codec:             videoStream.CodecName,
 		FrameRate:         frameRate,
@@ -224,9 +257,30 @@ func extractMetadataOnce(ctx context.Context, filePath string) (*VideoMetadata,
 		OriginalFilename:  originalFilename,
 		FileExtension:     fileExtension,
 		SanitizedFilename: sanitizedFilename,
+		AudioTracks:       audioTracks,
 	}, nil
 }
 
+// newAudioTrack describes the audio stream with the given index among the audio streams. Streams
+// tagged und have no language.
+func newAudioTrack(index int, stream ffprobeStream) AudioTrack {
+	language := strings.ToLower(strings.TrimSpace(stream.Tags["language"]))
+	if language == "und" {
+		language = ""
+	}
+	return AudioTrack{
+		Index:    index,
+		Codec:    stream.CodecName,
+		Channels: stream.Channels,
+		Language: language,
+		Title:    strings.TrimSpace(stream.Tags["title"]),
+	}
+}
+
+func isRemote(filePath string) bool {
+	return strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://")
+}
+
 func determineContentType(format, codec string) string {
 	format = strings.ToLower(format)
 	codec = strings.ToLower(codec)
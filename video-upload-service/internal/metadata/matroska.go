@@ -0,0 +1,299 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// EBML element IDs used by the Matroska probe
+const (
+	ebmlIDHeader         = 0x1a45dfa3
+	mkvIDSegment         = 0x18538067
+	mkvIDInfo            = 0x1549a966
+	mkvIDTimestampScale  = 0x2ad7b1
+	mkvIDDuration        = 0x4489
+	mkvIDTracks          = 0x1654ae6b
+	mkvIDTrackEntry      = 0xae
+	mkvIDTrackType       = 0x83
+	mkvIDCodecID         = 0x86
+	mkvIDDefaultDuration = 0x23e383
+	mkvIDVideo           = 0xe0
+	mkvIDPixelWidth      = 0xb0
+	mkvIDPixelHeight     = 0xba
+	mkvIDAudio           = 0xe1
+	mkvIDSamplingFreq    = 0xb5
+	mkvIDChannels        = 0x9f
+)
+
+const (
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+
+	// maxMatroskaHeaderSize limits how much of the info and tracks elements is read into memory
+	maxMatroskaHeaderSize = 16 * 1024 * 1024
+)
+
+// unknownSize marks an element whose size is not known, e.g. a live stream cluster
+const unknownSize = math.MaxUint64
+
+// matroskaCodecs maps Matroska codec IDs to ffprobe codec names
+var matroskaCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_AV1":            "av1",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MPEG2":          "mpeg2video",
+	"V_MJPEG":          "mjpeg",
+	"V_PRORES":         "prores",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_AAC":            "aac",
+	"A_MPEG/L3":        "mp3",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_FLAC":           "flac",
+	"A_PCM/INT/LIT":    "pcm_s16le",
+	"A_PCM/INT/BIG":    "pcm_s16be",
+}
+
+// ebmlElement is the header of an EBML element
+type ebmlElement struct {
+	id         uint64
+	dataOffset int64
+	size       uint64
+}
+
+// probeMatroska reads the segment info and tracks of a WebM/Matroska file.
+// Reading stops at the first cluster once both are known, the media data is never read.
+func probeMatroska(r io.ReaderAt, size int64) (*containerInfo, error) {
+	header, err := readEBMLElement(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if header.id != ebmlIDHeader || header.size == unknownSize {
+		return nil, fmt.Errorf("invalid EBML header")
+	}
+
+	segment, err := readEBMLElement(r, header.dataOffset+int64(header.size))
+	if err != nil {
+		return nil, err
+	}
+	if segment.id != mkvIDSegment {
+		return nil, fmt.Errorf("no matroska segment found")
+	}
+
+	end := size
+	if segment.size != unknownSize && segment.dataOffset+int64(segment.size) < end {
+		end = segment.dataOffset + int64(segment.size)
+	}
+
+	info := &containerInfo{format: formatMatroska}
+	timestampScale := uint64(1000000)
+	var duration float64
+	var haveInfo, haveTracks bool
+
+	for offset := segment.dataOffset; offset < end && !(haveInfo && haveTracks); {
+		element, err := readEBMLElement(r, offset)
+		if err != nil {
+			return nil, err
+		}
+		// Clusters of live recordings have no size, nothing useful can follow
+		if element.size == unknownSize {
+			break
+		}
+
+		switch element.id {
+		case mkvIDInfo, mkvIDTracks:
+			if element.size > maxMatroskaHeaderSize {
+				return nil, fmt.Errorf("matroska element too large: %d bytes", element.size)
+			}
+			if element.dataOffset+int64(element.size) > size {
+				return nil, fmt.Errorf("truncated matroska element")
+			}
+			data := make([]byte, element.size)
+			if _, err := r.ReadAt(data, element.dataOffset); err != nil {
+				return nil, fmt.Errorf("failed to read matroska element: %w", err)
+			}
+
+			if element.id == mkvIDInfo {
+				haveInfo = true
+				for _, child := range ebmlChildren(data) {
+					switch child.id {
+					case mkvIDTimestampScale:
+						timestampScale = ebmlUint(child.data)
+					case mkvIDDuration:
+						duration = ebmlFloat(child.data)
+					}
+				}
+			} else {
+				haveTracks = true
+				parseMatroskaTracks(data, info)
+			}
+		}
+
+		offset = element.dataOffset + int64(element.size)
+	}
+
+	if !haveTracks {
+		return nil, fmt.Errorf("no matroska tracks found")
+	}
+
+	info.duration = duration * float64(timestampScale) / 1e9
+
+	return info, nil
+}
+
+// parseMatroskaTracks keeps the first video and audio track
+func parseMatroskaTracks(data []byte, info *containerInfo) {
+	for _, entry := range ebmlChildren(data) {
+		if entry.id != mkvIDTrackEntry {
+			continue
+		}
+
+		var trackType uint64
+		var track trackInfo
+		for _, child := range ebmlChildren(entry.data) {
+			switch child.id {
+			case mkvIDTrackType:
+				trackType = ebmlUint(child.data)
+			case mkvIDCodecID:
+				codecID := string(child.data)
+				track.codec = matroskaCodecs[codecID]
+				if track.codec == "" {
+					track.codec = codecID
+				}
+			case mkvIDDefaultDuration:
+				if frameDuration := ebmlUint(child.data); frameDuration > 0 {
+					track.frameRate = 1e9 / float64(frameDuration)
+				}
+			case mkvIDVideo:
+				for _, video := range ebmlChildren(child.data) {
+					switch video.id {
+					case mkvIDPixelWidth:
+						track.width = int(ebmlUint(video.data))
+					case mkvIDPixelHeight:
+						track.height = int(ebmlUint(video.data))
+					}
+				}
+			case mkvIDAudio:
+				track.channels = 1 // Matroska default
+				for _, audio := range ebmlChildren(child.data) {
+					switch audio.id {
+					case mkvIDSamplingFreq:
+						track.sampleRate = int(ebmlFloat(audio.data))
+					case mkvIDChannels:
+						track.channels = int(ebmlUint(audio.data))
+					}
+				}
+			}
+		}
+
+		switch {
+		case trackType == mkvTrackTypeVideo && info.video == nil:
+			track.channels = 0
+			info.video = &track
+		case trackType == mkvTrackTypeAudio && info.audio == nil:
+			track.frameRate = 0
+			info.audio = &track
+		}
+	}
+}
+
+// readEBMLElement reads the ID and size of the element at offset
+func readEBMLElement(r io.ReaderAt, offset int64) (ebmlElement, error) {
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, offset)
+	if n == 0 && err != nil {
+		return ebmlElement{}, fmt.Errorf("failed to read EBML element: %w", err)
+	}
+
+	id, idLen, ok := ebmlVint(buf[:n], true)
+	if !ok {
+		return ebmlElement{}, fmt.Errorf("invalid EBML element ID at offset %d", offset)
+	}
+	size, sizeLen, ok := ebmlVint(buf[idLen:n], false)
+	if !ok {
+		return ebmlElement{}, fmt.Errorf("invalid EBML element size at offset %d", offset)
+	}
+
+	return ebmlElement{id: id, dataOffset: offset + int64(idLen+sizeLen), size: size}, nil
+}
+
+// ebmlChild is an element parsed from an in-memory master element
+type ebmlChild struct {
+	id   uint64
+	data []byte
+}
+
+// ebmlChildren splits the payload of a master element into its children
+func ebmlChildren(data []byte) []ebmlChild {
+	var children []ebmlChild
+	for len(data) > 0 {
+		id, idLen, ok := ebmlVint(data, true)
+		if !ok {
+			return children
+		}
+		size, sizeLen, ok := ebmlVint(data[idLen:], false)
+		if !ok {
+			return children
+		}
+		start := uint64(idLen + sizeLen)
+		if size == unknownSize || size > uint64(len(data))-start {
+			return children
+		}
+
+		children = append(children, ebmlChild{id: id, data: data[start : start+size]})
+		data = data[start+size:]
+	}
+	return children
+}
+
+// ebmlVint decodes a variable length integer. IDs keep their length marker, sizes do not.
+// A size with all value bits set means the size is unknown.
+func ebmlVint(data []byte, keepMarker bool) (uint64, int, bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+	length := bits.LeadingZeros8(data[0]) + 1
+	if len(data) < length || (keepMarker && length > 4) {
+		return 0, 0, false
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xff >> length)
+	}
+	allOnes := value == uint64(0xff>>length)
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xff
+	}
+
+	if !keepMarker && allOnes {
+		return unknownSize, length, true
+	}
+	return value, length, true
+}
+
+func ebmlUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// ebmlUnknownSize is an 8 byte size with all value bits set
+var ebmlUnknownSize = []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// ebmlBytes builds an element with an 8 byte size
+func ebmlBytes(id uint64, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(data)))
+	size[0] = 0x01
+	return bytes.Join([][]byte{ebmlIDBytes(id), size, data}, nil)
+}
+
+// ebmlOpenBytes builds an element of unknown size
+func ebmlOpenBytes(id uint64, payload ...[]byte) []byte {
+	return bytes.Join([][]byte{ebmlIDBytes(id), ebmlUnknownSize, bytes.Join(payload, nil)}, nil)
+}
+
+// ebmlIDBytes returns an element ID, which keeps its length marker, without leading zero bytes
+func ebmlIDBytes(id uint64) []byte {
+	data := binary.BigEndian.AppendUint64(nil, id)
+	return bytes.TrimLeft(data, "\x00")
+}
+
+func ebmlUintBytes(id uint64, value uint64) []byte {
+	return ebmlBytes(id, bytes.TrimLeft(binary.BigEndian.AppendUint64(nil, value), "\x00"))
+}
+
+func ebmlFloatBytes(id uint64, value float64) []byte {
+	return ebmlBytes(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+func TestProbeMatroska(t *testing.T) {
+	header := ebmlBytes(ebmlIDHeader, ebmlBytes(0x4282, []byte("webm")))
+	info := ebmlBytes(mkvIDInfo,
+		ebmlUintBytes(mkvIDTimestampScale, 1000000),
+		ebmlFloatBytes(mkvIDDuration, 2000),
+	)
+	tracks := ebmlBytes(mkvIDTracks,
+		ebmlBytes(mkvIDTrackEntry,
+			ebmlUintBytes(mkvIDTrackType, mkvTrackTypeVideo),
+			ebmlBytes(mkvIDCodecID, []byte("V_VP9")),
+			ebmlUintBytes(mkvIDDefaultDuration, 40000000),
+			ebmlBytes(mkvIDVideo,
+				ebmlUintBytes(mkvIDPixelWidth, 1920),
+				ebmlUintBytes(mkvIDPixelHeight, 1080),
+			),
+		),
+		ebmlBytes(mkvIDTrackEntry,
+			ebmlUintBytes(mkvIDTrackType, mkvTrackTypeAudio),
+			ebmlBytes(mkvIDCodecID, []byte("A_OPUS")),
+			ebmlBytes(mkvIDAudio,
+				ebmlFloatBytes(mkvIDSamplingFreq, 48000),
+				ebmlUintBytes(mkvIDChannels, 2),
+			),
+		),
+	)
+	cluster := ebmlBytes(0x1f43b675, make([]byte, 64))
+	openCluster := ebmlOpenBytes(0x1f43b675, make([]byte, 64))
+
+	video := &trackInfo{codec: "vp9", width: 1920, height: 1080, frameRate: 25}
+	audio := &trackInfo{codec: "opus", channels: 2, sampleRate: 48000}
+	want := &containerInfo{format: formatMatroska, duration: 2, video: video, audio: audio}
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    *containerInfo
+		wantErr bool
+	}{
+		{
+			name: "info and tracks before clusters",
+			file: bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, info, tracks, cluster)}, nil),
+			want: want,
+		},
+		{
+			name: "segment of unknown size",
+			file: bytes.Join([][]byte{header, ebmlOpenBytes(mkvIDSegment, info, tracks, openCluster)}, nil),
+			want: want,
+		},
+		{
+			name: "tracks after a cluster",
+			file: bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, info, cluster, tracks)}, nil),
+			want: want,
+		},
+		{
+			name:    "tracks after a cluster of unknown size",
+			file:    bytes.Join([][]byte{header, ebmlOpenBytes(mkvIDSegment, info, openCluster, tracks)}, nil),
+			wantErr: true,
+		},
+		{
+			name: "no info",
+			file: bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, tracks)}, nil),
+			want: &containerInfo{format: formatMatroska, video: video, audio: audio},
+		},
+		{
+			name:    "no tracks",
+			file:    bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, info, cluster)}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "truncated tracks",
+			file:    bytes.Join([][]byte{header, ebmlOpenBytes(mkvIDSegment, info, tracks[:len(tracks)-10])}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "tracks larger than the file",
+			file:    bytes.Join([][]byte{header, ebmlOpenBytes(mkvIDSegment, ebmlIDBytes(mkvIDTracks), []byte{0x01, 0, 0, 0, 0, 0xff, 0, 0})}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "header of unknown size",
+			file:    bytes.Join([][]byte{ebmlOpenBytes(ebmlIDHeader), ebmlBytes(mkvIDSegment, info, tracks)}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "no segment",
+			file:    bytes.Join([][]byte{header, info, tracks}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "invalid element ID",
+			file:    bytes.Join([][]byte{header, ebmlOpenBytes(mkvIDSegment, info, []byte{0x00, 0x81})}, nil),
+			wantErr: true,
+		},
+		{
+			name: "track entry of unknown size",
+			file: bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, info, ebmlBytes(mkvIDTracks,
+				ebmlOpenBytes(mkvIDTrackEntry, ebmlUintBytes(mkvIDTrackType, mkvTrackTypeVideo)),
+			))}, nil),
+			want: &containerInfo{format: formatMatroska, duration: 2},
+		},
+		{
+			name: "child past the end of its parent",
+			file: bytes.Join([][]byte{header, ebmlBytes(mkvIDSegment, info, ebmlBytes(mkvIDTracks,
+				ebmlIDBytes(mkvIDTrackEntry), []byte{0x01, 0, 0, 0, 0, 0, 0x10, 0},
+			))}, nil),
+			want: &containerInfo{format: formatMatroska, duration: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeContainer(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("probeContainer() = %s, want error", formatContainerInfo(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeContainer() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("probeContainer() = %s, want %s", formatContainerInfo(got), formatContainerInfo(tt.want))
+			}
+		})
+	}
+}
+
+func TestEBMLVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		keepMarker bool
+		want       uint64
+		wantLen    int
+		wantOK     bool
+	}{
+		{name: "1 byte size", data: []byte{0x82}, want: 2, wantLen: 1, wantOK: true},
+		{name: "2 byte size", data: []byte{0x40, 0x02}, want: 2, wantLen: 2, wantOK: true},
+		{name: "8 byte size", data: []byte{0x01, 0, 0, 0, 0, 0, 0x01, 0x00}, want: 256, wantLen: 8, wantOK: true},
+		{name: "1 byte unknown size", data: []byte{0xff}, want: unknownSize, wantLen: 1, wantOK: true},
+		{name: "8 byte unknown size", data: ebmlUnknownSize, want: unknownSize, wantLen: 8, wantOK: true},
+		{name: "4 byte ID", data: []byte{0x1a, 0x45, 0xdf, 0xa3}, keepMarker: true, want: ebmlIDHeader, wantLen: 4, wantOK: true},
+		{name: "all ones ID", data: []byte{0xff}, keepMarker: true, want: 0xff, wantLen: 1, wantOK: true},
+		{name: "5 byte ID", data: []byte{0x08, 0, 0, 0, 1}, keepMarker: true},
+		{name: "zero first byte", data: []byte{0x00, 0x81}},
+		{name: "truncated", data: []byte{0x40}},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, length, ok := ebmlVint(tt.data, tt.keepMarker)
+			if got != tt.want || length != tt.wantLen || ok != tt.wantOK {
+				t.Errorf("ebmlVint() = %d, %d, %t, want %d, %d, %t", got, length, ok, tt.want, tt.wantLen, tt.wantOK)
+			}
+		})
+	}
+}
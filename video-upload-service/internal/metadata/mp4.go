@@ -0,0 +1,312 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxMoovSize limits how much of the movie header is read into memory
+const maxMoovSize = 64 * 1024 * 1024
+
+// mp4Box is a box of an ISO base media (MP4/MOV) file
+type mp4Box struct {
+	typ  string
+	data []byte
+}
+
+// mp4Track is what a trak box tells about a track
+type mp4Track struct {
+	handler  string
+	duration float64
+	info     trackInfo
+}
+
+func isMP4BoxType(typ []byte) bool {
+	switch string(typ) {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// mp4Codecs maps sample entry types to ffprobe codec names
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"av01": "av1",
+	"mp4v": "mpeg4",
+	"s263": "h263",
+	"jpeg": "mjpeg",
+	"apch": "prores",
+	"apcn": "prores",
+	"apcs": "prores",
+	"apco": "prores",
+	"ap4h": "prores",
+	"mp4a": "aac",
+	"Opus": "opus",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"fLaC": "flac",
+	"alac": "alac",
+	".mp3": "mp3",
+	"sowt": "pcm_s16le",
+	"twos": "pcm_s16be",
+	"lpcm": "pcm_s16le",
+}
+
+// probeMP4 walks the top level boxes up to the moov box and parses it
+func probeMP4(r io.ReaderAt, size int64) (*containerInfo, error) {
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("failed to read box header: %w", err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0: // box extends to the end of the file
+			boxSize = size - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("failed to read box header: %w", err)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return nil, fmt.Errorf("invalid %q box size %d", typ, boxSize)
+		}
+
+		if typ == "moov" {
+			if boxSize > maxMoovSize || offset+boxSize > size {
+				return nil, fmt.Errorf("invalid moov box size %d", boxSize)
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := r.ReadAt(moov, offset+headerSize); err != nil {
+				return nil, fmt.Errorf("failed to read moov box: %w", err)
+			}
+			return parseMoov(moov), nil
+		}
+
+		offset += boxSize
+	}
+
+	return nil, fmt.Errorf("no moov box found")
+}
+
+// parseMoov reads the movie duration and the first video and audio track
+func parseMoov(data []byte) *containerInfo {
+	info := &containerInfo{format: formatMP4}
+
+	var timescale uint64
+	var longest float64
+	for _, box := range mp4Children(data) {
+		switch box.typ {
+		case "mvhd":
+			var duration uint64
+			timescale, duration = parseTimescaleDuration(box.data, 12)
+			if timescale > 0 {
+				info.duration = float64(duration) / float64(timescale)
+			}
+		case "mvex":
+			// Fragmented files may only carry their duration in the movie extends header
+			if mehd := mp4Child(box.data, "mehd"); mehd != nil && info.duration == 0 && timescale > 0 {
+				if duration, ok := mp4VersionedUint(mehd, 4); ok {
+					info.duration = float64(duration) / float64(timescale)
+				}
+			}
+		case "trak":
+			track := parseTrak(box.data)
+			if track.duration > longest {
+				longest = track.duration
+			}
+			switch {
+			case track.handler == "vide" && info.video == nil:
+				info.video = &track.info
+			case track.handler == "soun" && info.audio == nil:
+				info.audio = &track.info
+			}
+		}
+	}
+
+	if info.duration == 0 {
+		info.duration = longest
+	}
+
+	return info
+}
+
+// parseTrak reads the handler, duration, codec and dimensions of a track
+func parseTrak(data []byte) mp4Track {
+	var track mp4Track
+
+	// Track header dimensions are 16.16 fixed point, used when the sample entry has none
+	if tkhd := mp4Child(data, "tkhd"); tkhd != nil {
+		offset := 76
+		if len(tkhd) > 0 && tkhd[0] == 1 {
+			offset = 88
+		}
+		if len(tkhd) >= offset+8 {
+			track.info.width = int(binary.BigEndian.Uint32(tkhd[offset:]) >> 16)
+			track.info.height = int(binary.BigEndian.Uint32(tkhd[offset+4:]) >> 16)
+		}
+	}
+
+	mdia := mp4Child(data, "mdia")
+	if mdia == nil {
+		return track
+	}
+
+	var timescale, duration uint64
+	if mdhd := mp4Child(mdia, "mdhd"); mdhd != nil {
+		timescale, duration = parseTimescaleDuration(mdhd, 12)
+		if timescale > 0 {
+			track.duration = float64(duration) / float64(timescale)
+		}
+	}
+	if hdlr := mp4Child(mdia, "hdlr"); len(hdlr) >= 12 {
+		track.handler = string(hdlr[8:12])
+	}
+
+	stbl := mp4Child(mp4Child(mdia, "minf"), "stbl")
+	if stbl == nil {
+		return track
+	}
+
+	if stsd := mp4Child(stbl, "stsd"); len(stsd) >= 16 {
+		entry := stsd[8:]
+		fourcc := string(entry[4:8])
+		track.info.codec = mp4Codecs[fourcc]
+		if track.info.codec == "" {
+			track.info.codec = fourcc
+		}
+
+		switch track.handler {
+		case "vide":
+			if len(entry) >= 36 {
+				if width := int(binary.BigEndian.Uint16(entry[32:])); width > 0 {
+					track.info.width = width
+				}
+				if height := int(binary.BigEndian.Uint16(entry[34:])); height > 0 {
+					track.info.height = height
+				}
+			}
+		case "soun":
+			if len(entry) >= 36 {
+				track.info.channels = int(binary.BigEndian.Uint16(entry[24:]))
+				track.info.sampleRate = int(binary.BigEndian.Uint32(entry[32:]) >> 16)
+			}
+		}
+	}
+
+	// Frame rate is the number of samples over the summed sample durations
+	if stts := mp4Child(stbl, "stts"); len(stts) >= 8 && timescale > 0 {
+		count := int(binary.BigEndian.Uint32(stts[4:]))
+		var samples, delta uint64
+		for i := 0; i < count && 8+i*8+8 <= len(stts); i++ {
+			n := uint64(binary.BigEndian.Uint32(stts[8+i*8:]))
+			samples += n
+			delta += n * uint64(binary.BigEndian.Uint32(stts[12+i*8:]))
+		}
+		if track.handler == "vide" && delta > 0 {
+			track.info.frameRate = float64(samples) * float64(timescale) / float64(delta)
+		}
+	}
+
+	// Bitrate is the total sample size over the track duration
+	if stsz := mp4Child(stbl, "stsz"); len(stsz) >= 12 && track.duration > 0 {
+		sampleSize := uint64(binary.BigEndian.Uint32(stsz[4:]))
+		count := int(binary.BigEndian.Uint32(stsz[8:]))
+		var total uint64
+		if sampleSize > 0 {
+			total = sampleSize * uint64(count)
+		} else {
+			for i := 0; i < count && 12+i*4+4 <= len(stsz); i++ {
+				total += uint64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+			}
+		}
+		track.info.bitrate = int64(float64(total*8) / track.duration)
+	}
+
+	return track
+}
+
+// parseTimescaleDuration reads the timescale and duration of a mvhd or mdhd box.
+// Version 0 boxes use 32-bit times, version 1 boxes 64-bit ones.
+func parseTimescaleDuration(data []byte, v0Offset int) (timescale uint64, duration uint64) {
+	if len(data) < 4 {
+		return 0, 0
+	}
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0
+		}
+		return uint64(binary.BigEndian.Uint32(data[20:])), binary.BigEndian.Uint64(data[24:])
+	}
+	if len(data) < v0Offset+8 {
+		return 0, 0
+	}
+	return uint64(binary.BigEndian.Uint32(data[v0Offset:])), uint64(binary.BigEndian.Uint32(data[v0Offset+4:]))
+}
+
+// mp4VersionedUint reads a field that is 32-bit in version 0 and 64-bit in version 1 boxes
+func mp4VersionedUint(data []byte, offset int) (uint64, bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+	if data[0] == 1 {
+		if len(data) < offset+8 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint64(data[offset:]), true
+	}
+	if len(data) < offset+4 {
+		return 0, false
+	}
+	return uint64(binary.BigEndian.Uint32(data[offset:])), true
+}
+
+// mp4Child returns the payload of the first child box of the given type
+func mp4Child(data []byte, typ string) []byte {
+	for _, box := range mp4Children(data) {
+		if box.typ == typ {
+			return box.data
+		}
+	}
+	return nil
+}
+
+// mp4Children splits a box payload into its child boxes
+func mp4Children(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		typ := string(data[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return boxes
+		}
+
+		boxes = append(boxes, mp4Box{typ: typ, data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes
+}
@@ -0,0 +1,184 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// mp4BoxBytes builds a box with a 32-bit size
+func mp4BoxBytes(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	return append(append(box, typ...), data...)
+}
+
+// mp4LargeBoxBytes builds a box with a 64-bit size
+func mp4LargeBoxBytes(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, typ...)
+	box = binary.BigEndian.AppendUint64(box, uint64(16+len(data)))
+	return append(box, data...)
+}
+
+// mp4OpenBoxBytes builds a box with size 0, which extends to the end of the file
+func mp4OpenBoxBytes(typ string, payload ...[]byte) []byte {
+	return append(append([]byte{0, 0, 0, 0}, typ...), bytes.Join(payload, nil)...)
+}
+
+// putUint32 returns a buffer of the given length with values written every 4 bytes from offset
+func putUint32(length, offset int, values ...uint32) []byte {
+	data := make([]byte, length)
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[offset+i*4:], v)
+	}
+	return data
+}
+
+// mp4SampleEntry builds the sample description of a track with a single sample entry
+func mp4SampleEntry(fourcc string, fields map[int]uint16) []byte {
+	entry := putUint32(36, 0, 36)
+	copy(entry[4:], fourcc)
+	for offset, value := range fields {
+		binary.BigEndian.PutUint16(entry[offset:], value)
+	}
+	return mp4BoxBytes("stsd", putUint32(8, 4, 1), entry)
+}
+
+// testMoov builds a movie with a 1280x720 H.264 track at 30 fps and a stereo AAC track, 2 seconds each
+func testMoov(mvhd []byte) []byte {
+	video := mp4BoxBytes("trak",
+		mp4BoxBytes("tkhd", putUint32(84, 76, 640<<16, 360<<16)),
+		mp4BoxBytes("mdia",
+			mp4BoxBytes("mdhd", putUint32(20, 12, 30000, 60000)),
+			mp4BoxBytes("hdlr", append(make([]byte, 8), "vide"...)),
+			mp4BoxBytes("minf", mp4BoxBytes("stbl",
+				mp4SampleEntry("avc1", map[int]uint16{32: 1280, 34: 720}),
+				mp4BoxBytes("stts", putUint32(16, 4, 1, 60, 1000)),
+				mp4BoxBytes("stsz", putUint32(20, 8, 2, 1000, 1000)),
+			)),
+		),
+	)
+	// The sample rate is 16.16 fixed point, its integer part is the upper half
+	audio := mp4BoxBytes("trak",
+		mp4BoxBytes("mdia",
+			mp4BoxBytes("mdhd", putUint32(20, 12, 48000, 96000)),
+			mp4BoxBytes("hdlr", append(make([]byte, 8), "soun"...)),
+			mp4BoxBytes("minf", mp4BoxBytes("stbl",
+				mp4SampleEntry("mp4a", map[int]uint16{24: 2, 32: 48000}),
+			)),
+		),
+	)
+
+	return bytes.Join([][]byte{mvhd, video, audio}, nil)
+}
+
+func TestProbeMP4(t *testing.T) {
+	ftyp := mp4BoxBytes("ftyp", []byte("isom"), make([]byte, 4))
+	mvhd := mp4BoxBytes("mvhd", putUint32(20, 12, 1000, 2000))
+	// Version 1 headers carry 64-bit times
+	mvhd64 := mp4BoxBytes("mvhd", append([]byte{1, 0, 0, 0}, putUint32(28, 16, 1000, 0, 2000)...))
+	moov := testMoov(mvhd)
+
+	video := &trackInfo{codec: "h264", width: 1280, height: 720, frameRate: 30, bitrate: 8000}
+	audio := &trackInfo{codec: "aac", channels: 2, sampleRate: 48000}
+	want := &containerInfo{format: formatMP4, duration: 2, video: video, audio: audio}
+
+	tests := []struct {
+		name    string
+		file    []byte
+		want    *containerInfo
+		wantErr bool
+	}{
+		{
+			name: "moov after ftyp",
+			file: bytes.Join([][]byte{ftyp, mp4BoxBytes("moov", moov)}, nil),
+			want: want,
+		},
+		{
+			name: "64-bit mdat before moov",
+			file: bytes.Join([][]byte{ftyp, mp4LargeBoxBytes("mdat", make([]byte, 64)), mp4BoxBytes("moov", moov)}, nil),
+			want: want,
+		},
+		{
+			name: "64-bit moov",
+			file: bytes.Join([][]byte{ftyp, mp4LargeBoxBytes("moov", moov)}, nil),
+			want: want,
+		},
+		{
+			name: "64-bit movie header times",
+			file: bytes.Join([][]byte{ftyp, mp4BoxBytes("moov", testMoov(mvhd64))}, nil),
+			want: want,
+		},
+		{
+			name: "moov with size 0",
+			file: bytes.Join([][]byte{ftyp, mp4OpenBoxBytes("moov", moov)}, nil),
+			want: want,
+		},
+		{
+			name:    "mdat with size 0 before moov",
+			file:    bytes.Join([][]byte{ftyp, mp4OpenBoxBytes("mdat", make([]byte, 64), mp4BoxBytes("moov", moov))}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "truncated moov",
+			file:    bytes.Join([][]byte{ftyp, mp4BoxBytes("moov", moov)}, nil)[:len(ftyp)+100],
+			wantErr: true,
+		},
+		{
+			name:    "truncated box header",
+			file:    bytes.Join([][]byte{ftyp, {0, 0, 1}}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "box smaller than its header",
+			file:    bytes.Join([][]byte{ftyp, {0, 0, 0, 4}, []byte("free")}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "64-bit size smaller than its header",
+			file:    bytes.Join([][]byte{ftyp, {0, 0, 0, 1}, []byte("mdat"), make([]byte, 7), {8}}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "64-bit size past the end of the file",
+			file:    bytes.Join([][]byte{ftyp, {0, 0, 0, 1}, []byte("moov"), {0x7f}, make([]byte, 7)}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "no moov",
+			file:    bytes.Join([][]byte{ftyp, mp4BoxBytes("mdat", make([]byte, 64))}, nil),
+			wantErr: true,
+		},
+		{
+			name: "truncated track",
+			file: bytes.Join([][]byte{ftyp, mp4BoxBytes("moov", mvhd, mp4BoxBytes("trak", moov[len(mvhd)+8:len(mvhd)+64]))}, nil),
+			want: &containerInfo{format: formatMP4, duration: 2},
+		},
+		{
+			name: "child box past the end of its parent",
+			file: bytes.Join([][]byte{ftyp, mp4BoxBytes("moov", mvhd, []byte{0, 0, 1, 0}, []byte("trak"))}, nil),
+			want: &containerInfo{format: formatMP4, duration: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeContainer(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("probeContainer() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeContainer() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("probeContainer() = %s, want %s", formatContainerInfo(got), formatContainerInfo(tt.want))
+			}
+		})
+	}
+}
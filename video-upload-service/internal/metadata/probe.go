@@ -0,0 +1,250 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container formats as reported by ffprobe, so policy checks work the same for both probes
+const (
+	formatMP4      = "mov,mp4,m4a,3gp,3g2,mj2"
+	formatMatroska = "matroska,webm"
+)
+
+var ErrUnsupportedContainer = errors.New("unsupported container")
+
+// containerInfo is what the native container probe found out about a file
+type containerInfo struct {
+	format   string
+	duration float64
+	video    *trackInfo
+	audio    *trackInfo
+}
+
+// trackInfo describes the first video or audio track of a container
+type trackInfo struct {
+	codec      string
+	width      int
+	height     int
+	frameRate  float64
+	channels   int
+	sampleRate int
+	bitrate    int64
+}
+
+// ProbeContainer reads duration, dimensions, codecs, frame rate and audio info straight from the
+// MP4/MOV or WebM/Matroska headers of a file, without ffprobe. filePath may also be an http(s) URL
+// that supports range requests.
+func ProbeContainer(ctx context.Context, filePath string) (*VideoMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var (
+		r    io.ReaderAt
+		size int64
+	)
+	if isRemote(filePath) {
+		remote, err := newHTTPReaderAt(ctx, filePath)
+		if err != nil {
+			return nil, err
+		}
+		r, size = remote, remote.size
+	} else {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		r, size = file, stat.Size()
+	}
+
+	info, err := probeContainer(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if info.video == nil {
+		return nil, fmt.Errorf("no video stream found in file")
+	}
+
+	return info.toMetadata(filePath, size), nil
+}
+
+// probeContainer detects the container from its magic bytes and parses its headers
+func probeContainer(r io.ReaderAt, size int64) (*containerInfo, error) {
+	header := make([]byte, 12)
+	if _, err := r.ReadAt(header, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read container header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(header[:4], []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return probeMatroska(r, size)
+	case isMP4BoxType(header[4:8]):
+		return probeMP4(r, size)
+	default:
+		return nil, ErrUnsupportedContainer
+	}
+}
+
+// toMetadata converts the probe result to VideoMetadata
+func (c *containerInfo) toMetadata(filePath string, size int64) *VideoMetadata {
+	originalFilename := filepath.Base(filePath)
+
+	meta := &VideoMetadata{
+		Duration:          c.duration,
+		Format:            c.format,
+		FileSize:          size,
+		CreatedAt:         time.Now().UTC().Format(time.RFC3339),
+		OriginalFilename:  originalFilename,
+		FileExtension:     filepath.Ext(originalFilename),
+		SanitizedFilename: SanitizeFilename(originalFilename),
+	}
+	if c.duration > 0 {
+		meta.Bitrate = int64(float64(size*8) / c.duration)
+	}
+
+	if c.video != nil {
+		meta.Width = c.video.width
+		meta.Height = c.video.height
+		meta.Codec = c.video.codec
+		meta.FrameRate = c.video.frameRate
+	}
+	meta.AspectRatio = aspectRatioOf(meta.Width, meta.Height)
+
+	if c.audio != nil {
+		meta.AudioCodec = c.audio.codec
+		meta.AudioChannels = c.audio.channels
+		meta.AudioBitrate = c.audio.bitrate
+	}
+
+	meta.ContentType = determineContentType(c.format, meta.Codec)
+
+	return meta
+}
+
+// crossCheck fills the fields ffprobe could not determine with the values read from the container.
+// ffprobe stays authoritative for everything it reported.
+func crossCheck(meta *VideoMetadata, probed *VideoMetadata) {
+	if meta.Duration <= 0 {
+		meta.Duration = probed.Duration
+	}
+	if meta.Width <= 0 || meta.Height <= 0 {
+		meta.Width = probed.Width
+		meta.Height = probed.Height
+		meta.AspectRatio = probed.AspectRatio
+	}
+	if meta.Codec == "" {
+		meta.Codec = probed.Codec
+	}
+	if meta.FrameRate <= 0 {
+		meta.FrameRate = probed.FrameRate
+	}
+	if meta.Bitrate <= 0 {
+		meta.Bitrate = probed.Bitrate
+	}
+	if meta.AudioCodec == "" {
+		meta.AudioCodec = probed.AudioCodec
+		meta.AudioChannels = probed.AudioChannels
+	}
+	if meta.AudioBitrate <= 0 {
+		meta.AudioBitrate = probed.AudioBitrate
+	}
+	if meta.AspectRatio == "unknown" {
+		meta.AspectRatio = aspectRatioOf(meta.Width, meta.Height)
+	}
+}
+
+func aspectRatioOf(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return "unknown"
+	}
+	gcd := greatestCommonDivisor(width, height)
+	return fmt.Sprintf("%d:%d", width/gcd, height/gcd)
+}
+
+// httpReaderAt reads a remote object with HTTP range requests
+type httpReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+}
+
+// newHTTPReaderAt determines the object size with a one byte range request.
+// Presigned URLs are only valid for GET, so HEAD cannot be used.
+func newHTTPReaderAt(ctx context.Context, url string) (*httpReaderAt, error) {
+	r := &httpReaderAt{ctx: ctx, client: http.DefaultClient, url: url}
+
+	resp, err := r.get(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Content-Range: bytes 0-0/<size>
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return nil, fmt.Errorf("server does not support range requests")
+	}
+	r.size, err = strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Range header: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p)) - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	resp, err := r.get(off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *httpReaderAt) get(start, end int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create range request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote file: %w", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read remote file: unexpected status %s", resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// formatContainerInfo formats a probe result including its tracks
+func formatContainerInfo(info *containerInfo) string {
+	if info == nil {
+		return "<nil>"
+	}
+	format := func(track *trackInfo) string {
+		if track == nil {
+			return "<nil>"
+		}
+		return fmt.Sprintf("%+v", *track)
+	}
+	return fmt.Sprintf("{format:%s duration:%v video:%s audio:%s}", info.format, info.duration, format(info.video), format(info.audio))
+}
+
+func FuzzProbeContainer(f *testing.F) {
+	moov := testMoov(mp4BoxBytes("mvhd", putUint32(20, 12, 1000, 2000)))
+	f.Add(bytes.Join([][]byte{mp4BoxBytes("ftyp", []byte("isom")), mp4BoxBytes("moov", moov)}, nil))
+	f.Add(bytes.Join([][]byte{mp4BoxBytes("ftyp", []byte("isom")), mp4LargeBoxBytes("mdat", make([]byte, 16)), mp4OpenBoxBytes("moov", moov)}, nil))
+	f.Add(bytes.Join([][]byte{
+		ebmlBytes(ebmlIDHeader),
+		ebmlOpenBytes(mkvIDSegment,
+			ebmlBytes(mkvIDInfo, ebmlFloatBytes(mkvIDDuration, 2000)),
+			ebmlBytes(mkvIDTracks, ebmlBytes(mkvIDTrackEntry,
+				ebmlUintBytes(mkvIDTrackType, mkvTrackTypeVideo),
+				ebmlBytes(mkvIDVideo, ebmlUintBytes(mkvIDPixelWidth, 1920), ebmlUintBytes(mkvIDPixelHeight, 1080)),
+			)),
+		),
+	}, nil))
+
+	f.Fuzz(func(t *testing.T, file []byte) {
+		info, err := probeContainer(bytes.NewReader(file), int64(len(file)))
+		if err == nil && info == nil {
+			t.Fatal("probeContainer() returned neither a result nor an error")
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"youtube-clone-platform/video-upload-service/internal/events"
+)
+
+// RecordHook runs in the transaction that records an upload event, e.g. to update usage counters
+type RecordHook func(ctx context.Context, tx *sql.Tx, event events.VideoUploadEvent) error
+
+// Publisher records upload events in the outbox instead of sending them to Kafka directly.
+// Once PublishVideoUpload returns the event is durable, the relay takes care of delivery.
+type Publisher struct {
+	store *Store
+	relay *Relay
+	hooks []RecordHook
+}
+
+// NewPublisher creates a publisher that records events in store and wakes up relay.
+// The hooks run in the same transaction as the insert into the outbox.
+func NewPublisher(store *Store, relay *Relay, hooks ...RecordHook) *Publisher {
+	return &Publisher{
+		store: store,
+		relay: relay,
+		hooks: hooks,
+	}
+}
+
+// PublishVideoUpload implements events.Publisher
+func (p *Publisher) PublishVideoUpload(ctx context.Context, event events.VideoUploadEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	tx, err := p.store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := p.store.AddTx(ctx, tx, EventTypeVideoUpload, event.VideoID, payload); err != nil {
+		return err
+	}
+	for _, hook := range p.hooks {
+		if err := hook(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit outbox event: %w", err)
+	}
+
+	p.relay.Notify()
+	return nil
+}
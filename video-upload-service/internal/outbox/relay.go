@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sharedlog "youtube-clone-platform/internal/shared/log"
+)
+
+const (
+	relayBatchSize = 100
+	maxRetryDelay  = 5 * time.Minute
+)
+
+// Sender delivers an encoded event to the message broker
+type Sender interface {
+	PublishMessage(ctx context.Context, key string, payload []byte) error
+}
+
+// Relay delivers pending outbox events with exponential backoff between attempts
+type Relay struct {
+	store       *Store
+	sender      Sender
+	interval    time.Duration
+	maxAttempts int
+	wake        chan struct{}
+}
+
+// NewRelay creates a relay that polls the outbox every interval. Events that fail
+// maxAttempts times are marked failed and show up as stuck until they are re-driven.
+func NewRelay(store *Store, sender Sender, interval time.Duration, maxAttempts int) *Relay {
+	return &Relay{
+		store:       store,
+		sender:      sender,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay up so a freshly recorded event does not wait for the next poll
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// deliverDue sends every event that is due, batch by batch
+func (r *Relay) deliverDue(ctx context.Context) {
+	for {
+		events, err := r.store.Due(ctx, time.Now(), relayBatchSize)
+		if err != nil {
+			sharedlog.Error(fmt.Sprintf("Outbox relay: %v", err))
+			return
+		}
+
+		for _, event := range events {
+			if ctx.Err() != nil {
+				return
+			}
+			r.deliver(ctx, event)
+		}
+
+		if len(events) < relayBatchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) deliver(ctx context.Context, event *Event) {
+	attempts := event.Attempts + 1
+
+	err := r.sender.PublishMessage(ctx, event.AggregateID, event.Payload)
+	if err == nil {
+		if err := r.store.MarkDelivered(ctx, event.ID, attempts); err != nil {
+			sharedlog.Error(fmt.Sprintf("Outbox relay: %v", err))
+		}
+		return
+	}
+
+	if attempts >= r.maxAttempts {
+		sharedlog.Error(fmt.Sprintf("Outbox event %d (%s %s) failed after %d attempts: %v", event.ID, event.EventType, event.AggregateID, attempts, err))
+		if err := r.store.MarkFailed(ctx, event.ID, attempts, err.Error()); err != nil {
+			sharedlog.Error(fmt.Sprintf("Outbox relay: %v", err))
+		}
+		return
+	}
+
+	next := time.Now().Add(retryDelay(attempts))
+	sharedlog.Warn(fmt.Sprintf("Outbox event %d (%s %s) delivery attempt %d failed, retrying at %s: %v", event.ID, event.EventType, event.AggregateID, attempts, next.UTC().Format(time.RFC3339), err))
+	if err := r.store.MarkRetry(ctx, event.ID, attempts, err.Error(), next); err != nil {
+		sharedlog.Error(fmt.Sprintf("Outbox relay: %v", err))
+	}
+}
+
+// retryDelay doubles the delay with every attempt: 1s, 2s, 4s, ... up to maxRetryDelay
+func retryDelay(attempts int) time.Duration {
+	if attempts > 20 {
+		return maxRetryDelay
+	}
+	delay := time.Second << (attempts - 1)
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,236 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// EventTypeVideoUpload is the type of the events published to the upload topic
+const EventTypeVideoUpload = "video_upload"
+
+// Event is a message recorded in the outbox
+type Event struct {
+	ID            int64           `json:"id"`
+	EventType     string          `json:"event_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+const eventColumns = `id, event_type, aggregate_id, payload, status, attempts, last_error,
+	created_at, next_attempt_at, delivered_at`
+
+// Store keeps outbox events in SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates an outbox store on an opened database
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Add records a new event that is due for delivery immediately
+func (s *Store) Add(ctx context.Context, eventType string, aggregateID string, payload []byte) (int64, error) {
+	return addEvent(ctx, s.db, eventType, aggregateID, payload)
+}
+
+// AddTx records a new event as part of a transaction, so it is only delivered if the transaction commits
+func (s *Store) AddTx(ctx context.Context, tx *sql.Tx, eventType string, aggregateID string, payload []byte) (int64, error) {
+	return addEvent(ctx, tx, eventType, aggregateID, payload)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func addEvent(ctx context.Context, db execer, eventType string, aggregateID string, payload []byte) (int64, error) {
+	now := toMillis(time.Now())
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO outbox_events (event_type, aggregate_id, payload, status, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		eventType, aggregateID, payload, StatusPending, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record outbox event: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// Due returns pending events whose next attempt is due, oldest first
+func (s *Store) Due(ctx context.Context, now time.Time, limit int) ([]*Event, error) {
+	return s.query(ctx, `
+		SELECT `+eventColumns+` FROM outbox_events
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY id
+		LIMIT ?`,
+		StatusPending, toMillis(now), limit)
+}
+
+// Stuck returns events that failed permanently or are still pending although they were
+// recorded before the given time, oldest first
+func (s *Store) Stuck(ctx context.Context, createdBefore time.Time, limit int) ([]*Event, error) {
+	return s.query(ctx, `
+		SELECT `+eventColumns+` FROM outbox_events
+		WHERE status = ? OR (status = ? AND created_at <= ?)
+		ORDER BY created_at
+		LIMIT ?`,
+		StatusFailed, StatusPending, toMillis(createdBefore), limit)
+}
+
+// MarkDelivered marks an event as delivered
+func (s *Store) MarkDelivered(ctx context.Context, id int64, attempts int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = ?, attempts = ?, last_error = NULL, delivered_at = ?
+		WHERE id = ?`,
+		StatusDelivered, attempts, toMillis(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkRetry records a failed delivery attempt and schedules the next one
+func (s *Store) MarkRetry(ctx context.Context, id int64, attempts int, lastErr string, next time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET attempts = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`,
+		attempts, lastErr, toMillis(next), id)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule outbox event: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed gives up on an event after its last delivery attempt failed
+func (s *Store) MarkFailed(ctx context.Context, id int64, attempts int, lastErr string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = ?, attempts = ?, last_error = ?
+		WHERE id = ?`,
+		StatusFailed, attempts, lastErr, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	return nil
+}
+
+// Redrive returns up to limit failed events to pending with a fresh set of delivery attempts,
+// oldest first. The events that were re-driven are returned.
+func (s *Store) Redrive(ctx context.Context, limit int) ([]*Event, error) {
+	failed, err := s.query(ctx, `
+		SELECT `+eventColumns+` FROM outbox_events
+		WHERE status = ?
+		ORDER BY id
+		LIMIT ?`,
+		StatusFailed, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var redriven []*Event
+	for _, event := range failed {
+		// An event re-driven concurrently is only reported once
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE outbox_events
+			SET status = ?, attempts = 0, next_attempt_at = ?
+			WHERE id = ? AND status = ?`,
+			StatusPending, toMillis(now), event.ID, StatusFailed)
+		if err != nil {
+			return redriven, fmt.Errorf("failed to re-drive outbox event: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			continue
+		}
+
+		event.Status = StatusPending
+		event.Attempts = 0
+		event.NextAttemptAt = fromMillis(toMillis(now))
+		redriven = append(redriven, event)
+	}
+
+	return redriven, nil
+}
+
+// DeleteDelivered removes events delivered before the given time
+func (s *Store) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM outbox_events
+		WHERE status = ? AND delivered_at <= ?`,
+		StatusDelivered, toMillis(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete delivered outbox events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]*Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var (
+			event                  Event
+			lastError              sql.NullString
+			createdAt, nextAttempt int64
+			deliveredAt            sql.NullInt64
+		)
+		if err := rows.Scan(
+			&event.ID,
+			&event.EventType,
+			&event.AggregateID,
+			&event.Payload,
+			&event.Status,
+			&event.Attempts,
+			&lastError,
+			&createdAt,
+			&nextAttempt,
+			&deliveredAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+
+		event.LastError = lastError.String
+		event.CreatedAt = fromMillis(createdAt)
+		event.NextAttemptAt = fromMillis(nextAttempt)
+		if deliveredAt.Valid {
+			delivered := fromMillis(deliveredAt.Int64)
+			event.DeliveredAt = &delivered
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
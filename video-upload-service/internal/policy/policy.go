@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"youtube-clone-platform/video-upload-service/internal/metadata"
+	"youtube-clone-platform/video-upload-service/internal/quota"
+	"youtube-clone-platform/video-upload-service/internal/validation"
+)
+
+// DefaultRole is used when the gateway did not forward a role for the user
+const DefaultRole = "user"
+
+// Policy is the upload policy as read from the policy file.
+// Role limits override the default limits field by field; unset fields inherit the default.
+type Policy struct {
+	UserIDPrefixes []string                     `json:"user_id_prefixes"`
+	Default        validation.Limits            `json:"default"`
+	Roles          map[string]validation.Limits `json:"roles"`
+	Quotas         Quotas                       `json:"quotas"`
+}
+
+// Quotas are the per-user quotas. Role quotas override the default quotas the same way as limits.
+type Quotas struct {
+	Default quota.Limits            `json:"default"`
+	Roles   map[string]quota.Limits `json:"roles"`
+}
+
+// Engine checks uploads against the upload policy
+type Engine struct {
+	policy Policy
+}
+
+// New creates an engine for the given policy
+func New(policy Policy) *Engine {
+	return &Engine{policy: policy}
+}
+
+// Default returns the engine used when no policy file is configured
+func Default() *Engine {
+	return New(Policy{
+		UserIDPrefixes: []string{"test_user_", "google_"},
+		Default:        validation.DefaultLimits(),
+		Quotas: Quotas{
+			Default: quota.DefaultLimits(),
+		},
+	})
+}
+
+// Load reads the policy from a JSON file. Fields missing from the file keep their default value.
+func Load(path string) (*Engine, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload policy: %w", err)
+	}
+
+	policy := Default().policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse upload policy: %w", err)
+	}
+
+	return New(policy), nil
+}
+
+// LimitsFor returns the effective limits for a role
+func (e *Engine) LimitsFor(role string) validation.Limits {
+	limits := e.policy.Default
+
+	override, ok := e.policy.Roles[strings.ToLower(role)]
+	if !ok {
+		return limits
+	}
+
+	if override.MaxDuration != 0 {
+		limits.MaxDuration = override.MaxDuration
+	}
+	if override.MinDuration != 0 {
+		limits.MinDuration = override.MinDuration
+	}
+	if override.MaxResolution != 0 {
+		limits.MaxResolution = override.MaxResolution
+	}
+	if override.MinResolution != 0 {
+		limits.MinResolution = override.MinResolution
+	}
+	if override.MaxFileSize != 0 {
+		limits.MaxFileSize = override.MaxFileSize
+	}
+	if len(override.AllowedCodecs) > 0 {
+		limits.AllowedCodecs = override.AllowedCodecs
+	}
+	if len(override.AllowedContainers) > 0 {
+		limits.AllowedContainers = override.AllowedContainers
+	}
+
+	return limits
+}
+
+// QuotaFor returns the effective quotas for a role
+func (e *Engine) QuotaFor(role string) quota.Limits {
+	return e.policy.Quotas.Default.Merge(e.policy.Quotas.Roles[strings.ToLower(role)])
+}
+
+// ValidateUserID checks the user ID against the configured prefixes
+func (e *Engine) ValidateUserID(userID string) error {
+	return validation.ValidateUserID(userID, e.policy.UserIDPrefixes)
+}
+
+// ValidateFileSize checks the declared upload size before any bytes are stored
+func (e *Engine) ValidateFileSize(role string, size int64) error {
+	return validation.ValidateFileSizeLimit(size, e.LimitsFor(role))
+}
+
+// Check runs the policy against the metadata extracted from a stored video.
+// Without extracted metadata only the file size and container (from the file extension) can be checked,
+// so the video is rejected if duration, resolution or codec limits are configured.
+func (e *Engine) Check(role string, meta *metadata.VideoMetadata, extracted bool) error {
+	limits := e.LimitsFor(role)
+	if extracted {
+		return validation.ValidateVideoMetadata(meta, limits)
+	}
+
+	var errs []*validation.ValidationError
+	if limits.MaxDuration > 0 || limits.MinDuration > 0 || limits.MaxResolution > 0 || limits.MinResolution > 0 || len(limits.AllowedCodecs) > 0 {
+		errs = append(errs, &validation.ValidationError{
+			Field:   "metadata",
+			Message: "video metadata could not be extracted to check the duration, resolution and codec",
+		})
+	}
+	if err := validation.ValidateFileSizeLimit(meta.FileSize, limits); err != nil {
+		found, _ := validation.ValidationErrors(err)
+		errs = append(errs, found...)
+	}
+	if err := validation.ValidateContainer(strings.TrimPrefix(meta.FileExtension, "."), limits); err != nil {
+		found, _ := validation.ValidationErrors(err)
+		errs = append(errs, found...)
+	}
+	if len(errs) > 0 {
+		return &validation.MetadataError{Errors: errs}
+	}
+	return nil
+}
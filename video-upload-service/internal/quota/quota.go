@@ -0,0 +1,147 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error codes returned when a quota is exceeded
+const (
+	CodeStorageExceeded       = "quota_storage_exceeded"
+	CodeUploadsPerDayExceeded = "quota_uploads_per_day_exceeded"
+	CodeMinutesExceeded       = "quota_minutes_exceeded"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Limits are the quotas of a user. Zero means unlimited.
+type Limits struct {
+	MaxStoredBytes   int64   `json:"max_stored_bytes"`
+	MaxUploadsPerDay int     `json:"max_uploads_per_day"`
+	MaxMinutes       float64 `json:"max_minutes"`
+}
+
+// DefaultLimits returns the quotas used when the upload policy does not configure any
+func DefaultLimits() Limits {
+	return Limits{
+		MaxStoredBytes:   20 * 1024 * 1024 * 1024, // 20GB
+		MaxUploadsPerDay: 25,
+		MaxMinutes:       600,
+	}
+}
+
+// Merge overrides the limits field by field with the non-zero fields of override
+func (l Limits) Merge(override Limits) Limits {
+	if override.MaxStoredBytes != 0 {
+		l.MaxStoredBytes = override.MaxStoredBytes
+	}
+	if override.MaxUploadsPerDay != 0 {
+		l.MaxUploadsPerDay = override.MaxUploadsPerDay
+	}
+	if override.MaxMinutes != 0 {
+		l.MaxMinutes = override.MaxMinutes
+	}
+	return l
+}
+
+// Usage is what a user has uploaded so far
+type Usage struct {
+	StoredBytes  int64
+	Videos       int
+	Minutes      float64
+	UploadsToday int
+}
+
+// ExceededError is returned when an upload would exceed a quota
+type ExceededError struct {
+	Code    string
+	Message string
+	// RetryAfter is set when the quota frees up by itself, e.g. the daily upload count
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// Is makes errors.Is(err, ErrQuotaExceeded) match
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// CheckUpload checks whether a new upload of the given size fits the quotas.
+// The duration is not known before the upload is processed, only the minutes already used are checked.
+func CheckUpload(limits Limits, usage Usage, size int64, now time.Time) error {
+	if limits.MaxUploadsPerDay > 0 && usage.UploadsToday >= limits.MaxUploadsPerDay {
+		return &ExceededError{
+			Code:       CodeUploadsPerDayExceeded,
+			Message:    fmt.Sprintf("daily upload limit of %d videos reached", limits.MaxUploadsPerDay),
+			RetryAfter: NextDay(now).Sub(now),
+		}
+	}
+	if limits.MaxStoredBytes > 0 && usage.StoredBytes+size > limits.MaxStoredBytes {
+		return &ExceededError{
+			Code:    CodeStorageExceeded,
+			Message: fmt.Sprintf("storage quota of %d bytes exceeded: %d bytes used, upload is %d bytes", limits.MaxStoredBytes, usage.StoredBytes, size),
+		}
+	}
+	if limits.MaxMinutes > 0 && usage.Minutes >= limits.MaxMinutes {
+		return &ExceededError{
+			Code:    CodeMinutesExceeded,
+			Message: fmt.Sprintf("video minutes quota of %g minutes reached", limits.MaxMinutes),
+		}
+	}
+	return nil
+}
+
+// CheckDuration checks whether a processed video of the given duration fits the minutes quota
+func CheckDuration(limits Limits, usage Usage, duration float64) error {
+	if limits.MaxMinutes > 0 && usage.Minutes+duration/60 > limits.MaxMinutes {
+		return &ExceededError{
+			Code:    CodeMinutesExceeded,
+			Message: fmt.Sprintf("video minutes quota of %g minutes exceeded: %.1f minutes used, video is %.1f minutes", limits.MaxMinutes, usage.Minutes, duration/60),
+		}
+	}
+	return nil
+}
+
+// StartOfDay returns the start of the UTC day the daily upload count is based on
+func StartOfDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// NextDay returns when the daily upload count resets
+func NextDay(now time.Time) time.Time {
+	return StartOfDay(now).Add(24 * time.Hour)
+}
+
+// Report is the usage of a user against their limits. A limit of 0 means unlimited.
+type Report struct {
+	UserID           string    `json:"user_id"`
+	Role             string    `json:"role"`
+	Videos           int       `json:"videos"`
+	StoredBytes      int64     `json:"stored_bytes"`
+	MaxStoredBytes   int64     `json:"max_stored_bytes"`
+	UploadsToday     int       `json:"uploads_today"`
+	MaxUploadsPerDay int       `json:"max_uploads_per_day"`
+	UploadsResetAt   time.Time `json:"uploads_reset_at"`
+	Minutes          float64   `json:"minutes"`
+	MaxMinutes       float64   `json:"max_minutes"`
+}
+
+// NewReport builds the usage report of a user
+func NewReport(userID string, role string, limits Limits, usage Usage, now time.Time) *Report {
+	return &Report{
+		UserID:           userID,
+		Role:             role,
+		Videos:           usage.Videos,
+		StoredBytes:      usage.StoredBytes,
+		MaxStoredBytes:   limits.MaxStoredBytes,
+		UploadsToday:     usage.UploadsToday,
+		MaxUploadsPerDay: limits.MaxUploadsPerDay,
+		UploadsResetAt:   NextDay(now),
+		Minutes:          usage.Minutes,
+		MaxMinutes:       limits.MaxMinutes,
+	}
+}
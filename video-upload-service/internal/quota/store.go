@@ -0,0 +1,76 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"youtube-clone-platform/video-upload-service/internal/events"
+)
+
+// Store tracks the videos counted against user quotas in SQLite
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a quota store on an opened database
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Usage returns the current usage of a user
+func (s *Store) Usage(ctx context.Context, userID string, now time.Time) (Usage, error) {
+	var usage Usage
+	var seconds float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(CASE WHEN deleted_at IS NULL THEN size ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN deleted_at IS NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN deleted_at IS NULL THEN duration ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN uploaded_at >= ? THEN 1 ELSE 0 END), 0)
+		FROM quota_videos
+		WHERE user_id = ?`,
+		StartOfDay(now).UnixMilli(), userID,
+	).Scan(&usage.StoredBytes, &usage.Videos, &seconds, &usage.UploadsToday)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+
+	usage.Minutes = seconds / 60
+	return usage, nil
+}
+
+// RecordUpload counts an upload event against the quota of its user. It runs in the transaction
+// that records the event in the outbox, so usage and events never diverge.
+// Duplicates reusing the assets of another video do not use any storage.
+func (s *Store) RecordUpload(ctx context.Context, tx *sql.Tx, event events.VideoUploadEvent) error {
+	size := event.Size
+	if event.DuplicateOf != "" {
+		size = 0
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO quota_videos (video_id, user_id, size, duration, uploaded_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(video_id) DO NOTHING`,
+		event.VideoID, event.UserID, size, event.Metadata.Duration, time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to record quota usage: %w", err)
+	}
+	return nil
+}
+
+// RecordDeletion releases the storage and minutes of a deleted video.
+// Deleted videos still count towards the uploads of the day they were uploaded.
+func (s *Store) RecordDeletion(ctx context.Context, videoID string, deletedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE quota_videos
+		SET deleted_at = ?
+		WHERE video_id = ? AND deleted_at IS NULL`,
+		deletedAt.UnixMilli(), videoID)
+	if err != nil {
+		return fmt.Errorf("failed to record video deletion: %w", err)
+	}
+	return nil
+}
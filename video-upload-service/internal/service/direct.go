@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	sharedlog "youtube-clone-platform/internal/shared/log"
+	"youtube-clone-platform/video-upload-service/internal/checksum"
+	"youtube-clone-platform/video-upload-service/internal/direct"
+	"youtube-clone-platform/video-upload-service/internal/metadata"
+	"youtube-clone-platform/video-upload-service/internal/storage"
+	"youtube-clone-platform/video-upload-service/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	minPartSize = 5 * 1024 * 1024 // smallest part size accepted by S3 compatible storage
+	maxParts    = 10000
+)
+
+var (
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	ErrUploadCorrupt    = errors.New("uploaded object does not match the declared size")
+	ErrFileTooLarge     = errors.New("file too large")
+)
+
+// DirectUploadService lets clients upload straight to object storage using presigned
+// multipart URLs, keeping the upload service out of the bandwidth path.
+type DirectUploadService struct {
+	uploads  *UploadService
+	sessions *direct.Store
+	partSize int64
+	expiry   time.Duration
+}
+
+func NewDirectUploadService(uploads *UploadService, sessions *direct.Store, partSize int64, expiry time.Duration) *DirectUploadService {
+	return &DirectUploadService{
+		uploads:  uploads,
+		sessions: sessions,
+		partSize: partSize,
+		expiry:   expiry,
+	}
+}
+
+// PresignedPart is a part the client has to PUT to the given URL
+type PresignedPart struct {
+	Number int    `json:"part_number"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+}
+
+// DirectUpload is the result of initiating a direct upload
+type DirectUpload struct {
+	Session *direct.Session
+	Parts   []PresignedPart
+}
+
+// Initiate creates a multipart upload in the raw bucket and presigns a URL for every part
+func (s *DirectUploadService) Initiate(ctx context.Context, userID string, role string, title string, originalFilename string, contentType string, size int64) (*DirectUpload, error) {
+	// Validate inputs
+	if err := validation.ValidateTitle(title); err != nil {
+		return nil, err
+	}
+	if err := s.uploads.policy.ValidateUserID(userID); err != nil {
+		return nil, err
+	}
+	if size > s.uploads.maxBytes {
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.uploads.maxBytes)
+	}
+	if err := s.uploads.policy.ValidateFileSize(role, size); err != nil {
+		return nil, err
+	}
+	if err := s.uploads.CheckQuota(ctx, userID, role, size); err != nil {
+		return nil, err
+	}
+	if err := validation.ValidateFileSize(size); err != nil {
+		return nil, err
+	}
+	if err := validation.ValidateVideoExtension(originalFilename, contentType); err != nil {
+		return nil, err
+	}
+
+	partSize := s.partSizeFor(size)
+	partCount := int((size + partSize - 1) / partSize)
+
+	videoID := uuid.New().String()
+	objectName, uploadID, err := s.uploads.storage.CreateMultipartUpload(ctx, videoID, contentType, originalFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := &direct.Session{
+		ID:               videoID,
+		ObjectName:       objectName,
+		UploadID:         uploadID,
+		UserID:           userID,
+		Role:             role,
+		Title:            title,
+		OriginalFilename: originalFilename,
+		ContentType:      contentType,
+		Size:             size,
+		PartSize:         partSize,
+		PartCount:        partCount,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(s.expiry),
+	}
+
+	parts := make([]PresignedPart, 0, partCount)
+	for number := 1; number <= partCount; number++ {
+		partURL, err := s.uploads.storage.PresignUploadPart(ctx, objectName, uploadID, number, s.expiry)
+		if err != nil {
+			s.abortQuietly(ctx, session)
+			return nil, err
+		}
+		parts = append(parts, PresignedPart{
+			Number: number,
+			URL:    partURL,
+			Size:   session.PartSizeOf(number),
+		})
+	}
+
+	if err := s.sessions.Save(session); err != nil {
+		s.abortQuietly(ctx, session)
+		return nil, err
+	}
+
+	return &DirectUpload{Session: session, Parts: parts}, nil
+}
+
+// Session returns a direct upload that has not been purged yet
+func (s *DirectUploadService) Session(id string) (*direct.Session, error) {
+	return s.sessions.Get(id)
+}
+
+// Complete assembles the uploaded parts, verifies the object, extracts its metadata
+// and publishes the regular upload event. The storage verified every part against its SHA-256, the
+// assembled object is read once to compute the checksum of the whole file, and rejected when it
+// differs from a digest in expected.
+func (s *DirectUploadService) Complete(ctx context.Context, id string, expected checksum.Expected) (*UploadResult, error) {
+	if err := s.sessions.Lock(id); err != nil {
+		return nil, err
+	}
+	defer s.sessions.Unlock(id)
+
+	session, err := s.sessions.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Completed {
+		return nil, direct.ErrCompleted
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, direct.ErrExpired
+	}
+
+	// Make sure every part arrived with the expected size
+	parts, err := s.uploads.storage.ListUploadedParts(ctx, session.ObjectName, session.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyParts(session, parts); err != nil {
+		return nil, err
+	}
+
+	if err := s.uploads.storage.CompleteMultipartUpload(ctx, session.ObjectName, session.UploadID, parts); err != nil {
+		// The storage may have assembled the object although the request failed, its parts are gone
+		// then and the upload cannot be completed again
+		if _, statErr := s.uploads.storage.StatVideo(context.WithoutCancel(ctx), session.ObjectName); statErr == nil {
+			s.discard(context.WithoutCancel(ctx), session, true)
+		}
+		return nil, err
+	}
+
+	// From here on the object exists. It is either published or removed together with the session,
+	// also when the client goes away.
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.verifyObject(ctx, session); err != nil {
+		s.discard(ctx, session, true)
+		return nil, err
+	}
+
+	video := storedVideo{
+		videoID:          session.ID,
+		userID:           session.UserID,
+		role:             session.Role,
+		title:            session.Title,
+		size:             session.Size,
+		contentType:      session.ContentType,
+		originalFilename: session.OriginalFilename,
+	}
+
+	// The bytes never passed through us, hash the object while ffprobe reads it over HTTP. The
+	// checksum has to be the SHA-256 of the whole file for duplicates of other uploads to be found.
+	type hashResult struct {
+		digests checksum.Digests
+		err     error
+	}
+	hashCh := make(chan hashResult, 1)
+	go func() {
+		digests, err := s.hashObject(ctx, session.ObjectName, expected)
+		hashCh <- hashResult{digests, err}
+	}()
+
+	meta, mErr := s.probe(ctx, session.ObjectName)
+
+	hResult := <-hashCh
+	if hResult.err != nil {
+		s.discard(ctx, session, true)
+		return nil, hResult.err
+	}
+	video.digests = hResult.digests
+
+	result, err := s.uploads.publishUpload(ctx, video, expected, meta, mErr)
+	if err != nil {
+		// The object was rejected and removed, the session cannot be completed anymore
+		s.discard(ctx, session, false)
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session.Completed = true
+	session.CompletedAt = &now
+	if err := s.sessions.Save(session); err != nil {
+		// The video is published, a session that was not marked must not be completed or aborted again
+		sharedlog.Error(fmt.Sprintf("Failed to mark upload session %s as completed: %v", session.ID, err))
+		s.discard(ctx, session, false)
+	}
+
+	return result, nil
+}
+
+// Abort cancels a direct upload and discards the uploaded parts
+func (s *DirectUploadService) Abort(ctx context.Context, id string) error {
+	if err := s.sessions.Lock(id); err != nil {
+		return err
+	}
+	defer s.sessions.Unlock(id)
+
+	session, err := s.sessions.Get(id)
+	if err != nil {
+		return err
+	}
+	if session.Completed {
+		return direct.ErrCompleted
+	}
+
+	if err := s.uploads.storage.AbortMultipartUpload(ctx, session.ObjectName, session.UploadID); err != nil {
+		return err
+	}
+
+	return s.sessions.Delete(session.ID)
+}
+
+// PurgeExpired aborts unfinished uploads past their expiry and removes their sessions
+func (s *DirectUploadService) PurgeExpired(ctx context.Context) (int, error) {
+	expired, err := s.sessions.Expired()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, session := range expired {
+		if err := s.sessions.Lock(session.ID); err != nil {
+			continue
+		}
+		if !session.Completed {
+			s.abortQuietly(ctx, session)
+		}
+		if err := s.sessions.Delete(session.ID); err == nil {
+			purged++
+		}
+		s.sessions.Unlock(session.ID)
+	}
+
+	return purged, nil
+}
+
+// partSizeFor picks a part size that keeps the upload within the storage part limit
+func (s *DirectUploadService) partSizeFor(size int64) int64 {
+	partSize := s.partSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	if size > partSize*maxParts {
+		partSize = (size + maxParts - 1) / maxParts
+	}
+	return partSize
+}
+
+// verifyObject checks the assembled object has the declared size and is a video
+func (s *DirectUploadService) verifyObject(ctx context.Context, session *direct.Session) error {
+	size, err := s.uploads.storage.StatVideo(ctx, session.ObjectName)
+	if err != nil {
+		return err
+	}
+	if size != session.Size {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrUploadCorrupt, session.Size, size)
+	}
+
+	object, err := s.uploads.storage.OpenVideo(ctx, session.ObjectName)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	return validation.ValidateVideoContent(object)
+}
+
+// hashObject computes the digests of a stored object
+func (s *DirectUploadService) hashObject(ctx context.Context, objectName string, expected checksum.Expected) (checksum.Digests, error) {
+	object, err := s.uploads.storage.OpenVideo(ctx, objectName)
+	if err != nil {
+		return checksum.Digests{}, err
+	}
+	defer object.Close()
+
+	hasher := s.uploads.newHasher(expected)
+	if _, err := io.Copy(hasher, object); err != nil {
+		return checksum.Digests{}, fmt.Errorf("failed to hash uploaded object: %w", err)
+	}
+
+	return hasher.Sum(), nil
+}
+
+// probe runs metadata extraction against a short lived URL of the stored object
+func (s *DirectUploadService) probe(ctx context.Context, objectName string) (*metadata.VideoMetadata, error) {
+	objectURL, err := s.uploads.storage.PresignGetVideo(ctx, objectName, 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.ExtractMetadata(ctx, objectURL)
+}
+
+// discard removes the session of an upload that cannot be completed anymore and, with
+// deleteObject, its assembled object
+func (s *DirectUploadService) discard(ctx context.Context, session *direct.Session, deleteObject bool) {
+	if deleteObject {
+		if err := s.uploads.storage.DeleteVideo(ctx, session.ObjectName); err != nil {
+			sharedlog.Error(fmt.Sprintf("Failed to delete rejected upload %s: %v", session.ID, err))
+		}
+	}
+	if err := s.sessions.Delete(session.ID); err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to delete upload session %s: %v", session.ID, err))
+	}
+}
+
+func (s *DirectUploadService) abortQuietly(ctx context.Context, session *direct.Session) {
+	if err := s.uploads.storage.AbortMultipartUpload(ctx, session.ObjectName, session.UploadID); err != nil {
+		sharedlog.Warn(fmt.Sprintf("Failed to abort multipart upload %s: %v", session.ID, err))
+	}
+}
+
+// verifyParts checks that parts 1..PartCount were uploaded with the expected sizes and checksums
+func verifyParts(session *direct.Session, parts []storage.Part) error {
+	received := make(map[int]storage.Part, len(parts))
+	for _, part := range parts {
+		received[part.Number] = part
+	}
+
+	var missing []int
+	for number := 1; number <= session.PartCount; number++ {
+		part, ok := received[number]
+		if !ok {
+			missing = append(missing, number)
+			continue
+		}
+		if expected := session.PartSizeOf(number); part.Size != expected {
+			return fmt.Errorf("%w: part %d has %d bytes, expected %d", ErrUploadIncomplete, number, part.Size, expected)
+		}
+		if part.ChecksumSHA256 == "" {
+			return fmt.Errorf("%w: part %d was uploaded without a sha256 checksum", ErrUploadIncomplete, number)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing parts %v", ErrUploadIncomplete, missing)
+	}
+	if len(parts) != session.PartCount {
+		return fmt.Errorf("%w: expected %d parts, got %d", ErrUploadIncomplete, session.PartCount, len(parts))
+	}
+
+	return nil
+}
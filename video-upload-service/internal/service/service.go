@@ -9,42 +9,117 @@ import (
 	"time"
 
 	sharedlog "youtube-clone-platform/internal/shared/log"
+	"youtube-clone-platform/video-upload-service/internal/checksum"
+	"youtube-clone-platform/video-upload-service/internal/dedup"
 	"youtube-clone-platform/video-upload-service/internal/events"
 	"youtube-clone-platform/video-upload-service/internal/metadata"
+	"youtube-clone-platform/video-upload-service/internal/policy"
+	"youtube-clone-platform/video-upload-service/internal/quota"
 	"youtube-clone-platform/video-upload-service/internal/storage"
 	"youtube-clone-platform/video-upload-service/internal/validation"
 )
 
 type UploadService struct {
-	storage   storage.Storage
-	publisher events.Publisher
-	maxBytes  int64
+	storage    storage.Storage
+	publisher  events.Publisher
+	policy     *policy.Engine
+	duplicates *dedup.Detector
+	quotas     *quota.Store
+	maxBytes   int64
+	withMD5    bool
 }
 
-func NewUploadService(storage storage.Storage, publisher events.Publisher, maxBytes int64) *UploadService {
+// NewUploadService creates the upload service. withMD5 enables an MD5 digest next to the SHA-256 checksum.
+// Without a quota store user quotas are not enforced.
+func NewUploadService(storage storage.Storage, publisher events.Publisher, policy *policy.Engine, duplicates *dedup.Detector, quotas *quota.Store, maxBytes int64, withMD5 bool) *UploadService {
 	return &UploadService{
-		storage:   storage,
-		publisher: publisher,
-		maxBytes:  maxBytes,
+		storage:    storage,
+		publisher:  publisher,
+		policy:     policy,
+		duplicates: duplicates,
+		quotas:     quotas,
+		maxBytes:   maxBytes,
+		withMD5:    withMD5,
 	}
 }
 
+// Policy returns the upload policy enforced by the service
+func (s *UploadService) Policy() *policy.Engine {
+	return s.policy
+}
+
+// CheckQuota checks whether a user may start an upload of the given size
+func (s *UploadService) CheckQuota(ctx context.Context, userID string, role string, size int64) error {
+	if s.quotas == nil {
+		return nil
+	}
+
+	now := time.Now()
+	usage, err := s.quotas.Usage(ctx, userID, now)
+	if err != nil {
+		return err
+	}
+	return quota.CheckUpload(s.policy.QuotaFor(role), usage, size, now)
+}
+
+// QuotaReport returns the usage of a user against the quotas of their role
+func (s *UploadService) QuotaReport(ctx context.Context, userID string, role string) (*quota.Report, error) {
+	limits := s.policy.QuotaFor(role)
+	now := time.Now()
+
+	var usage quota.Usage
+	if s.quotas != nil {
+		var err error
+		usage, err = s.quotas.Usage(ctx, userID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return quota.NewReport(userID, role, limits, usage, now), nil
+}
+
 type UploadResult struct {
 	VideoID  string
+	UserID   string
+	Title    string
 	Warning  string
 	Metadata *metadata.VideoMetadata
+
+	// DuplicateOf is the existing video with the same content, if the upload was a duplicate of a
+	// video of the same user
+	DuplicateOf string
 }
 
-func (s *UploadService) HandleUpload(ctx context.Context, userID string, title string, file io.Reader, size int64, contentType string, originalFilename string) (*UploadResult, error) {
+// storedVideo describes a video that has been written to storage and is waiting to be published
+type storedVideo struct {
+	videoID          string
+	userID           string
+	role             string
+	title            string
+	size             int64
+	contentType      string
+	originalFilename string
+	digests          checksum.Digests
+}
+
+// HandleUpload streams an upload to storage while hashing it and extracting its metadata.
+// If expected carries a digest, the upload is rejected when the computed digest differs.
+func (s *UploadService) HandleUpload(ctx context.Context, userID string, role string, title string, file io.Reader, size int64, contentType string, originalFilename string, expected checksum.Expected) (*UploadResult, error) {
 	// Validate inputs
 	if err := validation.ValidateTitle(title); err != nil {
 		return nil, err
 	}
-	if err := validation.ValidateUserID(userID); err != nil {
+	if err := s.policy.ValidateUserID(userID); err != nil {
 		return nil, err
 	}
 	if size > s.maxBytes {
-		return nil, fmt.Errorf("file too large: max size is %d bytes", s.maxBytes)
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxBytes)
+	}
+	if err := s.policy.ValidateFileSize(role, size); err != nil {
+		return nil, err
+	}
+	if err := s.CheckQuota(ctx, userID, role, size); err != nil {
+		return nil, err
 	}
 
 	// Create temporary file for metadata
@@ -55,9 +130,10 @@ func (s *UploadService) HandleUpload(ctx context.Context, userID string, title s
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
 
-	// Create a pipe to stream into the upload service
+	// Create a pipe to stream into the upload service, hashing the bytes on the way
 	uploadReader, uploadWriter := io.Pipe()
-	multiWriter := io.MultiWriter(tmpFile, uploadWriter)
+	hasher := s.newHasher(expected)
+	multiWriter := io.MultiWriter(tmpFile, uploadWriter, hasher)
 
 	// Channels to collect results from both goroutines
 	type uploadResult struct {
@@ -65,8 +141,9 @@ func (s *UploadService) HandleUpload(ctx context.Context, userID string, title s
 		err     error
 	}
 	type metadataResult struct {
-		meta *metadata.VideoMetadata
-		err  error
+		meta    *metadata.VideoMetadata
+		digests checksum.Digests
+		err     error
 	}
 
 	uploadCh := make(chan uploadResult, 1)
@@ -84,19 +161,20 @@ func (s *UploadService) HandleUpload(ctx context.Context, userID string, title s
 		uploadWriter.Close() // Signal upload end
 		if err != nil {
 			uploadReader.CloseWithError(err)
-			metadataCh <- metadataResult{nil, fmt.Errorf("copy error: %w", err)}
+			metadataCh <- metadataResult{err: fmt.Errorf("copy error: %w", err)}
 			return
 		}
+		digests := hasher.Sum()
 
 		// Rewind temp file
 		_, err = tmpFile.Seek(0, 0)
 		if err != nil {
-			metadataCh <- metadataResult{nil, fmt.Errorf("seek error: %w", err)}
+			metadataCh <- metadataResult{digests: digests, err: fmt.Errorf("seek error: %w", err)}
 			return
 		}
 
 		meta, mErr := metadata.ExtractMetadata(ctx, tmpFile.Name())
-		metadataCh <- metadataResult{meta, mErr}
+		metadataCh <- metadataResult{meta, digests, mErr}
 	}()
 
 	// Wait for both to finish
@@ -107,54 +185,247 @@ func (s *UploadService) HandleUpload(ctx context.Context, userID string, title s
 		return nil, fmt.Errorf("failed to upload video: %w", uResult.err)
 	}
 
+	return s.publishUpload(ctx, storedVideo{
+		videoID:          uResult.videoID,
+		userID:           userID,
+		role:             role,
+		title:            title,
+		size:             size,
+		contentType:      contentType,
+		originalFilename: originalFilename,
+		digests:          mResult.digests,
+	}, expected, mResult.meta, mResult.err)
+}
+
+// CompleteUpload stores a fully received local file under the given video ID and
+// runs the same metadata extraction and event publishing as HandleUpload.
+// It is used by the resumable upload flow once all chunks have arrived.
+func (s *UploadService) CompleteUpload(ctx context.Context, videoID string, userID string, role string, title string, filePath string, contentType string, originalFilename string, expected checksum.Expected) (*UploadResult, error) {
+	// Validate inputs
+	if err := validation.ValidateTitle(title); err != nil {
+		return nil, err
+	}
+	if err := s.policy.ValidateUserID(userID); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat uploaded file: %w", err)
+	}
+	size := info.Size()
+	if size > s.maxBytes {
+		return nil, fmt.Errorf("%w: max size is %d bytes", ErrFileTooLarge, s.maxBytes)
+	}
+	if err := s.policy.ValidateFileSize(role, size); err != nil {
+		return nil, err
+	}
+	if err := s.CheckQuota(ctx, userID, role, size); err != nil {
+		return nil, err
+	}
+
+	// Sniff the content now that the whole file is available
+	if err := validation.ValidateVideoContent(file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek error: %w", err)
+	}
+
+	// Upload, hash and extract metadata in parallel
+	hasher := s.newHasher(expected)
+	uploadCh := make(chan error, 1)
+	go func() {
+		uploadCh <- s.storage.UploadVideoWithID(ctx, videoID, io.TeeReader(file, hasher), size, contentType, originalFilename)
+	}()
+
+	meta, mErr := metadata.ExtractMetadata(ctx, filePath)
+
+	if err := <-uploadCh; err != nil {
+		return nil, fmt.Errorf("failed to upload video: %w", err)
+	}
+
+	return s.publishUpload(ctx, storedVideo{
+		videoID:          videoID,
+		userID:           userID,
+		role:             role,
+		title:            title,
+		size:             size,
+		contentType:      contentType,
+		originalFilename: originalFilename,
+		digests:          hasher.Sum(),
+	}, expected, meta, mErr)
+}
+
+// publishUpload verifies the checksum of a stored video, finalizes its metadata, enforces the
+// upload policy and user quotas, handles duplicates and publishes the upload event. Rejected videos are removed from storage.
+func (s *UploadService) publishUpload(ctx context.Context, video storedVideo, expected checksum.Expected, extracted *metadata.VideoMetadata, extractErr error) (*UploadResult, error) {
 	var meta *metadata.VideoMetadata
 	var warning string
 
-	if mResult.err != nil {
-		sharedlog.Warn(fmt.Sprintf("Warning: failed to extract metadata: %v", mResult.err))
-		warning = fmt.Sprintf("failed to extract metadata: %v", mResult.err)
+	// Make sure we stored exactly what the client sent
+	if err := expected.Verify(video.digests); err != nil {
+		sharedlog.Warn(fmt.Sprintf("Upload %s rejected: %v", video.videoID, err))
+		s.deleteRejected(ctx, video)
+		return nil, err
+	}
+
+	if extractErr != nil {
+		sharedlog.Warn(fmt.Sprintf("Warning: failed to extract metadata: %v", extractErr))
+		warning = fmt.Sprintf("failed to extract metadata: %v", extractErr)
 	}
 
-	if mResult.meta == nil {
+	if extracted == nil {
 		meta = &metadata.VideoMetadata{
-			FileSize:  size,
-			Format:    filepath.Ext(originalFilename),
+			FileSize:  video.size,
+			Format:    filepath.Ext(video.originalFilename),
 			CreatedAt: time.Now().UTC().Format(time.RFC3339),
 		}
 	} else {
-		meta = mResult.meta
+		meta = extracted
 	}
 
 	// Finalize metadata
-	meta.OriginalFilename = originalFilename
-	meta.FileExtension = filepath.Ext(originalFilename)
-	meta.SanitizedFilename = metadata.SanitizeFilename(originalFilename)
+	meta.OriginalFilename = video.originalFilename
+	meta.FileExtension = filepath.Ext(video.originalFilename)
+	meta.SanitizedFilename = metadata.SanitizeFilename(video.originalFilename)
+	meta.Checksum = video.digests.SHA256
+	meta.ChecksumAlgorithm = checksum.Algorithm
+	meta.MD5 = video.digests.MD5
+
+	// Enforce the upload policy before anyone hears about the video
+	if err := s.policy.Check(video.role, meta, extracted != nil); err != nil {
+		sharedlog.Warn(fmt.Sprintf("Upload %s rejected by policy: %v", video.videoID, err))
+		s.deleteRejected(ctx, video)
+		return nil, err
+	}
+
+	// Other uploads may have finished in the meantime and the duration is only known now
+	if err := s.checkStoredQuota(ctx, video, meta); err != nil {
+		sharedlog.Warn(fmt.Sprintf("Upload %s rejected by quota: %v", video.videoID, err))
+		s.deleteRejected(ctx, video)
+		return nil, err
+	}
+
+	// Look for a video with the same content, a failed lookup does not block the upload
+	match, err := s.duplicates.Find(ctx, meta.Checksum, video.userID)
+	if err != nil {
+		sharedlog.Warn(fmt.Sprintf("Duplicate check failed for upload %s: %v", video.videoID, err))
+	}
+
+	duplicateOf := ""
+	ownDuplicate := false
+	if match != nil {
+		// Videos of other users are never returned, their duplicates can only reuse the assets
+		ownDuplicate = match.OwnedBy(video.userID)
+		action := s.duplicates.Action()
+		if !ownDuplicate && action == dedup.ActionReturnExisting {
+			action = dedup.ActionReuse
+		}
 
-	// Publish upload event
+		switch action {
+		case dedup.ActionReject:
+			sharedlog.Info(fmt.Sprintf("Upload %s rejected as a duplicate of %s", video.videoID, match.VideoID))
+			s.deleteRejected(ctx, video)
+			if !ownDuplicate {
+				return nil, &dedup.DuplicateError{}
+			}
+			return nil, &dedup.DuplicateError{ExistingVideoID: match.VideoID}
+		case dedup.ActionReturnExisting:
+			sharedlog.Info(fmt.Sprintf("Upload %s is a duplicate of %s, returning the existing video", video.videoID, match.VideoID))
+			s.deleteRejected(ctx, video)
+			return &UploadResult{
+				VideoID:     match.VideoID,
+				UserID:      video.userID,
+				Title:       video.title,
+				Warning:     warning,
+				Metadata:    meta,
+				DuplicateOf: match.VideoID,
+			}, nil
+		case dedup.ActionReuse:
+			// The transcoded assets already exist, the raw upload is not needed
+			duplicateOf = match.SourceID()
+			sharedlog.Info(fmt.Sprintf("Upload %s is a duplicate of %s, reusing its assets", video.videoID, duplicateOf))
+			s.deleteRejected(ctx, video)
+		}
+	}
+
+	// Keep the digests with the stored object
+	if duplicateOf == "" {
+		checksums := map[string]string{"sha256": video.digests.SHA256}
+		if video.digests.MD5 != "" {
+			checksums["md5"] = video.digests.MD5
+		}
+		if err := s.storage.UpdateVideoMetadata(ctx, storage.VideoObjectName(video.videoID, video.originalFilename), checksums); err != nil {
+			sharedlog.Warn(fmt.Sprintf("Failed to store checksum for upload %s: %v", video.videoID, err))
+		}
+	}
+
+	// Record the upload event, without it the video would never be processed
 	err = s.publisher.PublishVideoUpload(ctx, events.VideoUploadEvent{
-		VideoID:     uResult.videoID,
-		UserID:      userID,
-		Title:       title,
-		ContentType: contentType,
-		Size:        size,
+		VideoID:     video.videoID,
+		UserID:      video.userID,
+		Title:       video.title,
+		ContentType: video.contentType,
+		Size:        video.size,
 		Metadata:    *meta,
 		UploadedAt:  time.Now().UTC().Format(time.RFC3339),
+		DuplicateOf: duplicateOf,
 	})
+	if err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to record upload event for %s: %v", video.videoID, err))
+		if duplicateOf == "" {
+			s.deleteRejected(ctx, video)
+		}
+		return nil, fmt.Errorf("failed to record upload event: %w", err)
+	}
 
 	result := &UploadResult{
-		VideoID:  uResult.videoID,
+		VideoID:  video.videoID,
+		UserID:   video.userID,
+		Title:    video.title,
+		Warning:  warning,
 		Metadata: meta,
 	}
+	if ownDuplicate {
+		result.DuplicateOf = duplicateOf
+	}
+	return result, nil
+}
 
-	if warning != "" {
-		result.Warning = warning
+// checkStoredQuota checks a stored video against the quotas of its user
+func (s *UploadService) checkStoredQuota(ctx context.Context, video storedVideo, meta *metadata.VideoMetadata) error {
+	if s.quotas == nil {
+		return nil
 	}
+
+	now := time.Now()
+	usage, err := s.quotas.Usage(ctx, video.userID, now)
 	if err != nil {
-		if result.Warning != "" {
-			result.Warning += "; "
-		}
-		result.Warning += fmt.Sprintf("video uploaded but event publishing failed: %v", err)
+		return err
 	}
 
-	return result, nil
+	limits := s.policy.QuotaFor(video.role)
+	if err := quota.CheckUpload(limits, usage, video.size, now); err != nil {
+		return err
+	}
+	return quota.CheckDuration(limits, usage, meta.Duration)
+}
+
+// newHasher creates the hasher for an upload, MD5 is also computed when the client sent an MD5 digest
+func (s *UploadService) newHasher(expected checksum.Expected) *checksum.Hasher {
+	return checksum.NewHasher(s.withMD5 || expected.MD5 != "")
+}
+
+// deleteRejected removes a stored video that failed verification or is not needed anymore
+func (s *UploadService) deleteRejected(ctx context.Context, video storedVideo) {
+	if err := s.storage.DeleteVideo(ctx, storage.VideoObjectName(video.videoID, video.originalFilename)); err != nil {
+		sharedlog.Error(fmt.Sprintf("Failed to delete rejected upload %s: %v", video.videoID, err))
+	}
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"path"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
@@ -13,25 +16,70 @@ import (
 
 type Storage interface {
 	UploadVideo(ctx context.Context, reader io.Reader, size int64, contentType string, originalFilename string) (string, error)
+	UploadVideoWithID(ctx context.Context, videoID string, reader io.Reader, size int64, contentType string, originalFilename string) error
+
+	// Direct-to-storage multipart uploads
+	CreateMultipartUpload(ctx context.Context, videoID string, contentType string, originalFilename string) (objectName string, uploadID string, err error)
+	PresignUploadPart(ctx context.Context, objectName string, uploadID string, partNumber int, expiry time.Duration) (string, error)
+	ListUploadedParts(ctx context.Context, objectName string, uploadID string) ([]Part, error)
+	CompleteMultipartUpload(ctx context.Context, objectName string, uploadID string, parts []Part) error
+	AbortMultipartUpload(ctx context.Context, objectName string, uploadID string) error
+
+	// Access to stored videos
+	StatVideo(ctx context.Context, objectName string) (int64, error)
+	OpenVideo(ctx context.Context, objectName string) (io.ReadCloser, error)
+	PresignGetVideo(ctx context.Context, objectName string, expiry time.Duration) (string, error)
+	DeleteVideo(ctx context.Context, objectName string) error
+	UpdateVideoMetadata(ctx context.Context, objectName string, metadata map[string]string) error
+}
+
+// Part describes one uploaded part of a multipart upload
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+	// ChecksumSHA256 is the base64 encoded SHA-256 of the part, verified by the storage on upload
+	ChecksumSHA256 string
 }
 
 type MinIOStorage struct {
-	client     *minio.Client
-	bucketName string
+	client        *minio.Client
+	core          *minio.Core
+	presignClient *minio.Client
+	bucketName    string
 }
 
-func NewMinIOStorage(endpoint, accessKey, secretKey string, useSSL bool, bucketName string) (*MinIOStorage, error) {
+// NewMinIOStorage creates the storage client. publicEndpoint is the address clients use to reach
+// MinIO directly and is used to sign upload URLs; it defaults to endpoint when empty.
+func NewMinIOStorage(endpoint, publicEndpoint, region, accessKey, secretKey string, useSSL bool, bucketName string) (*MinIOStorage, error) {
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
+		Region: region,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create minio client: %w", err)
 	}
 
+	if publicEndpoint == "" {
+		publicEndpoint = endpoint
+	}
+
+	// Signing is done locally, the region must be set so the client never has to look it up
+	presignClient, err := minio.New(publicEndpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create minio presign client: %w", err)
+	}
+
 	return &MinIOStorage{
-		client:     client,
-		bucketName: bucketName,
+		client:        client,
+		core:          &minio.Core{Client: client},
+		presignClient: presignClient,
+		bucketName:    bucketName,
 	}, nil
 }
 
@@ -39,6 +87,198 @@ func (s *MinIOStorage) UploadVideo(ctx context.Context, reader io.Reader, size i
 	// Generate a unique ID for the video
 	videoID := uuid.New().String()
 
+	if err := s.UploadVideoWithID(ctx, videoID, reader, size, contentType, originalFilename); err != nil {
+		return "", err
+	}
+
+	// Return just the videoID without extension for compatibility with existing code
+	return videoID, nil
+}
+
+// UploadVideoWithID stores a video under original/<videoID><ext> using a caller supplied ID
+func (s *MinIOStorage) UploadVideoWithID(ctx context.Context, videoID string, reader io.Reader, size int64, contentType string, originalFilename string) error {
+	objectName := VideoObjectName(videoID, originalFilename)
+	contentType = videoContentType(path.Ext(objectName), contentType)
+
+	// Include original filename in metadata
+	metadata := map[string]string{
+		"original-filename": originalFilename,
+	}
+
+	// Upload the video to MinIO
+	_, err := s.client.PutObject(ctx, s.bucketName, objectName, reader, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload video: %w", err)
+	}
+
+	return nil
+}
+
+// CreateMultipartUpload starts a multipart upload for original/<videoID><ext>
+func (s *MinIOStorage) CreateMultipartUpload(ctx context.Context, videoID string, contentType string, originalFilename string) (string, string, error) {
+	objectName := VideoObjectName(videoID, originalFilename)
+
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.bucketName, objectName, minio.PutObjectOptions{
+		ContentType: videoContentType(path.Ext(objectName), contentType),
+		UserMetadata: map[string]string{
+			"original-filename": originalFilename,
+			// Every part has to be sent with its SHA-256, which the storage verifies
+			"X-Amz-Checksum-Algorithm": "SHA256",
+		},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	return objectName, uploadID, nil
+}
+
+// PresignUploadPart returns a URL the client can PUT a single part to. The client sends the SHA-256
+// of the part in the x-amz-checksum-sha256 header.
+func (s *MinIOStorage) PresignUploadPart(ctx context.Context, objectName string, uploadID string, partNumber int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+
+	u, err := s.presignClient.Presign(ctx, "PUT", s.bucketName, objectName, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign part %d: %w", partNumber, err)
+	}
+
+	return u.String(), nil
+}
+
+// ListUploadedParts returns all parts received so far for a multipart upload
+func (s *MinIOStorage) ListUploadedParts(ctx context.Context, objectName string, uploadID string) ([]Part, error) {
+	var parts []Part
+	marker := 0
+	for {
+		result, err := s.core.ListObjectParts(ctx, s.bucketName, objectName, uploadID, marker, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, Part{
+				Number:         part.PartNumber,
+				ETag:           part.ETag,
+				Size:           part.Size,
+				ChecksumSHA256: part.ChecksumSHA256,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the final object
+func (s *MinIOStorage) CompleteMultipartUpload(ctx context.Context, objectName string, uploadID string, parts []Part) error {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{
+			PartNumber:     part.Number,
+			ETag:           part.ETag,
+			ChecksumSHA256: part.ChecksumSHA256,
+		})
+	}
+
+	if _, err := s.core.CompleteMultipartUpload(ctx, s.bucketName, objectName, uploadID, completeParts, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts
+func (s *MinIOStorage) AbortMultipartUpload(ctx context.Context, objectName string, uploadID string) error {
+	if err := s.core.AbortMultipartUpload(ctx, s.bucketName, objectName, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// StatVideo returns the size of a stored video
+func (s *MinIOStorage) StatVideo(ctx context.Context, objectName string) (int64, error) {
+	info, err := s.client.StatObject(ctx, s.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat video: %w", err)
+	}
+	return info.Size, nil
+}
+
+// OpenVideo opens a stored video for reading
+func (s *MinIOStorage) OpenVideo(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open video: %w", err)
+	}
+	return object, nil
+}
+
+// PresignGetVideo returns an internal URL that tools like ffprobe can read the video from
+func (s *MinIOStorage) PresignGetVideo(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucketName, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign video URL: %w", err)
+	}
+	return u.String(), nil
+}
+
+// DeleteVideo removes a stored video
+func (s *MinIOStorage) DeleteVideo(ctx context.Context, objectName string) error {
+	if err := s.client.RemoveObject(ctx, s.bucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete video: %w", err)
+	}
+	return nil
+}
+
+// UpdateVideoMetadata adds user metadata to a stored video, keeping its existing metadata.
+// S3 objects are immutable so this is done with a server side copy onto itself. The copy is
+// composed from ranges of the object, which also works for objects above the 5 GiB copy limit.
+func (s *MinIOStorage) UpdateVideoMetadata(ctx context.Context, objectName string, metadata map[string]string) error {
+	info, err := s.client.StatObject(ctx, s.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to stat video: %w", err)
+	}
+
+	merged := make(map[string]string, len(info.UserMetadata)+len(metadata)+1)
+	for key, value := range info.UserMetadata {
+		merged[key] = value
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	// Replacing the metadata would otherwise reset the content type
+	merged["Content-Type"] = info.ContentType
+
+	_, err = s.client.ComposeObject(ctx,
+		minio.CopyDestOptions{
+			Bucket:          s.bucketName,
+			Object:          objectName,
+			UserMetadata:    merged,
+			ReplaceMetadata: true,
+		},
+		minio.CopySrcOptions{
+			Bucket:    s.bucketName,
+			Object:    objectName,
+			MatchETag: info.ETag,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update video metadata: %w", err)
+	}
+
+	return nil
+}
+
+// VideoObjectName returns the object name a video is stored under
+func VideoObjectName(videoID string, originalFilename string) string {
 	// Extract and preserve extension from original filename
 	fileExt := path.Ext(originalFilename)
 	if fileExt == "" {
@@ -47,8 +287,11 @@ func (s *MinIOStorage) UploadVideo(ctx context.Context, reader io.Reader, size i
 	}
 
 	// Combine the ID with the original extension
-	objectName := path.Join("original", videoID+fileExt)
+	return path.Join("original", videoID+fileExt)
+}
 
+// videoContentType picks the content type stored with a video
+func videoContentType(fileExt string, contentType string) string {
 	// Ensure we're using video/mp4 instead of application/octet-stream for better compatibility
 	if contentType == "" || contentType == "application/octet-stream" {
 		if fileExt == ".mp4" {
@@ -61,23 +304,7 @@ func (s *MinIOStorage) UploadVideo(ctx context.Context, reader io.Reader, size i
 			contentType = "video/mp4" // Default to MP4 for unknown extensions
 		}
 	}
-
-	// Include original filename in metadata
-	metadata := map[string]string{
-		"original-filename": originalFilename,
-	}
-
-	// Upload the video to MinIO
-	_, err := s.client.PutObject(ctx, s.bucketName, objectName, reader, size, minio.PutObjectOptions{
-		ContentType:  contentType,
-		UserMetadata: metadata,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload video: %w", err)
-	}
-
-	// Return just the videoID without extension for compatibility with existing code
-	return videoID, nil
+	return contentType
 }
 
 // CheckHealth verifies the MinIO connection is working
@@ -0,0 +1,314 @@
+package tus
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	ErrExpired        = errors.New("upload has expired")
+	ErrLocked         = errors.New("upload is locked by another request")
+	ErrSizeExceeded   = errors.New("chunk exceeds declared upload length")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrFinalized      = errors.New("upload already finalized")
+)
+
+// Upload describes the state of a resumable upload
+type Upload struct {
+	ID          string            `json:"id"`
+	Length      int64             `json:"length"`
+	Offset      int64             `json:"offset"`
+	Metadata    map[string]string `json:"metadata"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+	Finalized   bool              `json:"finalized"`
+	FinalizedAt *time.Time        `json:"finalized_at,omitempty"`
+}
+
+// IsComplete reports whether all bytes of the upload have been received
+func (u *Upload) IsComplete() bool {
+	return u.Offset == u.Length
+}
+
+// FileStore keeps resumable uploads on the local filesystem.
+// Each upload is stored as <id>.bin (the received bytes) and <id>.info (JSON state).
+type FileStore struct {
+	dir    string
+	expiry time.Duration
+
+	locksMux sync.Mutex
+	locks    map[string]bool
+}
+
+// NewFileStore creates a new FileStore rooted at dir
+func NewFileStore(dir string, expiry time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	return &FileStore{
+		dir:    dir,
+		expiry: expiry,
+		locks:  make(map[string]bool),
+	}, nil
+}
+
+// Create registers a new upload of the given length
+func (s *FileStore) Create(length int64, metadata map[string]string) (*Upload, error) {
+	now := time.Now().UTC()
+	upload := &Upload{
+		ID:        uuid.New().String(),
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expiry),
+	}
+
+	file, err := os.Create(s.DataPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	if err := s.save(upload); err != nil {
+		os.Remove(s.DataPath(upload.ID))
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// Get loads the state of an upload
+func (s *FileStore) Get(id string) (*Upload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload info: %w", err)
+	}
+
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to parse upload info: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// WriteChunk appends the bytes read from reader to the upload starting at offset.
+// The bytes that were received are kept even if the reader fails part way through,
+// so the client can resume from the new offset.
+func (s *FileStore) WriteChunk(id string, offset int64, reader io.Reader) (*Upload, error) {
+	if err := s.lock(id); err != nil {
+		return nil, err
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.DataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer file.Close()
+
+	// Never accept more than the declared length
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(file, io.LimitReader(reader, remaining+1))
+	if written > remaining {
+		if err := file.Truncate(upload.Length); err != nil {
+			return nil, fmt.Errorf("failed to truncate upload file: %w", err)
+		}
+		written = remaining
+		copyErr = ErrSizeExceeded
+	}
+
+	upload.Offset += written
+	if err := s.save(upload); err != nil {
+		return nil, err
+	}
+
+	if copyErr != nil {
+		return upload, copyErr
+	}
+	return upload, nil
+}
+
+// MarkFinalized records that the upload was handed over to the upload pipeline
+func (s *FileStore) MarkFinalized(id string) error {
+	upload, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	upload.Finalized = true
+	upload.FinalizedAt = &now
+
+	return s.save(upload)
+}
+
+// Lock prevents concurrent requests from modifying the upload
+func (s *FileStore) Lock(id string) error {
+	return s.lock(id)
+}
+
+// Unlock releases a lock taken with Lock
+func (s *FileStore) Unlock(id string) {
+	s.unlock(id)
+}
+
+// RemoveData deletes the received bytes but keeps the upload state
+func (s *FileStore) RemoveData(id string) error {
+	if err := os.Remove(s.DataPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload data: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the upload and its data
+func (s *FileStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := s.RemoveData(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload info: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired removes uploads whose expiry time has passed and returns how many were removed
+func (s *FileStore) PurgeExpired() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.info"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	purged := 0
+	now := time.Now()
+	for _, match := range matches {
+		id := strings.TrimSuffix(filepath.Base(match), ".info")
+		upload, err := s.Get(id)
+		if err != nil || now.Before(upload.ExpiresAt) {
+			continue
+		}
+		if err := s.lock(id); err != nil {
+			continue
+		}
+		if err := s.Delete(id); err == nil {
+			purged++
+		}
+		s.unlock(id)
+	}
+
+	return purged, nil
+}
+
+// DataPath returns the path of the file holding the received bytes
+func (s *FileStore) DataPath(id string) string {
+	return filepath.Join(s.dir, id+".bin")
+}
+
+func (s *FileStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+// save writes the upload state atomically
+func (s *FileStore) save(upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload info: %w", err)
+	}
+
+	tmpPath := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.infoPath(upload.ID)); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) lock(id string) error {
+	s.locksMux.Lock()
+	defer s.locksMux.Unlock()
+
+	if s.locks[id] {
+		return ErrLocked
+	}
+	s.locks[id] = true
+	return nil
+}
+
+func (s *FileStore) unlock(id string) {
+	s.locksMux.Lock()
+	defer s.locksMux.Unlock()
+
+	delete(s.locks, id)
+}
+
+// ParseMetadata decodes an Upload-Metadata header ("key base64value,key2 base64value2")
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value for metadata key %q", parts[0])
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+	}
+
+	return metadata, nil
+}
+
+// EncodeMetadata encodes metadata back into the Upload-Metadata header format
+func EncodeMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -3,10 +3,14 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"youtube-clone-platform/video-upload-service/internal/metadata"
+
 	"github.com/gabriel-vasile/mimetype"
 )
 
@@ -41,14 +45,27 @@ var SupportedFormats = map[string][]string{
 }
 
 type ValidationError struct {
-	Field   string
-	Message string
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 func (e *ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
 
+// MetadataError is returned when a stored video is rejected because of its metadata
+type MetadataError struct {
+	Errors []*ValidationError
+}
+
+func (e *MetadataError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
 // ValidateTitle checks if the video title is valid
 func ValidateTitle(title string) error {
 	title = strings.TrimSpace(title)
@@ -67,60 +84,90 @@ func ValidateTitle(title string) error {
 	return nil
 }
 
-// ValidateUserID checks if the user ID is valid
-func ValidateUserID(userID string) error {
+// ValidateUserID checks if the user ID is valid.
+// When allowedPrefixes is empty any non-empty ID is accepted.
+func ValidateUserID(userID string, allowedPrefixes []string) error {
 	if userID == "" {
 		return &ValidationError{
 			Field:   "user_id",
 			Message: "user ID is required",
 		}
 	}
-	if !strings.HasPrefix(userID, "test_user_") && !strings.HasPrefix(userID, "google_") {
-		return &ValidationError{
-			Field:   "user_id",
-			Message: "user ID must start with 'test_user_' or 'google_'",
+	if len(allowedPrefixes) == 0 {
+		return nil
+	}
+	for _, prefix := range allowedPrefixes {
+		if strings.HasPrefix(userID, prefix) {
+			return nil
 		}
 	}
-	return nil
+	quoted := make([]string, 0, len(allowedPrefixes))
+	for _, prefix := range allowedPrefixes {
+		quoted = append(quoted, "'"+prefix+"'")
+	}
+	return &ValidationError{
+		Field:   "user_id",
+		Message: fmt.Sprintf("user ID must start with %s", strings.Join(quoted, " or ")),
+	}
 }
 
 // ValidateVideoFile checks if the uploaded file is a valid video file
 func ValidateVideoFile(header *multipart.FileHeader) error {
 	// Check file size
-	if header.Size > MaxFileSize {
+	if err := ValidateFileSize(header.Size); err != nil {
+		return err
+	}
+
+	// Use mimetype library to validate file type based on content
+	file, err := header.Open()
+	if err != nil {
 		return &ValidationError{
 			Field:   "file",
-			Message: fmt.Sprintf("file size must be at most %d MB", MaxFileSize/1024/1024),
+			Message: "failed to open file",
 		}
 	}
-	if header.Size < MinFileSize {
+	defer file.Close()
+
+	if err := ValidateVideoContent(file); err != nil {
+		return err
+	}
+
+	// Check file extension and content type
+	return ValidateVideoExtension(header.Filename, header.Header.Get("Content-Type"))
+}
+
+// ValidateFileSize checks if the declared file size is within the allowed range
+func ValidateFileSize(size int64) error {
+	if size > MaxFileSize {
 		return &ValidationError{
 			Field:   "file",
-			Message: fmt.Sprintf("file size must be at least %d KB", MinFileSize/1024),
+			Message: fmt.Sprintf("file size must be at most %d MB", MaxFileSize/1024/1024),
 		}
 	}
-
-	// Use mimetype library to validate file type based on content
-	file, err := header.Open()
-	if err != nil {
+	if size < MinFileSize {
 		return &ValidationError{
 			Field:   "file",
-			Message: "failed to open file",
+			Message: fmt.Sprintf("file size must be at least %d KB", MinFileSize/1024),
 		}
 	}
-	defer file.Close()
+	return nil
+}
 
-	mime, err := mimetype.DetectReader(file)
+// ValidateVideoContent sniffs the file content to make sure it is a video
+func ValidateVideoContent(reader io.Reader) error {
+	mime, err := mimetype.DetectReader(reader)
 	if err != nil || !strings.HasPrefix(mime.String(), "video/") {
 		return &ValidationError{
 			Field:   "file",
 			Message: "invalid file type",
 		}
 	}
+	return nil
+}
 
-	// Check file extension and content type
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	contentType := header.Header.Get("Content-Type")
+// ValidateVideoExtension checks the file extension and that the declared content type matches it
+func ValidateVideoExtension(filename string, contentType string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
 
 	validExtensions := map[string]string{
 		".mp4":  "video/mp4",
@@ -143,60 +190,152 @@ func ValidateVideoFile(header *multipart.FileHeader) error {
 	return nil
 }
 
-// ValidateVideoMetadata checks if the video metadata is valid
-func ValidateVideoMetadata(duration float64, width, height int, codec string) error {
+// Limits describes what an uploaded video may look like
+type Limits struct {
+	MaxDuration       float64  `json:"max_duration_seconds"`
+	MinDuration       float64  `json:"min_duration_seconds"`
+	MaxResolution     int      `json:"max_resolution"` // shorter side in pixels, 1080 for 1080p
+	MinResolution     int      `json:"min_resolution"`
+	MaxFileSize       int64    `json:"max_file_size"`
+	AllowedCodecs     []string `json:"allowed_codecs"`
+	AllowedContainers []string `json:"allowed_containers"`
+}
+
+// DefaultLimits returns the limits used when no upload policy is configured
+func DefaultLimits() Limits {
+	codecs := make([]string, 0, len(SupportedFormats))
+	for codec := range SupportedFormats {
+		codecs = append(codecs, codec)
+	}
+	sort.Strings(codecs)
+
+	return Limits{
+		MaxDuration:       MaxVideoDuration,
+		MinDuration:       MinVideoDuration,
+		MaxResolution:     MaxVideoResolution,
+		MinResolution:     MinVideoResolution,
+		MaxFileSize:       MaxFileSize,
+		AllowedCodecs:     codecs,
+		AllowedContainers: []string{"mp4", "mov", "webm"},
+	}
+}
+
+// ValidateVideoMetadata checks the extracted video metadata against the given limits
+// and returns a *MetadataError listing every violation
+func ValidateVideoMetadata(meta *metadata.VideoMetadata, limits Limits) error {
+	var errs []*ValidationError
+
 	// Check duration
-	if duration > MaxVideoDuration {
-		return &ValidationError{
+	if limits.MaxDuration > 0 && meta.Duration > limits.MaxDuration {
+		errs = append(errs, &ValidationError{
 			Field:   "duration",
-			Message: fmt.Sprintf("video duration must be at most %d seconds", MaxVideoDuration),
-		}
+			Message: fmt.Sprintf("video duration must be at most %g seconds", limits.MaxDuration),
+		})
 	}
-	if duration < MinVideoDuration {
-		return &ValidationError{
+	if meta.Duration < limits.MinDuration {
+		errs = append(errs, &ValidationError{
 			Field:   "duration",
-			Message: fmt.Sprintf("video duration must be at least %d second", MinVideoDuration),
-		}
+			Message: fmt.Sprintf("video duration must be at least %g seconds", limits.MinDuration),
+		})
 	}
 
 	// Check resolution
-	maxDimension := max(width, height)
-	if maxDimension > MaxVideoResolution {
-		return &ValidationError{
+	if meta.Width <= 0 || meta.Height <= 0 {
+		errs = append(errs, &ValidationError{
 			Field:   "resolution",
-			Message: fmt.Sprintf("video resolution must be at most %dp", MaxVideoResolution),
+			Message: "invalid video dimensions",
+		})
+	} else {
+		resolution := min(meta.Width, meta.Height)
+		if limits.MaxResolution > 0 && resolution > limits.MaxResolution {
+			errs = append(errs, &ValidationError{
+				Field:   "resolution",
+				Message: fmt.Sprintf("video resolution must be at most %dp", limits.MaxResolution),
+			})
 		}
-	}
-	if maxDimension < MinVideoResolution {
-		return &ValidationError{
-			Field:   "resolution",
-			Message: fmt.Sprintf("video resolution must be at least %dp", MinVideoResolution),
+		if resolution < limits.MinResolution {
+			errs = append(errs, &ValidationError{
+				Field:   "resolution",
+				Message: fmt.Sprintf("video resolution must be at least %dp", limits.MinResolution),
+			})
 		}
 	}
 
-	// Check aspect ratio
-	if width <= 0 || height <= 0 {
-		return &ValidationError{
-			Field:   "resolution",
-			Message: "invalid video dimensions",
-		}
+	// Check file size
+	if err := ValidateFileSizeLimit(meta.FileSize, limits); err != nil {
+		found, _ := ValidationErrors(err)
+		errs = append(errs, found...)
 	}
 
 	// Check codec support
-	if _, ok := SupportedFormats[codec]; !ok {
-		supportedCodecs := make([]string, 0, len(SupportedFormats))
-		for codec := range SupportedFormats {
-			supportedCodecs = append(supportedCodecs, codec)
-		}
-		return &ValidationError{
+	if len(limits.AllowedCodecs) > 0 && !containsFold(limits.AllowedCodecs, meta.Codec) {
+		errs = append(errs, &ValidationError{
 			Field:   "codec",
-			Message: fmt.Sprintf("unsupported video codec. Supported codecs: %s", strings.Join(supportedCodecs, ", ")),
-		}
+			Message: fmt.Sprintf("unsupported video codec %q. Supported codecs: %s", meta.Codec, strings.Join(limits.AllowedCodecs, ", ")),
+		})
+	}
+
+	// Check container, ffprobe reports formats like "mov,mp4,m4a,3gp,3g2,mj2"
+	if err := ValidateContainer(meta.Format, limits); err != nil {
+		found, _ := ValidationErrors(err)
+		errs = append(errs, found...)
 	}
 
+	if len(errs) > 0 {
+		return &MetadataError{Errors: errs}
+	}
 	return nil
 }
 
+// ValidateFileSizeLimit checks the file size against the configured maximum
+func ValidateFileSizeLimit(size int64, limits Limits) error {
+	if limits.MaxFileSize > 0 && size > limits.MaxFileSize {
+		return &ValidationError{
+			Field:   "file",
+			Message: fmt.Sprintf("file size must be at most %d MB", limits.MaxFileSize/1024/1024),
+		}
+	}
+	return nil
+}
+
+// ValidateContainer checks a container format name (or comma separated list of names) is allowed
+func ValidateContainer(format string, limits Limits) error {
+	if len(limits.AllowedContainers) == 0 {
+		return nil
+	}
+	for _, name := range strings.Split(format, ",") {
+		if containsFold(limits.AllowedContainers, strings.TrimSpace(name)) {
+			return nil
+		}
+	}
+	return &ValidationError{
+		Field:   "container",
+		Message: fmt.Sprintf("unsupported container %q. Supported containers: %s", format, strings.Join(limits.AllowedContainers, ", ")),
+	}
+}
+
+// ValidationErrors returns the individual validation errors contained in err, if any
+func ValidationErrors(err error) ([]*ValidationError, bool) {
+	var metadataErr *MetadataError
+	if errors.As(err, &metadataErr) {
+		return metadataErr.Errors, true
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return []*ValidationError{validationErr}, true
+	}
+	return nil, false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 func getKeys(m map[string]string) []string {
 	keys := make([]string, 0, len(m))
 	for k := range m {
@@ -205,8 +344,8 @@ func getKeys(m map[string]string) []string {
 	return keys
 }
 
-func max(a, b int) int {
-	if a > b {
+func min(a, b int) int {
+	if a < b {
 		return a
 	}
 	return b